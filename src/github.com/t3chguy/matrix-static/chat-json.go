@@ -0,0 +1,206 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/t3chguy/matrix-static/mxclient"
+	"github.com/t3chguy/matrix-static/sanitizer"
+	"github.com/t3chguy/matrix-static/utils"
+	"html"
+	"net/http"
+	"strings"
+)
+
+type roomJSON struct {
+	RoomID         string `json:"room_id"`
+	Name           string `json:"name"`
+	CanonicalAlias string `json:"canonical_alias,omitempty"`
+	Topic          string `json:"topic,omitempty"`
+	AvatarURL      string `json:"avatar_url,omitempty"`
+	NumMembers     int    `json:"num_joined_members"`
+}
+
+type relationJSON struct {
+	RelType string `json:"rel_type,omitempty"`
+	EventID string `json:"event_id"`
+}
+
+type eventJSON struct {
+	EventID         string  `json:"event_id"`
+	Type            string  `json:"type"`
+	StateKey        *string `json:"state_key,omitempty"`
+	Sender          string  `json:"sender"`
+	SenderName      string  `json:"sender_name"`
+	SenderAvatarURL string  `json:"sender_avatar_url,omitempty"`
+	Timestamp       int     `json:"origin_server_ts"`
+
+	MsgType string `json:"msgtype,omitempty"`
+	Body    string `json:"body,omitempty"`
+	// HTML is the sanitized HTML of the message, the escaped body if it has no formatted body.
+	HTML string `json:"html,omitempty"`
+
+	RelatesTo  *relationJSON `json:"relates_to,omitempty"`
+	InReplyTo  string        `json:"in_reply_to,omitempty"`
+	ThreadRoot string        `json:"thread_root,omitempty"`
+	EditedBy   string        `json:"edited_by,omitempty"`
+}
+
+// cursorJSON is the anchor & offset to request an adjacent page of the timeline with.
+type cursorJSON struct {
+	Anchor string `json:"anchor"`
+	Offset int    `json:"offset"`
+}
+
+// roomChatJSON is the document served at chat.json, the same page of the timeline as the HTML room page but with
+// the events resolved for other clients to render as they see fit.
+type roomChatJSON struct {
+	Room roomJSON `json:"room"`
+	// Events are ordered oldest first, as they appear on the room page.
+	Events []eventJSON `json:"events"`
+
+	// Older & Newer are omitted once the page rests at the respective end of the timeline.
+	Older *cursorJSON `json:"older,omitempty"`
+	Newer *cursorJSON `json:"newer,omitempty"`
+
+	// HistoryTruncated is set if the events are short of the history leading up to them, it was too far back to reach.
+	HistoryTruncated bool `json:"history_truncated,omitempty"`
+}
+
+// newRoomChatJSON resolves the page of events a RoomEventsJob returned for anchor, offset & pageSize.
+func newRoomChatJSON(resp RoomEventsResp, anchor string, offset, pageSize int, sanitizerFn *sanitizer.Sanitizer) roomChatJSON {
+	doc := roomChatJSON{
+		HistoryTruncated: resp.HistoryTruncated,
+		Room: roomJSON{
+			RoomID:         resp.RoomInfo.RoomID,
+			Name:           resp.RoomInfo.Name,
+			CanonicalAlias: resp.RoomInfo.CanonicalAlias,
+			Topic:          resp.RoomInfo.Topic,
+			AvatarURL:      resp.RoomInfo.AvatarURL.MXC(),
+			NumMembers:     resp.RoomInfo.NumMembers,
+		},
+		Events: make([]eventJSON, 0, len(resp.Events)),
+	}
+
+	for _, ev := range mxclient.ReverseEventsCopy(resp.Events) {
+		doc.Events = append(doc.Events, newEventJSON(&ev, resp, sanitizerFn))
+	}
+
+	if !resp.AtTopEnd {
+		doc.Older = &cursorJSON{anchor, offset + pageSize}
+	}
+	if !resp.AtBottomEnd {
+		doc.Newer = &cursorJSON{anchor, offset - len(resp.Events)}
+	}
+	return doc
+}
+
+func newEventJSON(ev *mxclient.Event, resp RoomEventsResp, sanitizerFn *sanitizer.Sanitizer) eventJSON {
+	evJSON := eventJSON{
+		EventID:    ev.ID,
+		Type:       ev.Type,
+		StateKey:   ev.StateKey,
+		Sender:     ev.Sender,
+		SenderName: ev.Sender,
+		Timestamp:  ev.Timestamp,
+		InReplyTo:  mxclient.GetInReplyTo(ev),
+		ThreadRoot: mxclient.GetThreadRoot(ev),
+	}
+
+	if member, ok := resp.MemberMap[ev.Sender]; ok {
+		evJSON.SenderName = member.GetName()
+		evJSON.SenderAvatarURL = member.AvatarURL.MXC()
+	}
+	if relType, eventID, ok := mxclient.GetRelatesTo(ev); ok {
+		evJSON.RelatesTo = &relationJSON{relType, eventID}
+	}
+	if edit, ok := resp.Edits[ev.ID]; ok {
+		evJSON.EditedBy = edit.EventID
+	}
+
+	if ev.Type == "m.room.message" {
+		evJSON.MsgType, _ = ev.Content["msgtype"].(string)
+		body, _ := ev.Content["body"].(string)
+		evJSON.Body = mxclient.StripReplyFallback(body)
+		evJSON.HTML = messageHTML(ev, evJSON.Body, sanitizerFn)
+	}
+	return evJSON
+}
+
+// messageHTML returns the sanitized formatted body of the message, falling back to its escaped plaintext body.
+func messageHTML(ev *mxclient.Event, body string, sanitizerFn *sanitizer.Sanitizer) string {
+	if ev.Content["format"] == "org.matrix.custom.html" {
+		if formattedBody, ok := ev.Content["formatted_body"].(string); ok {
+			if sanitized, ok := sanitizerFn.Sanitize(mxclient.StripReplyFallbackHTML(formattedBody)); ok {
+				return sanitized
+			}
+		}
+	}
+	return html.EscapeString(body)
+}
+
+// serveRoomChatJSON serves chat.json for the room held by worker, paginated like the room page with timelineSize events
+// unless asked for more or less.
+func serveRoomChatJSON(c *gin.Context, worker Worker, timelineSize int, sanitizerFn *sanitizer.Sanitizer) {
+	pageSize, _ := parsePageSize(c, timelineSize)
+	offset := utils.StrToIntDefault(c.DefaultQuery("offset", "0"), 0)
+	eventID := c.DefaultQuery("anchor", "")
+
+	worker.Queue <- Job(RoomEventsJob{
+		c.Param("roomID"),
+		eventID,
+		offset,
+		pageSize,
+		c.Request.Context(),
+	})
+
+	jobResult := (<-worker.Output).(RoomEventsResp)
+	if abortIfCancelled(c) {
+		return
+	}
+	if err := jobResult.err; err != nil {
+		switch {
+		case err == errRoomGone:
+			abortRoomGone(c)
+		case err == mxclient.ErrEventNotFound:
+			abortWithJSONError(c, http.StatusNotFound, "M_NOT_FOUND", "Could not find event "+eventID+".")
+		case mxclient.ClassifySyncError(err) != "other":
+			// the homeserver failed us rather than the anchor being unknown.
+			abortWithJSONError(c, http.StatusBadGateway, "M_UNKNOWN", "Unable to load events from the homeserver.")
+		default:
+			abortWithJSONError(c, http.StatusInternalServerError, "M_UNKNOWN", "Cannot Load Room. Internal Server Error.")
+		}
+		return
+	}
+
+	if eventID == "" && len(jobResult.Events) > 0 {
+		eventID = jobResult.Events[0].ID
+	}
+
+	writeRoomChatJSON(c, "/room/:roomID/chat.json", func() roomChatJSON {
+		return newRoomChatJSON(jobResult, eventID, offset, pageSize, sanitizerFn)
+	})
+}
+
+// isJSONRequest returns whether the request is for one of our JSON documents, which must never be answered with HTML.
+func isJSONRequest(c *gin.Context) bool {
+	return strings.HasSuffix(c.Request.URL.Path, ".json")
+}
+
+// abortWithJSONError responds with an error object in the style of the Matrix client-server API.
+func abortWithJSONError(c *gin.Context, code int, errcode, message string) {
+	c.JSON(code, gin.H{"errcode": errcode, "error": message})
+	c.Abort()
+}
@@ -0,0 +1,174 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/matrix-org/gomatrix"
+	"github.com/t3chguy/matrix-static/mxclient"
+	"github.com/t3chguy/matrix-static/sanitizer"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const chatJSONInitialSync = `{
+	"messages": {"start": "s0", "end": "e0", "chunk": [
+		{"event_id": "$one", "type": "m.room.message", "sender": "@alice:example.org", "origin_server_ts": 1000,
+			"content": {"msgtype": "m.text", "body": "a < b"}},
+		{"event_id": "$two", "type": "m.room.message", "sender": "@alice:example.org", "origin_server_ts": 2000,
+			"content": {"msgtype": "m.text", "body": "bold", "format": "org.matrix.custom.html",
+				"formatted_body": "<b>bold</b><script>alert(1)</script>",
+				"m.relates_to": {"m.in_reply_to": {"event_id": "$one"}}}}
+	]},
+	"state": [
+		{"event_id": "$name", "type": "m.room.name", "state_key": "", "sender": "@alice:example.org",
+			"content": {"name": "Test Room"}},
+		{"event_id": "$alice", "type": "m.room.member", "state_key": "@alice:example.org", "sender": "@alice:example.org",
+			"content": {"membership": "join", "displayname": "Alice", "avatar_url": "mxc://example.org/avatar"}}
+	]
+}`
+
+// wantChatJSON is the chat.json of chatJSONInitialSync, which is all there is of the room, the room avatar falling back
+// to that of its only member. The sanitizer pads what it strips, such as the script, with spaces.
+const wantChatJSON = `{
+	"room": {"room_id": "!allowed:example.org", "name": "Test Room", "avatar_url": "mxc://example.org/avatar",
+		"num_joined_members": 1},
+	"events": [
+		{"event_id": "$one", "type": "m.room.message", "sender": "@alice:example.org", "sender_name": "Alice",
+			"sender_avatar_url": "mxc://example.org/avatar", "origin_server_ts": 1000,
+			"msgtype": "m.text", "body": "a < b", "html": "a &lt; b"},
+		{"event_id": "$two", "type": "m.room.message", "sender": "@alice:example.org", "sender_name": "Alice",
+			"sender_avatar_url": "mxc://example.org/avatar", "origin_server_ts": 2000,
+			"msgtype": "m.text", "body": "bold", "html": " <b>bold</b>   ", "in_reply_to": "$one"}
+	]
+}`
+
+func newChatJSONRouter(t *testing.T) *gin.Engine {
+	client := newTestClient(t,
+		homeserverRoute{suffix: "/rooms/!allowed:example.org/initialSync", status: http.StatusOK, body: chatJSONInitialSync},
+		homeserverRoute{suffix: "/rooms/!allowed:example.org/messages", status: http.StatusOK, body: `{"start":"s0","end":"s0","chunk":[]}`},
+		homeserverRoute{suffix: "/rooms/!forbidden:example.org/initialSync", status: http.StatusForbidden,
+			body: `{"errcode":"M_GUEST_ACCESS_FORBIDDEN","error":"Guest access is forbidden"}`},
+		homeserverRoute{suffix: "/rooms/!broken:example.org/initialSync", status: http.StatusOK, body: `{"messages":`},
+		homeserverRoute{suffix: "/directory/room/#alias:example.org", status: http.StatusOK, body: `{"room_id":"!allowed:example.org"}`},
+	)
+	blocklist := &roomBlocklist{newTestRoomList("!blocked:example.org")}
+	allowlist := &roomAllowlist{newTestRoomList("!allowed:example.org", "!blocked:example.org", "!forbidden:example.org", "!broken:example.org"), client}
+
+	sanitizerFn := sanitizer.InitSanitizer()
+	return newTestRoomRouter(client, blocklist, allowlist, func(roomRouter *gin.RouterGroup) {
+		roomRouter.GET("/chat.json", func(c *gin.Context) {
+			serveRoomChatJSON(c, c.MustGet("RoomWorker").(Worker), RoomTimelineSize, sanitizerFn)
+		})
+	})
+}
+
+func TestServeRoomChatJSON(t *testing.T) {
+	router := newChatJSONRouter(t)
+
+	tests := []struct {
+		name         string
+		path         string
+		wantStatus   int
+		wantErrcode  string
+		wantLocation string
+	}{
+		{"room", "/room/!allowed:example.org/chat.json", http.StatusOK, "", ""},
+		{"unknown anchor", "/room/!allowed:example.org/chat.json?anchor=$missing", http.StatusNotFound, "M_NOT_FOUND", ""},
+		{"invalid room ID", "/room/allowed/chat.json", http.StatusBadRequest, "M_INVALID_PARAM", ""},
+		{"blocked room", "/room/!blocked:example.org/chat.json", http.StatusNotFound, "M_NOT_FOUND", ""},
+		{"room outside the allowlist", "/room/!unlisted:example.org/chat.json", http.StatusNotFound, "M_NOT_FOUND", ""},
+		{"room we may not peek into", "/room/!forbidden:example.org/chat.json", http.StatusNotFound, "M_NOT_FOUND", ""},
+		{"room which fails to load", "/room/!broken:example.org/chat.json", http.StatusInternalServerError, "M_UNKNOWN", ""},
+		{"unknown alias", "/room/%23missing:example.org/chat.json", http.StatusNotFound, "M_NOT_FOUND", ""},
+		{"alias", "/room/%23alias:example.org/chat.json?limit=20", http.StatusFound, "", "/room/%21allowed:example.org/chat.json?limit=20"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+
+			if w.Code != test.wantStatus {
+				t.Fatalf("got status %d, want %d: %s", w.Code, test.wantStatus, w.Body.String())
+			}
+			if test.wantLocation != "" {
+				if location := w.Header().Get("Location"); location != test.wantLocation {
+					t.Errorf("redirected to %q, want %q", location, test.wantLocation)
+				}
+				return
+			}
+			if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "application/json") {
+				t.Errorf("got Content-Type %q, want application/json", contentType)
+			}
+
+			var body map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body is not JSON: %v", err)
+			}
+			if test.wantErrcode != "" {
+				if body["errcode"] != test.wantErrcode || body["error"] == "" {
+					t.Errorf("got error %v, want errcode %s", body, test.wantErrcode)
+				}
+				return
+			}
+
+			var want map[string]interface{}
+			if err := json.Unmarshal([]byte(wantChatJSON), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(body, want) {
+				t.Errorf("got %s\nwant %s", w.Body.String(), wantChatJSON)
+			}
+		})
+	}
+}
+
+func TestNewRoomChatJSONCursors(t *testing.T) {
+	events := []mxclient.Event{{Event: gomatrix.Event{ID: "$two"}}, {Event: gomatrix.Event{ID: "$one"}}}
+
+	tests := []struct {
+		name        string
+		atTopEnd    bool
+		atBottomEnd bool
+		offset      int
+		wantOlder   *cursorJSON
+		wantNewer   *cursorJSON
+	}{
+		{"whole timeline", true, true, 0, nil, nil},
+		{"latest page", false, true, 0, &cursorJSON{"$two", 30}, nil},
+		{"oldest page", true, false, 30, nil, &cursorJSON{"$two", 28}},
+		{"page in between", false, false, 30, &cursorJSON{"$two", 60}, &cursorJSON{"$two", 28}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := RoomEventsResp{Events: events, AtTopEnd: test.atTopEnd, AtBottomEnd: test.atBottomEnd}
+			doc := newRoomChatJSON(resp, "$two", test.offset, 30, sanitizer.InitSanitizer())
+
+			if !reflect.DeepEqual(doc.Older, test.wantOlder) {
+				t.Errorf("got older %+v, want %+v", doc.Older, test.wantOlder)
+			}
+			if !reflect.DeepEqual(doc.Newer, test.wantNewer) {
+				t.Errorf("got newer %+v, want %+v", doc.Newer, test.wantNewer)
+			}
+			if len(doc.Events) != 2 || doc.Events[0].EventID != "$one" {
+				t.Errorf("got events %+v, want $one then $two", doc.Events)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// DefaultTrustedProxies are the peers trusted to pass on client IPs unless told otherwise, a proxy on the same host.
+const DefaultTrustedProxies = "127.0.0.1/8,::1/128"
+
+// trustedProxies resolves the IP of the client behind our reverse proxies, believing the header they pass it in only
+// when it comes from one of them, as anyone else could put whatever they like in it.
+type trustedProxies struct {
+	// header is X-Forwarded-For or X-Real-IP, empty to always use the remote address.
+	header string
+	nets   []*net.IPNet
+}
+
+// newTrustedProxies parses the comma separated CIDRs or bare IPs of the proxies to trust to set header.
+func newTrustedProxies(header, cidrs string) (*trustedProxies, error) {
+	header = http.CanonicalHeaderKey(header)
+	switch header {
+	case "", "X-Forwarded-For", "X-Real-Ip":
+	default:
+		return nil, fmt.Errorf("unsupported header %q, must be X-Forwarded-For or X-Real-IP", header)
+	}
+
+	proxies := &trustedProxies{header: header}
+	for _, cidr := range strings.Split(cidrs, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		proxies.nets = append(proxies.nets, ipNet)
+	}
+	return proxies, nil
+}
+
+func (p *trustedProxies) trusts(ip net.IP) bool {
+	for _, ipNet := range p.nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the IP to attribute the request to. Proxies append the address they saw to X-Forwarded-For, so
+// it is walked from the end past our trusted proxies, the first address not one of them is the client, anything
+// before that is up to the client.
+func (p *trustedProxies) clientIP(r *http.Request) string {
+	peer, _, err := net.SplitHostPort(strings.TrimSpace(r.RemoteAddr))
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+	peerIP := net.ParseIP(peer)
+	if p.header == "" || peerIP == nil || !p.trusts(peerIP) {
+		return peer
+	}
+
+	values := r.Header[p.header]
+	if len(values) == 0 {
+		return peer
+	}
+	if p.header == "X-Real-Ip" {
+		if ip := net.ParseIP(strings.TrimSpace(values[len(values)-1])); ip != nil {
+			return ip.String()
+		}
+		return peer
+	}
+
+	hops := strings.Split(strings.Join(values, ","), ",")
+	clientIP := peerIP
+	for i := len(hops) - 1; i >= 0 && p.trusts(clientIP); i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		clientIP = ip
+	}
+	return clientIP.String()
+}
+
+// Middleware resolves the client IP of each request once, for the rate limiter & logs to attribute it to.
+func (p *trustedProxies) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("ClientIP", p.clientIP(c.Request))
+		c.Next()
+	}
+}
+
+// clientIP returns the client IP resolved by trustedProxies.Middleware, the remote address had it not run.
+func clientIP(c *gin.Context) string {
+	if ip, ok := c.Get("ClientIP"); ok {
+		return ip.(string)
+	}
+	host, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	if err != nil {
+		return c.Request.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,81 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustedProxiesClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		cidrs      string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{"no header configured ignores X-Forwarded-For", "", DefaultTrustedProxies, "127.0.0.1:1234",
+			map[string]string{"X-Forwarded-For": "203.0.113.7"}, "127.0.0.1"},
+		{"no trusted proxy ignores X-Forwarded-For", "X-Forwarded-For", "", "127.0.0.1:1234",
+			map[string]string{"X-Forwarded-For": "203.0.113.7"}, "127.0.0.1"},
+		{"trusted peer without the header", "X-Forwarded-For", "10.0.0.0/8", "10.0.0.1:1234", nil, "10.0.0.1"},
+		{"trusted peer single hop", "X-Forwarded-For", "10.0.0.0/8", "10.0.0.1:1234",
+			map[string]string{"X-Forwarded-For": "203.0.113.7"}, "203.0.113.7"},
+		{"trusted peer multi hop resolves the rightmost untrusted hop", "X-Forwarded-For", "10.0.0.0/8", "10.0.0.1:1234",
+			map[string]string{"X-Forwarded-For": "198.51.100.1, 203.0.113.7, 10.0.0.2"}, "203.0.113.7"},
+		{"trusted peer with every hop trusted resolves the first", "X-Forwarded-For", "10.0.0.0/8", "10.0.0.1:1234",
+			map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"trusted peer with a garbage hop stops at it", "X-Forwarded-For", "10.0.0.0/8", "10.0.0.1:1234",
+			map[string]string{"X-Forwarded-For": "203.0.113.7, garbage, 10.0.0.2"}, "10.0.0.2"},
+		{"untrusted peer spoofing X-Forwarded-For", "X-Forwarded-For", "10.0.0.0/8", "192.0.2.9:1234",
+			map[string]string{"X-Forwarded-For": "10.0.0.2, 203.0.113.7"}, "192.0.2.9"},
+		{"trusted peer X-Real-IP", "X-Real-IP", "10.0.0.1", "10.0.0.1:1234",
+			map[string]string{"X-Real-IP": "203.0.113.7"}, "203.0.113.7"},
+		{"untrusted peer spoofing X-Real-IP", "X-Real-IP", "10.0.0.1", "192.0.2.9:1234",
+			map[string]string{"X-Real-IP": "203.0.113.7"}, "192.0.2.9"},
+		{"trusted IPv6 peer", "X-Forwarded-For", DefaultTrustedProxies, "[::1]:1234",
+			map[string]string{"X-Forwarded-For": "2001:db8::1"}, "2001:db8::1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proxies, err := newTrustedProxies(test.header, test.cidrs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = test.remoteAddr
+			for name, value := range test.headers {
+				req.Header.Set(name, value)
+			}
+			if got := proxies.clientIP(req); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewTrustedProxiesInvalid(t *testing.T) {
+	for _, test := range []struct{ header, cidrs string }{
+		{"Forwarded", DefaultTrustedProxies},
+		{"X-Forwarded-For", "10.0.0.0/33"},
+		{"X-Forwarded-For", "not an address"},
+	} {
+		if _, err := newTrustedProxies(test.header, test.cidrs); err == nil {
+			t.Errorf("header %q with proxies %q was accepted", test.header, test.cidrs)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	log "github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CompressionMinSize is the smallest response body worth gzipping, smaller ones barely shrink.
+const CompressionMinSize = 1024
+
+// bufferedResponseWriter holds back the response so that we can decide whether to compress it once complete.
+// Its status is that written to it if any, otherwise that of the writer it wraps, as c.Status sets the status of the
+// writer gin started with rather than c.Writer.
+type bufferedResponseWriter struct {
+	gin.ResponseWriter
+	status int
+	buf    bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) WriteHeader(code int) {
+	if code > 0 {
+		w.status = code
+	}
+}
+
+func (w *bufferedResponseWriter) WriteHeaderNow() {}
+
+func (w *bufferedResponseWriter) Write(data []byte) (int, error) {
+	return w.buf.Write(data)
+}
+
+func (w *bufferedResponseWriter) WriteString(s string) (int, error) {
+	return w.buf.WriteString(s)
+}
+
+func (w *bufferedResponseWriter) Status() int {
+	if w.status == 0 {
+		return w.ResponseWriter.Status()
+	}
+	return w.status
+}
+
+func (w *bufferedResponseWriter) Size() int { return w.buf.Len() }
+func (w *bufferedResponseWriter) Written() bool {
+	return w.buf.Len() > 0
+}
+
+func isCompressibleType(contentType string) bool {
+	contentType = strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	switch contentType {
+	case "application/xml", "application/atom+xml", "application/json", "application/javascript", "image/svg+xml":
+		return true
+	}
+	return strings.HasPrefix(contentType, "text/")
+}
+
+// acceptsGzip reports whether the client accepts gzip, which it refuses by giving it a q-value of 0.
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		params := strings.Split(encoding, ";")
+		if !strings.EqualFold(strings.TrimSpace(params[0]), "gzip") {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range params[1:] {
+			if key, value, ok := strings.Cut(strings.TrimSpace(param), "="); ok && strings.EqualFold(key, "q") {
+				var err error
+				if quality, err = strconv.ParseFloat(value, 64); err != nil {
+					quality = 0
+				}
+			}
+		}
+		return quality > 0
+	}
+	return false
+}
+
+// compressResponses gzips text responses of at least minSize bytes for clients which accept it.
+// It must come after any middleware measuring the response size so that they see the compressed size.
+func compressResponses(minSize int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !acceptsGzip(c.Request) || isStreamedRequest(c) {
+			c.Next()
+			return
+		}
+
+		original := c.Writer
+		w := &bufferedResponseWriter{ResponseWriter: original}
+		c.Writer = w
+		defer func() { c.Writer = original }()
+
+		c.Next()
+
+		header := original.Header()
+		header.Add("Vary", "Accept-Encoding")
+		body, status := w.buf.Bytes(), w.Status()
+
+		if status != http.StatusOK || len(body) < minSize || header.Get("Content-Encoding") != "" ||
+			!isCompressibleType(header.Get("Content-Type")) {
+			original.WriteHeader(status)
+			original.Write(body)
+			return
+		}
+
+		var compressed bytes.Buffer
+		gz := gzip.NewWriter(&compressed)
+		if _, err := gz.Write(body); err != nil {
+			log.WithError(err).Error("Failed to gzip response")
+		}
+		gz.Close()
+
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		original.WriteHeader(status)
+		original.Write(compressed.Bytes())
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompressResponsesKeepsStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(compressResponses(CompressionMinSize))
+	router.GET("/:status", func(c *gin.Context) {
+		status := http.StatusOK
+		if c.Param("status") == "missing" {
+			status = http.StatusNotFound
+		}
+		// c.String sets the status of the writer gin started with, not of c.Writer.
+		c.String(status, strings.Repeat("x", CompressionMinSize))
+	})
+
+	tests := []struct {
+		path         string
+		wantStatus   int
+		wantEncoding string
+	}{
+		{"/found", http.StatusOK, "gzip"},
+		{"/missing", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, test.path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != test.wantStatus || w.Header().Get("Content-Encoding") != test.wantEncoding {
+			t.Errorf("%s = %d encoded %q, want %d encoded %q", test.path, w.Code, w.Header().Get("Content-Encoding"),
+				test.wantStatus, test.wantEncoding)
+		}
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		want           bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"GZIP", true},
+		{"deflate, gzip", true},
+		{"gzip;q=0.5", true},
+		{"gzip; q=1", true},
+		{"gzip;q=0", false},
+		{"gzip;q=0.0", false},
+		{"gzip;q=0.000", false},
+		{"gzip;q=invalid", false},
+		{"deflate, gzip;q=0", false},
+		{"br, deflate", false},
+		{"x-gzip", false},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", test.acceptEncoding)
+		if got := acceptsGzip(req); got != test.want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", test.acceptEncoding, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// roomETag derives the ETag of a room page from the newest event of the room, the pseudonyms its users are known by
+// and everything about the request which changes what is rendered for it.
+func roomETag(c *gin.Context, latest RoomLatestEventResp) string {
+	hash := sha1.New()
+	pseudonyms := ""
+	if !latest.PseudonymsAssigned.IsZero() {
+		pseudonyms = strconv.FormatInt(latest.PseudonymsAssigned.UnixNano(), 36)
+	}
+	for _, part := range []string{latest.EventID, pseudonyms, c.Request.URL.RequestURI(), c.Request.Header.Get("Accept-Language")} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return `W/"` + hex.EncodeToString(hash.Sum(nil)) + `"`
+}
+
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if candidate = strings.TrimSpace(candidate); candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// conditionalRoomPages sets ETag & Last-Modified on room pages from the newest event of the room, answering with
+// 304 Not Modified without rendering when the client already has the current page.
+// It must follow the middleware loading the RoomWorker.
+func conditionalRoomPages(c *gin.Context) {
+	if c.Request.Method != "GET" && c.Request.Method != "HEAD" {
+		c.Next()
+		return
+	}
+
+	worker := c.MustGet("RoomWorker").(Worker)
+	worker.Queue <- Job(RoomLatestEventJob{c.Param("roomID")})
+	latest := (<-worker.Output).(RoomLatestEventResp)
+	if latest.err == errRoomGone {
+		abortRoomGone(c)
+		return
+	}
+	if latest.EventID == "" {
+		c.Next()
+		return
+	}
+
+	etag := roomETag(c, latest)
+	// A page was last modified when its pseudonyms were reassigned, if that was after its newest event.
+	lastModified := parseTimestamp(latest.Timestamp)
+	if latest.PseudonymsAssigned.After(lastModified) {
+		lastModified = latest.PseudonymsAssigned
+	}
+	lastModified = lastModified.UTC().Truncate(time.Second)
+	header := c.Writer.Header()
+	header.Set("ETag", etag)
+	header.Set("Last-Modified", lastModified.Format(http.TimeFormat))
+	header.Set("Cache-Control", "no-cache")
+
+	// If-None-Match takes precedence over If-Modified-Since as per RFC 7232.
+	if ifNoneMatch := c.Request.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		if etagMatches(ifNoneMatch, etag) {
+			c.AbortWithStatus(http.StatusNotModified)
+			return
+		}
+	} else if ifModifiedSince, err := http.ParseTime(c.Request.Header.Get("If-Modified-Since")); err == nil {
+		if !lastModified.After(ifModifiedSince) {
+			c.AbortWithStatus(http.StatusNotModified)
+			return
+		}
+	}
+
+	c.Next()
+}
+
+func parseTimestamp(unixMillis int) time.Time {
+	return time.Unix(0, int64(unixMillis)*int64(time.Millisecond))
+}
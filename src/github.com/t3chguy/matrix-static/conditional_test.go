@@ -0,0 +1,100 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConditionalRoomPages(t *testing.T) {
+	client := newTestClient(t,
+		homeserverRoute{suffix: "/rooms/!room:example.org/initialSync", status: http.StatusOK,
+			body: `{"messages":{"start":"s0","end":"e0","chunk":[` + contextEventJSON("$latest", 1600000000000) + `]},"state":[]}`},
+		homeserverRoute{suffix: "/rooms/!empty:example.org/initialSync", status: http.StatusOK,
+			body: `{"messages":{"start":"s0","end":"e0","chunk":[]},"state":[]}`},
+	)
+	renders := 0
+	router := newTestRoomRouter(client, nil, nil, func(roomRouter *gin.RouterGroup) {
+		roomRouter.Use(conditionalRoomPages)
+		roomRouter.GET("/", func(c *gin.Context) {
+			renders++
+			c.String(http.StatusOK, "room")
+		})
+	})
+	get := func(path string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	first := get("/room/!room:example.org/", nil)
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || first.Header().Get("Cache-Control") != "no-cache" {
+		t.Fatalf("got %d with ETag %q & Cache-Control %q, want 200 with an ETag & no-cache", first.Code, etag, first.Header().Get("Cache-Control"))
+	}
+	const lastModified = "Sun, 13 Sep 2020 12:26:40 GMT"
+	if got := first.Header().Get("Last-Modified"); got != lastModified {
+		t.Errorf("got Last-Modified %q, want %q", got, lastModified)
+	}
+
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		wantCode int
+	}{
+		{"matching ETag", map[string]string{"If-None-Match": etag}, http.StatusNotModified},
+		{"matching ETag in a list", map[string]string{"If-None-Match": `W/"stale", ` + etag}, http.StatusNotModified},
+		{"any ETag", map[string]string{"If-None-Match": "*"}, http.StatusNotModified},
+		{"stale ETag", map[string]string{"If-None-Match": `W/"stale"`}, http.StatusOK},
+		{"stale ETag but unmodified since", map[string]string{"If-None-Match": `W/"stale"`, "If-Modified-Since": lastModified}, http.StatusOK},
+		{"unmodified since", map[string]string{"If-Modified-Since": lastModified}, http.StatusNotModified},
+		{"modified since", map[string]string{"If-Modified-Since": "Sun, 13 Sep 2020 12:26:39 GMT"}, http.StatusOK},
+		{"malformed date", map[string]string{"If-Modified-Since": "yesterday"}, http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rendersBefore := renders
+			w := get("/room/!room:example.org/", test.headers)
+			if w.Code != test.wantCode {
+				t.Errorf("got %d, want %d", w.Code, test.wantCode)
+			}
+			if rendered := renders > rendersBefore; rendered != (test.wantCode == http.StatusOK) {
+				t.Errorf("rendered = %v answering %d", rendered, w.Code)
+			}
+		})
+	}
+
+	// pages rendered differently for the same newest event are told apart.
+	for _, variant := range []*httptest.ResponseRecorder{
+		get("/room/!room:example.org/?offset=50", nil),
+		get("/room/!room:example.org/", map[string]string{"Accept-Language": "de"}),
+	} {
+		if variant.Header().Get("ETag") == etag {
+			t.Errorf("a variant of the page shares its ETag %s", etag)
+		}
+	}
+
+	// there is nothing to base the validators of an empty room on.
+	if w := get("/room/!empty:example.org/", map[string]string{"If-None-Match": "*"}); w.Code != http.StatusOK || w.Header().Get("ETag") != "" {
+		t.Errorf("got %d with ETag %q for an empty room, want 200 without one", w.Code, w.Header().Get("ETag"))
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/matrix-org/gomatrix"
+	"github.com/t3chguy/matrix-static/mxclient"
+)
+
+// featuredRooms holds the rooms the operator has chosen to feature on the front page, in the order they listed them.
+type featuredRooms struct {
+	*roomList
+}
+
+// newFeaturedRooms loads the featured rooms at path, an empty path features none.
+func newFeaturedRooms(path string, resolver *roomAliasResolver) (*featuredRooms, error) {
+	featured := &featuredRooms{&roomList{name: "Featured Rooms", path: path, resolver: resolver}}
+	return featured, featured.Load()
+}
+
+// Rooms returns those of the featured rooms which are among the worldReadableRooms, as those are the rooms we can show
+// and know the name, topic, avatar & size of.
+func (f *featuredRooms) Rooms(worldReadableRooms *mxclient.WorldReadableRooms) []gomatrix.PublicRoomsChunk {
+	entries := f.Entries()
+	rooms := make([]gomatrix.PublicRoomsChunk, 0, len(entries))
+	for _, entry := range entries {
+		if room, ok := worldReadableRooms.Get(f.RoomID(entry)); ok {
+			rooms = append(rooms, room)
+		}
+	}
+	return rooms
+}
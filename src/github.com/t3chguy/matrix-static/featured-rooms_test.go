@@ -0,0 +1,66 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFeaturedRooms(t *testing.T) {
+	directory := `{"chunk":[
+		{"room_id":"!a:example.org","world_readable":true},
+		{"room_id":"!b:example.org","canonical_alias":"#b:example.org","world_readable":true},
+		{"room_id":"!aliased:example.org","world_readable":true},
+		{"room_id":"!private:example.org","world_readable":false}
+	]}`
+	client := newTestClient(t,
+		homeserverRoute{suffix: "/publicRooms", status: http.StatusOK, body: directory},
+		homeserverRoute{suffix: "/directory/room/#featured:example.org", status: http.StatusOK, body: `{"room_id":"!aliased:example.org"}`},
+	)
+	worldReadableRooms := client.NewWorldReadableRooms()
+	resolver := newRoomAliasResolver(client)
+
+	// without a list no rooms are featured, so the front page is the directory.
+	featured, err := newFeaturedRooms("", resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rooms := featured.Rooms(worldReadableRooms); len(rooms) != 0 {
+		t.Errorf("got %d featured rooms without a list, want none", len(rooms))
+	}
+
+	path := filepath.Join(t.TempDir(), "featured.json")
+	if err := ioutil.WriteFile(path, []byte(`["#featured:example.org", "!missing:example.org", "!private:example.org",
+		"#b:example.org", "!a:example.org"]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	featured, err = newFeaturedRooms(path, resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// in the order listed, leaving out those which are not world readable rooms of the directory.
+	var got []string
+	for _, room := range featured.Rooms(worldReadableRooms) {
+		got = append(got, room.RoomID)
+	}
+	if want := "!aliased:example.org !b:example.org !a:example.org"; strings.Join(got, " ") != want {
+		t.Errorf("got %v, want %s", got, want)
+	}
+}
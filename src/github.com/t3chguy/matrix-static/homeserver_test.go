@@ -0,0 +1,103 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/t3chguy/matrix-static/mxclient"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// homeserverRoute answers the requests whose path ends in suffix with status & body, or by handler if it is set.
+type homeserverRoute struct {
+	suffix  string
+	status  int
+	body    string
+	handler http.HandlerFunc
+}
+
+// newTestClient returns a client of a homeserver answering each request by the first of routes that matches it.
+func newTestClient(t *testing.T, routes ...homeserverRoute) *mxclient.Client {
+	homeserver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, route := range routes {
+			if !strings.HasSuffix(r.URL.Path, route.suffix) {
+				continue
+			}
+			if route.handler != nil {
+				route.handler(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(route.status)
+			w.Write([]byte(route.body))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errcode":"M_UNRECOGNIZED","error":"Unrecognized request"}`))
+	}))
+	t.Cleanup(homeserver.Close)
+
+	client, err := mxclient.NewRawClient(homeserver.URL, homeserver.URL, "@static:example.org", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// newTestRoomRouter returns a router serving the room routes of rooms held by workers of client, each of which is
+// registered by register with the room loaded as it is in main, after middleware.
+func newTestRoomRouter(client *mxclient.Client, blocklist *roomBlocklist, allowlist *roomAllowlist, register func(roomRouter *gin.RouterGroup), middleware ...gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware...)
+	resolver := newRoomAliasResolver(client)
+	if blocklist == nil {
+		blocklist = &roomBlocklist{&roomList{}}
+	}
+	if allowlist == nil {
+		allowlist = &roomAllowlist{&roomList{}, client}
+	}
+
+	roomRouter := router.Group("/room/:roomID/")
+	roomRouter.Use(loadRoomWorker(NewWorkers(1, client, nil), blocklist, allowlist, resolver, "/"))
+	register(roomRouter)
+	return router
+}
+
+// newTestRoomList returns a roomList of the room IDs.
+func newTestRoomList(roomIDs ...string) *roomList {
+	rooms := make(map[string]bool, len(roomIDs))
+	for _, roomID := range roomIDs {
+		rooms[roomID] = true
+	}
+	return &roomList{rooms: rooms, entries: roomIDs}
+}
+
+// newTestWorker returns a worker holding roomID, synced from a homeserver answering its initialSync with initialSync
+// and any other request by the first of routes that matches it.
+func newTestWorker(t *testing.T, roomID, initialSync string, routes ...homeserverRoute) *Worker {
+	t.Helper()
+	routes = append(routes, homeserverRoute{suffix: "/rooms/" + roomID + "/initialSync", status: http.StatusOK, body: initialSync})
+	worker := NewWorker(0, newTestClient(t, routes...), nil)
+	worker.Queue <- RoomInitialSyncJob{roomID, context.Background()}
+	if resp := (<-worker.Output).(*RoomInitialSyncResp); resp.err != nil {
+		t.Fatalf("initial sync failed: %v", resp.err)
+	}
+	return worker
+}
@@ -0,0 +1,56 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package i18n
+
+import (
+	"golang.org/x/text/feature/plural"
+	"golang.org/x/text/language"
+)
+
+func init() {
+	en := language.English
+
+	// the first part of a membership summary names the users, subsequent parts only count them.
+	plurals := []struct{ key, one, other string }{
+		{"%d users joined", "%d user joined", "%d users joined"},
+		{"%d users left", "%d user left", "%d users left"},
+		{"%d users were invited", "%d user was invited", "%d users were invited"},
+		{"%d users rejected their invites", "%d user rejected their invite", "%d users rejected their invites"},
+		{"%d users were kicked", "%d user was kicked", "%d users were kicked"},
+		{"%d users were banned", "%d user was banned", "%d users were banned"},
+		{"%d users were unbanned", "%d user was unbanned", "%d users were unbanned"},
+		{"%d users changed their profiles", "%d user changed their profile", "%d users changed their profiles"},
+		{"%d users changed membership", "%d user changed membership", "%d users changed membership"},
+
+		{"%d were invited", "%d was invited", "%d were invited"},
+		{"%d rejected their invites", "%d rejected their invite", "%d rejected their invites"},
+		{"%d were kicked", "%d was kicked", "%d were kicked"},
+		{"%d were banned", "%d was banned", "%d were banned"},
+		{"%d were unbanned", "%d was unbanned", "%d were unbanned"},
+		{"%d changed their profiles", "%d changed their profile", "%d changed their profiles"},
+
+		{"%d replies in thread", "%d reply in thread", "%d replies in thread"},
+		{"%d others", "%d other", "%d others"},
+		{"%d members", "%d member", "%d members"},
+		{"%d votes", "%d vote", "%d votes"},
+		{"%d votes cast", "%d vote cast", "%d votes cast"},
+		{"(repeated %d more times)", "(repeated %d more time)", "(repeated %d more times)"},
+		// the count of messages in the room header, "%d+ messages" counts at least that many so is always plural.
+		{"%d messages", "%d message", "%d messages"},
+	}
+	for _, p := range plurals {
+		builder.Set(en, p.key, plural.Selectf(1, "%d", "one", p.one, "other", p.other))
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package i18n holds the message catalog for UI strings and selects the language to render them in.
+// Messages are keyed by their English text, so English only needs entries for those with plural forms.
+// To add a language, add a catalog_<lang>.go registering its messages in init, mirroring catalog_en.go.
+package i18n
+
+import (
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/message/catalog"
+)
+
+var builder = catalog.NewBuilder(catalog.Fallback(language.English))
+
+// Printer formats messages of the catalog in a single language.
+type Printer struct {
+	*message.Printer
+	Tag language.Tag
+}
+
+// NewPrinter instantiates a Printer for tag, which should be one returned by Detect.
+func NewPrinter(tag language.Tag) *Printer {
+	return &Printer{message.NewPrinter(tag, message.Catalog(builder)), tag}
+}
+
+// Default is the Printer used when no language has been selected.
+var Default = NewPrinter(language.English)
+
+// Lang returns the BCP 47 code of the language of the Printer, as used by the html lang attribute.
+func (p *Printer) Lang() string {
+	base, _ := p.Tag.Base()
+	return base.String()
+}
+
+// Join joins parts into a list as the language would, e.g. "a, b and c" in English.
+func (p *Printer) Join(parts []string) string {
+	switch len(parts) {
+	case 0:
+		return ""
+	case 1:
+		return parts[0]
+	}
+
+	list := parts[0]
+	for _, part := range parts[1 : len(parts)-1] {
+		list = p.Sprintf("%s, %s", list, part)
+	}
+	return p.Sprintf("%s and %s", list, parts[len(parts)-1])
+}
+
+// Detect returns the language to render in, override (e.g. from ?lang=) takes precedence over acceptLanguage (the
+// Accept-Language header). Falls back to English when neither names a language we have a catalog for.
+func Detect(acceptLanguage, override string) language.Tag {
+	matcher := language.NewMatcher(builder.Languages())
+
+	if override != "" {
+		if tag, err := language.Parse(override); err == nil {
+			if _, _, confidence := matcher.Match(tag); confidence != language.No {
+				return matchedBase(matcher, tag)
+			}
+		}
+	}
+
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return language.English
+	}
+	if _, _, confidence := matcher.Match(tags...); confidence == language.No {
+		return language.English
+	}
+	return matchedBase(matcher, tags...)
+}
+
+// matchedBase returns the catalog language matched for tags, without the -u-rg extensions Match may add.
+func matchedBase(matcher language.Matcher, tags ...language.Tag) language.Tag {
+	_, index, _ := matcher.Match(tags...)
+	return builder.Languages()[index]
+}
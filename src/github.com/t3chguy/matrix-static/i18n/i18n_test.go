@@ -0,0 +1,102 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package i18n
+
+import (
+	"golang.org/x/text/feature/plural"
+	"golang.org/x/text/language"
+	"testing"
+)
+
+func init() {
+	// a second catalog for negotiation to choose between, as English is all we ship.
+	builder.Set(language.German, "%d votes", plural.Selectf(1, "%d", "one", "%d Stimme", "other", "%d Stimmen"))
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		acceptLanguage string
+		override       string
+		want           language.Tag
+	}{
+		{"", "", language.English},
+		{"en-GB,en;q=0.9", "", language.English},
+		{"de-DE,de;q=0.9,en;q=0.8", "", language.German},
+		{"fr-FR,de;q=0.5", "", language.German},
+		{"en;q=0.5,de;q=0.9", "", language.German},
+		{"fr-FR,ja;q=0.5", "", language.English},
+		{"*", "", language.English},
+		{"not a language header;q=", "", language.English},
+		{"en", "de", language.German},
+		{"de", "en", language.English},
+		{"de", "fr", language.German},
+		{"", "not-a-tag!", language.English},
+	}
+	for _, test := range tests {
+		t.Run(test.acceptLanguage+"/"+test.override, func(t *testing.T) {
+			if got := Detect(test.acceptLanguage, test.override); got != test.want {
+				t.Errorf("Detect(%q, %q) = %v, want %v", test.acceptLanguage, test.override, got, test.want)
+			}
+		})
+	}
+}
+
+func TestPrinterPlurals(t *testing.T) {
+	tests := []struct {
+		tag  language.Tag
+		key  string
+		n    int
+		want string
+	}{
+		{language.English, "%d votes", 0, "0 votes"},
+		{language.English, "%d votes", 1, "1 vote"},
+		{language.English, "%d votes", 2, "2 votes"},
+		{language.English, "%d users joined", 1, "1 user joined"},
+		{language.English, "%d users joined", 3, "3 users joined"},
+		{language.English, "(repeated %d more times)", 1, "(repeated 1 more time)"},
+		{language.German, "%d votes", 1, "1 Stimme"},
+		{language.German, "%d votes", 5, "5 Stimmen"},
+		// messages without plural forms are their keys.
+		{language.English, "Found %d rooms", 1, "Found 1 rooms"},
+	}
+	for _, test := range tests {
+		if got := NewPrinter(test.tag).Sprintf(test.key, test.n); got != test.want {
+			t.Errorf("%v Sprintf(%q, %d) = %q, want %q", test.tag, test.key, test.n, got, test.want)
+		}
+	}
+}
+
+func TestPrinterJoin(t *testing.T) {
+	tests := []struct {
+		parts []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{"a"}, "a"},
+		{[]string{"a", "b"}, "a and b"},
+		{[]string{"a", "b", "c"}, "a, b and c"},
+	}
+	for _, test := range tests {
+		if got := Default.Join(test.parts); got != test.want {
+			t.Errorf("Join(%q) = %q, want %q", test.parts, got, test.want)
+		}
+	}
+}
+
+func TestPrinterLang(t *testing.T) {
+	if got := NewPrinter(Detect("en-GB", "")).Lang(); got != "en" {
+		t.Errorf("Lang() = %q, want en", got)
+	}
+}
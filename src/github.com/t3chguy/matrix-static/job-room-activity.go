@@ -0,0 +1,31 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+type RoomActivityResp struct {
+	// Activity maps roomID to how many messages were sent on each of the last mxclient.ActivityDays days.
+	Activity map[string][]int
+}
+
+type RoomActivityJob struct{}
+
+func (job RoomActivityJob) Work(w *Worker) {
+	activity := make(map[string][]int, len(w.rooms))
+	for roomID, room := range w.rooms {
+		activity[roomID] = room.Activity()
+	}
+
+	w.Output <- RoomActivityResp{activity}
+}
@@ -15,15 +15,13 @@
 package main
 
 import (
-	"github.com/t3chguy/matrix-static/mxclient"
+	"github.com/t3chguy/matrix-static/templates"
 	"github.com/t3chguy/matrix-static/utils"
 )
 
 type RoomAliasesResp struct {
-	RoomInfo    mxclient.RoomInfo
-	RoomAliases mxclient.RoomAliases
-	PageSize    int
-	Page        int
+	templates.RoomAliasesPage
+	err error
 }
 
 type RoomAliasesJob struct {
@@ -33,16 +31,20 @@ type RoomAliasesJob struct {
 }
 
 func (job RoomAliasesJob) Work(w *Worker) {
-	room := w.rooms[job.roomID]
+	room, ok := w.rooms[job.roomID]
+	if !ok {
+		w.Output <- RoomAliasesResp{err: errRoomGone}
+		return
+	}
 	aliases := room.GetState().Aliases
 
 	start, end := utils.CalcPaginationStartEnd(job.page, job.pageSize, len(aliases))
 
-	w.Output <- RoomAliasesResp{
-		room.RoomInfo(),
-		aliases[start:end],
-		job.pageSize,
-		job.page,
-	}
+	w.Output <- RoomAliasesResp{RoomAliasesPage: templates.RoomAliasesPage{
+		RoomInfo:    room.RoomInfo(),
+		RoomAliases: aliases[start:end],
+		PageSize:    job.pageSize,
+		Page:        job.page,
+	}}
 	room.Access()
 }
@@ -0,0 +1,97 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/t3chguy/matrix-static/mxclient"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+const contextRoomID = "!context:example.org"
+
+// contextEventJSON returns an m.room.message event of eventID sent at ts.
+func contextEventJSON(eventID string, ts int) string {
+	return `{"event_id":"` + eventID + `","type":"m.room.message","sender":"@alice:example.org","origin_server_ts":` +
+		strconv.Itoa(ts) + `,"content":{"msgtype":"m.text","body":"hi"}}`
+}
+
+// newContextTestWorker returns a worker holding contextRoomID, of a homeserver answering the context of $known with
+// two events either side of it and that of any other event with M_NOT_FOUND. The limits asked for are sent to limits.
+func newContextTestWorker(t *testing.T, limits chan<- string) *Worker {
+	return newTestWorker(t, contextRoomID, `{"messages":{"start":"s0","end":"e0","chunk":[`+contextEventJSON("$latest", 9000)+`]},"state":[]}`,
+		homeserverRoute{suffix: "/context/$known", handler: func(w http.ResponseWriter, r *http.Request) {
+			limits <- r.URL.Query().Get("limit")
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"event":` + contextEventJSON("$known", 3000) + `,
+				"events_before":[` + contextEventJSON("$before1", 2000) + `,` + contextEventJSON("$before2", 1000) + `],
+				"events_after":[` + contextEventJSON("$after1", 4000) + `,` + contextEventJSON("$after2", 5000) + `]}`))
+		}},
+		homeserverRoute{suffix: "/context/$unknown", status: http.StatusNotFound, body: `{"errcode":"M_NOT_FOUND","error":"Event not found"}`},
+	)
+}
+
+// TestRoomEventContextJobWindow asserts that the context of an event asks the homeserver for the window it is given
+// and returns the events either side of the event newest first, as the timeline is.
+func TestRoomEventContextJobWindow(t *testing.T) {
+	limits := make(chan string, 1)
+	worker := newContextTestWorker(t, limits)
+
+	worker.Queue <- RoomEventContextJob{contextRoomID, "$known", RoomContextSize, context.Background()}
+	resp := (<-worker.Output).(RoomEventsResp)
+	if resp.err != nil {
+		t.Fatalf("got error %v", resp.err)
+	}
+	if got := <-limits; got != strconv.Itoa(RoomContextSize) {
+		t.Errorf("asked the homeserver for a limit of %s, want %d", got, RoomContextSize)
+	}
+
+	var got []string
+	for _, ev := range resp.Events {
+		got = append(got, ev.ID)
+	}
+	want := []string{"$after2", "$after1", "$known", "$before1", "$before2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got events %v, want %v", got, want)
+	}
+}
+
+// TestRoomEventContextJobUnknownEvent asserts that the context of an event the homeserver does not know is a 404 page
+// rather than a failing homeserver.
+func TestRoomEventContextJobUnknownEvent(t *testing.T) {
+	worker := newContextTestWorker(t, make(chan string, 1))
+
+	worker.Queue <- RoomEventContextJob{contextRoomID, "$unknown", RoomContextSize, context.Background()}
+	resp := (<-worker.Output).(RoomEventsResp)
+	if resp.err != mxclient.ErrEventNotFound {
+		t.Fatalf("got error %v, want %v", resp.err, mxclient.ErrEventNotFound)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/room/:roomID/$:eventID", func(c *gin.Context) {
+		writeRoomErrorPage(c, resp.err, "Event not found", resp.RoomInfo)
+	})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/room/"+contextRoomID+"/$unknown", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("got %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -15,17 +15,38 @@
 package main
 
 import (
-	"github.com/matrix-org/gomatrix"
+	"context"
 	"github.com/t3chguy/matrix-static/mxclient"
 )
 
 type RoomEventsResp struct {
-	Events      []gomatrix.Event
+	Events      []mxclient.Event
 	RoomInfo    mxclient.RoomInfo
 	MemberMap   map[string]mxclient.MemberInfo
+	Reactions   map[string]mxclient.ReactionGroups
+	Polls       map[string]mxclient.PollResults
+	Edits       map[string]mxclient.Edit
+	ReplyTo     map[string]mxclient.Event
+	Threads     map[string]mxclient.ThreadSummary
+	Receipts    map[string]mxclient.ReadReceipts
 	AtTopEnd    bool
 	AtBottomEnd bool
-	err         error
+	// HistoryTruncated is set if the page is short of the history leading up to it, as that was too far back to reach.
+	HistoryTruncated bool
+	err              error
+}
+
+// pseudonymize replaces every user in resp with their pseudonym, unless p is nil as they are not to be anonymized.
+func (resp *RoomEventsResp) pseudonymize(p *mxclient.Pseudonyms) {
+	if p == nil {
+		return
+	}
+	resp.Events = p.Events(resp.Events)
+	resp.MemberMap = p.MemberMap(resp.MemberMap)
+	resp.Reactions = p.Reactions(resp.Reactions)
+	resp.ReplyTo = p.EventMap(resp.ReplyTo)
+	resp.Threads = p.Threads(resp.Threads)
+	resp.Receipts = p.Receipts(resp.Receipts)
 }
 
 type RoomEventsJob struct {
@@ -33,24 +54,40 @@ type RoomEventsJob struct {
 	anchor   string
 	offset   int
 	pageSize int
+	// ctx is of the request for the page, the homeserver is not kept waiting on for requests which have given up.
+	ctx context.Context
 }
 
 func (job RoomEventsJob) Work(w *Worker) {
-	room := w.rooms[job.roomID]
-	events, atTopEnd, atBottomEnd, err := room.GetEventPage(job.anchor, job.offset, job.pageSize)
+	room, ok := w.rooms[job.roomID]
+	if !ok {
+		w.Output <- RoomEventsResp{err: errRoomGone}
+		return
+	}
+	events, atTopEnd, atBottomEnd, truncated, err := room.GetEventPage(job.ctx, job.anchor, job.offset, job.pageSize)
+	events, edits := room.ApplyEdits(events)
 
 	membersMap := make(map[string]mxclient.MemberInfo)
 	for mxid, member := range room.GetState().MemberMap {
 		membersMap[mxid] = *member
 	}
 
-	w.Output <- RoomEventsResp{
+	resp := RoomEventsResp{
 		events,
 		room.RoomInfo(),
 		membersMap,
+		room.GetReactions(events),
+		room.GetPolls(events),
+		edits,
+		room.GetReplyTargets(events),
+		room.GetThreadSummaries(events),
+		room.GetReadReceipts(events),
 		atTopEnd,
 		atBottomEnd,
+		truncated,
 		err,
 	}
+	resp.pseudonymize(room.Pseudonyms())
+	w.Output <- resp
 	room.Access()
 }
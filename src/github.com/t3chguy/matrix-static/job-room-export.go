@@ -0,0 +1,82 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"github.com/t3chguy/matrix-static/mxclient"
+)
+
+type RoomExportBackpaginateResp struct {
+	AtStart bool
+	err     error
+}
+
+// RoomExportBackpaginateJob back-paginates the room by one batch towards its start ahead of an export, the worker is
+// only held that long.
+type RoomExportBackpaginateJob struct {
+	roomID string
+	// ctx is of the export, the homeserver is not kept waiting on for exports which have been abandoned.
+	ctx context.Context
+}
+
+func (job RoomExportBackpaginateJob) Work(w *Worker) {
+	room, ok := w.rooms[job.roomID]
+	if !ok {
+		w.Output <- RoomExportBackpaginateResp{err: errRoomGone}
+		return
+	}
+
+	atStart, err := room.BackpaginateTowardsStart(job.ctx)
+	w.Output <- RoomExportBackpaginateResp{atStart, err}
+	room.Access()
+}
+
+// RoomExportJob returns the next batch of the room's timeline for an export, the events following afterID or the
+// oldest events we hold of the room if it is empty, responding with a RoomEventsResp much like a RoomEventsJob.
+type RoomExportJob struct {
+	roomID  string
+	afterID string
+	limit   int
+}
+
+func (job RoomExportJob) Work(w *Worker) {
+	// the room may have been discarded or resynced between the batches of a long export.
+	room, ok := w.rooms[job.roomID]
+	if !ok {
+		w.Output <- RoomEventsResp{err: errRoomGone}
+		return
+	}
+
+	events, atBottomEnd, err := room.GetEventsAfter(job.afterID, job.limit)
+	events, edits := room.ApplyEdits(events)
+
+	membersMap := make(map[string]mxclient.MemberInfo)
+	for mxid, member := range room.GetState().MemberMap {
+		membersMap[mxid] = *member
+	}
+
+	resp := RoomEventsResp{
+		Events:      events,
+		RoomInfo:    room.RoomInfo(),
+		MemberMap:   membersMap,
+		Edits:       edits,
+		AtBottomEnd: atBottomEnd,
+		err:         err,
+	}
+	resp.pseudonymize(room.Pseudonyms())
+	w.Output <- resp
+	room.Access()
+}
@@ -15,6 +15,7 @@
 package main
 
 import (
+	"context"
 	log "github.com/Sirupsen/logrus"
 	"sync"
 	"time"
@@ -23,7 +24,9 @@ import (
 // This Job has no Resp.
 
 type RoomForwardPaginateJob struct {
-	wg *sync.WaitGroup
+	// ctx is of the forward paginator, cancelled as we shut down.
+	ctx context.Context
+	wg  *sync.WaitGroup
 }
 
 const LastAccessDiscardDuration = 30 * time.Minute
@@ -34,13 +37,16 @@ func (job RoomForwardPaginateJob) Work(w *Worker) {
 	for id, room := range w.rooms {
 		if room.LastAccess.Before(time.Now().Add(-LastAccessDiscardDuration)) {
 			delete(w.rooms, id)
+			w.invalidate(id)
 		}
 	}
 	numRoomsAfter := len(w.rooms)
 	log.WithField("worker", w.ID).WithField("numRooms", numRoomsAfter).Infof("Removed %d rooms", numRoomsBefore-numRoomsAfter)
 
-	for _, room := range w.rooms {
-		room.ForwardPaginateRoom()
+	for id, room := range w.rooms {
+		if room.ForwardPaginateRoom(job.ctx) {
+			w.invalidate(id)
+		}
 	}
 	job.wg.Done()
 }
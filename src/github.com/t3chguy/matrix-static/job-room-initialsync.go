@@ -14,7 +14,10 @@
 
 package main
 
-import log "github.com/Sirupsen/logrus"
+import (
+	"context"
+	"github.com/t3chguy/matrix-static/mxclient"
+)
 
 type RoomInitialSyncResp struct {
 	err error
@@ -22,15 +25,24 @@ type RoomInitialSyncResp struct {
 
 type RoomInitialSyncJob struct {
 	roomID string
+	// ctx is of the request which required the room, we do not sync rooms for requests which have already been
+	// abandoned. The sync is correlated to it by the request ID it carries.
+	ctx context.Context
 }
 
 func (job RoomInitialSyncJob) Work(w *Worker) {
 	resp := &RoomInitialSyncResp{}
 
 	if _, exists := w.rooms[job.roomID]; !exists {
-		loggerWithFields := log.WithField("worker", w.ID).WithField("roomID", job.roomID)
+		if err := job.ctx.Err(); err != nil {
+			resp.err = err
+			w.Output <- resp
+			return
+		}
+
+		loggerWithFields := mxclient.Logger(job.ctx).WithField("worker", w.ID).WithField("roomID", job.roomID)
 		loggerWithFields.Info("Started Initial Syncing Room")
-		if newRoom, err := w.client.NewRoom(job.roomID); err == nil {
+		if newRoom, err := w.client.NewRoom(job.ctx, job.roomID); err == nil {
 			loggerWithFields.Info("Finished Initial Syncing Room")
 			w.rooms[job.roomID] = newRoom
 		} else {
@@ -0,0 +1,45 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+)
+
+type RoomJumpToDateResp struct {
+	EventID string
+	Found   bool
+	err     error
+}
+
+type RoomJumpToDateJob struct {
+	roomID string
+	// timestamp is in unix millis
+	timestamp int
+	// ctx is of the request for the page, the homeserver is not kept waiting on for requests which have given up.
+	ctx context.Context
+}
+
+func (job RoomJumpToDateJob) Work(w *Worker) {
+	room, ok := w.rooms[job.roomID]
+	if !ok {
+		w.Output <- RoomJumpToDateResp{err: errRoomGone}
+		return
+	}
+	eventID, found := room.FindEventAtTime(job.ctx, job.timestamp)
+
+	w.Output <- RoomJumpToDateResp{eventID, found, nil}
+	room.Access()
+}
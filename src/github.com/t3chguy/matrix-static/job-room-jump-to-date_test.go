@@ -0,0 +1,71 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+const jumpRoomID = "!jump:example.org"
+
+// newJumpTestWorker returns a worker holding jumpRoomID, whose timeline is of events sent every second from 1s to 5s,
+// the last three loaded & the rest loaded by backpaginating once. Any further backpaginations find nothing.
+func newJumpTestWorker(t *testing.T, routes ...homeserverRoute) *Worker {
+	var mutex sync.Mutex
+	numBackpaginations := 0
+	routes = append(routes, homeserverRoute{suffix: "/messages", handler: func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		numBackpaginations++
+		chunk := `[` + contextEventJSON("$2000", 2000) + `,` + contextEventJSON("$1000", 1000) + `]`
+		if numBackpaginations > 1 {
+			chunk = `[]`
+		}
+		mutex.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"start":"s0","end":"s1","chunk":` + chunk + `}`))
+	}})
+	return newTestWorker(t, jumpRoomID, `{"messages":{"start":"s0","end":"e0","chunk":[`+contextEventJSON("$3000", 3000)+`,`+
+		contextEventJSON("$4000", 4000)+`,`+contextEventJSON("$5000", 5000)+`]},"state":[]}`, routes...)
+}
+
+func TestRoomJumpToDateJob(t *testing.T) {
+	tests := []struct {
+		name      string
+		timestamp int
+		routes    []homeserverRoute
+		want      string
+	}{
+		{"resolved by the homeserver", 4500, []homeserverRoute{{suffix: "/timestamp_to_event", status: http.StatusOK,
+			body: `{"event_id":"$3000","origin_server_ts":3000}`}}, "$3000"},
+		{"between loaded events", 4500, nil, "$4000"},
+		{"at a loaded event", 5000, nil, "$5000"},
+		{"after every event", 9000, nil, "$5000"},
+		{"before the events loaded", 2500, nil, "$2000"},
+		{"before every event", 10, nil, "$1000"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			worker := newJumpTestWorker(t, test.routes...)
+			worker.Queue <- RoomJumpToDateJob{jumpRoomID, test.timestamp, context.Background()}
+			resp := (<-worker.Output).(RoomJumpToDateResp)
+			if resp.err != nil || !resp.Found || resp.EventID != test.want {
+				t.Errorf("got %s, found = %v, err = %v, want %s", resp.EventID, resp.Found, resp.err, test.want)
+			}
+		})
+	}
+}
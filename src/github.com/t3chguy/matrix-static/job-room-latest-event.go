@@ -0,0 +1,43 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "time"
+
+type RoomLatestEventResp struct {
+	EventID   string
+	Timestamp int
+	// PseudonymsAssigned is when the pseudonyms of the room were assigned, zero unless its users are anonymized.
+	PseudonymsAssigned time.Time
+	err                error
+}
+
+type RoomLatestEventJob struct {
+	roomID string
+}
+
+func (job RoomLatestEventJob) Work(w *Worker) {
+	room, ok := w.rooms[job.roomID]
+	if !ok {
+		w.Output <- RoomLatestEventResp{err: errRoomGone}
+		return
+	}
+	eventID, timestamp := room.LatestObserved()
+	var pseudonymsAssigned time.Time
+	if pseudonyms := room.Pseudonyms(); pseudonyms != nil {
+		pseudonymsAssigned = pseudonyms.Assigned()
+	}
+	w.Output <- RoomLatestEventResp{eventID, timestamp, pseudonymsAssigned, nil}
+}
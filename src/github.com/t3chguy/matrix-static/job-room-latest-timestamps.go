@@ -0,0 +1,33 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+type RoomLatestTimestampsResp struct {
+	// Timestamps maps roomID to the timestamp of the latest event known in that room.
+	Timestamps map[string]int
+}
+
+type RoomLatestTimestampsJob struct{}
+
+func (job RoomLatestTimestampsJob) Work(w *Worker) {
+	timestamps := make(map[string]int, len(w.rooms))
+	for roomID, room := range w.rooms {
+		if timestamp, ok := room.LatestEventTimestamp(); ok {
+			timestamps[roomID] = timestamp
+		}
+	}
+
+	w.Output <- RoomLatestTimestampsResp{timestamps}
+}
@@ -40,16 +40,29 @@ type RoomMemberInfoJob struct {
 }
 
 func (job RoomMemberInfoJob) Work(w *Worker) {
-	room := w.rooms[job.roomID]
+	room, ok := w.rooms[job.roomID]
+	if !ok {
+		w.Output <- RoomMemberInfoResp{Err: errRoomGone}
+		return
+	}
 
 	var err error
 	var memberInfo mxclient.MemberInfo
 
-	if member := room.GetState().MemberMap[job.mxid]; member == nil {
+	// members are only found by their pseudonyms when anonymized, lest their pages confirm who is in the room.
+	mxid := job.mxid
+	pseudonyms := room.Pseudonyms()
+	if pseudonyms != nil {
+		mxid, _ = pseudonyms.MXID(job.mxid)
+	}
+
+	if member := room.GetState().MemberMap[mxid]; member == nil {
 		err = &RoomMemberNotFoundError{
 			job.roomID,
 			job.mxid,
 		}
+	} else if pseudonyms != nil {
+		memberInfo = pseudonyms.Member(*member)
 	} else {
 		memberInfo = *member
 	}
@@ -16,39 +16,78 @@ package main
 
 import (
 	"github.com/t3chguy/matrix-static/mxclient"
+	"github.com/t3chguy/matrix-static/templates"
 	"github.com/t3chguy/matrix-static/utils"
 )
 
 type RoomMembersResp struct {
-	RoomInfo mxclient.RoomInfo
-	Members  []mxclient.MemberInfo
-	PageSize int
-	Page     int
+	templates.RoomMembersPage
+	err error
 }
 
 type RoomMembersJob struct {
 	roomID   string
-	page     int
+	from     int
 	pageSize int
+	sortBy   string
 }
 
-func (job RoomMembersJob) Work(w *Worker) {
-	room := w.rooms[job.roomID]
-	members := room.GetState().Members()
+func derefMembers(members []*mxclient.MemberInfo) []mxclient.MemberInfo {
+	membersSlice := make([]mxclient.MemberInfo, 0, len(members))
+	for _, member := range members {
+		membersSlice = append(membersSlice, *member)
+	}
+	return membersSlice
+}
 
-	start, end := utils.CalcPaginationStartEnd(job.page, job.pageSize, len(members))
+func (job RoomMembersJob) Work(w *Worker) {
+	room, ok := w.rooms[job.roomID]
+	if !ok {
+		w.Output <- RoomMembersResp{err: errRoomGone}
+		return
+	}
+	members := room.GetState().CurrentMembers()
+	roomLastActive := room.LastActive()
 
-	membersPointerSlice := members[start:end]
-	membersSlice := make([]mxclient.MemberInfo, 0, len(membersPointerSlice))
-	for _, member := range membersPointerSlice {
-		membersSlice = append(membersSlice, *member)
+	// members are pseudonymized before being sorted, lest they be listed in the order of their real names.
+	if pseudonyms := room.Pseudonyms(); pseudonyms != nil {
+		pseudonymous := make([]*mxclient.MemberInfo, len(members))
+		for i, member := range members {
+			member := pseudonyms.Member(*member)
+			pseudonymous[i] = &member
+		}
+		members = pseudonymous
+		roomLastActive = pseudonyms.Timestamps(roomLastActive)
 	}
 
-	w.Output <- RoomMembersResp{
-		room.RoomInfo(),
-		membersSlice,
-		job.pageSize,
-		job.page,
+	groups := mxclient.GroupMembers(members)
+	mxclient.SortMembers(groups.Admins, job.sortBy, roomLastActive)
+	mxclient.SortMembers(groups.Moderators, job.sortBy, roomLastActive)
+	mxclient.SortMembers(groups.Others, job.sortBy, roomLastActive)
+
+	numOthers := len(groups.Others)
+	start := utils.Bound(0, job.from, numOthers)
+	end := utils.Min(start+job.pageSize, numOthers)
+
+	lastActive := make(map[string]int)
+	for _, group := range [][]*mxclient.MemberInfo{groups.Admins, groups.Moderators, groups.Others[start:end]} {
+		for _, member := range group {
+			if timestamp, ok := roomLastActive[member.MXID]; ok {
+				lastActive[member.MXID] = timestamp
+			}
+		}
 	}
+
+	w.Output <- RoomMembersResp{RoomMembersPage: templates.RoomMembersPage{
+		RoomInfo:   room.RoomInfo(),
+		Admins:     derefMembers(groups.Admins),
+		Moderators: derefMembers(groups.Moderators),
+		Others:     derefMembers(groups.Others[start:end]),
+		NumOthers:  numOthers,
+		From:       start,
+		PageSize:   job.pageSize,
+		SortBy:     job.sortBy,
+		LastActive: lastActive,
+	}}
 	room.Access()
 }
@@ -0,0 +1,130 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"github.com/t3chguy/matrix-static/mxclient"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestRoomMembersJobPagination asserts that admins & moderators are always listed while everyone else is paged through
+// by offset, offsets out of range being clamped.
+func TestRoomMembersJobPagination(t *testing.T) {
+	const roomID = "!members:example.org"
+	var state []string
+	for i := 0; i < 5; i++ {
+		mxid := fmt.Sprintf("@user%d:example.org", i)
+		state = append(state, `{"type":"m.room.member","state_key":"`+mxid+`","sender":"`+mxid+`","event_id":"$`+mxid+`",
+			"content":{"membership":"join","displayname":"User `+fmt.Sprint(i)+`"}}`)
+	}
+	state = append(state,
+		`{"type":"m.room.member","state_key":"@admin:example.org","sender":"@admin:example.org","event_id":"$admin","content":{"membership":"join","displayname":"Admin"}}`,
+		`{"type":"m.room.member","state_key":"@mod:example.org","sender":"@admin:example.org","event_id":"$mod","content":{"membership":"invite","displayname":"Mod"}}`,
+		`{"type":"m.room.power_levels","state_key":"","sender":"@admin:example.org","event_id":"$pl","content":{"users":{"@admin:example.org":100,"@mod:example.org":50}}}`,
+	)
+	worker := newTestWorker(t, roomID, `{"messages":{"start":"s0","end":"e0","chunk":[]},"state":[`+strings.Join(state, ",")+`]}`)
+
+	tests := []struct {
+		name     string
+		from     int
+		want     string
+		wantFrom int
+		wantPrev int
+		wantNext bool
+	}{
+		{"first page", 0, "User 0, User 1", 0, 0, true},
+		{"middle page", 2, "User 2, User 3", 2, 0, true},
+		{"last page is short", 4, "User 4", 4, 2, false},
+		{"past the end is clamped", 10, "", 5, 3, false},
+		{"negative is clamped", -3, "User 0, User 1", 0, 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			worker.Queue <- RoomMembersJob{roomID, test.from, 2, ""}
+			resp := (<-worker.Output).(RoomMembersResp)
+			if resp.err != nil {
+				t.Fatal(resp.err)
+			}
+			if len(resp.Admins) != 1 || resp.Admins[0].MXID != "@admin:example.org" ||
+				len(resp.Moderators) != 1 || resp.Moderators[0].MXID != "@mod:example.org" {
+				t.Errorf("got admins %v & moderators %v, want them listed on every page", resp.Admins, resp.Moderators)
+			}
+
+			var others []string
+			for _, member := range resp.Others {
+				others = append(others, member.GetName())
+			}
+			if got := strings.Join(others, ", "); got != test.want || resp.NumOthers != 5 {
+				t.Errorf("got %q of %d, want %q of 5", got, resp.NumOthers, test.want)
+			}
+			if resp.From != test.wantFrom || resp.PrevFrom() != test.wantPrev || resp.HasNextPage() != test.wantNext {
+				t.Errorf("got from %d, previous %d & next %v, want %d, %d & %v",
+					resp.From, resp.PrevFrom(), resp.HasNextPage(), test.wantFrom, test.wantPrev, test.wantNext)
+			}
+		})
+	}
+}
+
+func TestRoomMembersJobSort(t *testing.T) {
+	const roomID = "!sorted:example.org"
+	member := func(mxid, name string, ts int) string {
+		return fmt.Sprintf(`{"type":"m.room.member","state_key":"%s","sender":"%s","event_id":"$%s","origin_server_ts":%d,
+			"content":{"membership":"join","displayname":"%s"}}`, mxid, mxid, mxid, ts, name)
+	}
+	message := func(id, sender string, ts int) string {
+		return fmt.Sprintf(`{"type":"m.room.message","sender":"%s","event_id":"%s","origin_server_ts":%d,
+			"content":{"msgtype":"m.text","body":"hi"}}`, sender, id, ts)
+	}
+	state := []string{member("@a:example.org", "A", 100), member("@b:example.org", "B", 200), member("@c:example.org", "C", 0)}
+	chunk := []string{message("$1", "@b:example.org", 300), message("$2", "@b:example.org", 400), message("$3", "@a:example.org", 500)}
+	worker := newTestWorker(t, roomID, `{"messages":{"start":"s0","end":"e0","chunk":[`+strings.Join(chunk, ",")+`]},
+		"state":[`+strings.Join(state, ",")+`]}`)
+
+	tests := []struct {
+		sortBy      string
+		want        string
+		wantPageUrl string
+	}{
+		{mxclient.MemberSortName, "A, B, C", "./room/!sorted:example.org/members?from=10"},
+		{mxclient.MemberSortJoined, "B, A, C", "./room/!sorted:example.org/members?from=10&sort=joined"},
+		{mxclient.MemberSortActive, "A, B, C", "./room/!sorted:example.org/members?from=10&sort=active"},
+	}
+	for _, test := range tests {
+		t.Run(test.sortBy, func(t *testing.T) {
+			worker.Queue <- RoomMembersJob{roomID, 0, 10, test.sortBy}
+			resp := (<-worker.Output).(RoomMembersResp)
+			if resp.err != nil {
+				t.Fatal(resp.err)
+			}
+			var others []string
+			for _, member := range resp.Others {
+				others = append(others, member.GetName())
+			}
+			if got := strings.Join(others, ", "); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+			wantLastActive := map[string]int{"@a:example.org": 500, "@b:example.org": 400}
+			if !reflect.DeepEqual(resp.LastActive, wantLastActive) {
+				t.Errorf("got last active %v, want %v", resp.LastActive, wantLastActive)
+			}
+			if got := resp.PageUrl(10); got != test.wantPageUrl {
+				t.Errorf("got page URL %s, want %s", got, test.wantPageUrl)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"github.com/t3chguy/matrix-static/mxclient"
+)
+
+type RoomPinnedEventsResp struct {
+	Events    []mxclient.Event
+	NumPinned int
+	err       error
+}
+
+type RoomPinnedEventsJob struct {
+	roomID string
+	limit  int
+	// ctx is of the request for the page, pinned events are fetched within it.
+	ctx context.Context
+}
+
+func (job RoomPinnedEventsJob) Work(w *Worker) {
+	room, ok := w.rooms[job.roomID]
+	if !ok {
+		w.Output <- RoomPinnedEventsResp{err: errRoomGone}
+		return
+	}
+	events, numPinned := room.GetPinnedEvents(job.ctx, job.limit)
+	if pseudonyms := room.Pseudonyms(); pseudonyms != nil {
+		events = pseudonyms.Events(events)
+	}
+	w.Output <- RoomPinnedEventsResp{events, numPinned, nil}
+}
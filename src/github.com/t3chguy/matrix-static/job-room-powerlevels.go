@@ -15,12 +15,12 @@
 package main
 
 import (
-	"github.com/t3chguy/matrix-static/mxclient"
+	"github.com/t3chguy/matrix-static/templates"
 )
 
 type RoomPowerLevelsResp struct {
-	RoomInfo    mxclient.RoomInfo
-	PowerLevels mxclient.PowerLevels
+	templates.RoomPowerLevelsPage
+	err error
 }
 
 type RoomPowerLevelsJob struct {
@@ -28,12 +28,22 @@ type RoomPowerLevelsJob struct {
 }
 
 func (job RoomPowerLevelsJob) Work(w *Worker) {
-	room := w.rooms[job.roomID]
-	powerLevels := room.GetState().PowerLevels
+	room, ok := w.rooms[job.roomID]
+	if !ok {
+		w.Output <- RoomPowerLevelsResp{err: errRoomGone}
+		return
+	}
+	state := room.GetState()
 
-	w.Output <- RoomPowerLevelsResp{
-		room.RoomInfo(),
-		powerLevels,
+	users := state.UserPowerLevels()
+	if pseudonyms := room.Pseudonyms(); pseudonyms != nil {
+		users = pseudonyms.UserPowerLevels(users)
 	}
+
+	w.Output <- RoomPowerLevelsResp{RoomPowerLevelsPage: templates.RoomPowerLevelsPage{
+		RoomInfo:    room.RoomInfo(),
+		PowerLevels: state.PowerLevels,
+		Users:       users,
+	}}
 	room.Access()
 }
@@ -0,0 +1,103 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// powerLevelsInitialSync returns the initial sync of a room whose state is the m.room.power_levels event of content,
+// with Alice & Bob as members.
+func powerLevelsInitialSync(content string) string {
+	return `{"messages":{"start":"s0","end":"e0","chunk":[]},"state":[
+		{"type":"m.room.member","state_key":"@alice:example.org","sender":"@alice:example.org","event_id":"$alice",
+			"content":{"membership":"join","displayname":"Alice"}},
+		{"type":"m.room.member","state_key":"@bob:example.org","sender":"@bob:example.org","event_id":"$bob",
+			"content":{"membership":"join","displayname":"<b>Bob</b>"}},
+		{"type":"m.room.power_levels","state_key":"","sender":"@alice:example.org","event_id":"$pl","content":` + content + `}]}`
+}
+
+func TestRoomPowerLevelsPage(t *testing.T) {
+	const roomID = "!pl:example.org"
+	tests := []struct {
+		name      string
+		content   string
+		want      []string
+		wantNotIn []string
+	}{
+		{"realistic", `{"ban":50,"kick":50,"redact":75,"invite":0,"events_default":0,"state_default":50,"users_default":0,
+			"events":{"m.room.name":50,"m.room.power_levels":100,"m.room.avatar":50},
+			"users":{"@alice:example.org":100,"@bob:example.org":50,"@carol:example.org":0,"@dave:other.org":-1}}`,
+			[]string{
+				"<tr><td>Ban</td><td>50</td></tr>", "<tr><td>Kick</td><td>50</td></tr>",
+				"<tr><td>Redact</td><td>75</td></tr>", "<tr><td>Invite</td><td>0</td></tr>",
+				"<tr><td>m.room.avatar</td><td>50</td></tr><tr><td>m.room.name</td><td>50</td></tr><tr><td>m.room.power_levels</td><td>100</td></tr>",
+			},
+			// users at the default level are not shown.
+			[]string{"@carol:example.org", "<b>Bob</b>"}},
+		{"minimal", `{"users":{"@alice:example.org":100}}`,
+			[]string{
+				"<tr><td>Ban</td><td>50</td></tr>", "<tr><td>Kick</td><td>50</td></tr>",
+				"<tr><td>Redact</td><td>50</td></tr>", "<tr><td>Invite</td><td>0</td></tr>",
+				"<tr><td>User Default</td><td>0</td></tr>", "<tr><td>State Default</td><td>50</td></tr>",
+				"<tr><td>Events Default</td><td>0</td></tr>",
+			},
+			nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			worker := newTestWorker(t, roomID, powerLevelsInitialSync(test.content))
+			worker.Queue <- RoomPowerLevelsJob{roomID}
+			resp := (<-worker.Output).(RoomPowerLevelsResp)
+			if resp.err != nil {
+				t.Fatal(resp.err)
+			}
+
+			body := resp.Body()
+			for _, want := range test.want {
+				if !strings.Contains(body, want) {
+					t.Errorf("Body() is missing %s: %s", want, body)
+				}
+			}
+			for _, unwanted := range test.wantNotIn {
+				if strings.Contains(body, unwanted) {
+					t.Errorf("Body() has %s: %s", unwanted, body)
+				}
+			}
+		})
+	}
+}
+
+// TestRoomPowerLevelsPageUsers asserts that users are listed by their display names, highest power level first.
+func TestRoomPowerLevelsPageUsers(t *testing.T) {
+	const roomID = "!pl:example.org"
+	worker := newTestWorker(t, roomID, powerLevelsInitialSync(`{"users":{"@dave:other.org":-1,"@bob:example.org":50,
+		"@alice:example.org":100,"@carol:example.org":0}}`))
+	worker.Queue <- RoomPowerLevelsJob{roomID}
+	resp := (<-worker.Output).(RoomPowerLevelsResp)
+	body := resp.Body()
+
+	users := regexp.MustCompile(`<a href="[^"]*" title="[^"]*">([^<]*)</a></td><td>([^<]*)</td>`).FindAllStringSubmatch(body, -1)
+	var got []string
+	for _, user := range users {
+		got = append(got, user[1]+" "+user[2])
+	}
+	want := []string{"Alice Admin (100)", "&lt;b&gt;Bob&lt;/b&gt; Moderator (50)", "@dave:other.org Muted (-1)"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("got users %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"github.com/t3chguy/matrix-static/mxclient"
+)
+
+// RoomResyncJob replaces the room's cached state & timeline with those synced afresh, nobody waits on it so it sends no resp.
+type RoomResyncJob struct {
+	roomID string
+	// ctx carries the request ID of the request which asked for the resync, so that the sync can be correlated to it,
+	// but is not cancelled along with that request.
+	ctx context.Context
+}
+
+func (job RoomResyncJob) Work(w *Worker) {
+	loggerWithFields := mxclient.Logger(job.ctx).WithField("worker", w.ID).WithField("roomID", job.roomID)
+
+	// the room is only replaced once synced afresh, jobs queued behind this one rely on the worker still holding it,
+	// so a failed sync leaves what we had in place.
+	loggerWithFields.Info("Started Resyncing Room")
+	newRoom, err := w.client.NewRoom(job.ctx, job.roomID)
+	if err != nil {
+		loggerWithFields.WithError(err).Error("Failed Resyncing Room")
+		return
+	}
+
+	loggerWithFields.Info("Finished Resyncing Room")
+	w.rooms[job.roomID] = newRoom
+	w.invalidate(job.roomID)
+}
@@ -0,0 +1,55 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+// TestRoomResyncJobFailure asserts that a resync which fails leaves the worker holding the room as it was, so that the
+// jobs queued behind it still find the room.
+func TestRoomResyncJobFailure(t *testing.T) {
+	const roomID = "!resync:example.org"
+	var syncs int32
+	client := newTestClient(t, homeserverRoute{suffix: "/rooms/" + roomID + "/initialSync", handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if atomic.AddInt32(&syncs, 1) > 1 {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errcode":"M_FORBIDDEN","error":"You are not in the room"}`))
+			return
+		}
+		w.Write([]byte(`{"messages":{"start":"s0","end":"e0","chunk":[{"event_id":"$one","type":"m.room.message",
+			"sender":"@alice:example.org","origin_server_ts":1000,"content":{"msgtype":"m.text","body":"hi"}}]},"state":[]}`))
+	}})
+	worker := NewWorker(0, client, nil)
+
+	worker.Queue <- RoomInitialSyncJob{roomID, context.Background()}
+	if resp := (<-worker.Output).(*RoomInitialSyncResp); resp.err != nil {
+		t.Fatalf("initial sync failed: %v", resp.err)
+	}
+
+	worker.Queue <- RoomResyncJob{roomID, context.Background()}
+	worker.Queue <- RoomEventsJob{roomID, "", 0, 10, context.Background()}
+	resp := (<-worker.Output).(RoomEventsResp)
+	if got := atomic.LoadInt32(&syncs); got != 2 {
+		t.Fatalf("room was synced %d times, want 2", got)
+	}
+	if resp.err != nil || len(resp.Events) != 1 || resp.Events[0].ID != "$one" {
+		t.Errorf("got events %v with error %v, want the room as it was before the resync", resp.Events, resp.err)
+	}
+}
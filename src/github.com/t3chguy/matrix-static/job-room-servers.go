@@ -15,15 +15,17 @@
 package main
 
 import (
-	"github.com/t3chguy/matrix-static/mxclient"
+	"github.com/t3chguy/matrix-static/templates"
 	"github.com/t3chguy/matrix-static/utils"
 )
 
+// RoomServersMaxListed caps how many servers may be paged through, beyond which rooms have too long a tail of servers
+// with a single user each for the list to be of any use.
+const RoomServersMaxListed = 1000
+
 type RoomServersResp struct {
-	RoomInfo mxclient.RoomInfo
-	Servers  mxclient.ServerUserCounts
-	PageSize int
-	Page     int
+	templates.RoomServersPage
+	err error
 }
 
 type RoomServersJob struct {
@@ -33,16 +35,25 @@ type RoomServersJob struct {
 }
 
 func (job RoomServersJob) Work(w *Worker) {
-	room := w.rooms[job.roomID]
+	room, ok := w.rooms[job.roomID]
+	if !ok {
+		w.Output <- RoomServersResp{err: errRoomGone}
+		return
+	}
 	servers := room.GetState().Servers()
+	if len(servers) > RoomServersMaxListed {
+		servers = servers[:RoomServersMaxListed]
+	}
 
 	start, end := utils.CalcPaginationStartEnd(job.page, job.pageSize, len(servers))
 
-	w.Output <- RoomServersResp{
-		room.RoomInfo(),
-		servers[start:end],
-		job.pageSize,
-		job.page,
-	}
+	w.Output <- RoomServersResp{RoomServersPage: templates.RoomServersPage{
+		RoomInfo:     room.RoomInfo(),
+		Servers:      servers[start:end],
+		PageSize:     job.pageSize,
+		Page:         job.page,
+		OriginServer: room.GetState().OriginServer(),
+		NumListed:    len(servers),
+	}}
 	room.Access()
 }
@@ -0,0 +1,55 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestRoomServersJobTruncated asserts that the servers of the largest rooms are capped to those with the most users,
+// noting that there are more.
+func TestRoomServersJobTruncated(t *testing.T) {
+	const roomID = "!servers:example.org"
+	state := []string{`{"type":"m.room.create","state_key":"","sender":"@admin:origin.org","event_id":"$create","content":{}}`}
+	for i := 0; i < RoomServersMaxListed+2; i++ {
+		mxid := fmt.Sprintf("@user:server%d.org", i)
+		state = append(state, `{"type":"m.room.member","state_key":"`+mxid+`","sender":"`+mxid+`","event_id":"$`+mxid+`","content":{"membership":"join"}}`)
+	}
+	// the busiest server is listed first.
+	state = append(state, `{"type":"m.room.member","state_key":"@other:server7.org","sender":"@other:server7.org","event_id":"$other","content":{"membership":"join"}}`)
+	worker := newTestWorker(t, roomID, `{"messages":{"start":"s0","end":"e0","chunk":[]},"state":[`+strings.Join(state, ",")+`]}`)
+
+	worker.Queue <- RoomServersJob{roomID, 1, 10}
+	resp := (<-worker.Output).(RoomServersResp)
+	if resp.err != nil {
+		t.Fatal(resp.err)
+	}
+	if resp.NumListed != RoomServersMaxListed || resp.RoomInfo.NumServers != RoomServersMaxListed+2 {
+		t.Errorf("listed %d servers of %d, want %d of %d", resp.NumListed, resp.RoomInfo.NumServers, RoomServersMaxListed, RoomServersMaxListed+2)
+	}
+	if len(resp.Servers) != 10 || resp.Servers[0].ServerName != "server7.org" || resp.Servers[0].NumUsers != 2 {
+		t.Errorf("got first page %v, want 10 servers led by server7.org with 2 users", resp.Servers)
+	}
+	if resp.OriginServer != "origin.org" {
+		t.Errorf("got origin server %q, want origin.org", resp.OriginServer)
+	}
+
+	body := resp.Body()
+	if want := fmt.Sprintf("servers with the most users in this room are listed, of %d.", RoomServersMaxListed+2); !strings.Contains(body, want) {
+		t.Errorf("Body() does not note the truncation: %s", body)
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"github.com/t3chguy/matrix-static/mxclient"
+)
+
+type RoomThreadJob struct {
+	roomID string
+	rootID string
+	// ctx is of the request for the page, the homeserver is not kept waiting on for requests which have given up.
+	ctx context.Context
+}
+
+func (job RoomThreadJob) Work(w *Worker) {
+	room, ok := w.rooms[job.roomID]
+	if !ok {
+		w.Output <- RoomEventsResp{err: errRoomGone}
+		return
+	}
+	events, err := room.GetThread(job.ctx, job.rootID)
+	events, edits := room.ApplyEdits(events)
+
+	membersMap := make(map[string]mxclient.MemberInfo)
+	for mxid, member := range room.GetState().MemberMap {
+		membersMap[mxid] = *member
+	}
+
+	resp := RoomEventsResp{
+		Events:    events,
+		RoomInfo:  room.RoomInfo(),
+		MemberMap: membersMap,
+		Reactions: room.GetReactions(events),
+		Polls:     room.GetPolls(events),
+		Edits:     edits,
+		ReplyTo:   room.GetReplyTargets(events),
+		Receipts:  room.GetReadReceipts(events),
+		err:       err,
+	}
+	resp.pseudonymize(room.Pseudonyms())
+	w.Output <- resp
+	room.Access()
+}
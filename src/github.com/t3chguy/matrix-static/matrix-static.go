@@ -16,6 +16,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"flag"
 	log "github.com/Sirupsen/logrus"
 	"github.com/disintegration/letteravatar"
@@ -24,25 +25,44 @@ import (
 	"github.com/gin-contrib/pprof"
 	"github.com/gin-gonic/gin"
 	"github.com/matrix-org/dugong"
+	"github.com/matrix-org/gomatrix"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/t3chguy/go-gin-prometheus"
+	"github.com/t3chguy/matrix-static/i18n"
+	"github.com/t3chguy/matrix-static/mediaproxy"
 	"github.com/t3chguy/matrix-static/mxclient"
 	"github.com/t3chguy/matrix-static/sanitizer"
 	"github.com/t3chguy/matrix-static/templates"
 	"github.com/t3chguy/matrix-static/utils"
 	"image/png"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"path"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
+	// ?tz= may name any IANA timezone, regardless of those installed where we are deployed.
+	_ "time/tzdata"
 	"unicode"
 	"unicode/utf8"
 )
 
 const PublicRoomsPageSize = 20
 const RoomTimelineSize = 30
+const RoomTimelineMinSize = 10
+const RoomTimelineMaxSize = 500
+const RoomContextSize = 20
 const RoomMembersPageSize = 20
+const RoomPinnedEventsLimit = 5
+const RoomFeedDefaultSize = 50
+const RoomFeedMaxSize = 200
+
+const MetricsPath = "/metrics"
 
 type configVars struct {
 	ConfigFile string
@@ -52,9 +72,62 @@ type configVars struct {
 	EnablePrometheusMetrics bool
 	EnablePprof             bool
 
-	LogDir string
+	LogDir    string
+	LogFormat string
+
+	ShutdownTimeout time.Duration
+
+	ReadTimeout    time.Duration
+	WriteTimeout   time.Duration
+	IdleTimeout    time.Duration
+	RequestTimeout time.Duration
+	RenderTimeout  time.Duration
+
+	MaxConcurrentRenders int
+	RenderQueueSize      int
+
+	MediaCacheSize       int
+	RenderCacheSize      int
+	InlineAvatarMaxBytes int
+
+	HideEncryptedEvents bool
+	ShowReadReceipts    bool
+	AnonymizeUsers      bool
+	ShowEventTypes      string
+	HideEventTypes      string
+	MaxBackpaginations  int
+	SyncTimelineLimit   int
+	SyncTimeout         time.Duration
+	HighlightCode       bool
+	MaxBodyLength       int
+
+	MembershipCollapseThreshold int
+	RepeatCollapseSimilarity    float64
+	RepeatCollapseMinRun        int
+
+	TimelineSize int
+
+	RateLimit          float64
+	RateLimitBurst     int
+	TrustedProxyHeader string
+	TrustedProxies     string
+
+	Robots robotsPolicy
+
+	RoomBlocklist string
+	RoomAllowlist string
+	FeaturedRooms string
+
+	ThemeDir    string
+	Theme       templates.Theme
+	AssetMaxAge time.Duration
+
+	AdminUsername string
 }
 
+// AdminPasswordEnv names the environment variable which, if set, enables the /admin routes behind BasicAuth.
+const AdminPasswordEnv = "MATRIX_STATIC_ADMIN_PASSWORD"
+
 func main() {
 	config := configVars{}
 
@@ -65,9 +138,79 @@ func main() {
 	flag.BoolVar(&config.EnablePrometheusMetrics, "enable-prometheus-metrics", false, "Whether or not to enable the /metrics endpoint.")
 	flag.BoolVar(&config.EnablePprof, "enable-pprof", false, "Whether or not to enable the /debug/pprof endpoints.")
 	flag.StringVar(&config.LogDir, "logger-directory", "", "Where to write the info, warn and error logs to.")
+	flag.StringVar(&config.LogFormat, "log-format", "text", "Whether to log as text or json.")
+	flag.IntVar(&config.MediaCacheSize, "media-cache-size", 64*1024*1024, "How many bytes of proxied media to cache in memory.")
+	flag.IntVar(&config.InlineAvatarMaxBytes, "inline-avatar-max-bytes", 0, "Inline member list avatars of up to this many bytes into the page rather than each being requested, 0 to disable.")
+	flag.IntVar(&config.RenderCacheSize, "render-cache-size", 32*1024*1024, "How many bytes of rendered room pages to cache in memory, 0 to disable.")
+	flag.BoolVar(&config.HideEncryptedEvents, "hide-encrypted-events", false, "Whether to omit encrypted events from timelines instead of showing a placeholder.")
+	flag.StringVar(&config.ShowEventTypes, "show-event-types", "", "Comma separated event types to show in timelines even though we would hide them, a trailing * matches any suffix.")
+	flag.StringVar(&config.HideEventTypes, "hide-event-types", "", "Comma separated event types to hide from timelines e.g. m.room.member, a trailing * matches any suffix.")
+	flag.BoolVar(&config.ShowReadReceipts, "show-read-receipts", false, "Whether to show who has read up to each event, as of when the room was loaded.")
+	flag.BoolVar(&config.AnonymizeUsers, "anonymize-users", false, "Whether to replace users with per-room pseudonyms such as User 1, hiding their IDs, names & avatars.")
+	flag.BoolVar(&config.HighlightCode, "highlight-code", true, "Whether to highlight the syntax of code blocks in messages which name their language.")
+	flag.IntVar(&config.MaxBodyLength, "max-body-length", 0, "How many characters of each message to render before cutting it short, 0 for no limit.")
+	flag.IntVar(&config.MaxBackpaginations, "max-backpaginations", mxclient.DefaultMaxBackpaginations, "How many requests for older history a single room page may make to the homeserver, at least 1.")
+	flag.IntVar(&config.SyncTimelineLimit, "sync-timeline-limit", mxclient.DefaultSyncTimelineLimit, "How many events to request when loading a room & each time we catch up on it.")
+	flag.DurationVar(&config.SyncTimeout, "sync-timeout", mxclient.DefaultSyncTimeout, "How long loading a room & each time we catch up on it may take before giving up on it.")
+	flag.IntVar(&config.MembershipCollapseThreshold, "membership-collapse-threshold", 3, "Collapse runs of more than this many membership events into a summary, 0 to disable.")
+	flag.Float64Var(&config.RepeatCollapseSimilarity, "repeat-collapse-similarity", 0, "How similar (0 to 1) consecutive messages from the same sender must be to collapse them as repeats, 0 to disable.")
+	flag.IntVar(&config.RepeatCollapseMinRun, "repeat-collapse-min-run", 3, "How many similar consecutive messages from the same sender must be sent for them to be collapsed.")
+	flag.IntVar(&config.TimelineSize, "timeline-size", RoomTimelineSize, "Number of events shown per room page unless overridden by ?limit=.")
+	flag.BoolVar(&config.Robots.AllowDirectory, "robots-allow-directory", true, "Whether robots.txt allows crawling the room directory.")
+	flag.BoolVar(&config.Robots.AllowRooms, "robots-allow-rooms", true, "Whether robots.txt allows crawling room pages.")
+	flag.Float64Var(&config.RateLimit, "rate-limit", 0, "Requests per second allowed from each client IP, 0 to disable rate limiting.")
+	flag.IntVar(&config.RateLimitBurst, "rate-limit-burst", 20, "Requests each client IP may burst to above the rate limit.")
+	flag.StringVar(&config.TrustedProxyHeader, "trusted-proxy-header", "", "Header the reverse proxy in front of us puts client IPs in, X-Forwarded-For or X-Real-IP, to rate limit & log by.")
+	flag.StringVar(&config.TrustedProxies, "trusted-proxies", DefaultTrustedProxies, "Comma separated CIDRs of the reverse proxies trusted to set --trusted-proxy-header.")
+	flag.StringVar(&config.RoomAllowlist, "room-allowlist", "", "Path to a JSON array of the only room IDs & aliases to serve, joined on load & reloaded on SIGHUP.")
+	flag.StringVar(&config.RoomBlocklist, "room-blocklist", "", "Path to a JSON array of room IDs & aliases not to serve, reloaded on SIGHUP.")
+	flag.StringVar(&config.FeaturedRooms, "featured-rooms", "", "Path to a JSON array of room IDs & aliases to feature on the front page in place of the directory, reloaded on SIGHUP.")
+	flag.StringVar(&config.AdminUsername, "admin-username", "admin", "Username for the /admin routes, enabled by setting "+AdminPasswordEnv+".")
+	flag.DurationVar(&config.AssetMaxAge, "asset-max-age", 7*24*time.Hour, "How long browsers may cache stylesheets & images for, 0 to always revalidate them.")
+	flag.StringVar(&config.ThemeDir, "theme-dir", "", "Directory of css/ & img/ files to serve in place of the built in ones of the same name.")
+	flag.StringVar(&config.Theme.SiteName, "site-name", templates.SiteTheme.SiteName, "Name of the site used in page titles.")
+	flag.StringVar(&config.Theme.AccentColor, "accent-color", "", "CSS color of links and date separators, defaults to that of the stylesheet.")
+	flag.StringVar(&config.Theme.LogoURL, "logo-url", "", "URL of a logo to show atop every page.")
+	flag.DurationVar(&config.ReadTimeout, "read-timeout", 5*time.Second, "How long clients may take to send their requests.")
+	flag.DurationVar(&config.WriteTimeout, "write-timeout", 10*time.Second, "How long we may take to respond to requests, including reading them.")
+	flag.DurationVar(&config.IdleTimeout, "idle-timeout", 60*time.Second, "How long to keep idle keep-alive connections open.")
+	flag.DurationVar(&config.RequestTimeout, "request-timeout", 8*time.Second, "How long we may spend on handling a request before giving up on it.")
+	flag.IntVar(&config.MaxConcurrentRenders, "max-concurrent-renders", 0, "How many room pages may be loaded & rendered at once, 0 for no limit.")
+	flag.IntVar(&config.RenderQueueSize, "render-queue-size", 64, "How many room page requests may wait for a render beyond --max-concurrent-renders before being turned away.")
+	flag.DurationVar(&config.RenderTimeout, "render-timeout", 5*time.Second, "How long we may spend loading & rendering a room page before giving up on it for the user to try again.")
+	flag.DurationVar(&config.ShutdownTimeout, "shutdown-timeout", 10*time.Second, "How long to wait for in-flight requests to complete when shutting down.")
 
 	flag.Parse()
 
+	config.TimelineSize = utils.Bound(RoomTimelineMinSize, config.TimelineSize, RoomTimelineMaxSize)
+
+	if err := validateAccentColor(config.Theme.AccentColor); err != nil {
+		log.WithError(err).Fatal("Invalid --accent-color")
+	}
+	if config.SyncTimelineLimit < 1 || config.SyncTimelineLimit > mxclient.MaxSyncTimelineLimit {
+		log.WithField("limit", config.SyncTimelineLimit).Fatalf("Invalid --sync-timeline-limit, must be from 1 to %d", mxclient.MaxSyncTimelineLimit)
+	}
+	if config.SyncTimeout <= 0 {
+		log.WithField("timeout", config.SyncTimeout).Fatal("Invalid --sync-timeout, must be positive")
+	}
+	if config.RateLimitBurst < 1 {
+		log.WithField("burst", config.RateLimitBurst).Fatal("Invalid --rate-limit-burst, must be at least 1")
+	}
+	proxies, err := newTrustedProxies(config.TrustedProxyHeader, config.TrustedProxies)
+	if err != nil {
+		log.WithError(err).Fatal("Invalid --trusted-proxy-header or --trusted-proxies")
+	}
+	templates.SiteTheme = config.Theme
+	templates.AssetVersion = assetVersion(config.ThemeDir)
+	basePath := publicBasePath(config.PublicServePrefix)
+	templates.BasePath = basePath
+	// the metrics are served from within the prefix too, so that they are reachable through the same reverse proxy.
+	metricsPath := basePath + strings.TrimPrefix(MetricsPath, "/")
+
+	if config.LogFormat == "json" {
+		log.SetFormatter(&log.JSONFormatter{})
+	}
+
 	if config.LogDir != "" {
 		log.AddHook(dugong.NewFSHook(
 			filepath.Join(config.LogDir, "info.log"),
@@ -82,7 +225,7 @@ func main() {
 		))
 	}
 
-	log.Infof("Matrix-Static (%+v)", config)
+	log.WithField("build", buildInfo()).Infof("Matrix-Static (%+v)", config)
 
 	client, err := mxclient.NewClient(config.ConfigFile)
 	if err != nil {
@@ -90,20 +233,100 @@ func main() {
 		return
 	}
 
-	worldReadableRooms := client.NewWorldReadableRooms()
-	workers := NewWorkers(uint32(config.NumWorkers), client)
+	client.HideEncryptedEvents = config.HideEncryptedEvents
+	client.ShowReadReceipts = config.ShowReadReceipts
+	client.Anonymize = config.AnonymizeUsers
+	client.MaxBackpaginations = config.MaxBackpaginations
+	client.SyncTimelineLimit = config.SyncTimelineLimit
+	client.SyncTimeout = config.SyncTimeout
+	client.EventTypes = mxclient.EventTypeFilter{
+		Shown:  mxclient.ParseEventTypes(config.ShowEventTypes),
+		Hidden: mxclient.ParseEventTypes(config.HideEventTypes),
+	}
 	sanitizerFn := sanitizer.InitSanitizer()
+	sanitizerFn.HighlightCode = config.HighlightCode
+	sanitizerFn.MaxBodyLength = config.MaxBodyLength
+	client.Sanitizer = sanitizerFn
+
+	worldReadableRooms := client.NewWorldReadableRooms()
+
+	var renderCache *RenderCache
+	var invalidations chan string
+	if config.RenderCacheSize > 0 {
+		invalidations = make(chan string, config.NumWorkers)
+		renderCache = NewRenderCache(config.RenderCacheSize, invalidations)
+	}
+
+	workers := NewWorkers(uint32(config.NumWorkers), client, invalidations)
+
+	roomAliasResolver := newRoomAliasResolver(client)
+	roomBlocklist, err := newRoomBlocklist(config.RoomBlocklist, roomAliasResolver)
+	if err != nil {
+		log.WithError(err).Error("Unable to load Room Blocklist")
+		return
+	}
+	roomAllowlist, err := newRoomAllowlist(config.RoomAllowlist, roomAliasResolver, client)
+	if err != nil {
+		log.WithError(err).Error("Unable to load Room Allowlist")
+		return
+	}
+	featuredRooms, err := newFeaturedRooms(config.FeaturedRooms, roomAliasResolver)
+	if err != nil {
+		log.WithError(err).Error("Unable to load Featured Rooms")
+		return
+	}
 
 	router := gin.New()
 	router.RedirectTrailingSlash = false
+	// gin believes X-Real-IP & X-Forwarded-For from anyone, we resolve the client IP ourselves from trusted proxies.
+	router.ForwardedByClientIP = false
+	router.Use(proxies.Middleware())
 
 	if config.EnablePprof {
 		pprof.Register(router, nil)
 	}
 
+	// Probes are registered outside of the public routes to keep them out of the logs & request metrics.
+	router.GET("/health", func(c *gin.Context) {
+		c.String(http.StatusOK, "OK")
+	})
+	router.GET("/ready", serveReady(worldReadableRooms))
+	router.GET(VersionPath, func(c *gin.Context) {
+		c.JSON(http.StatusOK, buildInfo())
+	})
+
+	// Admin routes are left outside of the public routes, they should not be exposed to the public at all.
+	if adminPassword := os.Getenv(AdminPasswordEnv); adminPassword != "" {
+		adminRouter := router.Group("/admin")
+		adminRouter.Use(logRequests, gin.BasicAuth(gin.Accounts{config.AdminUsername: adminPassword}))
+
+		// The resync happens in the background, as it may take longer than a request is allowed.
+		adminRouter.POST("/room/:roomID/resync", func(c *gin.Context) {
+			roomID := c.Param("roomID")
+			if !mxclient.IsValidRoomID(roomID) {
+				c.String(http.StatusBadRequest, "Invalid Room ID")
+				return
+			}
+
+			worker := workers.GetWorkerForRoomID(roomID)
+			job := RoomResyncJob{roomID, context.WithoutCancel(c.Request.Context())}
+			go func() {
+				worker.Queue <- job
+			}()
+			c.String(http.StatusAccepted, "Resync queued")
+		})
+	}
+
+	// Everything but the probes & metrics are limited, so that one client cannot starve the others of the workers.
+	routerMiddleware := []gin.HandlerFunc{gin.Recovery()}
+	if config.RateLimit > 0 {
+		limiter := newRateLimiter(config.RateLimit, config.RateLimitBurst)
+		routerMiddleware = append(routerMiddleware, limiter.Middleware())
+	}
+
 	// This is temporary until generated server-side in Synapse as suggested by riot-web issues.
 	avatarRouter := router.Group(config.PublicServePrefix)
-	avatarRouter.Use(gin.Recovery())
+	avatarRouter.Use(routerMiddleware...)
 	generatedAvatarCache := persistence.NewInMemoryStore(time.Hour)
 	avatarRouter.GET("/avatar/:identifier", cache.CachePage(generatedAvatarCache, time.Hour, func(c *gin.Context) {
 		identifier := c.Param("identifier")
@@ -136,96 +359,166 @@ func main() {
 		}
 	}))
 
+	mediaProxy := mediaproxy.NewProxy(client, config.MediaCacheSize)
+	mediaRouter := router.Group(config.PublicServePrefix)
+	mediaRouter.Use(routerMiddleware...)
+	mediaRouter.GET("/media/:serverName/:mediaID", mediaProxy.Handler())
+	mediaRouter.GET("/thumb/:serverName/:mediaID", mediaProxy.ThumbnailHandler())
+
 	publicRouter := router.Group(config.PublicServePrefix)
-	publicRouter.Use(gin.Logger(), gin.Recovery())
+	publicRouter.Use(logRequests, requestDeadline(config.RequestTimeout))
+	publicRouter.Use(routerMiddleware...)
 
 	if config.EnablePrometheusMetrics {
 		ginProm := ginprometheus.NewPrometheus("http")
+		ginProm.MetricsPath = metricsPath
+		ginProm.CountUnknownLengthBodies = true
+		ginProm.ReqCntURLLabelMappingFn = newRouteLabeller(router).Label
+		// Static assets would otherwise drown out real page views.
+		ginProm.IgnoredPaths = []string{
+			path.Join(config.PublicServePrefix, "img") + "/*",
+			path.Join(config.PublicServePrefix, "css") + "/*",
+		}
 		publicRouter.Use(ginProm.HandlerFunc())
 		router.GET(ginProm.MetricsPath, ginprometheus.PrometheusHandler())
+		workers.RegisterMetrics(prometheus.DefaultRegisterer)
+		mxclient.RegisterMetrics(prometheus.DefaultRegisterer)
+		RegisterRenderMetrics(prometheus.DefaultRegisterer)
 	}
 
-	publicRouter.Static("/img", "./assets/img")
-	publicRouter.Static("/css", "./assets/css")
-	publicRouter.StaticFile("/robots.txt", "./assets/robots.txt")
+	// after the metrics middleware so that response sizes are measured compressed.
+	publicRouter.Use(compressResponses(CompressionMinSize))
 
-	publicRouter.GET("/", func(c *gin.Context) {
-		page := utils.StrToIntDefault(c.DefaultQuery("page", "1"), 1)
-		templates.WritePageTemplate(c.Writer, &templates.RoomsPage{
-			Rooms:    worldReadableRooms.GetPage(page, PublicRoomsPageSize),
-			PageSize: PublicRoomsPageSize,
-			Page:     page,
-		})
+	for _, dir := range []string{"img", "css"} {
+		handler := serveAssets(assetFileSystem(config.ThemeDir, dir), config.AssetMaxAge)
+		publicRouter.GET("/"+dir+"/*filepath", handler)
+		publicRouter.HEAD("/"+dir+"/*filepath", handler)
+	}
+	publicRouter.GET("/robots.txt", func(c *gin.Context) {
+		baseURL := publicBaseURL(c, config.PublicServePrefix)
+		c.String(http.StatusOK, robotsTxt(config.Robots, basePath, metricsPath, VersionPath, baseURL+"sitemap.xml"))
 	})
 
-	roomAliasCache := persistence.NewInMemoryStore(time.Hour)
-	publicRouter.GET("/alias/:roomAlias", cache.CachePage(roomAliasCache, time.Hour, func(c *gin.Context) {
-		roomAlias := c.Param("roomAlias")
-		resp, err := client.GetRoomDirectoryAlias(roomAlias)
+	roomDirectory := newRoomDirectoryCache(client)
+
+	// serveDirectory serves the room directory as found at path, relative to the base path.
+	serveDirectory := func(c *gin.Context, path string) {
+		from := c.Query("from")
+		page := &templates.RoomsPage{
+			Localised: localise(c),
+			Query:     utils.LimitRunes(strings.TrimSpace(c.Query("q")), templates.RoomSearchMaxLength),
+			Path:      path,
+		}
 
-		// TODO better error page
-		if err != nil || resp.RoomID == "" {
+		resp, err := roomDirectory.GetPage(from, PublicRoomsPageSize, page.Query)
+		if err == mxclient.ErrInvalidDirectoryToken {
+			// tokens expire, so start again from the first page rather than erroring.
+			page.Notice = page.T("That page of the room directory has expired, showing the first page instead.")
+			resp, err = roomDirectory.GetPage("", PublicRoomsPageSize, page.Query)
+		}
+		if err != nil {
+			c.Status(http.StatusInternalServerError)
 			templates.WritePageTemplate(c.Writer, &templates.ErrorPage{
-				ErrType: "Unable to resolve Room Alias.",
+				ErrType: "Unable to load Room Directory.",
 				Error:   err,
 			})
 			return
 		}
 
-		c.Redirect(http.StatusTemporaryRedirect, "/room/"+resp.RoomID+"/")
-	}))
-
-	roomRouter := publicRouter.Group("/room/:roomID/")
-	{
-		roomRouter.GET("/$:eventID", func(c *gin.Context) {
-			eventID := c.Param("eventID")
-			roomID := c.Param("roomID")
-
-			c.Redirect(http.StatusTemporaryRedirect, "/room/"+roomID+"/?anchor=$"+eventID+"&highlight")
-		})
-
-		// Load room worker into request object so that we can do any clean up etc here
-		roomRouter.Use(func(c *gin.Context) {
-			roomID := c.Param("roomID")
+		page.Rooms = roomAllowlist.FilterRooms(roomBlocklist.FilterRooms(resp.Rooms))
+		page.Activity = workers.Activity()
+		page.NextBatch = resp.NextBatch
+		page.PrevBatch = resp.PrevBatch
+		templates.WritePageTemplate(c.Writer, page)
+	}
 
-			if roomID[0] != '!' {
-				templates.WritePageTemplate(c.Writer, &templates.ErrorPage{
-					ErrType: "Unable to Load Room.",
-					Details: "Room ID must start with a '!'",
+	// The front page features the chosen rooms if any, otherwise it is the directory, as are links to its other pages.
+	publicRouter.GET("/", func(c *gin.Context) {
+		if c.Query("from") == "" && c.Query("q") == "" {
+			rooms := roomAllowlist.FilterRooms(roomBlocklist.FilterRooms(featuredRooms.Rooms(worldReadableRooms)))
+			if len(rooms) > 0 {
+				templates.WritePageTemplate(c.Writer, &templates.FeaturedRoomsPage{
+					Localised: localise(c),
+					Rooms:     rooms,
 				})
-				c.Abort()
 				return
 			}
+		}
+		serveDirectory(c, "./")
+	})
+	publicRouter.GET("/rooms", func(c *gin.Context) {
+		serveDirectory(c, "./rooms")
+	})
 
-			worker := workers.GetWorkerForRoomID(roomID)
+	sitemaps := &sitemapHandlers{
+		rooms: worldReadableRooms,
+		filter: func(rooms []gomatrix.PublicRoomsChunk) []gomatrix.PublicRoomsChunk {
+			return roomAllowlist.FilterRooms(roomBlocklist.FilterRooms(rooms))
+		},
+		lastModified:      workers.LatestEventTimestamps,
+		publicServePrefix: config.PublicServePrefix,
+	}
+	publicRouter.GET("/sitemap.xml", sitemaps.serveSitemap)
+	publicRouter.GET("/sitemap/:name", sitemaps.serveNumberedSitemap)
 
-			worker.Queue <- &RoomInitialSyncJob{roomID}
-			resp := (<-worker.Output).(*RoomInitialSyncResp)
+	publicRouter.GET("/alias/:roomAlias", serveRoomAlias(roomAliasResolver, roomBlocklist, basePath))
 
-			if resp.err != nil {
-				if respErr, ok := mxclient.UnwrapRespError(resp.err); ok {
+	roomRouter := publicRouter.Group("/room/:roomID/")
+	{
+		roomRouter.Use(renderDeadline(config.RenderTimeout))
+		// the initial sync of a room is the costliest part of loading it, so it must wait its turn for a render too,
+		// even though the cached & unmodified pages it leads to are served at next to no cost.
+		if config.MaxConcurrentRenders > 0 {
+			roomRouter.Use(newRenderLimiter(config.MaxConcurrentRenders, config.RenderQueueSize).Middleware())
+		}
+
+		roomRouter.Use(loadRoomWorker(workers, roomBlocklist, roomAllowlist, roomAliasResolver, basePath))
+		roomRouter.Use(conditionalRoomPages)
+		if renderCache != nil {
+			roomRouter.Use(renderCache.Middleware())
+		}
+
+		roomRouter.GET("/", func(c *gin.Context) {
+			worker := c.MustGet("RoomWorker").(Worker)
+
+			pageSize, explicitLimit := parsePageSize(c, config.TimelineSize)
+
+			if at := c.Query("at"); at != "" {
+				timestamp, err := parseJumpDate(at)
+				if err != nil {
+					c.Status(http.StatusBadRequest)
 					templates.WritePageTemplate(c.Writer, &templates.ErrorPage{
-						ErrType: "Unable to Join Room.",
-						Details: mxclient.TextForRespError(respErr),
+						ErrType: "Invalid Date.",
+						Details: "Dates must be of the form YYYY-MM-DD or RFC 3339.",
 					})
-					c.Abort()
 					return
 				}
 
-				templates.WritePageTemplate(c.Writer, &templates.ErrorPage{
-					ErrType: "Cannot Load Room. Internal Server Error.",
-					Error:   err,
-				})
-				c.Abort()
-				return
+				worker.Queue <- Job(RoomJumpToDateJob{c.Param("roomID"), timestamp, c.Request.Context()})
+				jumpResp := (<-worker.Output).(RoomJumpToDateResp)
+				if abortIfCancelled(c) {
+					return
+				}
+				if jumpResp.err == errRoomGone {
+					abortRoomGone(c)
+					return
+				}
+				if jumpResp.Found {
+					target := basePath + "room/" + c.Param("roomID") + "/?anchor=" + url.QueryEscape(jumpResp.EventID) + "&highlight"
+					if explicitLimit {
+						target += "&limit=" + strconv.Itoa(pageSize)
+					}
+					if c.Query("order") == "desc" {
+						target += "&order=desc"
+					}
+					if location := parseTimezone(c); location != nil {
+						target += "&tz=" + url.QueryEscape(location.String())
+					}
+					c.Redirect(http.StatusTemporaryRedirect, target)
+					return
+				}
 			}
 
-			c.Set("RoomWorker", worker)
-			c.Next()
-		})
-
-		roomRouter.GET("/", func(c *gin.Context) {
-			worker := c.MustGet("RoomWorker").(Worker)
 			offset := utils.StrToIntDefault(c.DefaultQuery("offset", "0"), 0)
 			eventID := c.DefaultQuery("anchor", "")
 
@@ -233,15 +526,20 @@ func main() {
 				c.Param("roomID"),
 				eventID,
 				offset,
-				RoomTimelineSize,
+				pageSize,
+				c.Request.Context(),
 			})
 
 			jobResult := (<-worker.Output).(RoomEventsResp)
+			if abortIfCancelled(c) {
+				return
+			}
+			if jobResult.err == errRoomGone {
+				abortRoomGone(c)
+				return
+			}
 			if jobResult.err != nil {
-				templates.WritePageTemplate(c.Writer, &templates.RoomErrorPage{
-					Error:    "Some error has occurred",
-					RoomInfo: jobResult.RoomInfo,
-				})
+				writeRoomErrorPage(c, jobResult.err, "Event not found", jobResult.RoomInfo)
 				return
 			}
 
@@ -251,26 +549,214 @@ func main() {
 				eventID = jobResult.Events[0].ID
 			}
 
-			events := mxclient.ReverseEventsCopy(jobResult.Events)
+			// the job returns events newest first, whereas we render oldest first unless asked otherwise.
+			descending := c.Query("order") == "desc"
+			events := jobResult.Events
+			if !descending {
+				events = mxclient.ReverseEventsCopy(jobResult.Events)
+			}
 			_, highlight := c.GetQuery("highlight")
 
-			templates.WritePageTemplate(c.Writer, &templates.RoomChatPage{
-				RoomInfo:      jobResult.RoomInfo,
-				MemberMap:     jobResult.MemberMap,
-				Events:        events,
-				PageSize:      RoomTimelineSize,
-				CurrentOffset: offset,
-				Anchor:        eventID,
+			worker.Queue <- Job(RoomPinnedEventsJob{c.Param("roomID"), RoomPinnedEventsLimit, c.Request.Context()})
+			pinned := (<-worker.Output).(RoomPinnedEventsResp)
+			if abortIfCancelled(c) {
+				return
+			}
+			if pinned.err == errRoomGone {
+				abortRoomGone(c)
+				return
+			}
+
+			writeRoomChatPage(c, "/room/:roomID/", &templates.RoomChatPage{
+				Localised: localise(c),
+
+				RoomInfo:         jobResult.RoomInfo,
+				MemberMap:        jobResult.MemberMap,
+				Reactions:        jobResult.Reactions,
+				Polls:            jobResult.Polls,
+				Edits:            jobResult.Edits,
+				ReplyTo:          jobResult.ReplyTo,
+				Events:           events,
+				PageSize:         pageSize,
+				ExplicitPageSize: explicitLimit,
+				Descending:       descending,
+				CurrentOffset:    offset,
+				Anchor:           eventID,
 
 				AtTopEnd:    jobResult.AtTopEnd,
 				AtBottomEnd: jobResult.AtBottomEnd,
 
+				HistoryTruncated: jobResult.HistoryTruncated,
+
 				Sanitizer:    sanitizerFn,
 				MediaBaseURL: client.MediaBaseURL,
 				Highlight:    highlight,
+
+				MembershipCollapseThreshold: config.MembershipCollapseThreshold,
+				RepeatCollapseSimilarity:    config.RepeatCollapseSimilarity,
+				RepeatCollapseMinRun:        config.RepeatCollapseMinRun,
+
+				Pinned:    pinned.Events,
+				NumPinned: pinned.NumPinned,
+
+				Threads:  jobResult.Threads,
+				Receipts: jobResult.Receipts,
+				Location: parseTimezone(c),
+			})
+		})
+
+		roomRouter.GET("/export.json", func(c *gin.Context) {
+			streamRoomExport(c, c.MustGet("RoomWorker").(Worker), config.WriteTimeout, sanitizerFn)
+		})
+
+		roomRouter.GET("/chat.json", func(c *gin.Context) {
+			serveRoomChatJSON(c, c.MustGet("RoomWorker").(Worker), config.TimelineSize, sanitizerFn)
+		})
+
+		roomRouter.GET("/$:eventID", func(c *gin.Context) {
+			worker := c.MustGet("RoomWorker").(Worker)
+			eventID := "$" + c.Param("eventID")
+
+			worker.Queue <- Job(RoomEventContextJob{
+				c.Param("roomID"),
+				eventID,
+				RoomContextSize,
+				c.Request.Context(),
+			})
+
+			jobResult := (<-worker.Output).(RoomEventsResp)
+			if abortIfCancelled(c) {
+				return
+			}
+			if jobResult.err == errRoomGone {
+				abortRoomGone(c)
+				return
+			}
+			if jobResult.err != nil {
+				writeRoomErrorPage(c, jobResult.err, "Event not found", jobResult.RoomInfo)
+				return
+			}
+
+			writeRoomChatPage(c, "/room/:roomID/$:eventID", &templates.RoomChatPage{
+				Localised: localise(c),
+
+				RoomInfo:  jobResult.RoomInfo,
+				MemberMap: jobResult.MemberMap,
+				Reactions: jobResult.Reactions,
+				Polls:     jobResult.Polls,
+				Edits:     jobResult.Edits,
+				ReplyTo:   jobResult.ReplyTo,
+				Events:    mxclient.ReverseEventsCopy(jobResult.Events),
+				PageSize:  RoomContextSize,
+				Anchor:    eventID,
+
+				Sanitizer:    sanitizerFn,
+				MediaBaseURL: client.MediaBaseURL,
+				Highlight:    true,
+				IsContext:    true,
+
+				MembershipCollapseThreshold: config.MembershipCollapseThreshold,
+				RepeatCollapseSimilarity:    config.RepeatCollapseSimilarity,
+				RepeatCollapseMinRun:        config.RepeatCollapseMinRun,
+
+				Threads:  jobResult.Threads,
+				Receipts: jobResult.Receipts,
+				Location: parseTimezone(c),
 			})
 		})
 
+		roomRouter.GET("/thread/:rootEventID", func(c *gin.Context) {
+			worker := c.MustGet("RoomWorker").(Worker)
+			rootID := c.Param("rootEventID")
+
+			worker.Queue <- Job(RoomThreadJob{
+				c.Param("roomID"),
+				rootID,
+				c.Request.Context(),
+			})
+
+			jobResult := (<-worker.Output).(RoomEventsResp)
+			if abortIfCancelled(c) {
+				return
+			}
+			if jobResult.err == errRoomGone {
+				abortRoomGone(c)
+				return
+			}
+			if jobResult.err != nil {
+				writeRoomErrorPage(c, jobResult.err, "Thread not found", jobResult.RoomInfo)
+				return
+			}
+
+			writeRoomChatPage(c, "/room/:roomID/thread/:rootEventID", &templates.RoomChatPage{
+				Localised: localise(c),
+
+				RoomInfo:  jobResult.RoomInfo,
+				MemberMap: jobResult.MemberMap,
+				Reactions: jobResult.Reactions,
+				Polls:     jobResult.Polls,
+				Edits:     jobResult.Edits,
+				ReplyTo:   jobResult.ReplyTo,
+				Events:    mxclient.ReverseEventsCopy(jobResult.Events),
+				Anchor:    rootID,
+
+				Sanitizer:    sanitizerFn,
+				MediaBaseURL: client.MediaBaseURL,
+				ThreadRoot:   rootID,
+
+				MembershipCollapseThreshold: config.MembershipCollapseThreshold,
+				RepeatCollapseSimilarity:    config.RepeatCollapseSimilarity,
+				RepeatCollapseMinRun:        config.RepeatCollapseMinRun,
+
+				Receipts: jobResult.Receipts,
+				Location: parseTimezone(c),
+			})
+		})
+
+		roomRouter.GET("/feed.atom", func(c *gin.Context) {
+			worker := c.MustGet("RoomWorker").(Worker)
+			limit := utils.StrToIntDefault(c.DefaultQuery("limit", ""), RoomFeedDefaultSize)
+
+			worker.Queue <- Job(RoomEventsJob{
+				c.Param("roomID"),
+				"",
+				0,
+				utils.Bound(1, limit, RoomFeedMaxSize),
+				c.Request.Context(),
+			})
+
+			jobResult := (<-worker.Output).(RoomEventsResp)
+			if abortIfCancelled(c) {
+				return
+			}
+			if jobResult.err == errRoomGone {
+				abortRoomGone(c)
+				return
+			}
+			if jobResult.err != nil {
+				c.AbortWithError(http.StatusInternalServerError, jobResult.err)
+				return
+			}
+
+			// The limit applies to the events fetched, of which only messages make it into the feed.
+			messages := make([]mxclient.Event, 0, len(jobResult.Events))
+			for _, event := range jobResult.Events {
+				if event.Type == "m.room.message" {
+					messages = append(messages, event)
+				}
+			}
+
+			c.Header("Content-Type", "application/atom+xml; charset=utf-8")
+			feed := &templates.RoomFeed{
+				RoomInfo:  jobResult.RoomInfo,
+				MemberMap: jobResult.MemberMap,
+				Events:    messages,
+				BaseURL:   publicBaseURL(c, config.PublicServePrefix),
+				Sanitizer: sanitizerFn,
+			}
+			feed.WriteFeed(c.Writer)
+		})
+
 		const RoomServersPageSize = 30
 
 		roomRouter.GET("/servers", func(c *gin.Context) {
@@ -281,7 +767,13 @@ func main() {
 				RoomServersPageSize,
 			}
 
-			jobResult := templates.RoomServersPage((<-worker.Output).(RoomServersResp))
+			resp := (<-worker.Output).(RoomServersResp)
+			if resp.err == errRoomGone {
+				abortRoomGone(c)
+				return
+			}
+
+			jobResult := resp.RoomServersPage
 			templates.WritePageTemplate(c.Writer, &jobResult)
 
 			/*
@@ -303,7 +795,13 @@ func main() {
 				RoomAliasesPageSize,
 			}
 
-			jobResult := templates.RoomAliasesPage((<-worker.Output).(RoomAliasesResp))
+			resp := (<-worker.Output).(RoomAliasesResp)
+			if resp.err == errRoomGone {
+				abortRoomGone(c)
+				return
+			}
+
+			jobResult := resp.RoomAliasesPage
 			templates.WritePageTemplate(c.Writer, &jobResult)
 		})
 
@@ -311,11 +809,21 @@ func main() {
 			worker := c.MustGet("RoomWorker").(Worker)
 			worker.Queue <- RoomMembersJob{
 				c.Param("roomID"),
-				utils.StrToIntDefault(c.DefaultQuery("page", "1"), 1),
+				utils.StrToIntDefault(c.DefaultQuery("from", "0"), 0),
 				RoomMembersPageSize,
+				parseMemberSort(c.Query("sort")),
+			}
+
+			resp := (<-worker.Output).(RoomMembersResp)
+			if resp.err == errRoomGone {
+				abortRoomGone(c)
+				return
 			}
 
-			jobResult := templates.RoomMembersPage((<-worker.Output).(RoomMembersResp))
+			jobResult := resp.RoomMembersPage
+			if config.InlineAvatarMaxBytes > 0 {
+				jobResult.InlineAvatars = inlineMemberAvatars(mediaProxy, config.InlineAvatarMaxBytes, &jobResult)
+			}
 			templates.WritePageTemplate(c.Writer, &jobResult)
 		})
 
@@ -328,7 +836,13 @@ func main() {
 
 			//c.AbortWithStatus(http.StatusNotFound)
 
-			jobResult := templates.RoomMemberInfoPage((<-worker.Output).(RoomMemberInfoResp))
+			resp := (<-worker.Output).(RoomMemberInfoResp)
+			if resp.Err == errRoomGone {
+				abortRoomGone(c)
+				return
+			}
+
+			jobResult := templates.RoomMemberInfoPage(resp)
 			templates.WritePageTemplate(c.Writer, &jobResult)
 		})
 
@@ -336,7 +850,13 @@ func main() {
 			worker := c.MustGet("RoomWorker").(Worker)
 			worker.Queue <- RoomPowerLevelsJob{c.Param("roomID")}
 
-			jobResult := templates.RoomPowerLevelsPage((<-worker.Output).(RoomPowerLevelsResp))
+			resp := (<-worker.Output).(RoomPowerLevelsResp)
+			if resp.err == errRoomGone {
+				abortRoomGone(c)
+				return
+			}
+
+			jobResult := resp.RoomPowerLevelsPage
 			templates.WritePageTemplate(c.Writer, &jobResult)
 		})
 	}
@@ -346,43 +866,210 @@ func main() {
 		port = "8000"
 	}
 
-	go startForwardPaginator(workers)
-	go startPublicRoomListTimer(worldReadableRooms)
+	ctx, cancel := context.WithCancel(context.Background())
+	forwardPaginatorDone := make(chan struct{})
+	go func() {
+		startForwardPaginator(ctx, workers)
+		close(forwardPaginatorDone)
+	}()
+	go startPublicRoomListTimer(ctx, worldReadableRooms)
+	if client.DiscoversHomeserver() {
+		go startHomeserverDiscoveryTimer(ctx, client)
+	}
 	log.Info("Listening on port " + port)
 
 	srv := &http.Server{
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		IdleTimeout:  60 * time.Second,
-		Handler:      router,
+		ReadTimeout:  config.ReadTimeout,
+		WriteTimeout: config.WriteTimeout,
+		IdleTimeout:  config.IdleTimeout,
+		Handler:      withResponseControllers(router),
 		Addr:         ":" + port,
 	}
 
-	log.Fatal(srv.ListenAndServe())
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	reloads := make(chan os.Signal, 1)
+	signal.Notify(reloads, syscall.SIGHUP)
+	go func() {
+		for range reloads {
+			if err := roomBlocklist.Load(); err != nil {
+				log.WithError(err).Error("Unable to reload Room Blocklist")
+			}
+			if err := roomAllowlist.Load(); err != nil {
+				log.WithError(err).Error("Unable to reload Room Allowlist")
+			}
+			if err := featuredRooms.Load(); err != nil {
+				log.WithError(err).Error("Unable to reload Featured Rooms")
+			}
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	log.WithField("signal", <-signals).Info("Shutting down")
+	shutdown(srv, config.ShutdownTimeout, cancel, forwardPaginatorDone)
+}
+
+// publicBaseURL returns the absolute URL (with trailing slash) the public routes are being served under.
+func publicBaseURL(c *gin.Context, publicServePrefix string) string {
+	scheme := "http"
+	if c.Request.TLS != nil || c.Request.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + publicBasePath(publicServePrefix)
+}
+
+// publicBasePath returns the path the public routes are served under, with leading & trailing slashes.
+func publicBasePath(publicServePrefix string) string {
+	basePath := path.Join("/", publicServePrefix)
+	if basePath != "/" {
+		basePath += "/"
+	}
+	return basePath
+}
+
+// localise selects the language to render the page in from ?lang= or the Accept-Language header.
+func localise(c *gin.Context) templates.Localised {
+	c.Header("Vary", "Accept-Language")
+	return templates.Localised{Printer: i18n.NewPrinter(i18n.Detect(c.Request.Header.Get("Accept-Language"), c.Query("lang")))}
+}
+
+// writeRoomErrorPage renders the error of loading events of the room, 404 with notFound if the event asked for is
+// unknown and otherwise 502 as the homeserver failed us, so that the page is never cached in place of the room.
+func writeRoomErrorPage(c *gin.Context, err error, notFound string, roomInfo mxclient.RoomInfo) {
+	errText := "Some error has occurred"
+	if err == mxclient.ErrEventNotFound {
+		c.Status(http.StatusNotFound)
+		errText = notFound
+	} else {
+		c.Status(http.StatusBadGateway)
+	}
+	templates.WritePageTemplate(c.Writer, &templates.RoomErrorPage{
+		Error:    errText,
+		RoomInfo: roomInfo,
+	})
+}
+
+// serveReady answers readiness probes, which fail while there are no rooms to list. The room list is loaded before we
+// start listening, but it may have come back empty.
+func serveReady(worldReadableRooms *mxclient.WorldReadableRooms) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if worldReadableRooms.Len() == 0 {
+			c.String(http.StatusServiceUnavailable, "No rooms available")
+			return
+		}
+		c.String(http.StatusOK, "OK")
+	}
+}
+
+// parseJumpDate parses an ISO-8601 date or RFC 3339 timestamp into unix millis.
+// A bare date refers to the end of that day so that jumping to it shows the messages sent on it.
+func parseJumpDate(str string) (int, error) {
+	t, err := time.Parse("2006-01-02", str)
+	if err == nil {
+		t = t.Add(24*time.Hour - time.Millisecond)
+	} else if t, err = time.Parse(time.RFC3339, str); err != nil {
+		return 0, err
+	}
+	return int(t.UnixNano() / int64(time.Millisecond)), nil
+}
+
+// inlineMemberAvatars returns data: URIs of the avatars of the members listed on page of at most maxBytes, keyed by mxc.
+func inlineMemberAvatars(mediaProxy *mediaproxy.Proxy, maxBytes int, page *templates.RoomMembersPage) map[string]string {
+	var mxcs []mxclient.MXCURL
+	for _, group := range [][]mxclient.MemberInfo{page.Admins, page.Moderators, page.Others} {
+		for _, member := range group {
+			mxcs = append(mxcs, member.AvatarURL)
+		}
+	}
+	params := mediaproxy.ThumbnailParams{Width: templates.MemberAvatarSize, Height: templates.MemberAvatarSize, Method: "crop"}
+	return mediaProxy.InlineThumbnails(mxcs, params, maxBytes)
+}
+
+// parseMemberSort returns the order members are to be listed in per ?sort=, by name unless it names another.
+func parseMemberSort(sortBy string) string {
+	switch sortBy {
+	case mxclient.MemberSortJoined, mxclient.MemberSortActive:
+		return sortBy
+	}
+	return mxclient.MemberSortName
+}
+
+// parsePageSize returns how many events a room page is to show per ?limit=, clamped to those we allow, or defaultSize if
+// it is absent. explicit is whether it was given, so that it is carried through the pagination links.
+func parsePageSize(c *gin.Context, defaultSize int) (pageSize int, explicit bool) {
+	limit, explicit := c.GetQuery("limit")
+	if !explicit {
+		return defaultSize, false
+	}
+	return utils.Bound(RoomTimelineMinSize, utils.StrToIntDefault(limit, defaultSize), RoomTimelineMaxSize), true
+}
+
+// parseTimezone returns the IANA timezone named by ?tz=, nil (meaning UTC) if it is absent or unknown.
+func parseTimezone(c *gin.Context) *time.Location {
+	name := c.Query("tz")
+	// LoadLocation takes "" to mean UTC and "Local" to mean our own timezone, which is not for the client to pick.
+	if name == "" || name == "Local" {
+		return nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil
+	}
+	return location
 }
 
 const LoadPublicRoomsPeriod = time.Hour
 
-func startPublicRoomListTimer(worldReadableRooms *mxclient.WorldReadableRooms) {
+func startPublicRoomListTimer(ctx context.Context, worldReadableRooms *mxclient.WorldReadableRooms) {
 	t := time.NewTicker(LoadPublicRoomsPeriod)
+	defer t.Stop()
 	for {
-		<-t.C
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
 		log.Info("Reloading public room list")
 		worldReadableRooms.Update()
 	}
 }
 
+// DiscoverHomeserverPeriod is how often the .well-known of the configured server name is resolved afresh.
+const DiscoverHomeserverPeriod = time.Hour
+
+func startHomeserverDiscoveryTimer(ctx context.Context, client *mxclient.Client) {
+	t := time.NewTicker(DiscoverHomeserverPeriod)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		client.RediscoverHomeserver()
+	}
+}
+
 const LazyForwardPaginateRooms = 2 * time.Minute
 
-func startForwardPaginator(workers *Workers) {
-	//t := time.NewTicker(LazyForwardPaginateRooms)
+// startForwardPaginator forward paginates all loaded rooms periodically until ctx is cancelled,
+// an iteration already in progress is always allowed to finish.
+func startForwardPaginator(ctx context.Context, workers *Workers) {
 	wg := sync.WaitGroup{}
 	for {
-		//<-t.C
-		time.Sleep(LazyForwardPaginateRooms)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(LazyForwardPaginateRooms):
+		}
 		wg.Add(int(workers.numWorkers))
 		log.Info("Forward paginating all loaded rooms")
-		workers.JobForAllWorkers(RoomForwardPaginateJob{&wg})
+		workers.JobForAllWorkers(RoomForwardPaginateJob{ctx, &wg})
 		wg.Wait()
 	}
 }
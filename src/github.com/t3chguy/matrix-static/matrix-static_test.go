@@ -0,0 +1,174 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/t3chguy/matrix-static/mxclient"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestQueryContext returns the context of a request for path, whose query is parsed by the helpers under test.
+func newTestQueryContext(path string) *gin.Context {
+	return &gin.Context{Request: httptest.NewRequest(http.MethodGet, path, nil)}
+}
+
+func TestParsePageSize(t *testing.T) {
+	tests := []struct {
+		name         string
+		path         string
+		wantSize     int
+		wantExplicit bool
+	}{
+		{"absent", "/", 50, false},
+		{"within bounds", "/?limit=100", 100, true},
+		{"below the minimum", "/?limit=1", RoomTimelineMinSize, true},
+		{"above the maximum", "/?limit=100000", RoomTimelineMaxSize, true},
+		{"negative", "/?limit=-20", RoomTimelineMinSize, true},
+		{"non-numeric", "/?limit=lots", 50, true},
+		{"empty", "/?limit=", 50, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			size, explicit := parsePageSize(newTestQueryContext(test.path), 50)
+			if size != test.wantSize || explicit != test.wantExplicit {
+				t.Errorf("got %d, %v, want %d, %v", size, explicit, test.wantSize, test.wantExplicit)
+			}
+		})
+	}
+}
+
+func TestParseTimezone(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want string // "" meaning nil, for UTC
+	}{
+		{"absent", "/", ""},
+		{"empty", "/?tz=", ""},
+		{"a known zone", "/?tz=Europe%2FBerlin", "Europe/Berlin"},
+		{"an unknown zone", "/?tz=Mars%2FOlympus_Mons", ""},
+		{"a path outside the zone database", "/?tz=..%2F..%2Fetc%2Fpasswd", ""},
+		{"our own zone", "/?tz=Local", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			location := parseTimezone(newTestQueryContext(test.path))
+			if test.want == "" {
+				if location != nil {
+					t.Errorf("got %v, want nil", location)
+				}
+			} else if location == nil || location.String() != test.want {
+				t.Errorf("got %v, want %s", location, test.want)
+			}
+		})
+	}
+}
+
+func TestParseJumpDate(t *testing.T) {
+	tests := []struct {
+		date    string
+		want    time.Time
+		wantErr bool
+	}{
+		// a day runs to its last millisecond so that its messages are all before the point jumped to.
+		{"2021-03-04", time.Date(2021, 3, 4, 23, 59, 59, int(999*time.Millisecond), time.UTC), false},
+		{"2021-03-04T12:30:00Z", time.Date(2021, 3, 4, 12, 30, 0, 0, time.UTC), false},
+		{"2021-03-04T12:30:00+02:00", time.Date(2021, 3, 4, 10, 30, 0, 0, time.UTC), false},
+		{"4 March 2021", time.Time{}, true},
+		{"2021-13-01", time.Time{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.date, func(t *testing.T) {
+			got, err := parseJumpDate(test.date)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error = %v", err, test.wantErr)
+			}
+			if want := int(test.want.UnixNano() / int64(time.Millisecond)); !test.wantErr && got != want {
+				t.Errorf("got %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestParseMemberSort(t *testing.T) {
+	for sortBy, want := range map[string]string{
+		"":       mxclient.MemberSortName,
+		"name":   mxclient.MemberSortName,
+		"joined": mxclient.MemberSortJoined,
+		"active": mxclient.MemberSortActive,
+		"Joined": mxclient.MemberSortName,
+		"power":  mxclient.MemberSortName,
+	} {
+		if got := parseMemberSort(sortBy); got != want {
+			t.Errorf("parseMemberSort(%q) = %q, want %q", sortBy, got, want)
+		}
+	}
+}
+
+func TestPublicBasePath(t *testing.T) {
+	for prefix, want := range map[string]string{
+		"":          "/",
+		"/":         "/",
+		"archive":   "/archive/",
+		"/archive":  "/archive/",
+		"/archive/": "/archive/",
+		"/a//b/":    "/a/b/",
+	} {
+		if got := publicBasePath(prefix); got != want {
+			t.Errorf("publicBasePath(%q) = %q, want %q", prefix, got, want)
+		}
+	}
+}
+
+func TestPublicBaseURL(t *testing.T) {
+	c := newTestQueryContext("/")
+	c.Request.Host = "archive.example.org"
+	if got, want := publicBaseURL(c, "/archive"), "http://archive.example.org/archive/"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	c.Request.Header.Set("X-Forwarded-Proto", "https")
+	if got, want := publicBaseURL(c, ""), "https://archive.example.org/"; got != want {
+		t.Errorf("got %s behind a TLS terminating proxy, want %s", got, want)
+	}
+}
+
+func TestServeReady(t *testing.T) {
+	directory := `{"chunk":[{"room_id":"!private:example.org","world_readable":false}]}`
+	client := newTestClient(t, homeserverRoute{suffix: "/publicRooms", handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(directory))
+	}})
+	worldReadableRooms := client.NewWorldReadableRooms()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/ready", serveReady(worldReadableRooms))
+
+	// rooms which are not world readable are not ours to list.
+	if w := getRoomPage(router, "/ready", ""); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("got %d without rooms to list, want 503", w.Code)
+	}
+
+	directory = `{"chunk":[{"room_id":"!public:example.org","world_readable":true}]}`
+	if err := worldReadableRooms.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if w := getRoomPage(router, "/ready", ""); w.Code != http.StatusOK || w.Body.String() != "OK" {
+		t.Errorf("got %d %q once there are rooms to list, want 200 OK", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mediaproxy
+
+import (
+	"container/list"
+	"sync"
+)
+
+type Media struct {
+	ContentType        string
+	ContentDisposition string
+	// LastModified is as the media repository sent it, if at all.
+	LastModified string
+	Body         []byte
+}
+
+type cacheEntry struct {
+	key   string
+	media *Media
+}
+
+// Cache is an LRU cache of Media bounded by the total size of the bodies it holds.
+type Cache struct {
+	mutex    sync.Mutex
+	maxBytes int
+	numBytes int
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+// NewCache instantiates a Cache which will hold at most maxBytes of Media.
+func NewCache(maxBytes int) *Cache {
+	return &Cache{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// Get returns the Media stored under key if any, marking it as most recently used.
+func (c *Cache) Get(key string) (*Media, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		return el.Value.(*cacheEntry).media, true
+	}
+	return nil, false
+}
+
+// Add stores media under key, evicting the least recently used Media until it fits.
+// Media larger than the whole budget is not stored.
+func (c *Cache) Add(key string, media *Media) {
+	size := len(media.Body)
+	if size > c.maxBytes {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.numBytes -= len(el.Value.(*cacheEntry).media.Body)
+		c.ll.Remove(el)
+		delete(c.items, key)
+	}
+
+	for c.numBytes+size > c.maxBytes {
+		c.removeOldest()
+	}
+
+	c.items[key] = c.ll.PushFront(&cacheEntry{key, media})
+	c.numBytes += size
+}
+
+func (c *Cache) removeOldest() {
+	el := c.ll.Back()
+	if el == nil {
+		return
+	}
+
+	entry := c.ll.Remove(el).(*cacheEntry)
+	delete(c.items, entry.key)
+	c.numBytes -= len(entry.media.Body)
+}
+
+// Len returns the number of Media currently held.
+func (c *Cache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.ll.Len()
+}
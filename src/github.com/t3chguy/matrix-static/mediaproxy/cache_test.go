@@ -0,0 +1,57 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mediaproxy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCache(t *testing.T) {
+	c := NewCache(10)
+	media := func(size int) *Media { return &Media{Body: []byte(strings.Repeat("x", size))} }
+
+	tests := []struct {
+		name    string
+		add     string
+		size    int
+		wantHit []string
+		wantLen int
+	}{
+		{"added media is held", "a", 4, []string{"a"}, 1},
+		// hits are looked up in order, so the last of them is the most recently used.
+		{"more is held within the budget", "b", 4, []string{"b", "a"}, 2},
+		{"the least recently used is evicted to fit", "c", 4, []string{"a", "c"}, 2},
+		{"replacing media frees its size", "c", 6, []string{"a", "c"}, 2},
+		{"media larger than the budget is not held", "d", 11, []string{"a", "c"}, 2},
+		{"media of the whole budget evicts everything else", "e", 10, []string{"e"}, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c.Add(test.add, media(test.size))
+			for _, key := range test.wantHit {
+				if _, ok := c.Get(key); !ok {
+					t.Errorf("Get(%q) missed", key)
+				}
+			}
+			if c.Len() != test.wantLen {
+				t.Errorf("Len() = %d, want %d", c.Len(), test.wantLen)
+			}
+			if c.numBytes > c.maxBytes {
+				t.Errorf("holding %d bytes, more than the %d allowed", c.numBytes, c.maxBytes)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mediaproxy
+
+import (
+	"encoding/base64"
+	"github.com/t3chguy/matrix-static/mxclient"
+	"mime"
+	"sync"
+)
+
+// InlineConcurrency is how many thumbnails InlineThumbnails may be fetching at once.
+const InlineConcurrency = 8
+
+// inlineTypes are the image types which may be inlined, others (e.g. SVG) are left to be served by the proxy.
+var inlineTypes = map[string]bool{
+	"image/gif":  true,
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/webp": true,
+}
+
+// dataURI returns media as a data: URI if it is an image which may be inlined of at most maxBytes.
+func dataURI(media *Media, maxBytes int) (string, bool) {
+	if len(media.Body) > maxBytes {
+		return "", false
+	}
+	contentType, _, err := mime.ParseMediaType(media.ContentType)
+	if err != nil || !inlineTypes[contentType] {
+		return "", false
+	}
+	return "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(media.Body), true
+}
+
+// InlineThumbnails returns data: URIs of the thumbnails of those of mxcs which are images of at most maxBytes, keyed
+// by mxc, so that they may be embedded in a page rather than each requested from the proxy. Those missing from the
+// result could not be fetched or are too large, and should be linked via the proxy as usual.
+func (p *Proxy) InlineThumbnails(mxcs []mxclient.MXCURL, params ThumbnailParams, maxBytes int) map[string]string {
+	var mu sync.Mutex
+	inlined := make(map[string]string)
+	if maxBytes <= 0 {
+		return inlined
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, InlineConcurrency)
+	seen := make(map[string]bool)
+	for i := range mxcs {
+		serverName, mediaID, ok := mxcs[i].Split()
+		mxc := mxcs[i].MXC()
+		if !ok || seen[mxc] {
+			continue
+		}
+		seen[mxc] = true
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			media, err := p.FetchThumbnail(serverName, mediaID, params, nil)
+			if err != nil {
+				return
+			}
+			if uri, ok := dataURI(media, maxBytes); ok {
+				mu.Lock()
+				inlined[mxc] = uri
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return inlined
+}
@@ -0,0 +1,83 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mediaproxy
+
+import (
+	"github.com/t3chguy/matrix-static/mxclient"
+	"reflect"
+	"testing"
+)
+
+func TestDataURI(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		maxBytes    int
+		want        string
+		wantOK      bool
+	}{
+		{"png", "image/png", "png", 10, "data:image/png;base64,cG5n", true},
+		{"parameters are dropped", "image/jpeg; charset=binary", "jpg", 10, "data:image/jpeg;base64,anBn", true},
+		{"at most maxBytes", "image/png", "png", 3, "data:image/png;base64,cG5n", true},
+		{"too large", "image/png", "png", 2, "", false},
+		{"svg may script", "image/svg+xml", "<svg/>", 10, "", false},
+		{"not an image", "text/html", "<b>", 10, "", false},
+		{"malformed type", "image/png; =", "png", 10, "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := dataURI(&Media{ContentType: test.contentType, Body: []byte(test.body)}, test.maxBytes)
+			if got != test.want || ok != test.wantOK {
+				t.Errorf("dataURI() = %q, %v, want %q, %v", got, ok, test.want, test.wantOK)
+			}
+		})
+	}
+}
+
+func TestInlineThumbnails(t *testing.T) {
+	p, _, numRequests := newTestProxy(t, serveTestMedia)
+	params := ThumbnailParams{32, 32, "crop"}
+	mxcs := []mxclient.MXCURL{
+		*mxclient.NewMXCURL("mxc://example.org/image", ""),
+		*mxclient.NewMXCURL("mxc://example.org/image", ""),
+		*mxclient.NewMXCURL("mxc://example.org/page", ""),
+		*mxclient.NewMXCURL("mxc://example.org/missing", ""),
+		*mxclient.NewMXCURL("not an mxc", ""),
+	}
+
+	tests := []struct {
+		name     string
+		maxBytes int
+		want     map[string]string
+	}{
+		{"disabled", 0, map[string]string{}},
+		{"images which fit are inlined once", 1024,
+			map[string]string{"mxc://example.org/image": "data:image/png;base64,iVBORw0KGgoAAAANSUhEUg=="}},
+		{"images which do not fit are left be", 4, map[string]string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := p.InlineThumbnails(mxcs, params, test.maxBytes); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("InlineThumbnails() = %v, want %v", got, test.want)
+			}
+		})
+	}
+	// the thumbnails of the image, page & missing media are each requested once, then only the missing one again, as
+	// those which were found are cached; the invalid mxc is never requested.
+	if got := *numRequests; got != 4 {
+		t.Errorf("the media repository had %d requests, want 4", got)
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mediaproxy
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/t3chguy/matrix-static/mxclient"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// MaxMediaSize is the largest media we will buffer, anything larger is redirected to the media repository instead.
+const MaxMediaSize = 32 * 1024 * 1024
+
+// CacheMaxAge is how long clients may cache media for, media at an mxc never changes.
+const CacheMaxAge = 30 * 24 * 60 * 60
+
+var ErrNotFound = errors.New("media not found")
+var ErrTooLarge = errors.New("media too large to proxy")
+
+// ErrNotModified is returned when the media repository confirms the client has the media already.
+var ErrNotModified = errors.New("media not modified")
+
+type Proxy struct {
+	client *mxclient.Client
+	cache  *Cache
+}
+
+// NewProxy instantiates a Proxy for the media repository of client, caching up to cacheBytes of media.
+func NewProxy(client *mxclient.Client, cacheBytes int) *Proxy {
+	return &Proxy{client, NewCache(cacheBytes)}
+}
+
+// Fetch returns the media at mxc://serverName/mediaID, from the cache if possible, otherwise conditionally upon
+// validators, the headers of the client's request, if any.
+func (p *Proxy) Fetch(serverName, mediaID string, validators http.Header) (*Media, error) {
+	return p.fetch(serverName+"/"+mediaID, func() (*http.Response, error) {
+		return p.client.DownloadMedia(serverName, mediaID, validators)
+	})
+}
+
+// fetch returns the media cached under key, otherwise the media returned by request which is then cached.
+func (p *Proxy) fetch(key string, request func() (*http.Response, error)) (*Media, error) {
+	if media, ok := p.cache.Get(key); ok {
+		return media, nil
+	}
+
+	resp, err := request()
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		return nil, ErrNotModified
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		return nil, errors.New("media repository responded with " + resp.Status)
+	case resp.ContentLength > MaxMediaSize:
+		return nil, ErrTooLarge
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, MaxMediaSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > MaxMediaSize {
+		return nil, ErrTooLarge
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" || contentType == "application/octet-stream" {
+		contentType = http.DetectContentType(body)
+	}
+
+	media := &Media{
+		ContentType:        contentType,
+		ContentDisposition: resp.Header.Get("Content-Disposition"),
+		LastModified:       resp.Header.Get("Last-Modified"),
+		Body:               body,
+	}
+	p.cache.Add(key, media)
+	return media, nil
+}
+
+// isImageRequest returns whether the request appears to come from an <img> element.
+func isImageRequest(r *http.Request) bool {
+	if dest := r.Header.Get("Sec-Fetch-Dest"); dest != "" {
+		return dest == "image"
+	}
+	return strings.HasPrefix(r.Header.Get("Accept"), "image/")
+}
+
+// isInlineType returns whether the content type is safe to be displayed inline from our origin.
+func isInlineType(contentType string) bool {
+	return strings.HasPrefix(contentType, "image/") ||
+		strings.HasPrefix(contentType, "audio/") ||
+		strings.HasPrefix(contentType, "video/")
+}
+
+// mediaETag returns the strong ETag of the media cached under key, which is derived from the key alone as the media
+// at an mxc never changes, so that clients with it can be answered without fetching it.
+func mediaETag(key string) string {
+	hash := sha1.Sum([]byte(key))
+	return `"` + hex.EncodeToString(hash[:]) + `"`
+}
+
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if candidate = strings.TrimSpace(candidate); candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// setCacheHeaders sets the headers shared by media & 304 Not Modified responses for it.
+func setCacheHeaders(c *gin.Context, etag string) {
+	header := c.Writer.Header()
+	header.Set("ETag", etag)
+	header.Set("Cache-Control", "public, max-age="+strconv.Itoa(CacheMaxAge))
+}
+
+// notModified answers 304 Not Modified if the client already has the media with etag, returning whether it did.
+func notModified(c *gin.Context, etag string) bool {
+	if !etagMatches(c.Request.Header.Get("If-None-Match"), etag) {
+		return false
+	}
+	setCacheHeaders(c, etag)
+	c.AbortWithStatus(http.StatusNotModified)
+	return true
+}
+
+// Handler serves media for routes with :serverName and :mediaID params.
+func (p *Proxy) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serverName, mediaID := c.Param("serverName"), c.Param("mediaID")
+		etag := mediaETag(serverName + "/" + mediaID)
+		if notModified(c, etag) {
+			return
+		}
+
+		media, err := p.Fetch(serverName, mediaID, c.Request.Header)
+		p.respond(c, serverName, mediaID, etag, media, err)
+	}
+}
+
+// respond serves media as etag or the response appropriate for err encountered fetching mxc://serverName/mediaID.
+func (p *Proxy) respond(c *gin.Context, serverName, mediaID, etag string, media *Media, err error) {
+	switch err {
+	case nil:
+		serveMedia(c, etag, media)
+	case ErrNotModified:
+		setCacheHeaders(c, etag)
+		c.AbortWithStatus(http.StatusNotModified)
+	case ErrNotFound, mxclient.ErrInvalidMXC:
+		c.AbortWithStatus(http.StatusNotFound)
+	case ErrTooLarge:
+		c.Redirect(http.StatusTemporaryRedirect, mxclient.NewMXCURL("mxc://"+serverName+"/"+mediaID, p.client.MediaBaseURL).ToURL())
+	default:
+		log.WithError(err).WithField("mxc", serverName+"/"+mediaID).Error("Failed to proxy media")
+		c.AbortWithStatus(http.StatusBadGateway)
+	}
+}
+
+// serveMedia writes media to the response with headers preventing it from being abused against our origin.
+// Conditional requests are answered against etag and the upstream Last-Modified, if any.
+func serveMedia(c *gin.Context, etag string, media *Media) {
+	if isImageRequest(c.Request) && !strings.HasPrefix(media.ContentType, "image/") {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	setCacheHeaders(c, etag)
+	header := c.Writer.Header()
+	header.Set("X-Content-Type-Options", "nosniff")
+	// never let user uploaded content run as part of our origin.
+	header.Set("Content-Security-Policy", "sandbox; default-src 'none'")
+	disposition := media.ContentDisposition
+	if !isInlineType(media.ContentType) {
+		if strings.HasPrefix(disposition, "inline") {
+			disposition = "attachment" + strings.TrimPrefix(disposition, "inline")
+		} else if disposition == "" {
+			disposition = "attachment"
+		}
+	}
+	if disposition != "" {
+		header.Set("Content-Disposition", disposition)
+	}
+
+	header.Set("Content-Type", media.ContentType)
+
+	lastModified, _ := http.ParseTime(media.LastModified)
+	http.ServeContent(c.Writer, c.Request, "", lastModified, bytes.NewReader(media.Body))
+}
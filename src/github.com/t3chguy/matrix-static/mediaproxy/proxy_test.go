@@ -0,0 +1,210 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mediaproxy
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/t3chguy/matrix-static/mxclient"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// pngHeader is enough of a PNG for its type to be sniffed.
+const pngHeader = "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+
+const testLastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+// serveTestMedia answers for the media IDs the tests ask for as their names suggest.
+func serveTestMedia(w http.ResponseWriter, r *http.Request) {
+	header := w.Header()
+	switch path.Base(r.URL.Path) {
+	case "image":
+		header.Set("Content-Type", "image/png")
+		header.Set("Last-Modified", testLastModified)
+		w.Write([]byte(pngHeader))
+	case "sniffed":
+		header.Set("Content-Type", "application/octet-stream")
+		w.Write([]byte(pngHeader))
+	case "page":
+		header.Set("Content-Type", "text/html")
+		header.Set("Content-Disposition", `inline; filename="page.html"`)
+		w.Write([]byte("<script>alert(1)</script>"))
+	case "large":
+		header.Set("Content-Type", "video/mp4")
+		header.Set("Content-Length", strconv.Itoa(MaxMediaSize+1))
+		w.WriteHeader(http.StatusOK)
+	case "forbidden":
+		w.WriteHeader(http.StatusForbidden)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// newTestProxy returns a Proxy of a media repository answering by handler & a router serving media & thumbnails via
+// it, along with how many requests the media repository has answered.
+func newTestProxy(t *testing.T, handler http.HandlerFunc) (*Proxy, *gin.Engine, *int32) {
+	var numRequests int32
+	repo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&numRequests, 1)
+		handler(w, r)
+	}))
+	t.Cleanup(repo.Close)
+
+	client, err := mxclient.NewRawClient(repo.URL, repo.URL, "@static:example.org", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewProxy(client, 1<<20)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/media/:serverName/:mediaID", p.Handler())
+	router.GET("/thumb/:serverName/:mediaID", p.ThumbnailHandler())
+	return p, router, &numRequests
+}
+
+func getMedia(router *gin.Engine, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestProxyHandler(t *testing.T) {
+	_, router, _ := newTestProxy(t, serveTestMedia)
+
+	tests := []struct {
+		name            string
+		mediaID         string
+		header          http.Header
+		wantCode        int
+		wantType        string
+		wantDisposition string
+	}{
+		{"images are shown inline", "image", nil, http.StatusOK, "image/png", ""},
+		{"untyped media is sniffed", "sniffed", nil, http.StatusOK, "image/png", ""},
+		{"other media is downloaded", "page", nil, http.StatusOK, "text/html", `attachment; filename="page.html"`},
+		{"images must be images", "page", http.Header{"Sec-Fetch-Dest": {"image"}}, http.StatusForbidden, "", ""},
+		{"missing media", "missing", nil, http.StatusNotFound, "", ""},
+		{"media repository errors", "forbidden", nil, http.StatusBadGateway, "", ""},
+		{"media too large to proxy is redirected to", "large", nil, http.StatusTemporaryRedirect, "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := getMedia(router, "/media/example.org/"+test.mediaID, test.header)
+			if w.Code != test.wantCode {
+				t.Fatalf("got %d, want %d", w.Code, test.wantCode)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			header := w.Header()
+			if header.Get("Content-Type") != test.wantType || header.Get("Content-Disposition") != test.wantDisposition {
+				t.Errorf("served as %q, %q, want %q, %q", header.Get("Content-Type"), header.Get("Content-Disposition"),
+					test.wantType, test.wantDisposition)
+			}
+			if header.Get("X-Content-Type-Options") != "nosniff" || !strings.HasPrefix(header.Get("Content-Security-Policy"), "sandbox") {
+				t.Errorf("served without the headers sandboxing it: %v", header)
+			}
+		})
+	}
+
+	if w := getMedia(router, "/media/example.org/large", nil); !strings.HasSuffix(w.Header().Get("Location"), "/download/example.org/large") {
+		t.Errorf("media too large to proxy was redirected to %q, want the media repository", w.Header().Get("Location"))
+	}
+}
+
+func TestProxyCachesMedia(t *testing.T) {
+	_, router, numRequests := newTestProxy(t, serveTestMedia)
+
+	tests := []struct {
+		path         string
+		wantRequests int32
+	}{
+		{"/media/example.org/image", 1},
+		{"/media/example.org/image", 1},
+		{"/media/example.org/missing", 2},
+		{"/media/example.org/missing", 3},
+	}
+	for _, test := range tests {
+		getMedia(router, test.path, nil)
+		if got := atomic.LoadInt32(numRequests); got != test.wantRequests {
+			t.Errorf("after %s the media repository had %d requests, want %d", test.path, got, test.wantRequests)
+		}
+	}
+}
+
+// TestProxyConditionalRequests asserts that clients which have the media already are answered with 304, by us if we
+// can tell from its ETag or Last-Modified, otherwise by the media repository which their validators are relayed to.
+func TestProxyConditionalRequests(t *testing.T) {
+	var relayed http.Header
+	_, router, numRequests := newTestProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		relayed = r.Header
+		if r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != "" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		serveTestMedia(w, r)
+	})
+	etag := mediaETag("example.org/image")
+
+	tests := []struct {
+		name         string
+		path         string
+		header       http.Header
+		wantCode     int
+		wantRequests int32
+		wantRelayed  string
+	}{
+		{"our ETag is answered without fetching", "/media/example.org/image", http.Header{"If-None-Match": {etag}},
+			http.StatusNotModified, 0, ""},
+		{"among others", "/media/example.org/image", http.Header{"If-None-Match": {`"other", ` + etag}},
+			http.StatusNotModified, 0, ""},
+		{"thumbnails have ETags of their own", "/thumb/example.org/image", http.Header{"If-None-Match": {etag}},
+			http.StatusNotModified, 1, etag},
+		{"other validators are relayed", "/media/example.org/image", http.Header{"If-Modified-Since": {testLastModified}},
+			http.StatusNotModified, 2, ""},
+		{"unconditional requests are served & cached", "/media/example.org/image", nil, http.StatusOK, 3, ""},
+		{"cached media is compared to Last-Modified", "/media/example.org/image",
+			http.Header{"If-Modified-Since": {testLastModified}}, http.StatusNotModified, 3, ""},
+		{"and served if it has been modified since", "/media/example.org/image",
+			http.Header{"If-Modified-Since": {"Sun, 01 Jan 2006 15:04:05 GMT"}}, http.StatusOK, 3, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := getMedia(router, test.path, test.header)
+			if w.Code != test.wantCode {
+				t.Errorf("got %d, want %d", w.Code, test.wantCode)
+			}
+			if got := atomic.LoadInt32(numRequests); got != test.wantRequests {
+				t.Errorf("the media repository had %d requests, want %d", got, test.wantRequests)
+			}
+			if test.wantRelayed != "" && relayed.Get("If-None-Match") != test.wantRelayed {
+				t.Errorf("relayed If-None-Match %q, want %q", relayed.Get("If-None-Match"), test.wantRelayed)
+			}
+			if w.Code == http.StatusNotModified && (w.Header().Get("ETag") == "" || w.Header().Get("Cache-Control") == "") {
+				t.Errorf("304 is missing the caching headers of the media: %v", w.Header())
+			}
+		})
+	}
+}
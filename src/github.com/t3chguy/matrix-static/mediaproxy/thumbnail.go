@@ -0,0 +1,115 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mediaproxy
+
+import (
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/t3chguy/matrix-static/mxclient"
+	"net/http"
+	"strconv"
+)
+
+const DefaultThumbnailSize = 96
+const DefaultThumbnailMethod = "crop"
+
+// ThumbnailSizes are the only widths and heights we will request thumbnails at,
+// so that we cannot be used as an arbitrary resizing proxy.
+var ThumbnailSizes = []int{32, 48, 60, 64, 96, 128, 256, 360}
+
+var ErrInvalidThumbnailParams = errors.New("invalid thumbnail parameters")
+
+// ThumbnailParams are the validated query parameters of a thumbnail request.
+type ThumbnailParams struct {
+	Width  int
+	Height int
+	Method string
+}
+
+func parseThumbnailSize(str string) (int, error) {
+	if str == "" {
+		return DefaultThumbnailSize, nil
+	}
+
+	size, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, ErrInvalidThumbnailParams
+	}
+	for _, allowed := range ThumbnailSizes {
+		if size == allowed {
+			return size, nil
+		}
+	}
+	return 0, ErrInvalidThumbnailParams
+}
+
+// ParseThumbnailParams validates the width, height and method against the allowlist, defaulting any omitted.
+func ParseThumbnailParams(width, height, method string) (params ThumbnailParams, err error) {
+	if params.Width, err = parseThumbnailSize(width); err != nil {
+		return
+	}
+	if params.Height, err = parseThumbnailSize(height); err != nil {
+		return
+	}
+
+	switch method {
+	case "":
+		params.Method = DefaultThumbnailMethod
+	case "crop", "scale":
+		params.Method = method
+	default:
+		err = ErrInvalidThumbnailParams
+	}
+	return
+}
+
+func thumbnailKey(serverName, mediaID string, params ThumbnailParams) string {
+	return serverName + "/" + mediaID + "/" + strconv.Itoa(params.Width) + "x" + strconv.Itoa(params.Height) + "/" + params.Method
+}
+
+// FetchThumbnail returns a thumbnail of the media at mxc://serverName/mediaID, from the cache if possible, otherwise
+// conditionally upon validators, the headers of the client's request, if any.
+func (p *Proxy) FetchThumbnail(serverName, mediaID string, params ThumbnailParams, validators http.Header) (*Media, error) {
+	return p.fetch(thumbnailKey(serverName, mediaID, params), func() (*http.Response, error) {
+		return p.client.ThumbnailMedia(serverName, mediaID, params.Width, params.Height, params.Method, validators)
+	})
+}
+
+// ThumbnailHandler serves thumbnails for routes with :serverName and :mediaID params,
+// falling back to the original media if the media repository could not thumbnail it.
+func (p *Proxy) ThumbnailHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		params, err := ParseThumbnailParams(c.Query("width"), c.Query("height"), c.Query("method"))
+		if err != nil {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		serverName, mediaID := c.Param("serverName"), c.Param("mediaID")
+		// the thumbnail is what is at its URL, whether or not it had to fall back, so is what the ETag identifies.
+		etag := mediaETag(thumbnailKey(serverName, mediaID, params))
+		if notModified(c, etag) {
+			return
+		}
+
+		media, err := p.FetchThumbnail(serverName, mediaID, params, c.Request.Header)
+		if err != nil && err != ErrNotModified && err != mxclient.ErrInvalidMXC {
+			log.WithError(err).WithField("mxc", serverName+"/"+mediaID).Warn("Failed to thumbnail media, falling back")
+			media, err = p.Fetch(serverName, mediaID, c.Request.Header)
+		}
+		p.respond(c, serverName, mediaID, etag, media, err)
+	}
+}
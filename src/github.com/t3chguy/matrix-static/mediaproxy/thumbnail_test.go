@@ -0,0 +1,88 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mediaproxy
+
+import (
+	"net/http"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestParseThumbnailParams(t *testing.T) {
+	tests := []struct {
+		width, height, method string
+		want                  ThumbnailParams
+		wantErr               bool
+	}{
+		{"", "", "", ThumbnailParams{DefaultThumbnailSize, DefaultThumbnailSize, DefaultThumbnailMethod}, false},
+		{"32", "64", "scale", ThumbnailParams{32, 64, "scale"}, false},
+		{"360", "", "crop", ThumbnailParams{360, DefaultThumbnailSize, "crop"}, false},
+		{"100", "", "", ThumbnailParams{}, true},
+		{"", "-32", "", ThumbnailParams{}, true},
+		{"big", "", "", ThumbnailParams{}, true},
+		{"", "", "stretch", ThumbnailParams{}, true},
+	}
+	for _, test := range tests {
+		got, err := ParseThumbnailParams(test.width, test.height, test.method)
+		if (err != nil) != test.wantErr || !test.wantErr && got != test.want {
+			t.Errorf("ParseThumbnailParams(%q, %q, %q) = %v, %v, want %v, error %v",
+				test.width, test.height, test.method, got, err, test.want, test.wantErr)
+		}
+	}
+}
+
+func TestThumbnailHandler(t *testing.T) {
+	// only images are thumbnailed, at the size & method asked for, anything else is fetched whole.
+	_, router, _ := newTestProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.URL.Path, "/thumbnail/") {
+			serveTestMedia(w, r)
+			return
+		}
+		if path.Base(r.URL.Path) != "image" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		q := r.URL.Query()
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write([]byte("thumbnail " + q.Get("width") + "x" + q.Get("height") + " " + q.Get("method")))
+	})
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{"thumbnailed at the default size", "/thumb/example.org/image", http.StatusOK, "thumbnail 96x96 crop"},
+		{"thumbnailed as asked", "/thumb/example.org/image?width=32&height=48&method=scale", http.StatusOK,
+			"thumbnail 32x48 scale"},
+		{"falls back to the media", "/thumb/example.org/sniffed", http.StatusOK, pngHeader},
+		{"missing media", "/thumb/example.org/missing", http.StatusNotFound, ""},
+		{"sizes outside of the allowlist", "/thumb/example.org/image?width=100", http.StatusBadRequest, ""},
+		{"unknown methods", "/thumb/example.org/image?method=stretch", http.StatusBadRequest, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := getMedia(router, test.path, nil)
+			if w.Code != test.wantCode {
+				t.Fatalf("got %d, want %d", w.Code, test.wantCode)
+			}
+			if w.Code == http.StatusOK && w.Body.String() != test.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), test.wantBody)
+			}
+		})
+	}
+}
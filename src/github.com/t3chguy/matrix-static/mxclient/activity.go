@@ -0,0 +1,79 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"github.com/t3chguy/matrix-static/utils"
+	"time"
+)
+
+// ActivityDays is how many days of message counts each room keeps.
+const ActivityDays = 14
+
+const dayMillis = 24 * 60 * 60 * 1000
+
+// activity is a ring buffer of how many messages were sent on each of the ActivityDays days up to latestDay.
+type activity struct {
+	counts [ActivityDays]int
+	// latestDay is the day (since the unix epoch) counted by the newest bucket.
+	latestDay int
+}
+
+// advance moves the newest bucket on to day, emptying the buckets of the days in between.
+func (a *activity) advance(day int) {
+	if day <= a.latestDay {
+		return
+	}
+	for d := utils.Max(a.latestDay+1, day-ActivityDays+1); d <= day; d++ {
+		a.counts[d%ActivityDays] = 0
+	}
+	a.latestDay = day
+}
+
+// record counts a message sent at timestamp (unix millis), those older than the days kept are dropped.
+func (a *activity) record(timestamp int) {
+	day := timestamp / dayMillis
+	a.advance(day)
+	if day <= a.latestDay-ActivityDays {
+		return
+	}
+	a.counts[day%ActivityDays]++
+}
+
+// Counts returns how many messages were sent on each of the ActivityDays days up to and including that of now,
+// oldest first.
+func (a activity) Counts(now time.Time) []int {
+	a.advance(int(now.UnixNano()/int64(time.Millisecond)) / dayMillis)
+	counts := make([]int, ActivityDays)
+	for i := range counts {
+		counts[i] = a.counts[(a.latestDay-ActivityDays+1+i)%ActivityDays]
+	}
+	return counts
+}
+
+// observeActivity counts ev towards the activity & messages of the room if it is a message, it must only be called
+// once for each.
+func (r *Room) observeActivity(ev *Event) {
+	if ev.Type == "m.room.message" {
+		r.activity.record(ev.Timestamp)
+		r.numMessages++
+	}
+}
+
+// Activity returns how many messages we have seen sent on each of the last ActivityDays days, oldest first.
+// Only the history which has been paginated is counted, which for quiet rooms may not reach back as far.
+func (r *Room) Activity() []int {
+	return r.activity.Counts(time.Now())
+}
@@ -0,0 +1,132 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoomInfoNumMessages(t *testing.T) {
+	const (
+		message = `{"event_id":"$m%d","type":"m.room.message","sender":"@alice:example.org","origin_server_ts":1000,
+			"content":{"msgtype":"m.text","body":"hi"}}`
+		topic = `{"event_id":"$topic","type":"m.room.topic","state_key":"","sender":"@alice:example.org",
+			"origin_server_ts":1000,"content":{"topic":"Topic"}}`
+		member = `{"event_id":"$member","type":"m.room.member","state_key":"@alice:example.org",
+			"sender":"@alice:example.org","origin_server_ts":1000,"content":{"membership":"join"}}`
+		reaction = `{"event_id":"$reaction","type":"m.reaction","sender":"@alice:example.org","origin_server_ts":1000,
+			"content":{"m.relates_to":{"rel_type":"m.annotation","event_id":"$ms0","key":"👍"}}}`
+	)
+	tests := []struct {
+		name          string
+		chunk         []string
+		backpaginated []string
+		wantNum       int
+		wantAllKnown  bool
+	}{
+		{"empty room", nil, nil, 0, false},
+		{"state events are not counted", []string{member, topic, message}, nil, 1, false},
+		{"reactions are not counted", []string{message, reaction, message}, nil, 2, false},
+		{"back-paginated messages are counted", []string{message}, []string{message, topic}, 2, false},
+		{"all are known at the start of the room", []string{message}, []string{}, 1, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hs := newFakeHomeserver(t)
+			hs.handleJSON("/rooms/"+testRoomID+"/messages", http.StatusOK,
+				`{"start":"s0","end":"older","chunk":`+numberedEvents("b", test.backpaginated)+`}`)
+			room := newTestRoom(t, hs, `{"messages":{"start":"s0","end":"e0","chunk":`+numberedEvents("s", test.chunk)+`},"state":[]}`)
+			if test.backpaginated != nil {
+				if _, err := room.BackpaginateTowardsStart(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			info := room.RoomInfo()
+			if info.NumMessages != test.wantNum || info.AllMessagesKnown != test.wantAllKnown {
+				t.Errorf("NumMessages, AllMessagesKnown = %d, %v, want %d, %v", info.NumMessages, info.AllMessagesKnown,
+					test.wantNum, test.wantAllKnown)
+			}
+		})
+	}
+}
+
+// numberedEvents returns a JSON array of events, replacing the %d in their IDs by prefix & their index.
+func numberedEvents(prefix string, events []string) string {
+	numbered := make([]string, len(events))
+	for i, ev := range events {
+		numbered[i] = strings.Replace(ev, "%d", prefix+strconv.Itoa(i), 1)
+	}
+	return "[" + strings.Join(numbered, ",") + "]"
+}
+
+func TestActivityCounts(t *testing.T) {
+	now := time.Date(2021, 3, 20, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) int {
+		return int(now.AddDate(0, 0, -days).UnixNano() / int64(time.Millisecond))
+	}
+
+	var a activity
+	for _, days := range []int{0, 0, 1, 13, ActivityDays, 30} {
+		a.record(daysAgo(days))
+	}
+	want := make([]int, ActivityDays)
+	want[ActivityDays-1], want[ActivityDays-2], want[0] = 2, 1, 1
+	if got := a.Counts(now); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// days pass without messages, those counted move out of the window.
+	want = make([]int, ActivityDays)
+	want[ActivityDays-4], want[ActivityDays-3] = 1, 2
+	if got := a.Counts(now.AddDate(0, 0, 2)); !reflect.DeepEqual(got, want) {
+		t.Errorf("two days later got %v, want %v", got, want)
+	}
+	if got := a.Counts(now.AddDate(0, 1, 0)); !reflect.DeepEqual(got, make([]int, ActivityDays)) {
+		t.Errorf("a month later got %v, want none", got)
+	}
+}
+
+func TestRoomActivity(t *testing.T) {
+	day := int64(24 * time.Hour / time.Millisecond)
+	today := time.Now().UnixNano() / int64(time.Millisecond)
+	message := func(timestamp int64) string {
+		return `{"event_id":"$m%d","type":"m.room.message","sender":"@alice:example.org","origin_server_ts":` +
+			strconv.FormatInt(timestamp, 10) + `,"content":{"msgtype":"m.text","body":"hi"}}`
+	}
+	reaction := `{"event_id":"$reaction","type":"m.reaction","sender":"@alice:example.org","origin_server_ts":` +
+		strconv.FormatInt(today, 10) + `,"content":{"m.relates_to":{"rel_type":"m.annotation","event_id":"$ms0","key":"👍"}}}`
+
+	hs := newFakeHomeserver(t)
+	hs.handleJSON("/rooms/"+testRoomID+"/messages", http.StatusOK,
+		`{"start":"s0","end":"older","chunk":`+numberedEvents("b", []string{message(today - 3*day)})+`}`)
+	room := newTestRoom(t, hs, `{"messages":{"start":"s0","end":"e0","chunk":`+
+		numberedEvents("s", []string{message(today - day), reaction, message(today)})+`},"state":[]}`)
+	if _, err := room.BackpaginateTowardsStart(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := make([]int, ActivityDays)
+	want[ActivityDays-4], want[ActivityDays-2], want[ActivityDays-1] = 1, 1, 1
+	if got := room.RoomInfo().Activity; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
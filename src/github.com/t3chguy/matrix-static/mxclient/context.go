@@ -0,0 +1,59 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"context"
+	"github.com/matrix-org/gomatrix"
+	"net/http"
+)
+
+// contextTransport makes every request it round trips part of ctx, so that they are cancelled along with it.
+type contextTransport struct {
+	ctx  context.Context
+	next http.RoundTripper
+}
+
+func (t contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.next.RoundTrip(req.WithContext(t.ctx))
+}
+
+// withContext returns a gomatrix client, which knows nothing of contexts, whose requests are cancelled along with ctx,
+// e.g. once the page they are made for has run out of time to render. They also send the request ID ctx carries.
+func (m *Client) withContext(ctx context.Context) *gomatrix.Client {
+	if ctx.Done() == nil && RequestID(ctx) == "" {
+		return m.Client
+	}
+
+	httpClient := *m.Client.Client
+	next := httpClient.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	httpClient.Transport = contextTransport{ctx, next}
+	return m.withHTTPClient(&httpClient)
+}
+
+// withHTTPClient returns a gomatrix client like ours which makes its requests with httpClient.
+func (m *Client) withHTTPClient(httpClient *http.Client) *gomatrix.Client {
+	return &gomatrix.Client{
+		HomeserverURL:    m.HomeserverURL,
+		Prefix:           m.Prefix,
+		UserID:           m.UserID,
+		AccessToken:      m.AccessToken,
+		Client:           httpClient,
+		AppServiceUserID: m.AppServiceUserID,
+	}
+}
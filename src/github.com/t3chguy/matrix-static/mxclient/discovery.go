@@ -0,0 +1,169 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// WellKnownClientPath is where a server names the base URL of its homeserver, according to
+// https://spec.matrix.org/v1.6/client-server-api/#well-known-uri
+const WellKnownClientPath = "/.well-known/matrix/client"
+
+// maxWellKnownSize caps how much of a .well-known we read, real ones are a few hundred bytes.
+const maxWellKnownSize = 64 * 1024
+
+type wellKnownClient struct {
+	Homeserver struct {
+		BaseURL string `json:"base_url"`
+	} `json:"m.homeserver"`
+}
+
+type respVersions struct {
+	Versions []string `json:"versions"`
+}
+
+// DiscoverHomeserver resolves the base URL of the homeserver of serverName from its .well-known, and checks that the
+// client-server API is served there before returning it, as clients are to according to the spec.
+func DiscoverHomeserver(httpClient *http.Client, serverName string) (*url.URL, error) {
+	var wellKnown wellKnownClient
+	if err := getJSON(httpClient, "https://"+serverName+WellKnownClientPath, &wellKnown); err != nil {
+		return nil, err
+	}
+	if wellKnown.Homeserver.BaseURL == "" {
+		return nil, errors.New("no m.homeserver base_url in .well-known")
+	}
+
+	baseURL, err := url.Parse(wellKnown.Homeserver.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	if (baseURL.Scheme != "https" && baseURL.Scheme != "http") || baseURL.Host == "" {
+		return nil, fmt.Errorf("invalid m.homeserver base_url %q in .well-known", wellKnown.Homeserver.BaseURL)
+	}
+	baseURL.Path = strings.TrimRight(baseURL.Path, "/")
+	baseURL.RawPath, baseURL.RawQuery, baseURL.Fragment = "", "", ""
+
+	var versions respVersions
+	if err := getJSON(httpClient, baseURL.String()+"/_matrix/client/versions", &versions); err != nil {
+		return nil, fmt.Errorf("m.homeserver base_url %s is not a homeserver: %v", baseURL, err)
+	}
+	if len(versions.Versions) == 0 {
+		return nil, fmt.Errorf("m.homeserver base_url %s is not a homeserver: no versions supported", baseURL)
+	}
+	return baseURL, nil
+}
+
+func getJSON(httpClient *http.Client, urlStr string, v interface{}) error {
+	resp, err := httpClient.Get(urlStr)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", urlStr, resp.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxWellKnownSize)).Decode(v); err != nil {
+		return fmt.Errorf("GET %s: %v", urlStr, err)
+	}
+	return nil
+}
+
+// homeserverDiscovery sends the requests made for the fallback URL to wherever the .well-known of serverName last named
+// as its homeserver instead, so that it may move without us restarting; until it has named one, or should it never,
+// they are sent to the fallback URL as they are.
+type homeserverDiscovery struct {
+	serverName string
+	fallback   *url.URL
+	httpClient *http.Client
+	next       http.RoundTripper
+
+	baseURL atomic.Value // *url.URL
+}
+
+func newHomeserverDiscovery(serverName string, fallback *url.URL, next http.RoundTripper) *homeserverDiscovery {
+	// requests are made for paths beneath the fallback URL, which it must not end in a slash to prefix.
+	trimmed := *fallback
+	trimmed.Path = strings.TrimRight(trimmed.Path, "/")
+	fallback = &trimmed
+
+	d := &homeserverDiscovery{
+		serverName: serverName,
+		fallback:   fallback,
+		httpClient: &http.Client{Timeout: 10 * time.Second, Transport: next},
+		next:       next,
+	}
+	d.baseURL.Store(fallback)
+	return d
+}
+
+// resolve discovers the homeserver afresh, keeping the one we already have should that fail.
+func (d *homeserverDiscovery) resolve() {
+	loggerWithFields := log.WithField("serverName", d.serverName)
+
+	baseURL, err := DiscoverHomeserver(d.httpClient, d.serverName)
+	if err != nil {
+		loggerWithFields.WithError(err).WithField("homeserverURL", d.current().String()).Warn("Failed to discover Homeserver, keeping the one we have")
+		return
+	}
+
+	if previous := d.current(); previous.String() != baseURL.String() {
+		loggerWithFields.WithField("homeserverURL", baseURL.String()).Info("Discovered Homeserver")
+	}
+	d.baseURL.Store(baseURL)
+}
+
+func (d *homeserverDiscovery) current() *url.URL {
+	return d.baseURL.Load().(*url.URL)
+}
+
+func (d *homeserverDiscovery) RoundTrip(req *http.Request) (*http.Response, error) {
+	baseURL := d.current()
+	if baseURL == d.fallback || req.URL.Scheme != d.fallback.Scheme || req.URL.Host != d.fallback.Host ||
+		!strings.HasPrefix(req.URL.Path, d.fallback.Path) {
+		return d.next.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = baseURL.Scheme, baseURL.Host
+	req.URL.Path = baseURL.Path + strings.TrimPrefix(req.URL.Path, d.fallback.Path)
+	req.URL.RawPath = ""
+	req.Host = ""
+	return d.next.RoundTrip(req)
+}
+
+// DiscoversHomeserver returns whether the homeserver is found via the .well-known of the configured server name, which
+// RediscoverHomeserver should then be called periodically to follow.
+func (m *Client) DiscoversHomeserver() bool {
+	return m.discovery != nil
+}
+
+// RediscoverHomeserver resolves the .well-known of the configured server name afresh, requests are sent to wherever it
+// names from then on; should that fail they are sent to where they were.
+func (m *Client) RediscoverHomeserver() {
+	if m.discovery != nil {
+		m.discovery.resolve()
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newWellKnownServer returns the name of a server answering its .well-known with the status & body returned by
+// wellKnown, which may name its own URL by {URL}, its /_matrix/client/versions with versions & everything else with
+// whatever was asked for, along with a client trusting it.
+func newWellKnownServer(t *testing.T, wellKnown func() (int, string), versions string) (serverName string, httpClient *http.Client) {
+	var srv *httptest.Server
+	srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == WellKnownClientPath:
+			status, body := wellKnown()
+			w.WriteHeader(status)
+			io.WriteString(w, strings.Replace(body, "{URL}", srv.URL, -1))
+		case strings.HasSuffix(r.URL.Path, "/_matrix/client/versions"):
+			io.WriteString(w, versions)
+		default:
+			io.WriteString(w, r.URL.Path)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "https://"), srv.Client()
+}
+
+func TestDiscoverHomeserver(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		wellKnown string
+		versions  string
+		want      string
+		wantErr   bool
+	}{
+		{"found", http.StatusOK, `{"m.homeserver":{"base_url":"{URL}"}}`, `{"versions":["v1.6"]}`, "{URL}", false},
+		{"trailing slash, query & fragment are dropped", http.StatusOK,
+			`{"m.homeserver":{"base_url":"{URL}/matrix/?a=b#c"}}`, `{"versions":["v1.6"]}`, "{URL}/matrix", false},
+		{"missing", http.StatusNotFound, `{"errcode":"M_NOT_FOUND"}`, `{"versions":["v1.6"]}`, "", true},
+		{"malformed", http.StatusOK, `{"m.homeserver":`, `{"versions":["v1.6"]}`, "", true},
+		{"no m.homeserver", http.StatusOK, `{"m.identity_server":{"base_url":"{URL}"}}`, `{"versions":["v1.6"]}`, "", true},
+		{"base_url is not a URL", http.StatusOK, `{"m.homeserver":{"base_url":"example.org"}}`, `{"versions":["v1.6"]}`, "", true},
+		{"base_url is not a homeserver", http.StatusOK, `{"m.homeserver":{"base_url":"{URL}"}}`, `not json`, "", true},
+		{"base_url supports no versions", http.StatusOK, `{"m.homeserver":{"base_url":"{URL}"}}`, `{"versions":[]}`, "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			serverName, httpClient := newWellKnownServer(t, func() (int, string) { return test.status, test.wellKnown }, test.versions)
+			want := strings.Replace(test.want, "{URL}", "https://"+serverName, -1)
+
+			baseURL, err := DiscoverHomeserver(httpClient, serverName)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("DiscoverHomeserver() error = %v, want error %v", err, test.wantErr)
+			}
+			if err == nil && baseURL.String() != want {
+				t.Errorf("DiscoverHomeserver() = %s, want %s", baseURL, want)
+			}
+		})
+	}
+}
+
+// TestHomeserverDiscovery asserts that requests for the fallback URL are sent to the homeserver last discovered,
+// which is kept should the .well-known later go missing or be malformed.
+func TestHomeserverDiscovery(t *testing.T) {
+	var mutex sync.Mutex
+	status, wellKnown := http.StatusNotFound, ""
+	serverName, httpClient := newWellKnownServer(t, func() (int, string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return status, wellKnown
+	}, `{"versions":["v1.6"]}`)
+
+	// the fallback is never listened on, requests are only to reach it before anything is discovered.
+	fallback, _ := url.Parse("https://fallback.invalid/prefix/")
+	d := newHomeserverDiscovery(serverName, fallback, httpClient.Transport)
+	d.httpClient = httpClient
+
+	tests := []struct {
+		name      string
+		status    int
+		wellKnown string
+		wantPath  string
+	}{
+		{"nothing discovered goes to the fallback", http.StatusNotFound, "", ""},
+		{"discovered", http.StatusOK, `{"m.homeserver":{"base_url":"{URL}/discovered/"}}`, "/discovered/_matrix/client/sync"},
+		{"moved", http.StatusOK, `{"m.homeserver":{"base_url":"{URL}/moved"}}`, "/moved/_matrix/client/sync"},
+		{"kept once missing", http.StatusNotFound, "", "/moved/_matrix/client/sync"},
+		{"kept once malformed", http.StatusOK, `{"m.homeserver":`, "/moved/_matrix/client/sync"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mutex.Lock()
+			status, wellKnown = test.status, test.wellKnown
+			mutex.Unlock()
+			d.resolve()
+
+			req, _ := http.NewRequest(http.MethodGet, "https://fallback.invalid/prefix/_matrix/client/sync", nil)
+			resp, err := d.RoundTrip(req)
+			if test.wantPath == "" {
+				if err == nil {
+					resp.Body.Close()
+					t.Errorf("request reached %s, want it sent to the unreachable fallback", resp.Request.URL)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if body, _ := io.ReadAll(resp.Body); string(body) != test.wantPath {
+				t.Errorf("request reached %q, want %q", body, test.wantPath)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"sort"
+	"strings"
+)
+
+// The state event types of image packs (MSC2545), under the unstable type which was in use long before its stable one.
+const (
+	imagePackEventType         = "m.image_pack"
+	unstableImagePackEventType = "im.ponies.room_emotes"
+)
+
+// hasEmoticonUsage returns whether the usage of an image or pack allows it as an emoticon, which if unset it does.
+func hasEmoticonUsage(content map[string]interface{}) bool {
+	usage, ok := content["usage"].([]interface{})
+	if !ok || len(usage) == 0 {
+		return true
+	}
+	for _, u := range usage {
+		if u == "emoticon" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseImagePack returns the mxc of each emoticon of the image pack by its shortcode, without the colons around it.
+// Packs predating MSC2545 list their shortcodes with colons under "emoticons", or just their urls under "short".
+func parseImagePack(content map[string]interface{}) map[string]string {
+	emotes := make(map[string]string)
+
+	packUsage := true
+	if pack, ok := content["pack"].(map[string]interface{}); ok {
+		packUsage = hasEmoticonUsage(pack)
+	}
+	if images, ok := content["images"].(map[string]interface{}); ok {
+		for shortcode, image := range images {
+			image, ok := image.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if _, hasUsage := image["usage"]; hasUsage && !hasEmoticonUsage(image) || !hasUsage && !packUsage {
+				continue
+			}
+			if url, ok := image["url"].(string); ok {
+				emotes[shortcode] = url
+			}
+		}
+	}
+
+	if emoticons, ok := content["emoticons"].(map[string]interface{}); ok {
+		for shortcode, emoticon := range emoticons {
+			if emoticon, ok := emoticon.(map[string]interface{}); ok {
+				if url, ok := emoticon["url"].(string); ok {
+					emotes[strings.Trim(shortcode, ":")] = url
+				}
+			}
+		}
+	}
+	if short, ok := content["short"].(map[string]interface{}); ok {
+		for shortcode, url := range short {
+			if url, ok := url.(string); ok {
+				emotes[strings.Trim(shortcode, ":")] = url
+			}
+		}
+	}
+
+	for shortcode, url := range emotes {
+		if shortcode == "" || !NewMXCURL(url, "").IsValid() {
+			delete(emotes, shortcode)
+		}
+	}
+	return emotes
+}
+
+// Emotes returns the mxc of each emoticon of the room's image packs by shortcode, where packs share a shortcode those
+// of the stable type win, otherwise that of the last pack by state key.
+func (rs *RoomState) Emotes() map[string]string {
+	keys := make([]string, 0, len(rs.imagePacks))
+	for key := range rs.imagePacks {
+		keys = append(keys, key)
+	}
+	// the unstable type sorts before the stable, so is applied first for the stable to override.
+	sort.Strings(keys)
+
+	emotes := make(map[string]string)
+	for _, key := range keys {
+		for shortcode, url := range rs.imagePacks[key] {
+			emotes[shortcode] = url
+		}
+	}
+	return emotes
+}
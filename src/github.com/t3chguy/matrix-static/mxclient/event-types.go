@@ -0,0 +1,60 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"strings"
+)
+
+// EventTypeFilter is the operator's choice of event types to show in timelines which we would otherwise hide, and of
+// those to hide which we would otherwise show. Types ending in * match any type with that prefix e.g. "org.example.*".
+type EventTypeFilter struct {
+	Shown  []string
+	Hidden []string
+}
+
+// ParseEventTypes splits a comma separated list of event types, ignoring empty entries.
+func ParseEventTypes(list string) []string {
+	var eventTypes []string
+	for _, eventType := range strings.Split(list, ",") {
+		if eventType = strings.TrimSpace(eventType); eventType != "" {
+			eventTypes = append(eventTypes, eventType)
+		}
+	}
+	return eventTypes
+}
+
+func matchesEventType(patterns []string, eventType string) bool {
+	for _, pattern := range patterns {
+		if prefix := strings.TrimSuffix(pattern, "*"); prefix != pattern {
+			if strings.HasPrefix(eventType, prefix) {
+				return true
+			}
+		} else if pattern == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// shows returns whether events of eventType are to be shown regardless of whether we would otherwise hide them.
+func (f EventTypeFilter) shows(eventType string) bool {
+	return matchesEventType(f.Shown, eventType)
+}
+
+// hides returns whether events of eventType are to be hidden, which takes precedence over them being shown.
+func (f EventTypeFilter) hides(eventType string) bool {
+	return matchesEventType(f.Hidden, eventType)
+}
@@ -0,0 +1,58 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseEventTypes(t *testing.T) {
+	tests := []struct {
+		list string
+		want []string
+	}{
+		{"", nil},
+		{"m.room.member", []string{"m.room.member"}},
+		{" m.room.member, org.example.* ,,m.reaction,", []string{"m.room.member", "org.example.*", "m.reaction"}},
+	}
+	for _, test := range tests {
+		if got := ParseEventTypes(test.list); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseEventTypes(%q) = %q, want %q", test.list, got, test.want)
+		}
+	}
+}
+
+func TestEventTypeFilter(t *testing.T) {
+	filter := EventTypeFilter{Shown: []string{"m.reaction", "org.example.*"}, Hidden: []string{"m.room.member", "org.example.secret"}}
+	tests := []struct {
+		eventType           string
+		wantShows, wantHide bool
+	}{
+		{"m.reaction", true, false},
+		{"org.example.widget", true, false},
+		{"org.example.", true, false},
+		{"org.example", false, false},
+		{"org.example.secret", true, true},
+		{"m.room.member", false, true},
+		{"m.room.member.extra", false, false},
+		{"m.room.message", false, false},
+	}
+	for _, test := range tests {
+		if shows, hides := filter.shows(test.eventType), filter.hides(test.eventType); shows != test.wantShows || hides != test.wantHide {
+			t.Errorf("%s: shows = %v, hides = %v, want %v, %v", test.eventType, shows, hides, test.wantShows, test.wantHide)
+		}
+	}
+}
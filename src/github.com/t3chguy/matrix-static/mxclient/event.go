@@ -0,0 +1,26 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"github.com/matrix-org/gomatrix"
+)
+
+// Event is a gomatrix.Event along with the fields of events which our gomatrix predates, decoded alongside its own.
+type Event struct {
+	gomatrix.Event
+	Redacts  string                 `json:"redacts,omitempty"`  // The event ID of the event an m.room.redaction redacts.
+	Unsigned map[string]interface{} `json:"unsigned,omitempty"` // The unsigned portions of the event, such as redacted_because.
+}
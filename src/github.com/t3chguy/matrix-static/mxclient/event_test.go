@@ -0,0 +1,62 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEventUnmarshal(t *testing.T) {
+	data := `{
+		"event_id": "$redaction",
+		"type": "m.room.redaction",
+		"sender": "@mod:example.org",
+		"origin_server_ts": 1234,
+		"redacts": "$redacted",
+		"content": {"reason": "spam"},
+		"unsigned": {"age": 5}
+	}`
+
+	var ev Event
+	if err := json.Unmarshal([]byte(data), &ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.ID != "$redaction" || ev.Type != "m.room.redaction" || ev.Sender != "@mod:example.org" || ev.Timestamp != 1234 {
+		t.Errorf("gomatrix.Event fields = %+v", ev.Event)
+	}
+	if ev.Redacts != "$redacted" {
+		t.Errorf("Redacts = %q, want $redacted", ev.Redacts)
+	}
+	if ev.Unsigned["age"] != float64(5) {
+		t.Errorf("Unsigned = %v, want age 5", ev.Unsigned)
+	}
+	if ev.Content["reason"] != "spam" {
+		t.Errorf("Content = %v, want reason spam", ev.Content)
+	}
+
+	// and they survive being served back out, e.g. as chat.json.
+	out, err := json.Marshal(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var roundTripped Event
+	if err := json.Unmarshal(out, &roundTripped); err != nil {
+		t.Fatal(err)
+	}
+	if roundTripped.Redacts != ev.Redacts || roundTripped.Unsigned["age"] != ev.Unsigned["age"] {
+		t.Errorf("round tripped %s", out)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testRoomID = "!room:example.org"
+
+// fakeHomeserver answers requests by the longest matching suffix of their path, counting the requests to each.
+type fakeHomeserver struct {
+	*httptest.Server
+
+	mutex    sync.Mutex
+	routes   map[string]http.HandlerFunc
+	requests map[string]int
+}
+
+func newFakeHomeserver(t *testing.T) *fakeHomeserver {
+	hs := &fakeHomeserver{
+		routes:   make(map[string]http.HandlerFunc),
+		requests: make(map[string]int),
+	}
+	hs.Server = httptest.NewServer(http.HandlerFunc(hs.serveHTTP))
+	t.Cleanup(hs.Close)
+	return hs
+}
+
+func (hs *fakeHomeserver) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	hs.mutex.Lock()
+	var match string
+	for suffix := range hs.routes {
+		if strings.HasSuffix(r.URL.Path, suffix) && len(suffix) > len(match) {
+			match = suffix
+		}
+	}
+	handler := hs.routes[match]
+	hs.requests[match]++
+	hs.mutex.Unlock()
+
+	if handler == nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errcode":"M_UNRECOGNIZED","error":"Unrecognized request"}`))
+		return
+	}
+	handler(w, r)
+}
+
+// handle answers requests whose path ends in suffix with handler.
+func (hs *fakeHomeserver) handle(suffix string, handler http.HandlerFunc) {
+	hs.mutex.Lock()
+	defer hs.mutex.Unlock()
+	hs.routes[suffix] = handler
+}
+
+// handleJSON answers requests whose path ends in suffix with status & body.
+func (hs *fakeHomeserver) handleJSON(suffix string, status int, body string) {
+	hs.handle(suffix, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	})
+}
+
+// numRequests returns how many requests were answered by the handler for suffix.
+func (hs *fakeHomeserver) numRequests(suffix string) int {
+	hs.mutex.Lock()
+	defer hs.mutex.Unlock()
+	return hs.requests[suffix]
+}
+
+func newTestClient(t *testing.T, hs *fakeHomeserver) *Client {
+	cli, err := NewRawClient(hs.URL, hs.URL, "@static:example.org", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cli
+}
+
+// newTestRoom syncs testRoomID from hs, which answers its initialSync with initialSync.
+func newTestRoom(t *testing.T, hs *fakeHomeserver, initialSync string) *Room {
+	hs.handleJSON("/rooms/"+testRoomID+"/initialSync", http.StatusOK, initialSync)
+	room, err := newTestClient(t, hs).NewRoom(context.Background(), testRoomID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return room
+}
@@ -0,0 +1,49 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import "regexp"
+
+// MaxIdentifierLength is the longest a room ID or alias may be, including its sigil and server name.
+const MaxIdentifierLength = 255
+
+// roomIdentifierRegex matches sigil, localpart then a server name of a hostname, IPv4 or bracketed IPv6 address with
+// optional port. The first colon ends the localpart as that is how we find the server name of a room.
+var roomIdentifierRegex = regexp.MustCompile(`^[!#][^:\x00]+:(?:[A-Za-z0-9.\-]+|\[[0-9A-Fa-f:.]+\])(?::[0-9]{1,5})?$`)
+
+// serverNameRegex matches a server name of a hostname of non-empty labels, IPv4 or bracketed IPv6 address with
+// optional port, hostnames of dots alone would otherwise climb paths they are joined into.
+var serverNameRegex = regexp.MustCompile(`^(?:[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*|\[[0-9A-Fa-f:.]+\])(?::[0-9]{1,5})?$`)
+
+// mediaIDRegex matches the media IDs of mxc URIs, which are opaque but only ever of these characters.
+var mediaIDRegex = regexp.MustCompile(`^[A-Za-z0-9_\-]+$`)
+
+func isValidServerName(str string) bool {
+	return len(str) <= MaxIdentifierLength && serverNameRegex.MatchString(str)
+}
+
+func isValidRoomIdentifier(str string, sigil byte) bool {
+	return len(str) <= MaxIdentifierLength && len(str) > 0 && str[0] == sigil && roomIdentifierRegex.MatchString(str)
+}
+
+// IsValidRoomID returns whether str is of the form !opaque_id:server_name.
+func IsValidRoomID(str string) bool {
+	return isValidRoomIdentifier(str, '!')
+}
+
+// IsValidRoomAlias returns whether str is of the form #room_alias:server_name.
+func IsValidRoomAlias(str string) bool {
+	return isValidRoomIdentifier(str, '#')
+}
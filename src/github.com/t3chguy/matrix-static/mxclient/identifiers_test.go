@@ -0,0 +1,59 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIsValidRoomIdentifier(t *testing.T) {
+	tests := []struct {
+		name      string
+		str       string
+		wantID    bool
+		wantAlias bool
+	}{
+		{"room ID", "!abcdef:example.org", true, false},
+		{"room ID with a port", "!abcdef:example.org:8448", true, false},
+		{"room ID on an IPv4 address", "!abcdef:192.0.2.1", true, false},
+		{"room ID on an IPv6 address", "!abcdef:[2001:db8::1]:8448", true, false},
+		{"alias", "#matrix:example.org", false, true},
+		{"alias with punctuation", "#room-name_1.2:matrix.example.org", false, true},
+		{"no sigil", "abcdef:example.org", false, false},
+		{"garbage", "garbage", false, false},
+		{"empty", "", false, false},
+		{"sigil alone", "!", false, false},
+		{"no server name", "!abcdef", false, false},
+		{"empty localpart", "!:example.org", false, false},
+		{"empty server name", "!abcdef:", false, false},
+		{"user ID", "@alice:example.org", false, false},
+		{"whitespace in the server name", "!abcdef:example .org", false, false},
+		{"path in the server name", "!abcdef:example.org/../x", false, false},
+		{"port out of range", "!abcdef:example.org:123456", false, false},
+		{"NUL in the localpart", "!abc\x00def:example.org", false, false},
+		{"too long", "!" + strings.Repeat("a", MaxIdentifierLength) + ":example.org", false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := IsValidRoomID(test.str); got != test.wantID {
+				t.Errorf("IsValidRoomID(%q) = %v, want %v", test.str, got, test.wantID)
+			}
+			if got := IsValidRoomAlias(test.str); got != test.wantAlias {
+				t.Errorf("IsValidRoomAlias(%q) = %v, want %v", test.str, got, test.wantAlias)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ParseGeoURI parses the latitude and longitude out of an RFC 5870 geo: URI such as "geo:52.5,13.4;u=35",
+// ok=false if it is malformed.
+func ParseGeoURI(uri string) (lat, lon float64, ok bool) {
+	if !strings.HasPrefix(uri, "geo:") {
+		return 0, 0, false
+	}
+
+	// drop parameters such as ;u= (uncertainty) and ;crs=, which we do not use.
+	coords := strings.SplitN(strings.TrimPrefix(uri, "geo:"), ";", 2)[0]
+	parts := strings.Split(coords, ",")
+	// an altitude may follow latitude and longitude.
+	if len(parts) != 2 && len(parts) != 3 {
+		return 0, 0, false
+	}
+
+	lat, latErr := strconv.ParseFloat(parts[0], 64)
+	lon, lonErr := strconv.ParseFloat(parts[1], 64)
+	if latErr != nil || lonErr != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return 0, 0, false
+	}
+	return lat, lon, true
+}
+
+// OpenStreetMapURL returns a link to OpenStreetMap centred on and marking the given coordinates.
+func OpenStreetMapURL(lat, lon float64) string {
+	latStr, lonStr := strconv.FormatFloat(lat, 'f', -1, 64), strconv.FormatFloat(lon, 'f', -1, 64)
+	return "https://www.openstreetmap.org/?mlat=" + latStr + "&mlon=" + lonStr + "#map=16/" + latStr + "/" + lonStr
+}
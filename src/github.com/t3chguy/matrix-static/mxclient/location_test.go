@@ -0,0 +1,51 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import "testing"
+
+func TestParseGeoURI(t *testing.T) {
+	tests := []struct {
+		uri      string
+		lat, lon float64
+		ok       bool
+	}{
+		{"geo:52.5,13.4", 52.5, 13.4, true},
+		{"geo:52.5,13.4;u=35", 52.5, 13.4, true},
+		{"geo:-33.86,151.21,58", -33.86, 151.21, true},
+		{"geo:90,-180", 90, -180, true},
+		{"geo:90.1,0", 0, 0, false},
+		{"geo:0,180.1", 0, 0, false},
+		{"geo:52.5", 0, 0, false},
+		{"geo:north,east", 0, 0, false},
+		{"52.5,13.4", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.uri, func(t *testing.T) {
+			lat, lon, ok := ParseGeoURI(test.uri)
+			if lat != test.lat || lon != test.lon || ok != test.ok {
+				t.Errorf("got %v, %v, %v, want %v, %v, %v", lat, lon, ok, test.lat, test.lon, test.ok)
+			}
+		})
+	}
+}
+
+func TestOpenStreetMapURL(t *testing.T) {
+	const want = "https://www.openstreetmap.org/?mlat=52.5&mlon=-0.125#map=16/52.5/-0.125"
+	if got := OpenStreetMapURL(52.5, -0.125); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	"github.com/matrix-org/gomatrix"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// AccessTokenEnv names the environment variable which, if set, supplies the access token in place of the config file.
+const AccessTokenEnv = "MATRIX_STATIC_ACCESS_TOKEN"
+
+// LoginDeviceDisplayName names the device our logins create, which later logins reuse by its device ID.
+const LoginDeviceDisplayName = "matrix-static"
+
+var errNoPassword = errors.New("no password configured to log in again with")
+
+// credentials holds the access token requests to the homeserver are made with, replacing it by logging in again
+// should the homeserver revoke it, if we have a password to log in with.
+type credentials struct {
+	// configPath is where the config is saved whenever we log in, so that the device ID outlives us.
+	configPath string
+
+	// homeserverURL & transport are those of our client, which may differ from the config as they follow discovery.
+	homeserverURL string
+	transport     http.RoundTripper
+
+	mu     sync.Mutex
+	config Config
+}
+
+func (c *credentials) accessToken() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.config.AccessToken
+}
+
+// login logs in with the configured password, reusing the configured device ID if there is one, and saves the config.
+// c.mu must be held.
+func (c *credentials) login() error {
+	if c.config.Password == "" {
+		return errNoPassword
+	}
+
+	// this client has no access token to find unknown, and so needs no loginTransport.
+	cli, err := gomatrix.NewClient(c.homeserverURL, "", "")
+	if err != nil {
+		return err
+	}
+	cli.Client = &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: c.transport,
+	}
+
+	resp, err := cli.Login(&gomatrix.ReqLogin{
+		Type:                     "m.login.password",
+		User:                     c.config.UserID,
+		Password:                 c.config.Password,
+		DeviceID:                 c.config.DeviceID,
+		InitialDeviceDisplayName: LoginDeviceDisplayName,
+	})
+	if err != nil {
+		return err
+	}
+
+	c.config.AccessToken = resp.AccessToken
+	c.config.DeviceID = resp.DeviceID
+	c.config.UserID = resp.UserID
+
+	if c.configPath != "" {
+		if err := c.config.save(c.configPath); err != nil {
+			log.WithError(err).Warn("Failed to save Config after logging in, the next login will create a new device")
+		}
+	}
+	return nil
+}
+
+// refresh logs in again, unless the access token has already been replaced since staleToken was found to be unknown,
+// returning the access token to retry with.
+func (c *credentials) refresh(staleToken string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.config.AccessToken != staleToken {
+		return c.config.AccessToken, nil
+	}
+
+	if err := c.login(); err != nil {
+		return "", err
+	}
+	log.WithField("deviceID", c.config.DeviceID).Info("Logged in again after the homeserver revoked our access token")
+	return c.config.AccessToken, nil
+}
+
+// loginTransport makes requests with the current access token of credentials, refreshing it & retrying once should the
+// homeserver respond that it does not know the token.
+type loginTransport struct {
+	next        http.RoundTripper
+	credentials *credentials
+}
+
+func (t *loginTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// gomatrix puts the access token in the query string, requests without one (e.g. for media) are not ours to touch.
+	if _, ok := req.URL.Query()["access_token"]; !ok {
+		return t.next.RoundTrip(req)
+	}
+
+	token := t.credentials.accessToken()
+	resp, err := t.next.RoundTrip(withAccessToken(req, token))
+	if err != nil || !isUnknownToken(resp) {
+		return resp, err
+	}
+
+	retry := withAccessToken(req, "")
+	if req.Body != nil {
+		if req.GetBody == nil {
+			return resp, nil
+		}
+		if retry.Body, err = req.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+
+	newToken, err := t.credentials.refresh(token)
+	if err != nil {
+		log.WithError(err).Error("Homeserver revoked our access token and we could not log in again")
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	return t.next.RoundTrip(withAccessToken(retry, newToken))
+}
+
+// withAccessToken returns a copy of req with its access_token query parameter set to token.
+func withAccessToken(req *http.Request, token string) *http.Request {
+	clone := req.Clone(req.Context())
+	query := clone.URL.Query()
+	query.Set("access_token", token)
+	clone.URL.RawQuery = query.Encode()
+	return clone
+}
+
+// isUnknownToken returns whether resp is an M_UNKNOWN_TOKEN error, leaving its body to be read again.
+func isUnknownToken(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusUnauthorized {
+		return false
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+
+	var respErr gomatrix.RespError
+	return json.Unmarshal(body, &respErr) == nil && respErr.ErrCode == "M_UNKNOWN_TOKEN"
+}
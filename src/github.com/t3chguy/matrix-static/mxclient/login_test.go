@@ -0,0 +1,134 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/matrix-org/gomatrix"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+// newLoginHomeserver returns a homeserver which only accepts validToken, revoked tokens being answered with errcode,
+// and which issues validToken to the device ID "DEVICE" when logged into with the password "hunter2".
+// The bodies of the requests to join testRoomID are appended to joinBodies.
+func newLoginHomeserver(t *testing.T, validToken, errcode string, loginStatus int, joinBodies *[]string) *fakeHomeserver {
+	hs := newFakeHomeserver(t)
+	hs.handle("/login", func(w http.ResponseWriter, r *http.Request) {
+		var req gomatrix.ReqLogin
+		json.NewDecoder(r.Body).Decode(&req)
+		if loginStatus != http.StatusOK || req.Password != "hunter2" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errcode":"M_FORBIDDEN","error":"Invalid password"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(gomatrix.RespLogin{AccessToken: validToken, DeviceID: "DEVICE", UserID: req.User})
+	})
+	authenticated := func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Query().Get("access_token") == validToken {
+			return true
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"errcode":"` + errcode + `","error":"Unauthorized"}`))
+		return false
+	}
+	hs.handle("/event/$event", func(w http.ResponseWriter, r *http.Request) {
+		if authenticated(w, r) {
+			w.Write([]byte(`{"event_id":"$event","type":"m.room.message"}`))
+		}
+	})
+	hs.handle("/join/"+testRoomID, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		*joinBodies = append(*joinBodies, string(body))
+		if authenticated(w, r) {
+			w.Write([]byte(`{"room_id":"` + testRoomID + `"}`))
+		}
+	})
+	return hs
+}
+
+// newLoginTestClient returns a client of hs configured by a config file with accessToken & password.
+func newLoginTestClient(t *testing.T, hs *fakeHomeserver, accessToken, password string) (*Client, string) {
+	t.Setenv(AccessTokenEnv, "")
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	config := Config{HomeServer: hs.URL, UserID: "@static:example.org", AccessToken: accessToken, Password: password}
+	if err := config.save(configPath); err != nil {
+		t.Fatal(err)
+	}
+	cli, err := NewClient(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cli, configPath
+}
+
+func TestLoginTransport(t *testing.T) {
+	tests := []struct {
+		name        string
+		accessToken string
+		password    string
+		errcode     string
+		loginStatus int
+		wantErr     bool
+		wantLogins  int
+		wantToken   string
+	}{
+		{"valid token", "valid", "hunter2", "M_UNKNOWN_TOKEN", http.StatusOK, false, 0, "valid"},
+		{"revoked token logs in again", "stale", "hunter2", "M_UNKNOWN_TOKEN", http.StatusOK, false, 1, "valid"},
+		{"revoked token without a password", "stale", "", "M_UNKNOWN_TOKEN", http.StatusOK, true, 0, "stale"},
+		{"other unauthorized errors", "stale", "hunter2", "M_MISSING_TOKEN", http.StatusOK, true, 0, "stale"},
+		// having failed, each request tries again.
+		{"failed login", "stale", "hunter2", "M_UNKNOWN_TOKEN", http.StatusForbidden, true, 2, "stale"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var joinBodies []string
+			hs := newLoginHomeserver(t, "valid", test.errcode, test.loginStatus, &joinBodies)
+			cli, configPath := newLoginTestClient(t, hs, test.accessToken, test.password)
+
+			_, err := cli.JoinRoom(testRoomID, "", map[string]string{"reason": "testing"})
+			if (err != nil) != test.wantErr {
+				t.Fatalf("JoinRoom() err = %v, want error %v", err, test.wantErr)
+			}
+			// the refreshed token is kept, rather than logging in for every request.
+			if _, err := cli.RoomEvent(context.Background(), testRoomID, "$event"); (err != nil) != test.wantErr {
+				t.Fatalf("RoomEvent() err = %v, want error %v", err, test.wantErr)
+			}
+			// the body of a retry must be that of the original request.
+			for _, body := range joinBodies {
+				if body == "" || body != joinBodies[0] {
+					t.Errorf("join requests were sent with bodies %q", joinBodies)
+					break
+				}
+			}
+			if logins := hs.numRequests("/login"); logins != test.wantLogins {
+				t.Errorf("logged in %d times, want %d", logins, test.wantLogins)
+			}
+
+			var saved Config
+			configJSON, _ := ioutil.ReadFile(configPath)
+			json.Unmarshal(configJSON, &saved)
+			if saved.AccessToken != test.wantToken {
+				t.Errorf("saved access token %q, want %q", saved.AccessToken, test.wantToken)
+			}
+			if test.wantToken != test.accessToken && saved.DeviceID != "DEVICE" {
+				t.Errorf("saved device ID %q, want DEVICE", saved.DeviceID)
+			}
+		})
+	}
+}
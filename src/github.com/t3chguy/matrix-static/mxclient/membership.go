@@ -0,0 +1,130 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+// TimelineChunk is a run of consecutive timeline events,
+// Collapsed if it is a run of membership changes long enough to be summarised,
+// Repeated if it is a run of near-identical messages from the same sender (see SplitRepeatedMessages).
+type TimelineChunk struct {
+	Events    []Event
+	Collapsed bool
+	Repeated  bool
+}
+
+// ChunkMembershipRuns splits events into chunks, collapsing any run of more than threshold consecutive m.room.member
+// events. A threshold <= 0 disables collapsing.
+func ChunkMembershipRuns(events []Event, threshold int) (chunks []TimelineChunk) {
+	var pending []Event
+	flush := func() {
+		if len(pending) > 0 {
+			chunks = append(chunks, TimelineChunk{Events: pending})
+			pending = nil
+		}
+	}
+
+	for i := 0; i < len(events); {
+		end := i
+		for end < len(events) && events[end].Type == "m.room.member" {
+			end++
+		}
+
+		if threshold > 0 && end-i > threshold {
+			flush()
+			chunks = append(chunks, TimelineChunk{Events: events[i:end], Collapsed: true})
+			i = end
+			continue
+		}
+
+		if end == i {
+			end++
+		}
+		pending = append(pending, events[i:end]...)
+		i = end
+	}
+	flush()
+	return
+}
+
+func membershipOf(content map[string]interface{}) string {
+	membership, _ := content["membership"].(string)
+	return membership
+}
+
+// The changes of membership which are counted in a summary, in the order they are summarised.
+const (
+	TransitionJoined         = "joined"
+	TransitionLeft           = "left"
+	TransitionInvited        = "invited"
+	TransitionRejectedInvite = "rejected_invite"
+	TransitionKicked         = "kicked"
+	TransitionBanned         = "banned"
+	TransitionUnbanned       = "unbanned"
+	TransitionProfileChange  = "profile_change"
+	TransitionOther          = "other"
+)
+
+var membershipTransitionOrder = []string{
+	TransitionJoined, TransitionLeft, TransitionInvited, TransitionRejectedInvite, TransitionKicked, TransitionBanned,
+	TransitionUnbanned, TransitionProfileChange, TransitionOther,
+}
+
+// membershipTransition names the change of membership an m.room.member event makes.
+func membershipTransition(ev *Event) string {
+	membership, prevMembership := membershipOf(ev.Content), membershipOf(ev.PrevContent)
+	switch membership {
+	case "join":
+		if prevMembership == "join" {
+			return TransitionProfileChange
+		}
+		return TransitionJoined
+	case "invite":
+		return TransitionInvited
+	case "ban":
+		return TransitionBanned
+	case "leave":
+		switch {
+		case prevMembership == "ban":
+			return TransitionUnbanned
+		case prevMembership == "invite":
+			return TransitionRejectedInvite
+		case ev.StateKey != nil && ev.Sender != *ev.StateKey:
+			return TransitionKicked
+		}
+		return TransitionLeft
+	}
+	return TransitionOther
+}
+
+type MembershipTransitionCount struct {
+	Transition string
+	Count      int
+}
+
+// CountMembershipTransitions counts the changes of membership made by a run of m.room.member events, for a summary
+// like "12 users joined and 4 left". Only transitions which occurred are returned, in the order to be summarised.
+func CountMembershipTransitions(events []Event) []MembershipTransitionCount {
+	counts := make(map[string]int)
+	for i := range events {
+		counts[membershipTransition(&events[i])]++
+	}
+
+	var transitions []MembershipTransitionCount
+	for _, transition := range membershipTransitionOrder {
+		if count, ok := counts[transition]; ok {
+			transitions = append(transitions, MembershipTransitionCount{transition, count})
+		}
+	}
+	return transitions
+}
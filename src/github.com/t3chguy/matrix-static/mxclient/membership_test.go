@@ -0,0 +1,116 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"encoding/json"
+	"github.com/matrix-org/gomatrix"
+	"reflect"
+	"testing"
+)
+
+// membershipEvent returns an m.room.member event by sender about target, changing their membership from prevMembership
+// ("" for none) to membership.
+func membershipEvent(t *testing.T, eventID, sender, target, prevMembership, membership string) Event {
+	t.Helper()
+	prevContent := "null"
+	if prevMembership != "" {
+		prevContent = `{"membership":"` + prevMembership + `"}`
+	}
+	var ev Event
+	data := `{"event_id":"` + eventID + `","type":"m.room.member","sender":"` + sender + `","state_key":"` + target + `",
+		"content":{"membership":"` + membership + `"},"prev_content":` + prevContent + `}`
+	if err := json.Unmarshal([]byte(data), &ev); err != nil {
+		t.Fatal(err)
+	}
+	return ev
+}
+
+func TestChunkMembershipRuns(t *testing.T) {
+	message := func(eventID string) Event {
+		return Event{Event: gomatrix.Event{ID: eventID, Type: "m.room.message"}}
+	}
+	join := func(eventID string) Event {
+		return membershipEvent(t, eventID, "@"+eventID[1:]+":example.org", "@"+eventID[1:]+":example.org", "", "join")
+	}
+	events := []Event{
+		message("$m1"), join("$j1"), join("$j2"), message("$m2"),
+		join("$j3"), join("$j4"), join("$j5"), join("$j6"), message("$m3"),
+	}
+
+	tests := []struct {
+		name      string
+		threshold int
+		want      [][]string
+		collapsed []bool
+	}{
+		{"runs longer than the threshold", 3,
+			[][]string{{"$m1", "$j1", "$j2", "$m2"}, {"$j3", "$j4", "$j5", "$j6"}, {"$m3"}}, []bool{false, true, false}},
+		{"every run", 1,
+			[][]string{{"$m1"}, {"$j1", "$j2"}, {"$m2"}, {"$j3", "$j4", "$j5", "$j6"}, {"$m3"}}, []bool{false, true, false, true, false}},
+		{"no run as long as the threshold", 4, [][]string{eventIDs(events)}, []bool{false}},
+		{"disabled", 0, [][]string{eventIDs(events)}, []bool{false}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got [][]string
+			var collapsed []bool
+			for _, chunk := range ChunkMembershipRuns(events, test.threshold) {
+				got = append(got, eventIDs(chunk.Events))
+				collapsed = append(collapsed, chunk.Collapsed)
+			}
+			if !reflect.DeepEqual(got, test.want) || !reflect.DeepEqual(collapsed, test.collapsed) {
+				t.Errorf("got chunks %v collapsed %v, want %v collapsed %v", got, collapsed, test.want, test.collapsed)
+			}
+		})
+	}
+}
+
+func TestCountMembershipTransitions(t *testing.T) {
+	const mod = "@mod:example.org"
+	events := []Event{
+		membershipEvent(t, "$1", "@a:example.org", "@a:example.org", "", "join"),
+		membershipEvent(t, "$2", "@b:example.org", "@b:example.org", "leave", "join"),
+		membershipEvent(t, "$3", "@a:example.org", "@a:example.org", "join", "join"),
+		membershipEvent(t, "$4", "@c:example.org", "@c:example.org", "join", "leave"),
+		membershipEvent(t, "$5", mod, "@d:example.org", "join", "leave"),
+		membershipEvent(t, "$6", mod, "@e:example.org", "", "invite"),
+		membershipEvent(t, "$7", "@e:example.org", "@e:example.org", "invite", "leave"),
+		membershipEvent(t, "$8", mod, "@f:example.org", "join", "ban"),
+		membershipEvent(t, "$9", mod, "@g:example.org", "ban", "leave"),
+		membershipEvent(t, "$10", "@h:example.org", "@h:example.org", "", "knock"),
+		membershipEvent(t, "$11", "@i:example.org", "@i:example.org", "", "join"),
+	}
+	want := []MembershipTransitionCount{
+		{TransitionJoined, 3},
+		{TransitionLeft, 1},
+		{TransitionInvited, 1},
+		{TransitionRejectedInvite, 1},
+		{TransitionKicked, 1},
+		{TransitionBanned, 1},
+		{TransitionUnbanned, 1},
+		{TransitionProfileChange, 1},
+		{TransitionOther, 1},
+	}
+	if got := CountMembershipTransitions(events); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// transitions which did not occur are left out.
+	want = []MembershipTransitionCount{{TransitionJoined, 1}, {TransitionLeft, 1}}
+	if got := CountMembershipTransitions([]Event{events[3], events[0]}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+// GetMentions returns the users an event intentionally mentions according to its m.mentions, without duplicates,
+// and whether it mentions the whole room.
+func GetMentions(ev *Event) (userIDs []string, room bool) {
+	mentions, _ := ev.Content["m.mentions"].(map[string]interface{})
+	room, _ = mentions["room"].(bool)
+
+	list, _ := mentions["user_ids"].([]interface{})
+	seen := make(map[string]bool, len(list))
+	for _, item := range list {
+		if userID, ok := item.(string); ok && len(userID) > 1 && userID[0] == '@' && !seen[userID] {
+			seen[userID] = true
+			userIDs = append(userIDs, userID)
+		}
+	}
+	return
+}
@@ -0,0 +1,52 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestGetMentions(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		wantUserIDs []string
+		wantRoom    bool
+	}{
+		{"users", `{"m.mentions":{"user_ids":["@alice:example.org","@bob:example.org"]}}`,
+			[]string{"@alice:example.org", "@bob:example.org"}, false},
+		{"the room", `{"m.mentions":{"room":true}}`, nil, true},
+		{"both", `{"m.mentions":{"user_ids":["@alice:example.org"],"room":true}}`, []string{"@alice:example.org"}, true},
+		{"duplicates", `{"m.mentions":{"user_ids":["@alice:example.org","@alice:example.org"]}}`, []string{"@alice:example.org"}, false},
+		{"anything but user IDs", `{"m.mentions":{"user_ids":["alice",7,"@",null,"@bob:example.org"],"room":"yes"}}`,
+			[]string{"@bob:example.org"}, false},
+		{"malformed", `{"m.mentions":["@alice:example.org"]}`, nil, false},
+		{"none at all", `{"body":"@alice:example.org"}`, nil, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var ev Event
+			if err := json.Unmarshal([]byte(test.content), &ev.Content); err != nil {
+				t.Fatal(err)
+			}
+			userIDs, room := GetMentions(&ev)
+			if !reflect.DeepEqual(userIDs, test.wantUserIDs) || room != test.wantRoom {
+				t.Errorf("got %v, %v, want %v, %v", userIDs, room, test.wantUserIDs, test.wantRoom)
+			}
+		})
+	}
+}
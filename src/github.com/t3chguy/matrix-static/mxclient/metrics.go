@@ -0,0 +1,137 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"encoding/json"
+	"github.com/matrix-org/gomatrix"
+	"github.com/prometheus/client_golang/prometheus"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var syncFailures = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "sync_failures_total",
+		Help: "How many requests syncing rooms against the homeserver failed, partitioned by error type.",
+	},
+	[]string{"error_type"},
+)
+
+var homeserverRequestDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "homeserver_request_duration_seconds",
+		Help:    "How long requests to the homeserver took until their response headers arrived, partitioned by endpoint category.",
+		Buckets: prometheus.DefBuckets,
+	},
+	[]string{"endpoint"},
+)
+
+// The endpoint categories homeserverRequestDuration is partitioned by.
+const (
+	endpointSync      = "sync"
+	endpointMessages  = "messages"
+	endpointContext   = "context"
+	endpointMedia     = "media"
+	endpointDirectory = "directory"
+	endpointOther     = "other"
+)
+
+// RegisterMetrics registers the mxclient metrics into reg.
+func RegisterMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(syncFailures)
+
+	for _, endpoint := range []string{endpointSync, endpointMessages, endpointContext, endpointMedia, endpointDirectory, endpointOther} {
+		homeserverRequestDuration.WithLabelValues(endpoint)
+	}
+	reg.MustRegister(homeserverRequestDuration)
+}
+
+var roomEndpointRegex = regexp.MustCompile(`/_matrix/client/[^/]+/rooms/[^/]+/([^/]+)`)
+
+// classifyEndpoint maps the path of a request to the homeserver into the endpoint category it is measured under.
+func classifyEndpoint(path string) string {
+	switch {
+	case strings.Contains(path, "/_matrix/media/"):
+		return endpointMedia
+	case strings.HasSuffix(path, "/sync"):
+		return endpointSync
+	case strings.HasSuffix(path, "/publicRooms") || strings.Contains(path, "/directory/"):
+		return endpointDirectory
+	}
+
+	if match := roomEndpointRegex.FindStringSubmatch(path); match != nil {
+		switch match[1] {
+		case "initialSync":
+			return endpointSync
+		case "messages":
+			return endpointMessages
+		case "context":
+			return endpointContext
+		}
+	}
+	return endpointOther
+}
+
+// metricsTransport observes how long each request it round trips takes into homeserverRequestDuration, apart from
+// any time spent by us on retrying it, so that the homeserver's share of slow pages can be told from ours.
+type metricsTransport struct {
+	next http.RoundTripper
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	homeserverRequestDuration.WithLabelValues(classifyEndpoint(req.URL.Path)).Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+// newHomeserverTransport returns the transport requests to the homeserver are made with: retried & measured.
+func newHomeserverTransport() http.RoundTripper {
+	return requestIDTransport{&retryTransport{&metricsTransport{http.DefaultTransport}}}
+}
+
+// ClassifySyncError maps an error returned by a gomatrix call into a bucket suitable for a metric label.
+func ClassifySyncError(err error) string {
+	switch err := err.(type) {
+	case gomatrix.HTTPError:
+		switch {
+		case err.Code == http.StatusUnauthorized || err.Code == http.StatusForbidden:
+			return "auth_error"
+		case err.Code == http.StatusTooManyRequests:
+			return "rate_limited"
+		case err.Code >= http.StatusInternalServerError:
+			return "server_error"
+		default:
+			return "http_error"
+		}
+	case *json.SyntaxError, *json.UnmarshalTypeError:
+		return "json_decode"
+	case net.Error:
+		if err.Timeout() {
+			return "timeout"
+		}
+		return "network_error"
+	default:
+		return "other"
+	}
+}
+
+func recordSyncFailure(err error) {
+	syncFailures.WithLabelValues(ClassifySyncError(err)).Inc()
+}
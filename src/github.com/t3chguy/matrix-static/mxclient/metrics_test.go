@@ -0,0 +1,226 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/matrix-org/gomatrix"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"net/http"
+	"testing"
+)
+
+// fakeNetError is a net.Error which timed out or not.
+type fakeNetError struct{ timeout bool }
+
+func (e fakeNetError) Error() string   { return "network is unreachable" }
+func (e fakeNetError) Timeout() bool   { return e.timeout }
+func (e fakeNetError) Temporary() bool { return false }
+
+func TestClassifySyncError(t *testing.T) {
+	var syntaxErr *json.SyntaxError
+	if err := json.Unmarshal([]byte(`{`), &struct{}{}); !errors.As(err, &syntaxErr) {
+		t.Fatalf("got %v, want a *json.SyntaxError", err)
+	}
+	var typeErr *json.UnmarshalTypeError
+	if err := json.Unmarshal([]byte(`"string"`), new(int)); !errors.As(err, &typeErr) {
+		t.Fatalf("got %v, want a *json.UnmarshalTypeError", err)
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"unauthorized", gomatrix.HTTPError{Code: http.StatusUnauthorized}, "auth_error"},
+		{"forbidden", gomatrix.HTTPError{Code: http.StatusForbidden}, "auth_error"},
+		{"rate limited", gomatrix.HTTPError{Code: http.StatusTooManyRequests}, "rate_limited"},
+		{"internal server error", gomatrix.HTTPError{Code: http.StatusInternalServerError}, "server_error"},
+		{"bad gateway", gomatrix.HTTPError{Code: http.StatusBadGateway}, "server_error"},
+		{"not found", gomatrix.HTTPError{Code: http.StatusNotFound}, "http_error"},
+		{"malformed json", syntaxErr, "json_decode"},
+		{"mistyped json", typeErr, "json_decode"},
+		{"timeout", fakeNetError{timeout: true}, "timeout"},
+		{"network error", fakeNetError{}, "network_error"},
+		{"anything else", errors.New("unexpected"), "other"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ClassifySyncError(test.err); got != test.want {
+				t.Errorf("ClassifySyncError(%v) = %q, want %q", test.err, got, test.want)
+			}
+		})
+	}
+}
+
+// numSyncFailures sums syncFailures across its error types.
+func numSyncFailures() float64 {
+	metrics := make(chan prometheus.Metric, 16)
+	go func() {
+		syncFailures.Collect(metrics)
+		close(metrics)
+	}()
+
+	var total float64
+	for metric := range metrics {
+		var m dto.Metric
+		metric.Write(&m)
+		total += m.GetCounter().GetValue()
+	}
+	return total
+}
+
+// TestSyncFailuresCancelled asserts that syncs given up on by us are not counted as failures of the homeserver, whereas
+// those it fails are.
+func TestSyncFailuresCancelled(t *testing.T) {
+	hs := newFakeHomeserver(t)
+	room := newTestRoom(t, hs, `{"messages":{"start":"s0","end":"e0","chunk":[]},"state":[]}`)
+	cli := newTestClient(t, hs)
+	hs.handleJSON("/messages", http.StatusForbidden, `{"errcode":"M_FORBIDDEN","error":"Forbidden"}`)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name         string
+		ctx          context.Context
+		wantFailures float64
+	}{
+		{"cancelled", cancelled, 0},
+		{"failed by the homeserver", context.Background(), 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			syncs := []struct {
+				name string
+				sync func() error
+			}{
+				{"NewRoom", func() error {
+					_, err := cli.NewRoom(test.ctx, "!unknown:example.org")
+					return err
+				}},
+				{"backpaginateRoom", func() error {
+					_, err := cli.backpaginateRoom(test.ctx, room, 10)
+					return err
+				}},
+				{"forwardpaginateRoom", func() error {
+					_, err := cli.forwardpaginateRoom(test.ctx, room, 10)
+					return err
+				}},
+			}
+			for _, sync := range syncs {
+				before := numSyncFailures()
+				if err := sync.sync(); err == nil {
+					t.Fatalf("%s succeeded, want it to fail", sync.name)
+				}
+				if got := numSyncFailures() - before; got != test.wantFailures {
+					t.Errorf("%s counted %v failures, want %v", sync.name, got, test.wantFailures)
+				}
+			}
+		})
+	}
+}
+
+func TestClassifyEndpoint(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/_matrix/client/r0/sync", endpointSync},
+		{"/_matrix/client/r0/rooms/!room:example.org/initialSync", endpointSync},
+		{"/_matrix/client/r0/rooms/!room:example.org/messages", endpointMessages},
+		{"/_matrix/client/v3/rooms/!room:example.org/context/$event", endpointContext},
+		{"/_matrix/media/r0/thumbnail/example.org/abc", endpointMedia},
+		{"/_matrix/client/r0/publicRooms", endpointDirectory},
+		{"/_matrix/client/r0/directory/room/#lobby:example.org", endpointDirectory},
+		{"/_matrix/client/r0/rooms/!room:example.org/state", endpointOther},
+		{"/_matrix/client/r0/join/!room:example.org", endpointOther},
+		// room IDs are opaque, so cannot be mistaken for the endpoint within the room.
+		{"/_matrix/client/r0/rooms/!messages:example.org/members", endpointOther},
+	}
+	for _, test := range tests {
+		if got := classifyEndpoint(test.path); got != test.want {
+			t.Errorf("classifyEndpoint(%q) = %q, want %q", test.path, got, test.want)
+		}
+	}
+}
+
+// numHomeserverRequests returns how many requests homeserverRequestDuration has observed for endpoint.
+func numHomeserverRequests(t *testing.T, endpoint string) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := homeserverRequestDuration.WithLabelValues(endpoint).(prometheus.Histogram).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+// TestHomeserverRequestDuration asserts that each attempt at a request is timed, retries included, by its endpoint.
+func TestHomeserverRequestDuration(t *testing.T) {
+	hs := newFakeHomeserver(t)
+	attempts := 0
+	hs.handle("/publicRooms", func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"chunk":[]}`))
+	})
+
+	syncs, directory := numHomeserverRequests(t, endpointSync), numHomeserverRequests(t, endpointDirectory)
+	newTestRoom(t, hs, `{"messages":{"start":"s0","end":"e0","chunk":[]},"state":[]}`)
+	if _, err := newTestClient(t, hs).PublicRooms(0, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := numHomeserverRequests(t, endpointSync) - syncs; got != 1 {
+		t.Errorf("observed %d syncs, want 1", got)
+	}
+	if got := numHomeserverRequests(t, endpointDirectory) - directory; got != 2 {
+		t.Errorf("observed %d directory requests, want 2 as it was retried once", got)
+	}
+}
+
+func TestRegisterMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	RegisterMetrics(reg)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoints := make(map[string]bool)
+	for _, family := range families {
+		if family.GetName() != "homeserver_request_duration_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				endpoints[label.GetValue()] = true
+			}
+		}
+	}
+	// every endpoint is exported before it is first requested, so that dashboards need not special case its absence.
+	for _, endpoint := range []string{endpointSync, endpointMessages, endpointContext, endpointMedia, endpointDirectory, endpointOther} {
+		if !endpoints[endpoint] {
+			t.Errorf("homeserver_request_duration_seconds lacks the %s endpoint: %v", endpoint, endpoints)
+		}
+	}
+}
@@ -15,6 +15,7 @@
 package mxclient
 
 import (
+	"errors"
 	"net/url"
 	"path"
 	"regexp"
@@ -30,6 +31,9 @@ import (
 // "invalidMxc://whatever" => [] (Invalid MXC Caught)
 var mxcRegex = regexp.MustCompile(`mxc://(.+?)/(.+?)(?:#.+)?$`)
 
+// ErrInvalidMXC is returned for media requested at an mxc which does not appear valid.
+var ErrInvalidMXC = errors.New("invalid mxc")
+
 type MXCURL struct {
 	string
 	homeserverURL string
@@ -40,24 +44,35 @@ func NewMXCURL(url string, baseUrl string) *MXCURL {
 	return &MXCURL{url, baseUrl}
 }
 
-// IsValid returns a boolean of whether or not this MXCURL appears valid.
+// IsValid returns a boolean of whether or not this MXCURL appears valid, i.e. is of a valid server name and a media ID
+// of URL safe characters, so that neither can escape the media repository's path.
 func (m *MXCURL) IsValid() bool {
 	ok, _, _ := m.split()
 	return ok
 }
 
+// MXC returns the mxc:// URI itself, empty if it does not appear valid.
+func (m *MXCURL) MXC() string {
+	if !m.IsValid() {
+		return ""
+	}
+	return m.string
+}
+
+// Split returns the serverName and mediaID of the MXCURL, ok is false if it does not appear valid.
+func (m *MXCURL) Split() (serverName, mediaID string, ok bool) {
+	ok, serverName, mediaID = m.split()
+	return
+}
+
 func (m *MXCURL) split() (ok bool, serverName string, mediaId string) {
 	mxc := m.string
 	matches := mxcRegex.FindStringSubmatch(mxc)
 
-	ok = true
-	if len(matches) != 3 {
+	if len(matches) != 3 || !isValidServerName(matches[1]) || !mediaIDRegex.MatchString(matches[2]) {
 		return false, "", ""
 	}
-
-	serverName = matches[1]
-	mediaId = matches[2]
-	return
+	return true, matches[1], matches[2]
 }
 
 func (m *MXCURL) mapMxcUrl(kind string) *url.URL {
@@ -93,5 +108,33 @@ func (m *MXCURL) ToThumbURL(width, height int, method string) string {
 
 // ToThumbUrl returns a http/s URL string representation of the original file uploaded at the MXCURL.s
 func (m *MXCURL) ToURL() string {
-	return m.mapMxcUrl("download").String()
+	mediaUrl := m.mapMxcUrl("download")
+	if mediaUrl == nil {
+		return ""
+	}
+	return mediaUrl.String()
+}
+
+// ToProxyURL returns a relative URL string to the original file uploaded at the MXCURL via our media proxy.
+func (m *MXCURL) ToProxyURL() string {
+	ok, serverName, mediaId := m.split()
+	if !ok {
+		return ""
+	}
+	return "./media/" + url.PathEscape(serverName) + "/" + url.PathEscape(mediaId)
+}
+
+// ToProxyThumbURL returns a relative URL string to a thumbnail of the MXCURL at the width&height specified via our
+// media proxy.
+func (m *MXCURL) ToProxyThumbURL(width, height int, method string) string {
+	ok, serverName, mediaId := m.split()
+	if !ok {
+		return ""
+	}
+
+	q := url.Values{}
+	q.Set("width", strconv.Itoa(width))
+	q.Set("height", strconv.Itoa(height))
+	q.Set("method", method)
+	return "./thumb/" + url.PathEscape(serverName) + "/" + url.PathEscape(mediaId) + "?" + q.Encode()
 }
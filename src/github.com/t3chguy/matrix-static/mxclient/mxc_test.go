@@ -0,0 +1,68 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"testing"
+)
+
+func TestMXCURLSplit(t *testing.T) {
+	tests := []struct {
+		mxc        string
+		serverName string
+		mediaID    string
+		ok         bool
+	}{
+		{"mxc://example.org/abcDEF123_-", "example.org", "abcDEF123_-", true},
+		{"mxc://example.org:8448/media", "example.org:8448", "media", true},
+		{"mxc://1.2.3.4/media", "1.2.3.4", "media", true},
+		{"mxc://[::1]:8448/media", "[::1]:8448", "media", true},
+		{"mxc://localhost/media#auto", "localhost", "media", true},
+		{"mxc://../media", "", "", false},
+		{"mxc://./media", "", "", false},
+		{"mxc://example..org/media", "", "", false},
+		{"mxc://.example.org/media", "", "", false},
+		{"mxc://example.org/..", "", "", false},
+		{"mxc://example.org/../../../../_synapse/admin", "", "", false},
+		{"mxc://example.org/media/../..", "", "", false},
+		{"mxc://example.org/media%2F..", "", "", false},
+		{"mxc://exa mple.org/media", "", "", false},
+		{"mxc://example.org:port/media", "", "", false},
+		{"mxc://example.org/", "", "", false},
+		{"https://example.org/media", "", "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.mxc, func(t *testing.T) {
+			mxc := NewMXCURL(test.mxc, "https://hs.example.org")
+			serverName, mediaID, ok := mxc.Split()
+			if serverName != test.serverName || mediaID != test.mediaID || ok != test.ok {
+				t.Errorf("Split() = %q, %q, %v, want %q, %q, %v", serverName, mediaID, ok, test.serverName, test.mediaID, test.ok)
+			}
+			if !test.ok && (mxc.ToURL() != "" || mxc.ToThumbURL(32, 32, "crop") != "" || mxc.ToProxyURL() != "") {
+				t.Errorf("invalid mxc mapped to %q", mxc.ToURL())
+			}
+		})
+	}
+}
+
+func TestMXCURLToURL(t *testing.T) {
+	mxc := NewMXCURL("mxc://example.org/media", "https://hs.example.org/prefix/")
+	if got, want := mxc.ToURL(), "https://hs.example.org/prefix/_matrix/media/r0/download/example.org/media"; got != want {
+		t.Errorf("ToURL() = %q, want %q", got, want)
+	}
+	if got, want := mxc.ToThumbURL(32, 48, "crop"), "https://hs.example.org/prefix/_matrix/media/r0/thumbnail/example.org/media?height=48&method=crop&width=32"; got != want {
+		t.Errorf("ToThumbURL() = %q, want %q", got, want)
+	}
+}
@@ -15,13 +15,16 @@
 package mxclient
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	log "github.com/Sirupsen/logrus"
 	"github.com/matrix-org/gomatrix"
+	"github.com/t3chguy/matrix-static/sanitizer"
 	"github.com/t3chguy/matrix-static/utils"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"time"
@@ -29,13 +32,13 @@ import (
 
 // This is a Truncated RespInitialSync as we only need SOME information from it.
 type RespInitialSync struct {
-	// AccountData []gomatrix.Event `json:"account_data"`
+	// AccountData []Event `json:"account_data"`
 
-	Messages gomatrix.RespMessages `json:"messages"`
+	Messages RespMessages `json:"messages"`
 	// Membership string                 `json:"membership"`
-	State []gomatrix.Event `json:"state"`
+	State []Event `json:"state"`
 	// RoomID     string                 `json:"room_id"`
-	// Receipts   []*gomatrix.Event      `json:"receipts"`
+	Receipts []Event `json:"receipts"`
 	// Presence   []*PresenceEvent       `json:"presence"`
 }
 
@@ -44,14 +47,91 @@ type RespInitialSync struct {
 type Client struct {
 	*gomatrix.Client
 	MediaBaseURL string
+
+	// discovery, if the config names a server, sends our requests to the homeserver its .well-known names.
+	discovery *homeserverDiscovery
+
+	// HideEncryptedEvents omits m.room.encrypted events from timelines rather than showing a placeholder for them.
+	HideEncryptedEvents bool
+
+	// Sanitizer cleans up HTML found in room state, such as formatted topics.
+	Sanitizer *sanitizer.Sanitizer
+
+	// ShowReadReceipts keeps the read receipts rooms come with, we otherwise have no use for them.
+	ShowReadReceipts bool
+
+	// Anonymize replaces the users of every room with their Pseudonyms in what we serve, hiding their avatars.
+	Anonymize bool
+
+	// EventTypes are the event types the operator has chosen to show or hide in timelines.
+	EventTypes EventTypeFilter
+
+	// MaxBackpaginations caps how many back-pagination requests to the homeserver a single page may cost, so that
+	// requests for pages far back in history cannot hammer it; at least one is always made.
+	MaxBackpaginations int
+
+	// SyncTimelineLimit is how many events to request when loading a room & each time we catch up on those since.
+	SyncTimelineLimit int
+
+	// SyncTimeout is how long loading a room & each time we catch up on it may take before we give up on it.
+	SyncTimeout time.Duration
 }
 
 // Register makes an HTTP request according to http://matrix.org/docs/spec/client_server/r0.2.0.html#get-matrix-client-r0-rooms-roomid-initialsync
-func (m *Client) RoomInitialSync(roomID string, limit int) (resp *RespInitialSync, err error) {
-	urlPath := m.BuildURLWithQuery([]string{"rooms", roomID, "initialSync"}, map[string]string{
+// within SyncTimeout & ctx.
+func (m *Client) RoomInitialSync(ctx context.Context, roomID string, limit int) (resp *RespInitialSync, err error) {
+	cli := m.syncClient(ctx)
+	urlPath := cli.BuildURLWithQuery([]string{"rooms", roomID, "initialSync"}, map[string]string{
 		"limit": strconv.Itoa(limit),
 	})
-	_, err = m.MakeRequest("GET", urlPath, nil, &resp)
+	_, err = cli.MakeRequest("GET", urlPath, nil, &resp)
+	return
+}
+
+type RespTimestampToEvent struct {
+	EventID        string `json:"event_id"`
+	OriginServerTS int    `json:"origin_server_ts"`
+}
+
+// TimestampToEvent makes an HTTP request according to https://spec.matrix.org/v1.6/client-server-api/#get_matrixclientv1roomsroomidtimestamp_to_event
+// (MSC3030), finding the event closest to ts in direction dir ("b" or "f"), which is abandoned should ctx be cancelled.
+func (m *Client) TimestampToEvent(ctx context.Context, roomID string, ts int, dir string) (resp *RespTimestampToEvent, err error) {
+	cli := m.withContext(ctx)
+	u, _ := url.Parse(cli.BuildBaseURL("_matrix", "client", "v1", "rooms", roomID, "timestamp_to_event"))
+	q := u.Query()
+	q.Set("ts", strconv.Itoa(ts))
+	q.Set("dir", dir)
+	u.RawQuery = q.Encode()
+
+	_, err = cli.MakeRequest("GET", u.String(), nil, &resp)
+	return
+}
+
+type RespContext struct {
+	Start        string  `json:"start"`
+	End          string  `json:"end"`
+	EventsBefore []Event `json:"events_before"`
+	Event        Event   `json:"event"`
+	EventsAfter  []Event `json:"events_after"`
+}
+
+// EventContext makes an HTTP request according to https://matrix.org/docs/spec/client_server/r0.6.0#get-matrix-client-r0-rooms-roomid-context-eventid
+// which is abandoned should ctx be cancelled.
+func (m *Client) EventContext(ctx context.Context, roomID, eventID string, limit int) (resp *RespContext, err error) {
+	cli := m.withContext(ctx)
+	urlPath := cli.BuildURLWithQuery([]string{"rooms", roomID, "context", eventID}, map[string]string{
+		"limit": strconv.Itoa(limit),
+	})
+	_, err = cli.MakeRequest("GET", urlPath, nil, &resp)
+	return
+}
+
+// RoomEvent makes an HTTP request according to https://matrix.org/docs/spec/client_server/r0.6.0#get-matrix-client-r0-rooms-roomid-event-eventid
+// which is abandoned should ctx be cancelled.
+func (m *Client) RoomEvent(ctx context.Context, roomID, eventID string) (resp *Event, err error) {
+	cli := m.withContext(ctx)
+	urlPath := cli.BuildURL("rooms", roomID, "event", eventID)
+	_, err = cli.MakeRequest("GET", urlPath, nil, &resp)
 	return
 }
 
@@ -66,46 +146,99 @@ func (m *Client) GetRoomDirectoryAlias(roomAlias string) (resp *RespRoomDirector
 	return
 }
 
+// DownloadMedia requests the original file uploaded at mxc://serverName/mediaID from the media repository,
+// conditionally upon the If-None-Match & If-Modified-Since of validators if any.
+func (m *Client) DownloadMedia(serverName, mediaID string, validators http.Header) (*http.Response, error) {
+	mxc := NewMXCURL("mxc://"+serverName+"/"+mediaID, m.MediaBaseURL)
+	if !mxc.IsValid() {
+		return nil, ErrInvalidMXC
+	}
+	return m.getMedia(mxc.ToURL(), validators)
+}
+
+// ThumbnailMedia requests a thumbnail of the file uploaded at mxc://serverName/mediaID from the media repository,
+// conditionally upon the If-None-Match & If-Modified-Since of validators if any.
+func (m *Client) ThumbnailMedia(serverName, mediaID string, width, height int, method string, validators http.Header) (*http.Response, error) {
+	mxc := NewMXCURL("mxc://"+serverName+"/"+mediaID, m.MediaBaseURL)
+	if !mxc.IsValid() {
+		return nil, ErrInvalidMXC
+	}
+	return m.getMedia(mxc.ToThumbURL(width, height, method), validators)
+}
+
+func (m *Client) getMedia(url string, validators http.Header) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range []string{"If-None-Match", "If-Modified-Since"} {
+		if value := validators.Get(key); value != "" {
+			req.Header.Set(key, value)
+		}
+	}
+	return m.Client.Client.Do(req)
+}
+
 const minimumPagination = 64
 
 // TODO split into runs of max size recursively otherwise synapse may enforce its own limit (999?)
-func (m *Client) backpaginateRoom(room *Room, amount int) (int, error) {
-	loggerWithFields := log.WithField("roomID", room.ID).WithField("amount", amount)
+// The request is abandoned should ctx be cancelled, e.g. by the deadline of the page it is for.
+func (m *Client) backpaginateRoom(ctx context.Context, room *Room, amount int) (int, error) {
+	loggerWithFields := Logger(ctx).WithField("roomID", room.ID).WithField("amount", amount)
 	loggerWithFields.Info("Backpaginating Room")
 
 	amount = utils.Max(amount, minimumPagination)
-	resp, err := m.Messages(room.ID, room.backPaginationToken, "", 'b', amount)
+	resp, err := messages(m.withContext(ctx), room.ID, room.backPaginationToken, 'b', amount)
 
 	if err != nil {
+		// giving up on a request is no fault of the homeserver's.
+		if ctx.Err() == nil {
+			recordSyncFailure(err)
+		}
 		loggerWithFields.WithError(err).Error("Failed Backpaginating Room")
 		return -1, err
 	}
 
+	room.observeLazyMembers(resp.State)
 	room.concatBackpagination(resp.Chunk, resp.End)
 	loggerWithFields.Info("Finished Backpaginating Room")
 	return len(resp.Chunk), nil
 }
 
-func (m *Client) forwardpaginateRoom(room *Room, amount int) (int, error) {
-	amount = utils.Max(amount, minimumPagination)
-	resp, err := m.Messages(room.ID, room.forwardPaginationToken, "", 'f', amount)
+// Forward pagination catches up on what the room has missed, and so is a sync, asking for at least SyncTimelineLimit
+// events within SyncTimeout. The request is abandoned should ctx be cancelled.
+func (m *Client) forwardpaginateRoom(ctx context.Context, room *Room, amount int) (int, error) {
+	amount = utils.Max(amount, m.syncTimelineLimit())
+	resp, err := messages(m.syncClient(ctx), room.ID, room.forwardPaginationToken, 'f', amount)
 
 	if err != nil {
+		// giving up on a request is no fault of the homeserver's.
+		if ctx.Err() == nil {
+			recordSyncFailure(err)
+		}
 		return -1, err
 	}
 
 	// I would have thought to use resp.Start here but NOPE
+	room.observeLazyMembers(resp.State)
 	room.concatForwardPagination(resp.Chunk, resp.End)
 	return len(resp.Chunk), nil
 }
 
-// NewRawClient returns a wrapped client with http client timeouts applied.
+// NewRawClient returns a wrapped client with http client timeouts applied, within which transient failures of
+// idempotent requests are retried, and every attempt timed into homeserverRequestDuration.
 func NewRawClient(homeserverURL, mediaBaseURL, userID, accessToken string) (*Client, error) {
 	cli, err := gomatrix.NewClient(homeserverURL, userID, accessToken)
 	cli.Client = &http.Client{
-		Timeout: 30 * time.Second,
+		Timeout:   30 * time.Second,
+		Transport: newHomeserverTransport(),
 	}
-	return &Client{cli, mediaBaseURL}, err
+	return &Client{
+		Client:            cli,
+		MediaBaseURL:      mediaBaseURL,
+		SyncTimelineLimit: DefaultSyncTimelineLimit,
+		SyncTimeout:       DefaultSyncTimeout,
+	}, err
 }
 
 // The struct representing the json config file format.
@@ -116,9 +249,23 @@ type Config struct {
 	RefreshToken string `json:"refresh_token"`
 	UserID       string `json:"user_id"`
 	MediaBaseUrl string `json:"media_base_url"`
+	// ServerName, if set, is resolved via its .well-known to find the homeserver, which HomeServer is used in place of
+	// until it has been found, defaulting to https://ServerName.
+	ServerName string `json:"server_name,omitempty"`
+	// Password, if set, is used to log in as UserID if we have no AccessToken, and again should it be revoked.
+	Password string `json:"password,omitempty"`
+}
+
+func (config *Config) save(configPath string) error {
+	configJson, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(configPath, configJson, 0600)
 }
 
 // NewClient returns a Client configured by the config file found at configPath or an error if encountered.
+// The access token may be supplied by the AccessTokenEnv environment variable instead, else we log in if we can.
 func NewClient(configPath string) (*Client, error) {
 	var config Config
 
@@ -133,13 +280,48 @@ func NewClient(configPath string) (*Client, error) {
 
 	json.Unmarshal(file, &config)
 
-	if config.HomeServer == "" {
+	if config.HomeServer == "" && config.ServerName == "" {
 		return nil, errors.New("no user configuration found")
 	}
 
+	homeserverURL := config.HomeServer
+	if homeserverURL == "" {
+		homeserverURL = "https://" + config.ServerName
+	}
+
+	transport := newHomeserverTransport()
+	var discovery *homeserverDiscovery
+	if config.ServerName != "" {
+		fallbackURL, err := url.Parse(homeserverURL)
+		if err != nil {
+			return nil, err
+		}
+		discovery = newHomeserverDiscovery(config.ServerName, fallbackURL, transport)
+		discovery.resolve()
+		transport = discovery
+	}
+
+	if accessToken := os.Getenv(AccessTokenEnv); accessToken != "" {
+		config.AccessToken = accessToken
+	}
+
+	creds := &credentials{configPath: configPath, config: config, homeserverURL: homeserverURL, transport: transport}
+	if config.AccessToken == "" && config.Password != "" {
+		if err := creds.login(); err != nil {
+			return nil, err
+		}
+		log.WithField("deviceID", creds.config.DeviceID).Info("Logged in")
+	}
+
 	if config.MediaBaseUrl == "" {
-		config.MediaBaseUrl = config.HomeServer
+		config.MediaBaseUrl = homeserverURL
 	}
 
-	return NewRawClient(config.HomeServer, config.MediaBaseUrl, config.UserID, config.AccessToken)
+	cli, err := NewRawClient(homeserverURL, config.MediaBaseUrl, creds.config.UserID, creds.config.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	cli.discovery = discovery
+	cli.Client.Client.Transport = &loginTransport{transport, creds}
+	return cli, nil
 }
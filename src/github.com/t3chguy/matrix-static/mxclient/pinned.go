@@ -0,0 +1,74 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"context"
+	"time"
+)
+
+// PinnedEventRetryInterval is how long a pinned event which could not be fetched is skipped before fetching it again,
+// so that pinned events which are gone or hidden from us are not requested on every render of the room.
+const PinnedEventRetryInterval = 10 * time.Minute
+
+// pinnedEvent is a pinned event fetched from the homeserver, event is nil if it could not be.
+type pinnedEvent struct {
+	event     *Event
+	fetchedAt time.Time
+}
+
+// GetPinnedEvents resolves the first limit events pinned in the room, in the order they are pinned, with edits
+// applied, and counts those pinned which may be resolved. Pinned events which do not exist or which we may not see are
+// skipped, those out of our timeline are fetched within ctx.
+func (r *Room) GetPinnedEvents(ctx context.Context, limit int) (events []Event, numPinned int) {
+	if r.pinnedEvents == nil {
+		r.pinnedEvents = make(map[string]pinnedEvent)
+	}
+
+	for _, eventID := range r.latestRoomState.pinnedEvents {
+		fetched, cached := r.pinnedEvents[eventID]
+		if cached && fetched.event == nil && time.Since(fetched.fetchedAt) < PinnedEventRetryInterval {
+			continue
+		}
+		numPinned++
+		if len(events) >= limit {
+			continue
+		}
+
+		if index, found := r.findEventIndex(eventID, false); found {
+			events = append(events, r.eventList[index])
+			continue
+		}
+
+		if !cached || fetched.event == nil {
+			event, err := r.client.RoomEvent(ctx, r.ID, eventID)
+			if err != nil && ctx.Err() != nil {
+				// giving up on the page is no failure of the event's, the rest would be given up on too.
+				numPinned--
+				break
+			}
+			fetched = pinnedEvent{event, time.Now()}
+			r.pinnedEvents[eventID] = fetched
+		}
+		if fetched.event == nil {
+			numPinned--
+			continue
+		}
+		events = append(events, *fetched.event)
+	}
+
+	events, _ = r.ApplyEdits(events)
+	return events, numPinned
+}
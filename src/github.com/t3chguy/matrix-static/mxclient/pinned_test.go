@@ -0,0 +1,114 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const pinnedInitialSync = `{
+	"messages": {
+		"start": "s0",
+		"end": "s1",
+		"chunk": [
+			{"event_id": "$in", "type": "m.room.message", "sender": "@a:example.org", "origin_server_ts": 1, "content": {"msgtype": "m.text", "body": "in the timeline"}}
+		]
+	},
+	"state": [
+		{"event_id": "$pins", "type": "m.room.pinned_events", "state_key": "", "sender": "@a:example.org", "origin_server_ts": 1,
+			"content": {"pinned": ["$a", "$gone", "$in", "$b", "$c"]}}
+	]
+}`
+
+func pinnedEventJSON(eventID string) string {
+	return `{"event_id": "` + eventID + `", "type": "m.room.message", "sender": "@a:example.org", "origin_server_ts": 1, "content": {"msgtype": "m.text", "body": "pinned"}}`
+}
+
+func eventIDs(events []Event) []string {
+	ids := make([]string, len(events))
+	for i, ev := range events {
+		ids[i] = ev.ID
+	}
+	return ids
+}
+
+func TestGetPinnedEvents(t *testing.T) {
+	hs := newFakeHomeserver(t)
+	for _, eventID := range []string{"$a", "$b", "$c"} {
+		hs.handleJSON("/event/"+eventID, http.StatusOK, pinnedEventJSON(eventID))
+	}
+	hs.handleJSON("/event/$gone", http.StatusNotFound, `{"errcode":"M_NOT_FOUND","error":"Event not found"}`)
+	room := newTestRoom(t, hs, pinnedInitialSync)
+
+	type requests struct{ a, gone, b, c int }
+	numRequests := func() requests {
+		return requests{hs.numRequests("/event/$a"), hs.numRequests("/event/$gone"), hs.numRequests("/event/$b"), hs.numRequests("/event/$c")}
+	}
+
+	tests := []struct {
+		name          string
+		limit         int
+		expireFailure bool
+		wantEvents    []string
+		wantNumPinned int
+		wantRequests  requests
+	}{
+		// $gone may yet resolve, so it is counted until it has been tried.
+		{"resolves only up to the limit", 1, false, []string{"$a"}, 5, requests{1, 0, 0, 0}},
+		{"fetched events are cached", 2, false, []string{"$a", "$in"}, 4, requests{1, 1, 0, 0}},
+		{"failures are cached", 2, false, []string{"$a", "$in"}, 4, requests{1, 1, 0, 0}},
+		{"failures are retried once expired", 2, true, []string{"$a", "$in"}, 4, requests{1, 2, 0, 0}},
+		{"the rest are fetched once within the limit", 5, false, []string{"$a", "$in", "$b", "$c"}, 4, requests{1, 2, 1, 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.expireFailure {
+				gone := room.pinnedEvents["$gone"]
+				gone.fetchedAt = gone.fetchedAt.Add(-PinnedEventRetryInterval)
+				room.pinnedEvents["$gone"] = gone
+			}
+
+			events, numPinned := room.GetPinnedEvents(context.Background(), test.limit)
+			if ids := eventIDs(events); !reflect.DeepEqual(ids, test.wantEvents) || numPinned != test.wantNumPinned {
+				t.Errorf("GetPinnedEvents(%d) = %v, %d, want %v, %d", test.limit, ids, numPinned, test.wantEvents, test.wantNumPinned)
+			}
+			if got := numRequests(); got != test.wantRequests {
+				t.Errorf("requests = %+v, want %+v", got, test.wantRequests)
+			}
+		})
+	}
+}
+
+func TestGetPinnedEventsCancelled(t *testing.T) {
+	hs := newFakeHomeserver(t)
+	hs.handle("/event/$a", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	room := newTestRoom(t, hs, pinnedInitialSync)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	events, numPinned := room.GetPinnedEvents(ctx, 5)
+	if len(events) != 0 || numPinned != 0 {
+		t.Errorf("GetPinnedEvents() = %v, %d, want nothing once cancelled", eventIDs(events), numPinned)
+	}
+	if _, cached := room.pinnedEvents["$a"]; cached {
+		t.Error("giving up on an event was cached as it failing")
+	}
+}
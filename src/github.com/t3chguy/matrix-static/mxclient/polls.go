@@ -0,0 +1,271 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+// The event types of polls according to MSC3381, by their stable names and by the unstable names most clients send.
+const (
+	PollStartType            = "m.poll.start"
+	PollResponseType         = "m.poll.response"
+	PollEndType              = "m.poll.end"
+	UnstablePollStartType    = "org.matrix.msc3381.poll.start"
+	UnstablePollResponseType = "org.matrix.msc3381.poll.response"
+	UnstablePollEndType      = "org.matrix.msc3381.poll.end"
+)
+
+// IsPollStart returns whether the event starts a poll, by either of its names.
+func IsPollStart(ev *Event) bool {
+	return ev.Type == PollStartType || ev.Type == UnstablePollStartType
+}
+
+// PollAnswer is one of the answers a poll may be answered with.
+type PollAnswer struct {
+	ID   string
+	Text string
+}
+
+// Poll is the question & answers of an m.poll.start event.
+type Poll struct {
+	Question string
+	Answers  []PollAnswer
+	// MaxSelections is how many answers each vote may select, only the first that many of a vote are counted.
+	MaxSelections int
+	// Undisclosed polls keep their results hidden until they are closed.
+	Undisclosed bool
+}
+
+// hasAnswer returns whether answerID is one of the answers of the poll.
+func (p *Poll) hasAnswer(answerID string) bool {
+	for _, answer := range p.Answers {
+		if answer.ID == answerID {
+			return true
+		}
+	}
+	return false
+}
+
+// extensibleText returns the plain text of an MSC1767 extensible text field, which is either a string or an array of
+// representations of which we prefer the plain text one.
+func extensibleText(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case []interface{}:
+		var text string
+		for _, representation := range value {
+			representation, _ := representation.(map[string]interface{})
+			body, _ := representation["body"].(string)
+			if mimetype, _ := representation["mimetype"].(string); mimetype == "" || mimetype == "text/plain" {
+				return body
+			}
+			if text == "" {
+				text = body
+			}
+		}
+		return text
+	}
+	return ""
+}
+
+// GetPoll returns the poll started by an m.poll.start event, ok=false if the event does not start a well formed one.
+func GetPoll(ev *Event) (poll *Poll, ok bool) {
+	var textKey, idKey, undisclosedKind string
+	var content map[string]interface{}
+	switch ev.Type {
+	case PollStartType:
+		content, _ = ev.Content["m.poll"].(map[string]interface{})
+		textKey, idKey, undisclosedKind = "m.text", "m.id", "m.undisclosed"
+	case UnstablePollStartType:
+		content, _ = ev.Content[UnstablePollStartType].(map[string]interface{})
+		textKey, idKey, undisclosedKind = "org.matrix.msc1767.text", "id", "org.matrix.msc3381.poll.undisclosed"
+	}
+	if content == nil {
+		return nil, false
+	}
+
+	question, _ := content["question"].(map[string]interface{})
+	poll = &Poll{Question: extensibleText(question[textKey])}
+	if poll.Question == "" {
+		poll.Question, _ = question["body"].(string)
+	}
+
+	answers, _ := content["answers"].([]interface{})
+	for _, answer := range answers {
+		answer, _ := answer.(map[string]interface{})
+		id, _ := answer[idKey].(string)
+		if id == "" || poll.hasAnswer(id) {
+			continue
+		}
+		poll.Answers = append(poll.Answers, PollAnswer{id, extensibleText(answer[textKey])})
+	}
+	if len(poll.Answers) == 0 {
+		return nil, false
+	}
+
+	kind, _ := content["kind"].(string)
+	poll.Undisclosed = kind == undisclosedKind
+
+	poll.MaxSelections = 1
+	if maxSelections, ok := content["max_selections"].(float64); ok && maxSelections > 1 {
+		poll.MaxSelections = int(maxSelections)
+	}
+	return poll, true
+}
+
+// getPollSelections returns the answers selected by an m.poll.response event, ok=false if it is not one.
+func getPollSelections(ev *Event) (selections []string, ok bool) {
+	var values []interface{}
+	switch ev.Type {
+	case PollResponseType:
+		values, ok = ev.Content["m.selections"].([]interface{})
+	case UnstablePollResponseType:
+		response, _ := ev.Content[UnstablePollResponseType].(map[string]interface{})
+		values, ok = response["answers"].([]interface{})
+	}
+	for _, value := range values {
+		if selection, isString := value.(string); isString {
+			selections = append(selections, selection)
+		}
+	}
+	return selections, ok
+}
+
+type pollResponse struct {
+	targetID   string
+	sender     string
+	timestamp  int
+	selections []string
+}
+
+type pollEnd struct {
+	targetID  string
+	sender    string
+	timestamp int
+}
+
+// observePoll records m.poll.response votes and m.poll.end events against the poll they reference, which need not
+// have been loaded yet.
+func (r *Room) observePoll(ev *Event) {
+	relType, targetID, ok := GetRelatesTo(ev)
+	if !ok || relType != "m.reference" {
+		return
+	}
+
+	switch ev.Type {
+	case PollResponseType, UnstablePollResponseType:
+		if selections, ok := getPollSelections(ev); ok {
+			r.pollResponses[ev.ID] = pollResponse{targetID, ev.Sender, ev.Timestamp, selections}
+		}
+	case PollEndType, UnstablePollEndType:
+		r.pollEnds[ev.ID] = pollEnd{targetID, ev.Sender, ev.Timestamp}
+	}
+}
+
+// PollResults are the votes counted for a poll.
+type PollResults struct {
+	// Votes is how many voters selected each answer, by its ID.
+	Votes     map[string]int
+	NumVoters int
+	// Closed polls have been ended, by their sender or by a moderator, at ClosedAt; votes after that are not counted.
+	Closed   bool
+	ClosedAt int
+}
+
+// MaxVotes returns the most votes any answer has.
+func (pr PollResults) MaxVotes() int {
+	var maxVotes int
+	for _, votes := range pr.Votes {
+		if votes > maxVotes {
+			maxVotes = votes
+		}
+	}
+	return maxVotes
+}
+
+// closedAt returns when the poll was first ended by someone allowed to end it, ok=false if it has not been.
+func (r *Room) closedAt(ev *Event) (timestamp int, ok bool) {
+	powerLevels := r.latestRoomState.PowerLevels
+	for _, end := range r.pollEnds {
+		if end.targetID != ev.ID {
+			continue
+		}
+		if end.sender != ev.Sender && powerLevels.UserPowerLevel(end.sender) < powerLevels.Redact {
+			continue
+		}
+		if !ok || end.timestamp < timestamp {
+			timestamp, ok = end.timestamp, true
+		}
+	}
+	return
+}
+
+// tallyPoll counts the votes for poll, started by ev. Only the latest vote of each user is counted, within the answers
+// of the poll & its MaxSelections; votes selecting no answer of the poll, such as spoofed ones, are ignored entirely.
+func (r *Room) tallyPoll(ev *Event, poll *Poll) PollResults {
+	results := PollResults{Votes: make(map[string]int, len(poll.Answers))}
+	results.ClosedAt, results.Closed = r.closedAt(ev)
+
+	latest := make(map[string]string)
+	valid := make(map[string][]string)
+	for responseID, response := range r.pollResponses {
+		if response.targetID != ev.ID || (results.Closed && response.timestamp > results.ClosedAt) {
+			continue
+		}
+
+		var selections []string
+		seen := make(map[string]bool)
+		for _, selection := range response.selections {
+			if poll.hasAnswer(selection) && !seen[selection] && len(selections) < poll.MaxSelections {
+				seen[selection] = true
+				selections = append(selections, selection)
+			}
+		}
+		if len(selections) == 0 {
+			continue
+		}
+		valid[responseID] = selections
+
+		if prevID, ok := latest[response.sender]; ok {
+			prev := r.pollResponses[prevID]
+			if prev.timestamp > response.timestamp || (prev.timestamp == response.timestamp && prevID > responseID) {
+				continue
+			}
+		}
+		latest[response.sender] = responseID
+	}
+
+	for _, responseID := range latest {
+		for _, selection := range valid[responseID] {
+			results.Votes[selection]++
+		}
+	}
+	results.NumVoters = len(latest)
+	return results
+}
+
+// GetPolls counts the votes for the polls among the given events, keyed by the ID of the event starting them.
+// Only the votes in the part of the timeline we have loaded are counted.
+func (r *Room) GetPolls(events []Event) map[string]PollResults {
+	polls := make(map[string]PollResults)
+	for i := range events {
+		ev := &events[i]
+		if !IsPollStart(ev) {
+			continue
+		}
+		if poll, ok := GetPoll(ev); ok {
+			polls[ev.ID] = r.tallyPoll(ev, poll)
+		}
+	}
+	return polls
+}
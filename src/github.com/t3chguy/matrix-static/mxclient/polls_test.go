@@ -0,0 +1,132 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestGetPoll(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		want    *Poll
+		wantNot bool
+	}{
+		{"stable", `{"type":"m.poll.start","content":{"m.poll":{"kind":"m.disclosed","max_selections":2,
+			"question":{"m.text":[{"mimetype":"text/html","body":"<b>Lunch?</b>"},{"body":"Lunch?"}]},
+			"answers":[{"m.id":"pizza","m.text":[{"body":"Pizza"}]},{"m.id":"sushi","m.text":"Sushi"}]}}}`,
+			&Poll{"Lunch?", []PollAnswer{{"pizza", "Pizza"}, {"sushi", "Sushi"}}, 2, false}, false},
+		{"unstable & undisclosed", `{"type":"org.matrix.msc3381.poll.start","content":{"org.matrix.msc3381.poll.start":{
+			"kind":"org.matrix.msc3381.poll.undisclosed","question":{"org.matrix.msc1767.text":"Lunch?"},
+			"answers":[{"id":"pizza","org.matrix.msc1767.text":"Pizza"}]}}}`,
+			&Poll{"Lunch?", []PollAnswer{{"pizza", "Pizza"}}, 1, true}, false},
+		{"the question falls back to its body", `{"type":"m.poll.start","content":{"m.poll":{"question":{"body":"Lunch?"},
+			"answers":[{"m.id":"pizza","m.text":"Pizza"}]}}}`,
+			&Poll{"Lunch?", []PollAnswer{{"pizza", "Pizza"}}, 1, false}, false},
+		{"answers without or of duplicate IDs are dropped", `{"type":"m.poll.start","content":{"m.poll":{"question":{"m.text":"Lunch?"},
+			"answers":[{"m.text":"Nothing"},{"m.id":"pizza","m.text":"Pizza"},{"m.id":"pizza","m.text":"More pizza"}]}}}`,
+			&Poll{"Lunch?", []PollAnswer{{"pizza", "Pizza"}}, 1, false}, false},
+		{"without answers", `{"type":"m.poll.start","content":{"m.poll":{"question":{"m.text":"Lunch?"},"answers":[]}}}`, nil, true},
+		{"of the other name", `{"type":"m.poll.start","content":{"org.matrix.msc3381.poll.start":{"question":{"body":"Lunch?"},
+			"answers":[{"id":"pizza","org.matrix.msc1767.text":"Pizza"}]}}}`, nil, true},
+		{"not a poll", `{"type":"m.room.message","content":{"msgtype":"m.text","body":"Lunch?"}}`, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var ev Event
+			if err := json.Unmarshal([]byte(test.json), &ev); err != nil {
+				t.Fatal(err)
+			}
+			poll, ok := GetPoll(&ev)
+			if ok == test.wantNot || !reflect.DeepEqual(poll, test.want) {
+				t.Errorf("got %+v, %v, want %+v", poll, ok, test.want)
+			}
+		})
+	}
+}
+
+func TestGetPolls(t *testing.T) {
+	const poll = `{"event_id":"$poll","type":"m.poll.start","sender":"@alice:example.org","origin_server_ts":1,
+		"content":{"m.poll":{"max_selections":2,"question":{"m.text":"Lunch?"},
+		"answers":[{"m.id":"pizza","m.text":"Pizza"},{"m.id":"sushi","m.text":"Sushi"},{"m.id":"soup","m.text":"Soup"}]}}}`
+	response := func(id, sender string, ts int, selections ...string) string {
+		return `{"event_id":"` + id + `","type":"m.poll.response","sender":"` + sender + `","origin_server_ts":` + strconv.Itoa(ts) + `,
+			"content":{"m.relates_to":{"rel_type":"m.reference","event_id":"$poll"},"m.selections":["` + strings.Join(selections, `","`) + `"]}}`
+	}
+	end := func(id, sender string, ts int) string {
+		return `{"event_id":"` + id + `","type":"m.poll.end","sender":"` + sender + `","origin_server_ts":` + strconv.Itoa(ts) + `,
+			"content":{"m.relates_to":{"rel_type":"m.reference","event_id":"$poll"}}}`
+	}
+	const powerLevels = `{"event_id":"$pl","type":"m.room.power_levels","state_key":"","sender":"@alice:example.org",
+		"content":{"users":{"@alice:example.org":100,"@mod:example.org":50}}}`
+
+	tests := []struct {
+		name      string
+		events    []string
+		want      map[string]int
+		wantVoter int
+		wantEnd   int
+	}{
+		{"only the latest vote of each user counts", []string{
+			response("$r1", "@bob:example.org", 2, "pizza"),
+			response("$r2", "@bob:example.org", 3, "sushi"),
+			response("$r3", "@carol:example.org", 2, "sushi"),
+		}, map[string]int{"sushi": 2}, 2, 0},
+		{"votes count up to max_selections of the poll's answers", []string{
+			response("$r1", "@bob:example.org", 2, "pizza", "pizza", "burger", "sushi", "soup"),
+		}, map[string]int{"pizza": 1, "sushi": 1}, 1, 0},
+		{"votes for no answer of the poll are ignored", []string{
+			response("$r1", "@bob:example.org", 2, "pizza"),
+			response("$r2", "@bob:example.org", 3, "burger"),
+		}, map[string]int{"pizza": 1}, 1, 0},
+		{"votes after the poll ended are not counted", []string{
+			response("$r1", "@bob:example.org", 2, "pizza"),
+			end("$end", "@alice:example.org", 3),
+			response("$r2", "@carol:example.org", 4, "sushi"),
+		}, map[string]int{"pizza": 1}, 1, 3},
+		{"moderators may end the poll", []string{end("$end", "@mod:example.org", 3)}, map[string]int{}, 0, 3},
+		{"others may not", []string{end("$end", "@bob:example.org", 3)}, map[string]int{}, 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chunk := poll
+			for _, ev := range test.events {
+				chunk = ev + "," + chunk
+			}
+			room := newTestRoom(t, newFakeHomeserver(t), `{"messages":{"start":"s0","end":"e0","chunk":[`+chunk+`]},
+				"state":[`+powerLevels+`]}`)
+
+			var ev Event
+			if err := json.Unmarshal([]byte(poll), &ev); err != nil {
+				t.Fatal(err)
+			}
+			results, ok := room.GetPolls([]Event{ev})["$poll"]
+			if !ok {
+				t.Fatal("the poll was not tallied")
+			}
+			if !reflect.DeepEqual(results.Votes, test.want) || results.NumVoters != test.wantVoter {
+				t.Errorf("got votes %v of %d voters, want %v of %d", results.Votes, results.NumVoters, test.want, test.wantVoter)
+			}
+			if results.Closed != (test.wantEnd != 0) || results.ClosedAt != test.wantEnd {
+				t.Errorf("got closed %v at %d, want closed at %d", results.Closed, results.ClosedAt, test.wantEnd)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pseudonymIDPrefix prefixes the number of each pseudonymous user ID.
+const pseudonymIDPrefix = "@user-"
+
+// Pseudonyms stand in for the users of a room when the Client is anonymizing them. Users are numbered in the order
+// they are first seen, starting with the members of the room when it was loaded by MXID, so that each keeps their
+// pseudonym on every page for as long as the room is held.
+type Pseudonyms struct {
+	numbers map[string]int
+	mxids   []string
+	// assigned tells these pseudonyms apart from those assigned when the room was loaded before, even by another
+	// process, as the same user may be numbered differently by each.
+	assigned time.Time
+}
+
+func newPseudonyms(mxids []string) *Pseudonyms {
+	sort.Strings(mxids)
+	p := &Pseudonyms{
+		numbers:  make(map[string]int, len(mxids)),
+		assigned: time.Now(),
+	}
+	for _, mxid := range mxids {
+		p.number(mxid)
+	}
+	return p
+}
+
+// number returns the number of mxid, assigning it the next one if it is new.
+func (p *Pseudonyms) number(mxid string) int {
+	if number, ok := p.numbers[mxid]; ok {
+		return number
+	}
+	p.mxids = append(p.mxids, mxid)
+	p.numbers[mxid] = len(p.mxids)
+	return len(p.mxids)
+}
+
+// Assigned returns when these pseudonyms were assigned, which identifies them as they change whenever the room is
+// loaded again.
+func (p *Pseudonyms) Assigned() time.Time {
+	return p.assigned
+}
+
+// ID returns the pseudonymous user ID standing in for mxid, which takes its place in links.
+func (p *Pseudonyms) ID(mxid string) string {
+	return pseudonymIDPrefix + strconv.Itoa(p.number(mxid))
+}
+
+// Name returns the pseudonymous display name standing in for mxid.
+func (p *Pseudonyms) Name(mxid string) string {
+	return "User " + strconv.Itoa(p.number(mxid))
+}
+
+// MXID returns the user ID which id stands in for, ok=false if it does not stand in for anyone.
+func (p *Pseudonyms) MXID(id string) (mxid string, ok bool) {
+	if !strings.HasPrefix(id, pseudonymIDPrefix) {
+		return "", false
+	}
+	number, err := strconv.Atoi(strings.TrimPrefix(id, pseudonymIDPrefix))
+	if err != nil || number < 1 || number > len(p.mxids) {
+		return "", false
+	}
+	return p.mxids[number-1], true
+}
+
+// Member returns member under their pseudonym, with no avatar.
+func (p *Pseudonyms) Member(member MemberInfo) MemberInfo {
+	member.DisplayName = p.Name(member.MXID)
+	member.MXID = p.ID(member.MXID)
+	member.AvatarURL = MXCURL{}
+	member.ambiguous = false
+	return member
+}
+
+// MemberMap returns members keyed & named by their pseudonyms.
+func (p *Pseudonyms) MemberMap(members map[string]MemberInfo) map[string]MemberInfo {
+	pseudonymous := make(map[string]MemberInfo, len(members))
+	for _, member := range members {
+		member = p.Member(member)
+		pseudonymous[member.MXID] = member
+	}
+	return pseudonymous
+}
+
+// IDs returns mxids as their pseudonyms.
+func (p *Pseudonyms) IDs(mxids []string) []string {
+	ids := make([]string, len(mxids))
+	for i, mxid := range mxids {
+		ids[i] = p.ID(mxid)
+	}
+	return ids
+}
+
+// mxidRegex matches user IDs wherever they are mentioned.
+var mxidRegex = regexp.MustCompile(`@[a-zA-Z0-9._=\-/+]+:[a-zA-Z0-9.\-]+(:[0-9]+)?`)
+
+// pillRegex matches the links clients make of mentions, named after the display name of the user they mention,
+// whatever other attributes they have and however the link text is marked up. Links may carry a query such as ?via=
+// or further path after the user ID.
+var pillRegex = regexp.MustCompile(`(?is)<a\s[^>]*?href\s*=\s*["']https?://matrix\.to/#/([^"'/?#]+)[^"']*["'][^>]*>.*?</a\s*>`)
+
+// text returns str with every user ID it mentions replaced by their pseudonym, as must the display names of pills.
+func (p *Pseudonyms) text(str string) string {
+	str = pillRegex.ReplaceAllStringFunc(str, func(pill string) string {
+		mxid, err := url.PathUnescape(pillRegex.FindStringSubmatch(pill)[1])
+		if err != nil || mxidRegex.FindString(mxid) != mxid {
+			return pill
+		}
+		return `<a href="https://matrix.to/#/` + p.ID(mxid) + `">` + p.Name(mxid) + `</a>`
+	})
+	return mxidRegex.ReplaceAllStringFunc(str, p.ID)
+}
+
+// value returns a copy of the JSON value v with the user IDs within it replaced, including as keys such as those of
+// the users of m.room.power_levels.
+func (p *Pseudonyms) value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return p.text(v)
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, value := range v {
+			values[i] = p.value(value)
+		}
+		return values
+	case map[string]interface{}:
+		return p.content(v)
+	default:
+		return v
+	}
+}
+
+func (p *Pseudonyms) content(content map[string]interface{}) map[string]interface{} {
+	if content == nil {
+		return nil
+	}
+	pseudonymous := make(map[string]interface{}, len(content))
+	for key, value := range content {
+		pseudonymous[p.text(key)] = p.value(value)
+	}
+	return pseudonymous
+}
+
+// memberContent returns the content of an m.room.member event for mxid, with their profile replaced.
+func (p *Pseudonyms) memberContent(content map[string]interface{}, mxid string) map[string]interface{} {
+	content = p.content(content)
+	if _, ok := content["displayname"]; ok {
+		content["displayname"] = p.Name(mxid)
+	}
+	delete(content, "avatar_url")
+	return content
+}
+
+// Event returns a copy of ev with every user ID within it replaced by their pseudonym and the profiles of members
+// dropped. Of its unsigned data only who redacted it is kept.
+func (p *Pseudonyms) Event(ev Event) Event {
+	if ev.Type == "m.room.member" && ev.StateKey != nil {
+		ev.Content = p.memberContent(ev.Content, *ev.StateKey)
+		ev.PrevContent = p.memberContent(ev.PrevContent, *ev.StateKey)
+	} else {
+		ev.Content = p.content(ev.Content)
+		ev.PrevContent = p.content(ev.PrevContent)
+	}
+
+	ev.Sender = p.ID(ev.Sender)
+	if ev.StateKey != nil {
+		stateKey := p.text(*ev.StateKey)
+		ev.StateKey = &stateKey
+	}
+
+	var unsigned map[string]interface{}
+	if because, ok := ev.Unsigned["redacted_because"].(map[string]interface{}); ok {
+		unsigned = map[string]interface{}{"redacted_because": p.content(because)}
+	}
+	ev.Unsigned = unsigned
+	return ev
+}
+
+// Events returns events with Event applied to each of them.
+func (p *Pseudonyms) Events(events []Event) []Event {
+	pseudonymous := make([]Event, len(events))
+	for i, ev := range events {
+		pseudonymous[i] = p.Event(ev)
+	}
+	return pseudonymous
+}
+
+// EventMap returns events keyed as they were, such as reply targets, with Event applied to each of them.
+func (p *Pseudonyms) EventMap(events map[string]Event) map[string]Event {
+	pseudonymous := make(map[string]Event, len(events))
+	for key, ev := range events {
+		pseudonymous[key] = p.Event(ev)
+	}
+	return pseudonymous
+}
+
+// Reactions returns reactions with their senders replaced.
+func (p *Pseudonyms) Reactions(reactions map[string]ReactionGroups) map[string]ReactionGroups {
+	pseudonymous := make(map[string]ReactionGroups, len(reactions))
+	for eventID, groups := range reactions {
+		pseudonymousGroups := make(ReactionGroups, len(groups))
+		for i, group := range groups {
+			pseudonymousGroups[i] = ReactionGroup{group.Key, p.IDs(group.Senders)}
+		}
+		pseudonymous[eventID] = pseudonymousGroups
+	}
+	return pseudonymous
+}
+
+// Threads returns threads with the senders of their latest replies replaced.
+func (p *Pseudonyms) Threads(threads map[string]ThreadSummary) map[string]ThreadSummary {
+	pseudonymous := make(map[string]ThreadSummary, len(threads))
+	for rootID, summary := range threads {
+		summary.LatestReplySender = p.ID(summary.LatestReplySender)
+		pseudonymous[rootID] = summary
+	}
+	return pseudonymous
+}
+
+// Receipts returns receipts with their readers replaced.
+func (p *Pseudonyms) Receipts(receipts map[string]ReadReceipts) map[string]ReadReceipts {
+	pseudonymous := make(map[string]ReadReceipts, len(receipts))
+	for eventID, receipt := range receipts {
+		pseudonymous[eventID] = ReadReceipts{p.IDs(receipt.Readers), receipt.NumReaders}
+	}
+	return pseudonymous
+}
+
+// UserPowerLevels returns users under their pseudonyms.
+func (p *Pseudonyms) UserPowerLevels(users UserPowerLevels) UserPowerLevels {
+	pseudonymous := make(UserPowerLevels, len(users))
+	for i, user := range users {
+		pseudonymous[i] = UserPowerLevel{p.ID(user.MXID), p.Name(user.MXID), user.PowerLevel}
+	}
+	sort.Sort(pseudonymous)
+	return pseudonymous
+}
+
+// Timestamps returns timestamps keyed by user ID, such as when they were last active, keyed by pseudonym instead.
+func (p *Pseudonyms) Timestamps(timestamps map[string]int) map[string]int {
+	pseudonymous := make(map[string]int, len(timestamps))
+	for mxid, timestamp := range timestamps {
+		pseudonymous[p.ID(mxid)] = timestamp
+	}
+	return pseudonymous
+}
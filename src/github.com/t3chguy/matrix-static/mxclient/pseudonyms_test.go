@@ -0,0 +1,52 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import "testing"
+
+func TestPseudonymsText(t *testing.T) {
+	tests := []struct {
+		name string
+		str  string
+		want string
+	}{
+		{"user ID", "hi @alice:example.org", "hi @user-1"},
+		{"pill", `<a href="https://matrix.to/#/@alice:example.org">Alice</a>: hi`,
+			`<a href="https://matrix.to/#/@user-1">User 1</a>: hi`},
+		{"pill with via", `<a href="https://matrix.to/#/@alice:example.org?via=example.org">Alice</a>`,
+			`<a href="https://matrix.to/#/@user-1">User 1</a>`},
+		{"pill with a fragment", `<a href="https://matrix.to/#/@alice:example.org#x">Alice</a>`,
+			`<a href="https://matrix.to/#/@user-1">User 1</a>`},
+		{"percent-encoded pill", `<a href="https://matrix.to/#/%40alice%3Aexample.org">Alice</a>`,
+			`<a href="https://matrix.to/#/@user-1">User 1</a>`},
+		{"pill with other attributes & single quotes", `<a rel='noopener' href='https://matrix.to/#/@alice:example.org' target=_blank>Alice</a>`,
+			`<a href="https://matrix.to/#/@user-1">User 1</a>`},
+		{"pill with marked up text", `<A HREF="https://matrix.to/#/@bob:example.org"><b>Bob</b>
+</A>`, `<a href="https://matrix.to/#/@user-2">User 2</a>`},
+		{"two pills", `<a href="https://matrix.to/#/@alice:example.org">Alice</a> & <a href="https://matrix.to/#/@bob:example.org">Bob</a>`,
+			`<a href="https://matrix.to/#/@user-1">User 1</a> & <a href="https://matrix.to/#/@user-2">User 2</a>`},
+		{"room links are kept", `<a href="https://matrix.to/#/#room:example.org?via=example.org">#room</a>`,
+			`<a href="https://matrix.to/#/#room:example.org?via=example.org">#room</a>`},
+		{"other links are kept", `<a href="https://example.org/@alice">Alice</a>`, `<a href="https://example.org/@alice">Alice</a>`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := newPseudonyms([]string{"@bob:example.org", "@alice:example.org"})
+			if got := p.text(test.str); got != test.want {
+				t.Errorf("text() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -15,8 +15,10 @@
 package mxclient
 
 import (
+	"errors"
 	"github.com/matrix-org/gomatrix"
 	"github.com/t3chguy/matrix-static/utils"
+	"net/http"
 	"sync"
 )
 
@@ -26,7 +28,7 @@ type WorldReadableRooms struct {
 	rooms      []gomatrix.PublicRoomsChunk
 }
 
-// processRoomDirectory replaces AvatarUrl from mxc to its https counterpart and filters on WorldReadable rooms.
+// processRoomDirectory replaces AvatarUrl from mxc to its thumbnail via our media proxy and filters on WorldReadable rooms.
 func processRoomDirectory(homeserverBaseUrl string, roomList []gomatrix.PublicRoomsChunk) (filteredRooms []gomatrix.PublicRoomsChunk) {
 	for _, room := range roomList {
 		if !room.WorldReadable {
@@ -38,7 +40,7 @@ func processRoomDirectory(homeserverBaseUrl string, roomList []gomatrix.PublicRo
 			room.CanonicalAlias = room.Aliases[0]
 		}
 
-		room.AvatarUrl = NewMXCURL(room.AvatarUrl, homeserverBaseUrl).ToThumbURL(60, 60, "crop")
+		room.AvatarUrl = NewMXCURL(room.AvatarUrl, homeserverBaseUrl).ToProxyThumbURL(60, 60, "crop")
 
 		// Append world readable room to the filtered list.
 		filteredRooms = append(filteredRooms, room)
@@ -71,6 +73,58 @@ func (r *WorldReadableRooms) Update() error {
 	return nil
 }
 
+// ReqPublicRoomsFiltered is the JSON request for POST /publicRooms.
+// gomatrix.PublicRoomsFiltered sends the limit and filter as strings, which homeservers reject.
+type ReqPublicRoomsFiltered struct {
+	Limit  int                `json:"limit,omitempty"`
+	Since  string             `json:"since,omitempty"`
+	Filter *PublicRoomsFilter `json:"filter,omitempty"`
+}
+
+type PublicRoomsFilter struct {
+	GenericSearchTerm string `json:"generic_search_term,omitempty"`
+}
+
+// SearchPublicRooms makes an HTTP request according to https://matrix.org/docs/spec/client_server/r0.6.0#post-matrix-client-r0-publicrooms
+func (m *Client) SearchPublicRooms(limit int, since, searchTerm string) (resp *gomatrix.RespPublicRooms, err error) {
+	req := ReqPublicRoomsFiltered{Limit: limit, Since: since}
+	if searchTerm != "" {
+		req.Filter = &PublicRoomsFilter{searchTerm}
+	}
+	_, err = m.MakeRequest("POST", m.BuildURL("publicRooms"), req, &resp)
+	return
+}
+
+// ErrInvalidDirectoryToken is returned when the homeserver rejects a pagination token, e.g. because it expired.
+var ErrInvalidDirectoryToken = errors.New("room directory pagination token rejected")
+
+// RoomDirectoryPage is a single page of the public room directory,
+// with the tokens to fetch its siblings; empty string means there is no such sibling.
+type RoomDirectoryPage struct {
+	Rooms     []gomatrix.PublicRoomsChunk
+	NextBatch string
+	PrevBatch string
+}
+
+// GetRoomDirectoryPage fetches a page of the public room directory from the homeserver, starting at the since token.
+// Only WorldReadable rooms are returned so the page may hold fewer than limit rooms even if more follow.
+func (m *Client) GetRoomDirectoryPage(since string, limit int, searchTerm string) (*RoomDirectoryPage, error) {
+	resp, err := m.SearchPublicRooms(limit, since, searchTerm)
+	if err != nil {
+		if httpErr, ok := err.(gomatrix.HTTPError); ok && since != "" &&
+			httpErr.Code >= http.StatusBadRequest && httpErr.Code < http.StatusInternalServerError {
+			return nil, ErrInvalidDirectoryToken
+		}
+		return nil, err
+	}
+
+	return &RoomDirectoryPage{
+		Rooms:     processRoomDirectory(m.MediaBaseURL, resp.Chunk),
+		NextBatch: resp.NextBatch,
+		PrevBatch: resp.PrevBatch,
+	}, nil
+}
+
 // For future when we support filtering the public room directory (LOCALLY)
 //func (r *WorldReadableRooms) GetFilteredPage(page, pageSize int, query string) []gomatrix.PublicRoomsChunk {
 //	r.roomsMutex.RLock()
@@ -78,6 +132,26 @@ func (r *WorldReadableRooms) Update() error {
 //	return nil
 //}
 
+// Len returns the number of rooms in the WorldReadableRooms Collection
+func (r *WorldReadableRooms) Len() int {
+	r.roomsMutex.RLock()
+	defer r.roomsMutex.RUnlock()
+	return len(r.rooms)
+}
+
+// Get returns the room of the WorldReadableRooms Collection with the given ID or canonical alias, ok=false if it
+// holds no such room.
+func (r *WorldReadableRooms) Get(roomIDOrAlias string) (room gomatrix.PublicRoomsChunk, ok bool) {
+	r.roomsMutex.RLock()
+	defer r.roomsMutex.RUnlock()
+	for _, room := range r.rooms {
+		if room.RoomID == roomIDOrAlias || room.CanonicalAlias == roomIDOrAlias {
+			return room, true
+		}
+	}
+	return gomatrix.PublicRoomsChunk{}, false
+}
+
 // GetPage returns a paginated slice of the WorldReadableRooms Collection
 func (r *WorldReadableRooms) GetPage(page, pageSize int) []gomatrix.PublicRoomsChunk {
 	r.roomsMutex.RLock()
@@ -0,0 +1,88 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import "sort"
+
+// ReadReceiptsMaxReaders caps how many readers are listed per event, the rest are only counted.
+const ReadReceiptsMaxReaders = 5
+
+type readReceipt struct {
+	eventID   string
+	timestamp int
+}
+
+// observeReceipts records the latest m.read receipt of each user found in an m.receipt event.
+func (r *Room) observeReceipts(ev *Event) {
+	for eventID, receiptTypes := range ev.Content {
+		receiptTypes, _ := receiptTypes.(map[string]interface{})
+		readers, _ := receiptTypes["m.read"].(map[string]interface{})
+		for userID, receipt := range readers {
+			receipt, _ := receipt.(map[string]interface{})
+			timestamp, _ := receipt["ts"].(float64)
+			if existing, ok := r.readReceipts[userID]; !ok || int(timestamp) >= existing.timestamp {
+				r.readReceipts[userID] = readReceipt{eventID, int(timestamp)}
+			}
+		}
+	}
+}
+
+// ReadReceipts lists the users who have read up to an event, most recent first, along with how many more there are.
+type ReadReceipts struct {
+	Readers    []string
+	NumReaders int
+}
+
+type readersByRecency struct {
+	readers  []string
+	receipts map[string]readReceipt
+}
+
+func (rr readersByRecency) Len() int { return len(rr.readers) }
+func (rr readersByRecency) Less(i, j int) bool {
+	a, b := rr.receipts[rr.readers[i]], rr.receipts[rr.readers[j]]
+	if a.timestamp == b.timestamp {
+		return rr.readers[i] < rr.readers[j]
+	}
+	return a.timestamp > b.timestamp
+}
+func (rr readersByRecency) Swap(i, j int) {
+	rr.readers[i], rr.readers[j] = rr.readers[j], rr.readers[i]
+}
+
+// GetReadReceipts returns who has read up to each of the given events, keyed by event ID.
+// Receipts are only received with the initial sync of a room, so they are as of when it was loaded.
+func (r *Room) GetReadReceipts(events []Event) map[string]ReadReceipts {
+	readers := make(map[string][]string)
+	for userID, receipt := range r.readReceipts {
+		readers[receipt.eventID] = append(readers[receipt.eventID], userID)
+	}
+
+	receipts := make(map[string]ReadReceipts)
+	for _, ev := range events {
+		eventReaders, ok := readers[ev.ID]
+		if !ok {
+			continue
+		}
+
+		sort.Sort(readersByRecency{eventReaders, r.readReceipts})
+		numReaders := len(eventReaders)
+		if numReaders > ReadReceiptsMaxReaders {
+			eventReaders = eventReaders[:ReadReceiptsMaxReaders]
+		}
+		receipts[ev.ID] = ReadReceipts{eventReaders, numReaders}
+	}
+	return receipts
+}
@@ -0,0 +1,73 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// receiptsInitialSync returns the initial sync of a room with the events $one & $two, @user1 to @user5 having read up
+// to $two in turn, as has @user0 since reading $one.
+func receiptsInitialSync() string {
+	var readers []string
+	for i := 1; i < 6; i++ {
+		readers = append(readers, fmt.Sprintf(`"@user%d:example.org":{"ts":%d}`, i, i*100))
+	}
+	return `{"messages":{"start":"s0","end":"e0","chunk":[
+			{"event_id":"$one","type":"m.room.message","sender":"@a:example.org","origin_server_ts":1,"content":{"msgtype":"m.text","body":"one"}},
+			{"event_id":"$two","type":"m.room.message","sender":"@a:example.org","origin_server_ts":2,"content":{"msgtype":"m.text","body":"two"}}
+		]},
+		"state":[],
+		"receipts":[
+			{"type":"m.receipt","content":{"$one":{"m.read":{"@user0:example.org":{"ts":50}}}}},
+			{"type":"m.receipt","content":{"$two":{"m.read":{` + strings.Join(readers, ",") + `,"@user0:example.org":{"ts":60}}},
+				"$unknown":{"m.read":{"@other:example.org":{"ts":70}}}}}
+		]}`
+}
+
+func TestGetReadReceipts(t *testing.T) {
+	tests := []struct {
+		name             string
+		showReadReceipts bool
+		want             map[string]ReadReceipts
+	}{
+		{"shown", true, map[string]ReadReceipts{"$two": {
+			Readers:    []string{"@user5:example.org", "@user4:example.org", "@user3:example.org", "@user2:example.org", "@user1:example.org"},
+			NumReaders: 6,
+		}}},
+		{"not shown", false, map[string]ReadReceipts{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hs := newFakeHomeserver(t)
+			hs.handleJSON("/rooms/"+testRoomID+"/initialSync", http.StatusOK, receiptsInitialSync())
+			cli := newTestClient(t, hs)
+			cli.ShowReadReceipts = test.showReadReceipts
+			room, err := cli.NewRoom(context.Background(), testRoomID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := room.GetReadReceipts(room.eventList); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
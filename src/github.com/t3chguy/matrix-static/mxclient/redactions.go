@@ -0,0 +1,111 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+// Redaction describes the m.room.redaction event which redacted an event.
+type Redaction struct {
+	Sender string
+	Reason string
+}
+
+// ByModerator returns whether ev was redacted by someone other than its sender.
+func (r Redaction) ByModerator(ev *Event) bool {
+	return r.Sender != "" && r.Sender != ev.Sender
+}
+
+// GetRedaction returns the redaction of ev from its unsigned redacted_because, ok=false if it has not been redacted.
+func GetRedaction(ev *Event) (redaction Redaction, ok bool) {
+	because, ok := ev.Unsigned["redacted_because"].(map[string]interface{})
+	if !ok {
+		return Redaction{}, false
+	}
+
+	redaction.Sender, _ = because["sender"].(string)
+	if content, ok := because["content"].(map[string]interface{}); ok {
+		redaction.Reason, _ = content["reason"].(string)
+	}
+	return redaction, true
+}
+
+// redactionPreservedKeys are the content keys which survive redaction by event type, as of the redaction algorithm of
+// room version 11 (https://spec.matrix.org/v1.8/rooms/v11/#redactions), which keeps what the room needs to function.
+// m.room.create keeps the whole of its content, & m.room.member the signed part of its third_party_invite.
+var redactionPreservedKeys = map[string][]string{
+	"m.room.member":             {"membership", "join_authorised_via_users_server"},
+	"m.room.join_rules":         {"join_rule", "allow"},
+	"m.room.power_levels":       {"ban", "events", "events_default", "invite", "kick", "redact", "state_default", "users", "users_default"},
+	"m.room.history_visibility": {"history_visibility"},
+	"m.room.redaction":          {"redacts"},
+}
+
+// redactContent returns the content of an event of eventType stripped of all but its redactionPreservedKeys.
+func redactContent(eventType string, content map[string]interface{}) map[string]interface{} {
+	redacted := map[string]interface{}{}
+	if eventType == "m.room.create" {
+		for key, value := range content {
+			redacted[key] = value
+		}
+		return redacted
+	}
+
+	for _, key := range redactionPreservedKeys[eventType] {
+		if value, ok := content[key]; ok {
+			redacted[key] = value
+		}
+	}
+	if eventType == "m.room.member" {
+		if invite, ok := content["third_party_invite"].(map[string]interface{}); ok {
+			if signed, ok := invite["signed"]; ok {
+				redacted["third_party_invite"] = map[string]interface{}{"signed": signed}
+			}
+		}
+	}
+	return redacted
+}
+
+// redactEvent returns a copy of ev with its content stripped, bar the keys the spec preserves, & redacted_because set
+// to redaction, as the server would serve it once redacted.
+func redactEvent(ev Event, redaction *Event) Event {
+	unsigned := make(map[string]interface{}, len(ev.Unsigned)+1)
+	for key, value := range ev.Unsigned {
+		unsigned[key] = value
+	}
+	unsigned["redacted_because"] = map[string]interface{}{
+		"event_id":         redaction.ID,
+		"sender":           redaction.Sender,
+		"type":             redaction.Type,
+		"origin_server_ts": float64(redaction.Timestamp),
+		"content":          redaction.Content,
+	}
+
+	ev.Content = redactContent(ev.Type, ev.Content)
+	ev.Unsigned = unsigned
+	return ev
+}
+
+// applyRedaction redacts the event in the timeline which redaction redacts, if we hold it. Events paginated after
+// being redacted come redacted from the server already, only those we held beforehand need redacting ourselves.
+func (r *Room) applyRedaction(redaction *Event) {
+	redacts := GetRedacts(redaction)
+	if redacts == "" {
+		return
+	}
+	for i := range r.eventList {
+		if r.eventList[i].ID == redacts {
+			r.eventList[i] = redactEvent(r.eventList[i], redaction)
+			return
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"github.com/matrix-org/gomatrix"
+	"reflect"
+	"testing"
+)
+
+func TestRedactContent(t *testing.T) {
+	tests := []struct {
+		eventType string
+		content   map[string]interface{}
+		want      map[string]interface{}
+	}{
+		{"m.room.message", map[string]interface{}{"msgtype": "m.text", "body": "hello"}, map[string]interface{}{}},
+		{"m.room.member",
+			map[string]interface{}{"membership": "join", "displayname": "Alice", "avatar_url": "mxc://example.org/a",
+				"third_party_invite": map[string]interface{}{"display_name": "alice", "signed": "sig"}},
+			map[string]interface{}{"membership": "join", "third_party_invite": map[string]interface{}{"signed": "sig"}}},
+		{"m.room.create", map[string]interface{}{"creator": "@alice:example.org", "room_version": "11"},
+			map[string]interface{}{"creator": "@alice:example.org", "room_version": "11"}},
+		{"m.room.join_rules", map[string]interface{}{"join_rule": "public", "extra": true},
+			map[string]interface{}{"join_rule": "public"}},
+		{"m.room.power_levels", map[string]interface{}{"ban": 50.0, "users": map[string]interface{}{}, "notifications": 50.0},
+			map[string]interface{}{"ban": 50.0, "users": map[string]interface{}{}}},
+		{"m.room.history_visibility", map[string]interface{}{"history_visibility": "world_readable", "extra": true},
+			map[string]interface{}{"history_visibility": "world_readable"}},
+		{"m.room.name", map[string]interface{}{"name": "Room"}, map[string]interface{}{}},
+	}
+	for _, test := range tests {
+		t.Run(test.eventType, func(t *testing.T) {
+			if got := redactContent(test.eventType, test.content); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("redactContent() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRedactEvent(t *testing.T) {
+	stateKey := "@alice:example.org"
+	member := Event{
+		Event: gomatrix.Event{ID: "$member", Type: "m.room.member", Sender: "@alice:example.org", StateKey: &stateKey,
+			Content: map[string]interface{}{"membership": "join", "displayname": "Alice"}},
+		Unsigned: map[string]interface{}{"age": 1000.0},
+	}
+	redaction := func(sender string, content map[string]interface{}) *Event {
+		return &Event{Event: gomatrix.Event{ID: "$redaction", Type: "m.room.redaction", Sender: sender, Content: content}}
+	}
+
+	tests := []struct {
+		name          string
+		redaction     *Event
+		wantReason    string
+		wantModerator bool
+	}{
+		{"with a reason", redaction("@alice:example.org", map[string]interface{}{"reason": "typo"}), "typo", false},
+		{"without a reason", redaction("@alice:example.org", map[string]interface{}{}), "", false},
+		{"by a moderator", redaction("@mod:example.org", map[string]interface{}{"reason": "spam"}), "spam", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			redacted := redactEvent(member, test.redaction)
+
+			got, ok := GetRedaction(&redacted)
+			if !ok || got.Reason != test.wantReason || got.ByModerator(&redacted) != test.wantModerator {
+				t.Errorf("GetRedaction() = %+v, %v, want reason %q & by moderator %v", got, ok, test.wantReason, test.wantModerator)
+			}
+			if want := map[string]interface{}{"membership": "join"}; !reflect.DeepEqual(redacted.Content, want) {
+				t.Errorf("redacted content %v, want %v", redacted.Content, want)
+			}
+			if redacted.StateKey != member.StateKey || redacted.Unsigned["age"] != 1000.0 {
+				t.Errorf("redaction lost the state key or unsigned age: %+v", redacted)
+			}
+			if _, ok := GetRedaction(&member); ok || member.Content["displayname"] != "Alice" {
+				t.Errorf("redaction modified the original event: %+v", member)
+			}
+		})
+	}
+}
+
+func TestApplyRedaction(t *testing.T) {
+	hs := newFakeHomeserver(t)
+	room := newTestRoom(t, hs, `{"messages":{"start":"s0","end":"e0","chunk":[
+		{"event_id":"$message","type":"m.room.message","sender":"@alice:example.org","content":{"msgtype":"m.text","body":"oops"}}
+	]},"state":[]}`)
+
+	room.applyRedaction(&Event{
+		Event:   gomatrix.Event{ID: "$redaction", Type: "m.room.redaction", Sender: "@mod:example.org", Content: map[string]interface{}{}},
+		Redacts: "$message",
+	})
+
+	message := room.eventList[0]
+	redaction, ok := GetRedaction(&message)
+	if !ok || redaction.Reason != "" || !redaction.ByModerator(&message) || len(message.Content) != 0 {
+		t.Errorf("got %+v redacted by %+v, %v, want it redacted by @mod:example.org", message, redaction, ok)
+	}
+}
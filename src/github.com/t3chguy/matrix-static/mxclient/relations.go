@@ -0,0 +1,290 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// GetRelatesTo returns the rel_type and event_id of the m.relates_to of the event, ok=false if it has none.
+func GetRelatesTo(ev *Event) (relType, eventID string, ok bool) {
+	relatesTo, ok := ev.Content["m.relates_to"].(map[string]interface{})
+	if !ok {
+		return "", "", false
+	}
+
+	relType, _ = relatesTo["rel_type"].(string)
+	eventID, _ = relatesTo["event_id"].(string)
+	return relType, eventID, eventID != ""
+}
+
+// GetRedacts returns the ID of the event redacted by an m.room.redaction event.
+func GetRedacts(ev *Event) string {
+	if ev.Redacts != "" {
+		return ev.Redacts
+	}
+	// newer room versions move redacts into the content.
+	redacts, _ := ev.Content["redacts"].(string)
+	return redacts
+}
+
+// GetInReplyTo returns the ID of the event this event is a reply to, empty string if it is not a reply.
+func GetInReplyTo(ev *Event) string {
+	relatesTo, _ := ev.Content["m.relates_to"].(map[string]interface{})
+	inReplyTo, _ := relatesTo["m.in_reply_to"].(map[string]interface{})
+	eventID, _ := inReplyTo["event_id"].(string)
+	return eventID
+}
+
+// StripReplyFallback removes the rich reply fallback ("> <@user:server> ..." lines up to the first blank line) from
+// the start of the plaintext body.
+func StripReplyFallback(body string) string {
+	if !strings.HasPrefix(body, "> ") {
+		return body
+	}
+
+	lines := strings.Split(body, "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(line, ">") {
+			if line == "" {
+				i++
+			}
+			return strings.Join(lines[i:], "\n")
+		}
+	}
+	return ""
+}
+
+var mxReplyRegex = regexp.MustCompile(`(?s)^\s*<mx-reply>.*?</mx-reply>`)
+
+// StripReplyFallbackHTML removes the rich reply fallback <mx-reply> block from the start of the formatted body.
+func StripReplyFallbackHTML(formattedBody string) string {
+	return mxReplyRegex.ReplaceAllString(formattedBody, "")
+}
+
+type annotation struct {
+	targetID string
+	key      string
+	sender   string
+}
+
+type replacement struct {
+	targetID   string
+	sender     string
+	timestamp  int
+	newContent map[string]interface{}
+}
+
+// Edit describes the m.replace event which has been applied to an event.
+type Edit struct {
+	EventID   string
+	Timestamp int
+}
+
+// IsEdit returns whether the event is an m.replace edit of another event.
+func IsEdit(ev *Event) bool {
+	relType, _, ok := GetRelatesTo(ev)
+	return ok && relType == "m.replace"
+}
+
+// ReactionGroup is a single reaction key and the users who reacted with it.
+type ReactionGroup struct {
+	Key     string
+	Senders []string
+}
+
+// Count returns the number of users who reacted with this key.
+func (rg ReactionGroup) Count() int {
+	return len(rg.Senders)
+}
+
+// implements sort.Interface
+type ReactionGroups []ReactionGroup
+
+func (p ReactionGroups) Len() int { return len(p) }
+func (p ReactionGroups) Less(i, j int) bool {
+	a, b := p[i], p[j]
+	if a.Count() == b.Count() {
+		// Secondary Sort is Low->High Lexicographically on Key
+		return a.Key < b.Key
+	}
+	// Primary Sort is High->Low on Count
+	return a.Count() > b.Count()
+}
+func (p ReactionGroups) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+
+// observeRelations records m.reaction annotations, m.replace edits, thread replies and poll votes, and forgets them again when
+// redacted.
+// Redacted reactions have no content so are never recorded in the first place.
+func (r *Room) observeRelations(ev *Event) {
+	r.observeThreadReply(ev)
+	r.observePoll(ev)
+
+	switch ev.Type {
+	case "m.reaction":
+		relType, targetID, ok := GetRelatesTo(ev)
+		if !ok || relType != "m.annotation" {
+			return
+		}
+
+		relatesTo := ev.Content["m.relates_to"].(map[string]interface{})
+		if key, ok := relatesTo["key"].(string); ok && key != "" {
+			r.annotations[ev.ID] = annotation{targetID, key, ev.Sender}
+		}
+	case "m.room.message":
+		if !IsEdit(ev) {
+			return
+		}
+
+		_, targetID, _ := GetRelatesTo(ev)
+		newContent, ok := ev.Content["m.new_content"].(map[string]interface{})
+		if !ok {
+			// fall back to the fallback body of the edit itself, dropping its "* " prefix.
+			newContent = make(map[string]interface{}, len(ev.Content))
+			for key, value := range ev.Content {
+				newContent[key] = value
+			}
+			delete(newContent, "m.relates_to")
+			if body, ok := newContent["body"].(string); ok {
+				newContent["body"] = strings.TrimPrefix(body, "* ")
+			}
+		}
+		r.replacements[ev.ID] = replacement{targetID, ev.Sender, ev.Timestamp, newContent}
+	case "m.room.redaction":
+		redacts := GetRedacts(ev)
+		delete(r.annotations, redacts)
+		delete(r.replacements, redacts)
+		delete(r.pollResponses, redacts)
+		delete(r.pollEnds, redacts)
+		for _, replies := range r.threadReplies {
+			delete(replies, redacts)
+		}
+	}
+}
+
+// ApplyEdits returns a copy of events with the latest m.replace edit applied to each of them, and a map of the edits
+// applied keyed by the ID of the event edited. Only edits made by the sender of the original event are applied, and
+// none to redacted events, which would otherwise be restored by them.
+func (r *Room) ApplyEdits(events []Event) ([]Event, map[string]Edit) {
+	index := make(map[string]int, len(events))
+	for i, ev := range events {
+		index[ev.ID] = i
+	}
+
+	latest := make(map[string]string)
+	for editID, edit := range r.replacements {
+		i, ok := index[edit.targetID]
+		if !ok || events[i].Sender != edit.sender {
+			continue
+		}
+		if _, redacted := GetRedaction(&events[i]); redacted {
+			continue
+		}
+
+		if prevID, ok := latest[edit.targetID]; ok {
+			prev := r.replacements[prevID]
+			if prev.timestamp > edit.timestamp || (prev.timestamp == edit.timestamp && prevID > editID) {
+				continue
+			}
+		}
+		latest[edit.targetID] = editID
+	}
+
+	editedEvents := make([]Event, len(events))
+	copy(editedEvents, events)
+
+	edits := make(map[string]Edit, len(latest))
+	for targetID, editID := range latest {
+		edit := r.replacements[editID]
+		ev := &editedEvents[index[targetID]]
+
+		content := make(map[string]interface{}, len(edit.newContent)+1)
+		for key, value := range edit.newContent {
+			content[key] = value
+		}
+		// m.new_content never carries m.relates_to, so keep that of the original (e.g. reply relations).
+		if relatesTo, ok := ev.Content["m.relates_to"]; ok {
+			content["m.relates_to"] = relatesTo
+		}
+
+		ev.Content = content
+		edits[targetID] = Edit{editID, edit.timestamp}
+	}
+	return editedEvents, edits
+}
+
+// GetReplyTargets returns the events replied to by the given events, keyed by their ID, with edits applied.
+// Only events already loaded into the room are returned.
+func (r *Room) GetReplyTargets(events []Event) map[string]Event {
+	targets := make(map[string]Event)
+	for _, ev := range events {
+		replyTo := GetInReplyTo(&ev)
+		if replyTo == "" {
+			continue
+		}
+		if _, ok := targets[replyTo]; ok {
+			continue
+		}
+
+		if index, found := r.findEventIndex(replyTo, false); found {
+			edited, _ := r.ApplyEdits(r.eventList[index : index+1])
+			targets[replyTo] = edited[0]
+		}
+	}
+	return targets
+}
+
+// GetReactions aggregates the reactions to the given events, keyed by the ID of the event reacted to.
+// Reactions to events outside of the given events are ignored.
+func (r *Room) GetReactions(events []Event) map[string]ReactionGroups {
+	wanted := make(map[string]bool, len(events))
+	for _, ev := range events {
+		wanted[ev.ID] = true
+	}
+
+	// targetID -> key -> sender set
+	aggregated := make(map[string]map[string]map[string]bool)
+	for _, a := range r.annotations {
+		if !wanted[a.targetID] {
+			continue
+		}
+
+		if aggregated[a.targetID] == nil {
+			aggregated[a.targetID] = make(map[string]map[string]bool)
+		}
+		if aggregated[a.targetID][a.key] == nil {
+			aggregated[a.targetID][a.key] = make(map[string]bool)
+		}
+		aggregated[a.targetID][a.key][a.sender] = true
+	}
+
+	reactions := make(map[string]ReactionGroups, len(aggregated))
+	for targetID, keys := range aggregated {
+		groups := make(ReactionGroups, 0, len(keys))
+		for key, senderSet := range keys {
+			senders := make([]string, 0, len(senderSet))
+			for sender := range senderSet {
+				senders = append(senders, sender)
+			}
+			sort.Strings(senders)
+			groups = append(groups, ReactionGroup{key, senders})
+		}
+		sort.Sort(groups)
+		reactions[targetID] = groups
+	}
+	return reactions
+}
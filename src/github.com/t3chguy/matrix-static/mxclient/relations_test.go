@@ -0,0 +1,147 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+)
+
+func TestStripReplyFallback(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"not a reply", "hello", "hello"},
+		{"single line fallback", "> <@alice:example.org> hi\n\nhello", "hello"},
+		{"multi-line fallback", "> <@alice:example.org> hi\n> how are you?\n> \n> well?\n\nfine thanks\nand you?",
+			"fine thanks\nand you?"},
+		{"without the blank line", "> <@alice:example.org> hi\nhello", "hello"},
+		{"only the fallback", "> <@alice:example.org> hi\n> there", ""},
+		{"quotes later on are kept", "hello\n> quoted", "hello\n> quoted"},
+		{"quotes without a space are not fallbacks", ">.< hello", ">.< hello"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := StripReplyFallback(test.body); got != test.want {
+				t.Errorf("StripReplyFallback(%q) = %q, want %q", test.body, got, test.want)
+			}
+		})
+	}
+}
+
+func TestStripReplyFallbackHTML(t *testing.T) {
+	tests := []struct {
+		name          string
+		formattedBody string
+		want          string
+	}{
+		{"not a reply", "<b>hello</b>", "<b>hello</b>"},
+		{"multi-line fallback", "<mx-reply><blockquote>\n<a href=\"https://matrix.to/#/!r:example.org/$e\">In reply to</a>\n" +
+			"<br>hi<br>there\n</blockquote></mx-reply><b>hello</b>", "<b>hello</b>"},
+		{"fallbacks are only at the start", "hello <mx-reply>quoted</mx-reply>", "hello <mx-reply>quoted</mx-reply>"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := StripReplyFallbackHTML(test.formattedBody); got != test.want {
+				t.Errorf("StripReplyFallbackHTML(%q) = %q, want %q", test.formattedBody, got, test.want)
+			}
+		})
+	}
+}
+
+func TestApplyEdits(t *testing.T) {
+	edit := func(id, sender string, timestamp int, body string) string {
+		return `{"event_id":"` + id + `","type":"m.room.message","sender":"` + sender + `","origin_server_ts":` +
+			strconv.Itoa(timestamp) + `,"content":{"msgtype":"m.text","body":"* ` + body + `",
+			"m.new_content":{"msgtype":"m.text","body":"` + body + `"},
+			"m.relates_to":{"rel_type":"m.replace","event_id":"$original"}}}`
+	}
+	original := `{"event_id":"$original","type":"m.room.message","sender":"@alice:example.org","origin_server_ts":1,
+		"content":{"msgtype":"m.text","body":"first"}}`
+
+	tests := []struct {
+		name       string
+		edits      []string
+		wantBody   string
+		wantEditID string
+	}{
+		{"a chain of edits resolves to the latest", []string{
+			edit("$second", "@alice:example.org", 2, "second"),
+			edit("$third", "@alice:example.org", 3, "third"),
+		}, "third", "$third"},
+		{"whichever order they were loaded in", []string{
+			edit("$third", "@alice:example.org", 3, "third"),
+			edit("$second", "@alice:example.org", 2, "second"),
+		}, "third", "$third"},
+		{"edits by other senders are ignored", []string{
+			edit("$second", "@alice:example.org", 2, "second"),
+			edit("$forged", "@mallory:example.org", 3, "forged"),
+		}, "second", "$second"},
+		{"even when they are the only edits", []string{
+			edit("$forged", "@mallory:example.org", 2, "forged"),
+		}, "first", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chunk := original
+			for _, edit := range test.edits {
+				chunk = edit + "," + chunk
+			}
+			room := newTestRoom(t, newFakeHomeserver(t), `{"messages":{"start":"s0","end":"e0","chunk":[`+chunk+`]},"state":[]}`)
+
+			var ev Event
+			if err := json.Unmarshal([]byte(original), &ev); err != nil {
+				t.Fatal(err)
+			}
+			edited, edits := room.ApplyEdits([]Event{ev})
+			if got := edited[0].Content["body"]; got != test.wantBody {
+				t.Errorf("body = %v, want %q", got, test.wantBody)
+			}
+			if got := edits["$original"].EventID; got != test.wantEditID {
+				t.Errorf("applied edit %q, want %q", got, test.wantEditID)
+			}
+			if ev.Content["body"] != "first" {
+				t.Errorf("the original event was edited in place, its body is now %v", ev.Content["body"])
+			}
+		})
+	}
+}
+
+func TestApplyEditsRedacted(t *testing.T) {
+	const (
+		edit = `{"event_id":"$edit","type":"m.room.message","sender":"@alice:example.org","origin_server_ts":2,
+			"content":{"msgtype":"m.text","body":"* restored","m.new_content":{"msgtype":"m.text","body":"restored"},
+			"m.relates_to":{"rel_type":"m.replace","event_id":"$original"}}}`
+		original = `{"event_id":"$original","type":"m.room.message","sender":"@alice:example.org","origin_server_ts":1,
+			"content":{},"unsigned":{"redacted_because":{"sender":"@mod:example.org","content":{"reason":"spam"}}}}`
+	)
+	room := newTestRoom(t, newFakeHomeserver(t), `{"messages":{"start":"s0","end":"e0","chunk":[`+edit+`,`+original+`]},"state":[]}`)
+
+	var ev Event
+	if err := json.Unmarshal([]byte(original), &ev); err != nil {
+		t.Fatal(err)
+	}
+	// the edit would otherwise bring back the content the redaction removed.
+	edited, edits := room.ApplyEdits([]Event{ev})
+	if body, ok := edited[0].Content["body"]; ok || len(edits) != 0 {
+		t.Errorf("got body %v & edits %v, want the redacted event left without content", body, edits)
+	}
+	if _, redacted := GetRedaction(&edited[0]); !redacted {
+		t.Error("the event is no longer marked as redacted")
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"strings"
+)
+
+// RepeatCompareLength is how many runes of each message are compared, so that floods of long messages stay cheap.
+const RepeatCompareLength = 512
+
+// normalizeMessageText folds the case & whitespace of a message body, runs of which spam varies between repeats.
+func normalizeMessageText(body string) []rune {
+	runes := []rune(strings.ToLower(strings.Join(strings.Fields(body), " ")))
+	if len(runes) > RepeatCompareLength {
+		runes = runes[:RepeatCompareLength]
+	}
+	return runes
+}
+
+// textSimilarity is 1 minus the edit distance between a and b relative to the longer of the two,
+// 1 for identical texts and 0 for entirely different ones.
+func textSimilarity(a, b []rune) float64 {
+	if len(a) < len(b) {
+		a, b = b, a
+	}
+	if len(a) == 0 {
+		return 1
+	}
+
+	// Levenshtein distance, keeping only the previous row.
+	row := make([]int, len(b)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		diagonal := row[0]
+		row[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			next := diagonal + cost
+			if row[j]+1 < next {
+				next = row[j] + 1
+			}
+			if row[j-1]+1 < next {
+				next = row[j-1] + 1
+			}
+			diagonal, row[j] = row[j], next
+		}
+	}
+	return 1 - float64(row[len(b)])/float64(len(a))
+}
+
+// repeatableText returns the normalized body of a message which may be part of a run of repeats.
+func repeatableText(ev *Event) ([]rune, bool) {
+	if ev.Type != "m.room.message" {
+		return nil, false
+	}
+	body, ok := ev.Content["body"].(string)
+	if !ok {
+		return nil, false
+	}
+	return normalizeMessageText(body), true
+}
+
+// SplitRepeatedMessages splits any run of at least minRun consecutive messages from the same sender, each at least
+// similarity (0 to 1) similar to the first of the run once normalized, out of chunks which are not already Collapsed.
+// A similarity <= 0 or minRun < 2 disables splitting.
+func SplitRepeatedMessages(chunks []TimelineChunk, similarity float64, minRun int) []TimelineChunk {
+	if similarity <= 0 || minRun < 2 {
+		return chunks
+	}
+
+	var split []TimelineChunk
+	for _, chunk := range chunks {
+		if chunk.Collapsed {
+			split = append(split, chunk)
+			continue
+		}
+
+		events, start := chunk.Events, 0
+		for i := 0; i < len(events); {
+			first, ok := repeatableText(&events[i])
+			end := i + 1
+			if ok {
+				for end < len(events) && events[end].Sender == events[i].Sender {
+					text, ok := repeatableText(&events[end])
+					if !ok || textSimilarity(first, text) < similarity {
+						break
+					}
+					end++
+				}
+			}
+
+			if end-i >= minRun {
+				if start < i {
+					split = append(split, TimelineChunk{Events: events[start:i]})
+				}
+				split = append(split, TimelineChunk{Events: events[i:end], Repeated: true})
+				start = end
+			}
+			i = end
+		}
+		if start < len(events) {
+			split = append(split, TimelineChunk{Events: events[start:]})
+		}
+	}
+	return split
+}
@@ -0,0 +1,102 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"github.com/matrix-org/gomatrix"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTextSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"", "", 1},
+		{"buy now", "buy now", 1},
+		{"Buy   NOW", "buy now", 1},
+		{"buy now!", "buy now", 0.875},
+		{"abcd", "wxyz", 0},
+		{"kitten", "sitting", 1 - 3.0/7},
+	}
+	for _, test := range tests {
+		t.Run(test.a+"/"+test.b, func(t *testing.T) {
+			a, b := normalizeMessageText(test.a), normalizeMessageText(test.b)
+			if got, reversed := textSimilarity(a, b), textSimilarity(b, a); math.Abs(got-test.want) > 1e-9 || got != reversed {
+				t.Errorf("got %v (%v reversed), want %v", got, reversed, test.want)
+			}
+		})
+	}
+
+	// only the start of long messages is compared.
+	long := normalizeMessageText(strings.Repeat("spam ", RepeatCompareLength))
+	if len(long) != RepeatCompareLength {
+		t.Errorf("normalized %d runes, want %d", len(long), RepeatCompareLength)
+	}
+}
+
+func TestSplitRepeatedMessages(t *testing.T) {
+	message := func(eventID, sender, body string) Event {
+		return Event{Event: gomatrix.Event{ID: eventID, Type: "m.room.message", Sender: sender,
+			Content: map[string]interface{}{"msgtype": "m.text", "body": body}}}
+	}
+	const spammer, other = "@spam:example.org", "@other:example.org"
+	events := []Event{
+		message("$hello", other, "hello"),
+		message("$s1", spammer, "BUY NOW"),
+		message("$s2", spammer, "buy now!"),
+		message("$s3", spammer, "buy  now"),
+		message("$different", spammer, "sorry about that"),
+		message("$s4", other, "buy now"),
+		message("$s5", other, "buy now"),
+	}
+	join := Event{Event: gomatrix.Event{ID: "$join", Type: "m.room.member", Sender: spammer}}
+
+	tests := []struct {
+		name       string
+		chunks     []TimelineChunk
+		similarity float64
+		minRun     int
+		want       [][]string
+		repeated   []bool
+	}{
+		{"runs of repeats", []TimelineChunk{{Events: events}}, 0.8, 2,
+			[][]string{{"$hello"}, {"$s1", "$s2", "$s3"}, {"$different"}, {"$s4", "$s5"}}, []bool{false, true, false, true}},
+		{"runs too short", []TimelineChunk{{Events: events}}, 0.8, 3,
+			[][]string{{"$hello"}, {"$s1", "$s2", "$s3"}, {"$different", "$s4", "$s5"}}, []bool{false, true, false}},
+		{"too dissimilar", []TimelineChunk{{Events: events}}, 0.9, 3,
+			[][]string{eventIDs(events)}, []bool{false}},
+		{"collapsed chunks are left be", []TimelineChunk{{Events: events[1:4], Collapsed: true}, {Events: []Event{join}}}, 0.8, 2,
+			[][]string{{"$s1", "$s2", "$s3"}, {"$join"}}, []bool{false, false}},
+		{"disabled by similarity", []TimelineChunk{{Events: events}}, 0, 2, [][]string{eventIDs(events)}, []bool{false}},
+		{"disabled by run length", []TimelineChunk{{Events: events}}, 0.8, 1, [][]string{eventIDs(events)}, []bool{false}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got [][]string
+			var repeated []bool
+			for _, chunk := range SplitRepeatedMessages(test.chunks, test.similarity, test.minRun) {
+				got = append(got, eventIDs(chunk.Events))
+				repeated = append(repeated, chunk.Repeated)
+			}
+			if !reflect.DeepEqual(got, test.want) || !reflect.DeepEqual(repeated, test.repeated) {
+				t.Errorf("got chunks %v repeated %v, want %v repeated %v", got, repeated, test.want, test.repeated)
+			}
+		})
+	}
+}
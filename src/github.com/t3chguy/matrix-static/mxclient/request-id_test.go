@@ -0,0 +1,138 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"context"
+	log "github.com/Sirupsen/logrus"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const testInitialSync = `{"messages":{"start":"s1","end":"e1","chunk":[]},"state":[]}`
+
+// logCapture is a logrus hook keeping every entry logged while it is installed.
+type logCapture struct {
+	entries []*log.Entry
+}
+
+func (h *logCapture) Levels() []log.Level { return log.AllLevels }
+
+func (h *logCapture) Fire(entry *log.Entry) error {
+	h.entries = append(h.entries, entry)
+	return nil
+}
+
+func captureLogs(t *testing.T) *logCapture {
+	hook := &logCapture{}
+	log.AddHook(hook)
+	t.Cleanup(func() { log.StandardLogger().Hooks = make(log.LevelHooks) })
+	return hook
+}
+
+func TestRequestIDReachesHomeserver(t *testing.T) {
+	deadline, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"no request ID", context.Background(), ""},
+		{"request ID without a deadline", WithRequestID(context.Background(), "abc123"), "abc123"},
+		{"request ID within a deadline", WithRequestID(deadline, "def456"), "def456"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hs := newFakeHomeserver(t)
+			gotHeaders := make(map[string]string)
+			for _, suffix := range []string{"/initialSync", "/messages", "/event/$event"} {
+				suffix := suffix
+				hs.handle(suffix, func(w http.ResponseWriter, r *http.Request) {
+					gotHeaders[suffix] = r.Header.Get(RequestIDHeader)
+					w.Header().Set("Content-Type", "application/json")
+					switch suffix {
+					case "/initialSync":
+						w.Write([]byte(testInitialSync))
+					case "/messages":
+						w.Write([]byte(`{"start":"s1","end":"s0","chunk":[]}`))
+					default:
+						w.Write([]byte(`{"event_id":"$event","type":"m.room.message"}`))
+					}
+				})
+			}
+
+			cli := newTestClient(t, hs)
+			room, err := cli.NewRoom(test.ctx, testRoomID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := cli.backpaginateRoom(test.ctx, room, 10); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := cli.RoomEvent(test.ctx, testRoomID, "$event"); err != nil {
+				t.Fatal(err)
+			}
+
+			for suffix, got := range gotHeaders {
+				if got != test.want {
+					t.Errorf("%s sent %s %q, want %q", suffix, RequestIDHeader, got, test.want)
+				}
+			}
+			if len(gotHeaders) != 3 {
+				t.Errorf("homeserver saw %d of the 3 requests", len(gotHeaders))
+			}
+		})
+	}
+}
+
+func TestBackpaginateRoomLogsRequestID(t *testing.T) {
+	hook := captureLogs(t)
+
+	hs := newFakeHomeserver(t)
+	hs.handleJSON("/messages", http.StatusOK, `{"start":"s1","end":"s0","chunk":[]}`)
+	room := newTestRoom(t, hs, testInitialSync)
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want interface{}
+	}{
+		{"tagged with the request ID", WithRequestID(context.Background(), "abc123"), "abc123"},
+		{"untagged without one", context.Background(), nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hook.entries = nil
+			if _, err := room.client.backpaginateRoom(test.ctx, room, 10); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(hook.entries) == 0 {
+				t.Fatal("nothing was logged")
+			}
+			for _, entry := range hook.entries {
+				if got := entry.Data["request_id"]; got != test.want {
+					t.Errorf("%q logged with request_id %v, want %v", entry.Message, got, test.want)
+				}
+				if got := entry.Data["roomID"]; got != testRoomID {
+					t.Errorf("%q logged with roomID %v, want %v", entry.Message, got, testRoomID)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// MaxRequestRetries caps how many times a request to the homeserver is retried after failing transiently.
+const MaxRequestRetries = 3
+
+// RetryBaseDelay is how long we wait before the first retry, doubling for each subsequent retry up to RetryMaxDelay.
+const RetryBaseDelay = 250 * time.Millisecond
+const RetryMaxDelay = 5 * time.Second
+
+// retryTransport retries idempotent requests which fail with a network error, a 5xx or a 429 with exponential backoff,
+// giving up once the next attempt could not be made before the deadline of the request.
+type retryTransport struct {
+	next http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if (req.Method != "GET" && req.Method != "HEAD") || req.Body != nil {
+		return t.next.RoundTrip(req)
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+		if attempt >= MaxRequestRetries || !shouldRetry(resp, err) {
+			return resp, err
+		}
+
+		delay := retryDelay(attempt, resp)
+		if deadline, ok := req.Context().Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return resp, err
+		}
+
+		// the response is being discarded, drain it so that the connection may be reused.
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// shouldRetry returns whether the failure may be transient, other 4xx responses will only fail again.
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// retryDelay returns how long to wait before the retry following attempt, as told by Retry-After if we were rate
+// limited, capped at RetryMaxDelay regardless so that one slow request does not hold up a worker indefinitely.
+func retryDelay(attempt int, resp *http.Response) time.Duration {
+	delay := RetryBaseDelay << uint(attempt)
+	if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			delay = time.Duration(seconds) * time.Second
+		} else if retryAfter, err := http.ParseTime(resp.Header.Get("Retry-After")); err == nil {
+			delay = time.Until(retryAfter)
+		}
+	}
+
+	if delay > RetryMaxDelay {
+		return RetryMaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,124 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeTransport answers the requests made through it with statuses in turn, counting them.
+type fakeTransport struct {
+	statuses   []int
+	retryAfter string
+	attempts   int
+}
+
+func (t *fakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	status := t.statuses[t.attempts]
+	t.attempts++
+	resp := &http.Response{StatusCode: status, Header: make(http.Header), Body: ioutil.NopCloser(strings.NewReader("{}"))}
+	if status == http.StatusTooManyRequests {
+		resp.Header.Set("Retry-After", t.retryAfter)
+	}
+	return resp, nil
+}
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		retryAfter   string
+		timeout      time.Duration
+		wantStatus   int
+		wantAttempts int
+		minElapsed   time.Duration
+	}{
+		{"fails twice then succeeds", []int{502, 503, 200}, "", 0, 200, 3, RetryBaseDelay * 3},
+		{"permanent error is not retried", []int{404}, "", 0, 404, 1, 0},
+		{"gives up after the last retry", []int{500, 500, 500, 500}, "", 0, 500, MaxRequestRetries + 1, 0},
+		{"rate limited waits for Retry-After", []int{429, 200}, "1", 0, 200, 2, time.Second},
+		{"rate limited past the deadline gives up", []int{429, 200}, "3", 2 * time.Second, 429, 1, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			if test.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, test.timeout)
+				defer cancel()
+			}
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://homeserver.invalid/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			next := &fakeTransport{statuses: test.statuses, retryAfter: test.retryAfter}
+			start := time.Now()
+			resp, err := (&retryTransport{next}).RoundTrip(req)
+			elapsed := time.Since(start)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != test.wantStatus || next.attempts != test.wantAttempts {
+				t.Errorf("got %d after %d attempts, want %d after %d", resp.StatusCode, next.attempts, test.wantStatus, test.wantAttempts)
+			}
+			if elapsed < test.minElapsed {
+				t.Errorf("took %v, want at least %v", elapsed, test.minElapsed)
+			}
+		})
+	}
+}
+
+func TestRetryTransportNotIdempotent(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPut, "http://homeserver.invalid/", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := &fakeTransport{statuses: []int{503, 200}}
+	if resp, _ := (&retryTransport{next}).RoundTrip(req); resp.StatusCode != 503 || next.attempts != 1 {
+		t.Errorf("got %d after %d attempts, want the 503 without a retry", resp.StatusCode, next.attempts)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	rateLimited := func(retryAfter string) *http.Response {
+		return &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {retryAfter}}}
+	}
+	tests := []struct {
+		name    string
+		attempt int
+		resp    *http.Response
+		want    time.Duration
+	}{
+		{"first retry", 0, nil, RetryBaseDelay},
+		{"backs off exponentially", 2, &http.Response{StatusCode: 503}, RetryBaseDelay * 4},
+		{"capped", 10, nil, RetryMaxDelay},
+		{"Retry-After in seconds", 0, rateLimited("2"), 2 * time.Second},
+		{"Retry-After capped", 0, rateLimited("3600"), RetryMaxDelay},
+		{"invalid Retry-After backs off", 1, rateLimited("soon"), RetryBaseDelay * 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := retryDelay(test.attempt, test.resp); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -14,6 +14,12 @@
 
 package mxclient
 
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
 type PowerLevel int
 
 // TODO don't bother with this and have a map similar to react-sdk "Roles.js"
@@ -62,6 +68,11 @@ type MemberInfo struct {
 	DisplayName string
 	AvatarURL   MXCURL
 	PowerLevel  PowerLevel
+	// JoinedAt is when the user last joined (unix millis), 0 if we have not seen them do so.
+	JoinedAt int
+
+	// ambiguous is whether the DisplayName could be mistaken for another user, see disambiguateDisplayNames.
+	ambiguous bool
 }
 
 // NewMemberInfo returns a new MemberInfo with defaults (membership=leave) applied.
@@ -72,13 +83,109 @@ func NewMemberInfo(mxid string) *MemberInfo {
 	}
 }
 
-// GetName returns either the user's DisplayName, or if empty, their MXID.
-// TODO make this disambiguate users if their DisplayName is not unique,
-// implementation tips say to make a map of DisplayNames (or Set?) -> MXID?
+// GetName returns either the user's DisplayName, followed by their MXID if the DisplayName is ambiguous, or if empty,
+// their MXID.
 func (memberInfo MemberInfo) GetName() string {
-	if memberInfo.DisplayName != "" {
-		return memberInfo.DisplayName
-	} else {
+	if memberInfo.DisplayName == "" {
 		return memberInfo.MXID
+	} else if memberInfo.ambiguous {
+		return memberInfo.DisplayName + " (" + memberInfo.MXID + ")"
+	} else {
+		return memberInfo.DisplayName
+	}
+}
+
+// isCurrent returns whether the user has joined or is invited to the room.
+func (memberInfo MemberInfo) isCurrent() bool {
+	return memberInfo.Membership == "join" || memberInfo.Membership == "invite"
+}
+
+var mxidLikeRegex = regexp.MustCompile(`@[^\s:]+:\S+`)
+
+// disambiguateDisplayNames marks the members whose DisplayName is also that of a current member other than themselves,
+// or which contains something resembling an MXID, as per the spec's rules for calculating display names, so that
+// nobody may pass themselves off as someone else.
+func disambiguateDisplayNames(memberMap map[string]*MemberInfo) {
+	numWithDisplayName := make(map[string]int)
+	for _, member := range memberMap {
+		if member.isCurrent() {
+			numWithDisplayName[member.DisplayName]++
+		}
+	}
+
+	for _, member := range memberMap {
+		numOthers := numWithDisplayName[member.DisplayName]
+		if member.isCurrent() {
+			numOthers--
+		}
+		member.ambiguous = member.DisplayName != "" && (numOthers > 0 || mxidLikeRegex.MatchString(member.DisplayName))
+	}
+}
+
+// The power levels from which members are grouped as admins and moderators, matching the roles of riot-web.
+const (
+	AdminPowerLevel     PowerLevel = 100
+	ModeratorPowerLevel PowerLevel = 50
+)
+
+// implements sort.Interface
+type membersByName []*MemberInfo
+
+func (ml membersByName) Len() int { return len(ml) }
+func (ml membersByName) Less(i, j int) bool {
+	nameA, nameB := strings.ToLower(ml[i].GetName()), strings.ToLower(ml[j].GetName())
+	if nameA == nameB {
+		return ml[i].MXID < ml[j].MXID
+	}
+	return nameA < nameB
+}
+func (ml membersByName) Swap(i, j int) { ml[i], ml[j] = ml[j], ml[i] }
+
+type MemberGroups struct {
+	Admins     []*MemberInfo
+	Moderators []*MemberInfo
+	Others     []*MemberInfo
+}
+
+// GroupMembers splits members by their role, each group sorted Low->High Lexicographically on GetName().
+func GroupMembers(members []*MemberInfo) (groups MemberGroups) {
+	for _, member := range members {
+		switch {
+		case member.PowerLevel >= AdminPowerLevel:
+			groups.Admins = append(groups.Admins, member)
+		case member.PowerLevel >= ModeratorPowerLevel:
+			groups.Moderators = append(groups.Moderators, member)
+		default:
+			groups.Others = append(groups.Others, member)
+		}
+	}
+
+	sort.Sort(membersByName(groups.Admins))
+	sort.Sort(membersByName(groups.Moderators))
+	sort.Sort(membersByName(groups.Others))
+	return
+}
+
+// The orders members may be listed in.
+const (
+	MemberSortName   = "name"
+	MemberSortJoined = "joined"
+	MemberSortActive = "active"
+)
+
+// SortMembers re-sorts members (sorted by name) most recent first by when they joined or were last active according to
+// lastActive, with those we know no such time of last, as sorted by name. Any other sortBy leaves them sorted by name.
+func SortMembers(members []*MemberInfo, sortBy string, lastActive map[string]int) {
+	var key func(member *MemberInfo) int
+	switch sortBy {
+	case MemberSortJoined:
+		key = func(member *MemberInfo) int { return member.JoinedAt }
+	case MemberSortActive:
+		key = func(member *MemberInfo) int { return lastActive[member.MXID] }
+	default:
+		return
 	}
+	sort.SliceStable(members, func(i, j int) bool {
+		return key(members[i]) > key(members[j])
+	})
 }
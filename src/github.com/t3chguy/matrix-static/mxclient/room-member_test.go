@@ -0,0 +1,118 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"reflect"
+	"testing"
+)
+
+func memberNames(members []*MemberInfo) []string {
+	names := make([]string, len(members))
+	for i, member := range members {
+		names[i] = member.GetName()
+	}
+	return names
+}
+
+func TestGroupMembers(t *testing.T) {
+	members := []*MemberInfo{
+		{MXID: "@zed:example.org", DisplayName: "zed", PowerLevel: 0},
+		{MXID: "@root:example.org", DisplayName: "Root", PowerLevel: 100},
+		{MXID: "@owner:example.org", DisplayName: "Owner", PowerLevel: 150},
+		{MXID: "@mod:example.org", DisplayName: "Mod", PowerLevel: 50},
+		{MXID: "@helper:example.org", DisplayName: "Helper", PowerLevel: 75},
+		{MXID: "@almost:example.org", DisplayName: "Almost", PowerLevel: 49},
+		{MXID: "@muted:example.org", DisplayName: "muted", PowerLevel: -1},
+		// members of the same name are in the order of their MXIDs.
+		{MXID: "@b:example.org", DisplayName: "Alex", PowerLevel: 0},
+		{MXID: "@a:example.org", DisplayName: "alex", PowerLevel: 0},
+	}
+	groups := GroupMembers(members)
+
+	tests := []struct {
+		name  string
+		group []*MemberInfo
+		want  []string
+	}{
+		{"admins", groups.Admins, []string{"Owner", "Root"}},
+		{"moderators", groups.Moderators, []string{"Helper", "Mod"}},
+		{"others", groups.Others, []string{"alex", "Alex", "Almost", "muted", "zed"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := memberNames(test.group); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDisambiguateDisplayNames(t *testing.T) {
+	memberMap := map[string]*MemberInfo{
+		"@unique:example.org":   {MXID: "@unique:example.org", Membership: "join", DisplayName: "Unique"},
+		"@alice:example.org":    {MXID: "@alice:example.org", Membership: "join", DisplayName: "Alice"},
+		"@impostor:example.org": {MXID: "@impostor:example.org", Membership: "invite", DisplayName: "Alice"},
+		"@mxid:example.org":     {MXID: "@mxid:example.org", Membership: "join", DisplayName: "@admin:example.org"},
+		"@embeds:example.org":   {MXID: "@embeds:example.org", Membership: "join", DisplayName: "really @admin:example.org"},
+		// members who have left do not make the names of those still in the room ambiguous, though theirs are.
+		"@former:example.org":   {MXID: "@former:example.org", Membership: "leave", DisplayName: "Unique"},
+		"@nameless:example.org": {MXID: "@nameless:example.org", Membership: "join"},
+	}
+	disambiguateDisplayNames(memberMap)
+
+	want := map[string]string{
+		"@unique:example.org":   "Unique",
+		"@alice:example.org":    "Alice (@alice:example.org)",
+		"@impostor:example.org": "Alice (@impostor:example.org)",
+		"@mxid:example.org":     "@admin:example.org (@mxid:example.org)",
+		"@embeds:example.org":   "really @admin:example.org (@embeds:example.org)",
+		"@former:example.org":   "Unique (@former:example.org)",
+		"@nameless:example.org": "@nameless:example.org",
+	}
+	for mxid, wantName := range want {
+		if got := memberMap[mxid].GetName(); got != wantName {
+			t.Errorf("%s is named %q, want %q", mxid, got, wantName)
+		}
+	}
+}
+
+func TestSortMembers(t *testing.T) {
+	lastActive := map[string]int{"@c:example.org": 30, "@b:example.org": 20}
+	tests := []struct {
+		sortBy string
+		want   []string
+	}{
+		{MemberSortName, []string{"a", "b", "c", "d"}},
+		{"unknown", []string{"a", "b", "c", "d"}},
+		// members we know no such time of are left last, sorted by name.
+		{MemberSortJoined, []string{"b", "a", "c", "d"}},
+		{MemberSortActive, []string{"c", "b", "a", "d"}},
+	}
+	for _, test := range tests {
+		t.Run(test.sortBy, func(t *testing.T) {
+			members := []*MemberInfo{
+				{MXID: "@a:example.org", DisplayName: "a", JoinedAt: 10},
+				{MXID: "@b:example.org", DisplayName: "b", JoinedAt: 20},
+				{MXID: "@c:example.org", DisplayName: "c"},
+				{MXID: "@d:example.org", DisplayName: "d"},
+			}
+			SortMembers(members, test.sortBy, lastActive)
+			if got := memberNames(members); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -16,8 +16,8 @@ package mxclient
 
 import (
 	"encoding/json"
-	"github.com/matrix-org/gomatrix"
 	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -33,16 +33,59 @@ type PowerLevels struct {
 	UsersDefault  PowerLevel            `json:"users_default"`
 }
 
+// DefaultPowerLevels returns the levels the spec applies for any keys missing from an m.room.power_levels event.
+func DefaultPowerLevels() PowerLevels {
+	return PowerLevels{
+		Ban:           50,
+		EventsDefault: 0,
+		Invite:        0,
+		Kick:          50,
+		Redact:        50,
+		StateDefault:  50,
+		UsersDefault:  0,
+	}
+}
+
+// EventTypes returns the event types with a specific power level requirement, sorted lexicographically.
+func (pl PowerLevels) EventTypes() []string {
+	eventTypes := make([]string, 0, len(pl.Events))
+	for eventType := range pl.Events {
+		eventTypes = append(eventTypes, eventType)
+	}
+	sort.Strings(eventTypes)
+	return eventTypes
+}
+
+// UserPowerLevel returns the power level of mxid, UsersDefault unless it has one of its own.
+func (pl PowerLevels) UserPowerLevel(mxid string) PowerLevel {
+	if powerLevel, ok := pl.Users[mxid]; ok {
+		return powerLevel
+	}
+	return pl.UsersDefault
+}
+
+// Tombstone describes the room which replaced this one, ReplacementRoomID is empty if it has not been replaced.
+type Tombstone struct {
+	Body              string
+	ReplacementRoomID string
+}
+
 type RoomState struct {
 	client *Client
 
 	Creator        string
 	Topic          string
+	topicHTML      string
 	Name           string
 	canonicalAlias string
+	altAliases     []string
+	pinnedEvents   []string
+	tombstone      Tombstone
 	AvatarURL      MXCURL
 	aliasMap       map[string][]string
 	Aliases        RoomAliases
+	// imagePacks are the emoticons of each image pack by shortcode, keyed by the type & state key of its event.
+	imagePacks map[string]map[string]string
 
 	PowerLevels PowerLevels
 	serverList  []ServerUserCount
@@ -53,9 +96,10 @@ type RoomState struct {
 // NewRoomState creates a RoomState with defaults applied.
 func NewRoomState(client *Client) *RoomState {
 	return &RoomState{
-		client:    client,
-		MemberMap: make(map[string]*MemberInfo),
-		aliasMap:  make(map[string][]string),
+		client:     client,
+		MemberMap:  make(map[string]*MemberInfo),
+		aliasMap:   make(map[string][]string),
+		imagePacks: make(map[string]map[string]string),
 	}
 }
 
@@ -70,7 +114,7 @@ func (rs *RoomState) GetNumMemberEvents() int {
 }
 
 // UpdateOnEvent iterates the Room State based on the event observed.
-func (rs *RoomState) UpdateOnEvent(event *gomatrix.Event, usePrevContent bool) {
+func (rs *RoomState) UpdateOnEvent(event *Event, usePrevContent bool) {
 	if event.StateKey == nil {
 		return
 	}
@@ -97,7 +141,18 @@ func (rs *RoomState) UpdateOnEvent(event *gomatrix.Event, usePrevContent bool) {
 		if alias, ok := event.Content["alias"].(string); ok {
 			rs.canonicalAlias = alias
 		}
+		// alt_aliases is replaced wholesale, so a missing field means there are none.
+		rs.altAliases = nil
+		if altAliases, ok := event.Content["alt_aliases"].([]interface{}); ok {
+			for _, alias := range altAliases {
+				if alias, ok := alias.(string); ok && alias != "" {
+					rs.altAliases = append(rs.altAliases, alias)
+				}
+			}
+		}
 	case "m.room.create":
+		// creator was dropped from the content in room version 11 as it is always the sender.
+		rs.Creator = event.Sender
 		if creator, ok := event.Content["creator"].(string); ok {
 			rs.Creator = creator
 		}
@@ -123,6 +178,10 @@ func (rs *RoomState) UpdateOnEvent(event *gomatrix.Event, usePrevContent bool) {
 		}
 
 		if membership, ok := event.Content["membership"].(string); ok {
+			// profile changes are also joins, but only a change of membership to join is when they joined.
+			if membership == "join" && currentMemberState.Membership != "join" {
+				currentMemberState.JoinedAt = event.Timestamp
+			}
 			currentMemberState.Membership = membership
 		}
 		if avatarUrl, ok := event.Content["avatar_url"].(string); ok {
@@ -131,10 +190,19 @@ func (rs *RoomState) UpdateOnEvent(event *gomatrix.Event, usePrevContent bool) {
 		if displayName, ok := event.Content["displayname"].(string); ok {
 			currentMemberState.DisplayName = displayName
 		}
+	case "m.room.pinned_events":
+		rs.pinnedEvents = nil
+		if pinned, ok := event.Content["pinned"].([]interface{}); ok {
+			for _, eventID := range pinned {
+				if eventID, ok := eventID.(string); ok && eventID != "" {
+					rs.pinnedEvents = append(rs.pinnedEvents, eventID)
+				}
+			}
+		}
 	case "m.room.power_levels":
 		// ez convert to powerLevels
 		if data, err := json.Marshal(event.Content); err == nil {
-			var powerLevels PowerLevels
+			powerLevels := DefaultPowerLevels()
 			err = json.Unmarshal(data, &powerLevels)
 			if err == nil {
 				rs.PowerLevels = powerLevels
@@ -148,11 +216,17 @@ func (rs *RoomState) UpdateOnEvent(event *gomatrix.Event, usePrevContent bool) {
 	case "m.room.topic":
 		if topic, ok := event.Content["topic"].(string); ok {
 			rs.Topic = topic
+			rs.topicHTML = rs.renderTopic(event.Content)
 		}
+	case "m.room.tombstone":
+		rs.tombstone.Body, _ = event.Content["body"].(string)
+		rs.tombstone.ReplacementRoomID, _ = event.Content["replacement_room"].(string)
 	case "m.room.avatar":
 		if url, ok := event.Content["url"].(string); ok {
 			rs.AvatarURL = *NewMXCURL(url, rs.client.MediaBaseURL)
 		}
+	case imagePackEventType, unstableImagePackEventType:
+		rs.imagePacks[event.Type+"\x00"+stateKey] = parseImagePack(event.Content)
 	}
 }
 
@@ -166,6 +240,8 @@ func (rs *RoomState) RecalculateMemberListAndServers() {
 		}
 	}
 
+	disambiguateDisplayNames(rs.MemberMap)
+
 	// Filter list of members with Membership=join
 	memberList := make(MemberList, 0)
 	for _, member := range rs.MemberMap {
@@ -212,6 +288,17 @@ func (rs RoomState) Members() []*MemberInfo {
 	return rs.memberList
 }
 
+// CurrentMembers returns the users who have joined or are invited to the room, in no particular order.
+func (rs RoomState) CurrentMembers() []*MemberInfo {
+	members := make([]*MemberInfo, 0, len(rs.memberList))
+	for _, member := range rs.MemberMap {
+		if member.isCurrent() {
+			members = append(members, member)
+		}
+	}
+	return members
+}
+
 type ServerUserCount struct {
 	ServerName string
 	NumUsers   int
@@ -253,19 +340,173 @@ func (p RoomAliases) Less(i, j int) bool {
 }
 func (p RoomAliases) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
 
+// OriginServer returns the server name of the homeserver the room was created on, empty if we do not know.
+func (rs RoomState) OriginServer() string {
+	if mxidSplit := strings.SplitN(rs.Creator, ":", 2); len(mxidSplit) == 2 {
+		return mxidSplit[1]
+	}
+	return ""
+}
+
+// MaxViaServers caps how many servers permalinks suggest joining the room via.
+const MaxViaServers = 3
+
+// ViaServers returns the servers the most joined users are on, which are the most likely to remain in the room and so
+// to be able to join others to it.
+func (rs RoomState) ViaServers() []string {
+	servers := make([]string, 0, MaxViaServers)
+	for i := 0; i < len(rs.serverList) && i < MaxViaServers; i++ {
+		servers = append(servers, rs.serverList[i].ServerName)
+	}
+	return servers
+}
+
 // Servers iterates over the Member List (membership=join), splits each MXID and counts the number of each homeserver url.
 func (rs RoomState) Servers() []ServerUserCount {
 	return rs.serverList
 }
 
-// Partial implementation of http://matrix.org/docs/spec/client_server/r0.2.0.html#calculating-the-display-name-for-a-room
-// Does not handle based on members if there is no Name/Alias (yet)
-func (rs RoomState) CalculateName() string {
+// maxRoomHeroes is how many members rooms lacking a name are named after, at most.
+const maxRoomHeroes = 2
+
+// roomHeroes returns the first maxRoomHeroes by MXID of the current members other than ourselves, whom rooms lacking a
+// name or avatar are represented by as we have no room summary to pick them by, and how many such members there are.
+func (rs RoomState) roomHeroes() (heroes []*MemberInfo, numOthers int) {
+	var ownUserID string
+	if rs.client != nil && rs.client.Client != nil {
+		ownUserID = rs.client.UserID
+	}
+
+	for _, member := range rs.MemberMap {
+		if !member.isCurrent() || member.MXID == ownUserID {
+			continue
+		}
+		numOthers++
+
+		heroes = append(heroes, member)
+		sort.Slice(heroes, func(i, j int) bool {
+			return heroes[i].MXID < heroes[j].MXID
+		})
+		if len(heroes) > maxRoomHeroes {
+			heroes = heroes[:maxRoomHeroes]
+		}
+	}
+	return
+}
+
+// Implementation of https://spec.matrix.org/v1.6/client-server-api/#calculating-the-display-name-for-a-room
+// naming rooms with neither a name nor an alias after their members, e.g. "Alice and 4 others", by the names nameOf
+// gives them, or by the roomID itself if there is nobody to name them after.
+func (rs RoomState) CalculateName(roomID string, nameOf func(MemberInfo) string) string {
 	if rs.Name != "" {
 		return rs.Name
 	}
 	if rs.canonicalAlias != "" {
 		return rs.canonicalAlias
 	}
-	return "Empty Room"
+
+	heroes, numOthers := rs.roomHeroes()
+	switch numOthers {
+	case 0:
+		return roomID
+	case 1:
+		return nameOf(*heroes[0])
+	case 2:
+		return nameOf(*heroes[0]) + " and " + nameOf(*heroes[1])
+	default:
+		return nameOf(*heroes[0]) + " and " + strconv.Itoa(numOthers-1) + " others"
+	}
+}
+
+// CalculateAvatar returns the avatar of the room, falling back for 1:1 rooms without one on that of the member the room
+// is with: the only other member than ourselves, or of two the one who was invited to it rather than created it.
+func (rs RoomState) CalculateAvatar() MXCURL {
+	if rs.AvatarURL.IsValid() {
+		return rs.AvatarURL
+	}
+
+	heroes, numOthers := rs.roomHeroes()
+	switch {
+	case numOthers == 1:
+		return heroes[0].AvatarURL
+	case numOthers == 2 && heroes[0].MXID == rs.Creator:
+		return heroes[1].AvatarURL
+	case numOthers == 2 && heroes[1].MXID == rs.Creator:
+		return heroes[0].AvatarURL
+	}
+	return rs.AvatarURL
+}
+
+type UserPowerLevel struct {
+	MXID       string
+	Name       string
+	PowerLevel PowerLevel
+}
+
+// implements sort.Interface
+type UserPowerLevels []UserPowerLevel
+
+func (p UserPowerLevels) Len() int { return len(p) }
+func (p UserPowerLevels) Less(i, j int) bool {
+	a, b := p[i], p[j]
+	if a.PowerLevel == b.PowerLevel {
+		// Secondary sort is Low->High Lexicographically on MXID
+		return a.MXID < b.MXID
+	}
+
+	// Primary Sort is High->Low on PowerLevel
+	return a.PowerLevel > b.PowerLevel
+}
+func (p UserPowerLevels) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+
+// UserPowerLevels returns the users whose power level differs from UsersDefault, named after their membership if any.
+func (rs *RoomState) UserPowerLevels() UserPowerLevels {
+	userPowerLevels := make(UserPowerLevels, 0, len(rs.PowerLevels.Users))
+	for mxid, powerLevel := range rs.PowerLevels.Users {
+		if powerLevel == rs.PowerLevels.UsersDefault {
+			continue
+		}
+
+		name := mxid
+		if member, ok := rs.MemberMap[mxid]; ok {
+			name = member.GetName()
+		}
+		userPowerLevels = append(userPowerLevels, UserPowerLevel{mxid, name, powerLevel})
+	}
+	sort.Sort(userPowerLevels)
+	return userPowerLevels
+}
+
+// formattedTopic returns the HTML of the topic from either its m.topic content block or formatted_body, if any.
+func formattedTopic(content map[string]interface{}) (string, bool) {
+	if representations, ok := content["m.topic"].([]interface{}); ok {
+		for _, representation := range representations {
+			representation, _ := representation.(map[string]interface{})
+			if representation["mimetype"] == "text/html" {
+				if body, ok := representation["body"].(string); ok {
+					return body, true
+				}
+			}
+		}
+	}
+	if content["format"] == "org.matrix.custom.html" {
+		formattedBody, ok := content["formatted_body"].(string)
+		return formattedBody, ok
+	}
+	return "", false
+}
+
+// renderTopic returns the topic as sanitized HTML, its plaintext with URLs linkified if it has no HTML.
+// Without a Sanitizer there is no HTML and the plaintext topic is to be used alone.
+func (rs *RoomState) renderTopic(content map[string]interface{}) string {
+	if rs.client == nil || rs.client.Sanitizer == nil {
+		return ""
+	}
+
+	if formatted, ok := formattedTopic(content); ok {
+		if sanitized, ok := rs.client.Sanitizer.Sanitize(formatted); ok {
+			return sanitized
+		}
+	}
+	return rs.client.Sanitizer.Linkify(rs.Topic)
 }
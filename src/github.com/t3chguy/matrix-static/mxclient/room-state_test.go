@@ -0,0 +1,262 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"context"
+	"github.com/t3chguy/matrix-static/sanitizer"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRoomInfoAliases(t *testing.T) {
+	tests := []struct {
+		name      string
+		state     string
+		wantAlias string
+		wantAlt   []string
+	}{
+		{"canonical alias & alternatives", `{"type":"m.room.canonical_alias","state_key":"","event_id":"$alias",
+			"content":{"alias":"#lobby:example.org","alt_aliases":["#hall:example.org","",1,"#foyer:other.org"]}}`,
+			"#lobby:example.org", []string{"#hall:example.org", "#foyer:other.org"}},
+		{"no alias", `{"type":"m.room.topic","state_key":"","event_id":"$topic","content":{"topic":"hi"}}`, "", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			room := newTestRoom(t, newFakeHomeserver(t), `{"messages":{"start":"s0","end":"e0","chunk":[]},"state":[`+test.state+`]}`)
+			info := room.RoomInfo()
+			if info.CanonicalAlias != test.wantAlias || !reflect.DeepEqual(info.AltAliases, test.wantAlt) {
+				t.Errorf("got alias %q with alternatives %v, want %q with %v", info.CanonicalAlias, info.AltAliases, test.wantAlias, test.wantAlt)
+			}
+		})
+	}
+}
+
+func TestRoomInfoTopic(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"formatted", `{"topic":"Rules","format":"org.matrix.custom.html","formatted_body":"<b>Rules</b><script>alert(1)</script>"}`,
+			"<b>Rules</b>"},
+		{"m.topic content block", `{"topic":"Rules","m.topic":[{"mimetype":"text/plain","body":"Rules"},
+			{"mimetype":"text/html","body":"<i>Rules</i>"}]}`, "<i>Rules</i>"},
+		{"plaintext with a bare URL", `{"topic":"<Rules> at https://example.org/rules"}`,
+			`&lt;Rules&gt; at <a href="https://example.org/rules" target="_blank" rel="noopener">https://example.org/rules</a>`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hs := newFakeHomeserver(t)
+			hs.handleJSON("/rooms/"+testRoomID+"/initialSync", http.StatusOK, `{"messages":{"start":"s0","end":"e0","chunk":[]},
+				"state":[{"type":"m.room.topic","state_key":"","event_id":"$topic","content":`+test.content+`}]}`)
+			cli := newTestClient(t, hs)
+			cli.Sanitizer = sanitizer.InitSanitizer()
+			room, err := cli.NewRoom(context.Background(), testRoomID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSpace(room.RoomInfo().TopicHTML); got != test.want {
+				t.Errorf("got topic %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRoomInfoTombstone(t *testing.T) {
+	tests := []struct {
+		name  string
+		state string
+		want  Tombstone
+	}{
+		{"tombstoned", `{"type":"m.room.tombstone","state_key":"","event_id":"$tombstone",
+			"content":{"body":"We moved","replacement_room":"!new:example.org"}}`, Tombstone{"We moved", "!new:example.org"}},
+		{"not tombstoned", `{"type":"m.room.topic","state_key":"","event_id":"$topic","content":{"topic":"hi"}}`, Tombstone{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			room := newTestRoom(t, newFakeHomeserver(t), `{"messages":{"start":"s0","end":"e0","chunk":[]},"state":[`+test.state+`]}`)
+			if got := room.RoomInfo().Tombstone; got != test.want {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+// memberJSON returns the m.room.member event of mxid with membership.
+func memberJSON(mxid, membership string) string {
+	return `{"type":"m.room.member","state_key":"` + mxid + `","sender":"` + mxid + `","event_id":"$` + mxid + `",
+		"content":{"membership":"` + membership + `"}}`
+}
+
+func TestServers(t *testing.T) {
+	state := []string{
+		memberJSON("@a:big.org", "join"), memberJSON("@b:big.org", "join"), memberJSON("@c:big.org", "join"),
+		memberJSON("@a:small.org", "join"), memberJSON("@b:small.org", "join"),
+		memberJSON("@a:tie.org", "join"), memberJSON("@a:alsotie.org", "join"),
+		// only members who are in the room count towards their server.
+		memberJSON("@d:big.org", "leave"), memberJSON("@a:invited.org", "invite"), memberJSON("@a:banned.org", "ban"),
+		memberJSON("@a:host.org:8448", "join"),
+	}
+	room := newTestRoom(t, newFakeHomeserver(t), `{"messages":{"start":"s0","end":"e0","chunk":[]},"state":[`+strings.Join(state, ",")+`]}`)
+
+	want := []ServerUserCount{{"big.org", 3}, {"small.org", 2}, {"alsotie.org", 1}, {"host.org:8448", 1}, {"tie.org", 1}}
+	if got := room.GetState().Servers(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestOriginServer(t *testing.T) {
+	tests := []struct {
+		name   string
+		create string
+		want   string
+	}{
+		{"creator in the content", `{"type":"m.room.create","state_key":"","sender":"@admin:origin.org","event_id":"$create",
+			"content":{"creator":"@admin:origin.org","room_version":"10"}}`, "origin.org"},
+		{"room version 11 without creator", `{"type":"m.room.create","state_key":"","sender":"@admin:origin.org:8448","event_id":"$create",
+			"content":{"room_version":"11"}}`, "origin.org:8448"},
+		{"no create event", `{"type":"m.room.topic","state_key":"","event_id":"$topic","content":{"topic":"hi"}}`, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			room := newTestRoom(t, newFakeHomeserver(t), `{"messages":{"start":"s0","end":"e0","chunk":[]},"state":[`+test.create+`]}`)
+			if got := room.GetState().OriginServer(); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestViaServers(t *testing.T) {
+	state := []string{
+		memberJSON("@a:big.org", "join"), memberJSON("@b:big.org", "join"), memberJSON("@c:big.org", "join"),
+		memberJSON("@a:small.org", "join"), memberJSON("@b:small.org", "join"),
+		memberJSON("@a:tie.org", "join"), memberJSON("@a:alsotie.org", "join"),
+	}
+	tests := []struct {
+		name  string
+		state []string
+		want  []string
+	}{
+		{"the servers with the most users", state, []string{"big.org", "small.org", "alsotie.org"}},
+		{"fewer servers than the most suggested", state[:4], []string{"big.org", "small.org"}},
+		{"no members", nil, []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			room := newTestRoom(t, newFakeHomeserver(t), `{"messages":{"start":"s0","end":"e0","chunk":[]},"state":[`+strings.Join(test.state, ",")+`]}`)
+			if got := room.RoomInfo().ViaServers; !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMemberJoinedAt(t *testing.T) {
+	rs := NewRoomState(&Client{})
+	update := func(ts int, content map[string]interface{}) {
+		stateKey := "@a:example.org"
+		ev := Event{}
+		ev.Type, ev.StateKey, ev.Sender, ev.Timestamp, ev.Content = "m.room.member", &stateKey, stateKey, ts, content
+		rs.UpdateOnEvent(&ev, false)
+	}
+
+	tests := []struct {
+		name    string
+		ts      int
+		content map[string]interface{}
+		want    int
+	}{
+		{"invited", 1, map[string]interface{}{"membership": "invite"}, 0},
+		{"joined", 2, map[string]interface{}{"membership": "join"}, 2},
+		{"changed their profile", 3, map[string]interface{}{"membership": "join", "displayname": "A"}, 2},
+		{"left", 4, map[string]interface{}{"membership": "leave"}, 2},
+		{"rejoined", 5, map[string]interface{}{"membership": "join"}, 5},
+	}
+	for _, test := range tests {
+		update(test.ts, test.content)
+		if got := rs.MemberMap["@a:example.org"].JoinedAt; got != test.want {
+			t.Errorf("%s: got JoinedAt %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+// profileJSON returns the m.room.member event of mxid with membership, a display name & an avatar, sent by sender.
+func profileJSON(mxid, sender, membership, displayName, avatarURL string) string {
+	return `{"type":"m.room.member","state_key":"` + mxid + `","sender":"` + sender + `","event_id":"$` + mxid + `",
+		"content":{"membership":"` + membership + `","displayname":"` + displayName + `","avatar_url":"` + avatarURL + `"}}`
+}
+
+func TestRoomInfoNamedAfterMembers(t *testing.T) {
+	const (
+		name    = `{"type":"m.room.name","state_key":"","event_id":"$name","content":{"name":"Lobby"}}`
+		alias   = `{"type":"m.room.canonical_alias","state_key":"","event_id":"$alias","content":{"alias":"#lobby:example.org"}}`
+		avatar  = `{"type":"m.room.avatar","state_key":"","event_id":"$avatar","content":{"url":"mxc://example.org/room"}}`
+		creator = `{"type":"m.room.create","state_key":"","sender":"@alice:example.org","event_id":"$create","content":{}}`
+	)
+	var (
+		ourselves = profileJSON("@static:example.org", "@static:example.org", "join", "Static", "")
+		alice     = profileJSON("@alice:example.org", "@alice:example.org", "join", "Alice", "mxc://example.org/alice")
+		bob       = profileJSON("@bob:example.org", "@alice:example.org", "invite", "Bob", "mxc://example.org/bob")
+		carol     = profileJSON("@carol:example.org", "@carol:example.org", "join", "Carol", "mxc://example.org/carol")
+		dave      = profileJSON("@dave:example.org", "@dave:example.org", "leave", "Dave", "mxc://example.org/dave")
+	)
+
+	tests := []struct {
+		name       string
+		state      []string
+		wantName   string
+		wantAvatar string
+	}{
+		{"named", []string{name, alias, alice}, "Lobby", "mxc://example.org/alice"},
+		{"aliased", []string{alias, avatar, alice}, "#lobby:example.org", "mxc://example.org/room"},
+		{"nobody but ourselves", []string{ourselves, dave}, testRoomID, ""},
+		{"one other", []string{ourselves, alice, dave}, "Alice", "mxc://example.org/alice"},
+		{"two others", []string{creator, bob, alice}, "Alice and Bob", "mxc://example.org/bob"},
+		{"two others, neither the creator", []string{alice, carol}, "Alice and Carol", ""},
+		{"more others", []string{ourselves, carol, bob, alice}, "Alice and 2 others", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			room := newTestRoom(t, newFakeHomeserver(t), `{"messages":{"start":"s0","end":"e0","chunk":[]},
+				"state":[`+strings.Join(test.state, ",")+`]}`)
+			info := room.RoomInfo()
+			if info.Name != test.wantName || info.AvatarURL.MXC() != test.wantAvatar {
+				t.Errorf("got %q pictured by %q, want %q by %q", info.Name, info.AvatarURL.MXC(), test.wantName, test.wantAvatar)
+			}
+		})
+	}
+}
+
+func TestRoomInfoNamedAfterPseudonyms(t *testing.T) {
+	hs := newFakeHomeserver(t)
+	hs.handleJSON("/rooms/"+testRoomID+"/initialSync", http.StatusOK, `{"messages":{"start":"s0","end":"e0","chunk":[]},
+		"state":[`+profileJSON("@alice:example.org", "@alice:example.org", "join", "Alice", "mxc://example.org/alice")+`]}`)
+	client := newTestClient(t, hs)
+	client.Anonymize = true
+	room, err := client.NewRoom(context.Background(), testRoomID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the members a room is named & pictured after are not to be identified by it.
+	info := room.RoomInfo()
+	if want := room.Pseudonyms().Name("@alice:example.org"); info.Name != want || info.AvatarURL.IsValid() {
+		t.Errorf("got %q pictured by %q, want %q without an avatar", info.Name, info.AvatarURL.MXC(), want)
+	}
+}
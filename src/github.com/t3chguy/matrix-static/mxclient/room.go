@@ -15,9 +15,12 @@
 package mxclient
 
 import (
+	"context"
 	"errors"
 	"github.com/matrix-org/gomatrix"
 	"github.com/t3chguy/matrix-static/utils"
+	"net/http"
+	"net/url"
 	"time"
 )
 
@@ -25,11 +28,42 @@ type RoomInfo struct {
 	RoomID          string
 	Name            string
 	CanonicalAlias  string
+	AltAliases      []string
 	Topic           string
+	TopicHTML       string // sanitized HTML of Topic, empty if it is to be shown as plaintext
 	AvatarURL       MXCURL
 	NumMemberEvents int
 	NumMembers      int
 	NumServers      int
+	Tombstone       Tombstone
+	ViaServers      []string
+	// Activity is how many messages were sent on each of the last ActivityDays days, oldest first.
+	Activity []int
+	// Emotes are the mxcs of the custom emoji of the room's image packs by shortcode.
+	Emotes map[string]string
+	// NumMessages is how many m.room.message events of the timeline have been loaded, all of them if AllMessagesKnown.
+	NumMessages      int
+	AllMessagesKnown bool
+}
+
+const matrixToPrefix = "https://matrix.to/#/"
+
+// Permalink returns the matrix.to link to the room, or to eventID within it unless empty, suggesting clients join the
+// room via its ViaServers.
+func (info RoomInfo) Permalink(eventID string) string {
+	link := matrixToPrefix + info.RoomID
+	if eventID != "" {
+		link += "/" + eventID
+	}
+	for i, server := range info.ViaServers {
+		if i == 0 {
+			link += "?"
+		} else {
+			link += "&"
+		}
+		link += "via=" + url.QueryEscape(server)
+	}
+	return link
 }
 
 type Room struct {
@@ -42,10 +76,40 @@ type Room struct {
 	forwardPaginationToken string
 
 	// eventList[0] is the latest event we know
-	eventList []gomatrix.Event
-	//eventMap        map[string]*gomatrix.Event
+	eventList []Event
+	//eventMap        map[string]*Event
 	latestRoomState RoomState
 
+	// annotations maps the ID of each m.reaction event to what it annotates
+	annotations map[string]annotation
+	// replacements maps the ID of each m.replace event to the edit it makes
+	replacements map[string]replacement
+	// pollResponses & pollEnds map the ID of each m.poll.response & m.poll.end event to the poll it answers or ends
+	pollResponses map[string]pollResponse
+	pollEnds      map[string]pollEnd
+	// threadReplies maps the ID of each thread root to the replies to it we have seen
+	threadReplies map[string]map[string]threadReply
+
+	// latestObservedID & latestObservedTS are of the newest event received, including those hidden from the timeline
+	// e.g. edits and reactions, so they change whenever anything rendered of the room may have.
+	latestObservedID string
+	latestObservedTS int
+
+	// pinnedEvents caches pinned events fetched from the homeserver as they may be long out of our timeline,
+	// along with those which could not be fetched until they are to be tried again.
+	pinnedEvents map[string]pinnedEvent
+
+	// readReceipts maps each user to the latest event they have read, only if the client shows read receipts.
+	readReceipts map[string]readReceipt
+
+	// activity counts the messages of the last ActivityDays days, from the events in eventList.
+	activity activity
+	// numMessages counts every message in eventList.
+	numMessages int
+
+	// pseudonyms of the users of the room, nil unless the client is anonymizing them.
+	pseudonyms *Pseudonyms
+
 	HasReachedHistoricEndOfTimeline bool
 
 	LastAccess time.Time
@@ -55,16 +119,20 @@ func (r *Room) Access() {
 	r.LastAccess = time.Now()
 }
 
-// ForwardPaginateRoom queries the API for any events newer than the latest one currently in the timeline and appends them.
-func (r *Room) ForwardPaginateRoom() {
-	r.client.forwardpaginateRoom(r, 0)
+// ForwardPaginateRoom queries the API for any events newer than the latest one currently in the timeline and appends them,
+// returning whether there were any. The request is abandoned should ctx be cancelled, e.g. as we shut down.
+func (r *Room) ForwardPaginateRoom(ctx context.Context) bool {
+	numEvents, _ := r.client.forwardpaginateRoom(ctx, r, 0)
+	return numEvents > 0
 }
 
-func (r *Room) concatBackpagination(oldEvents []gomatrix.Event, newToken string) {
+func (r *Room) concatBackpagination(oldEvents []Event, newToken string) {
 	for _, event := range oldEvents {
-		if ShouldHideEvent(event) {
+		r.observeRelations(&event)
+		if r.client.shouldHideEvent(event) {
 			continue
 		}
+		r.observeActivity(&event)
 		//if event.Type == "m.room.redaction" {
 		// The server has already handled these for us
 		// so just consume them to prevent them blanking on timeline
@@ -77,19 +145,48 @@ func (r *Room) concatBackpagination(oldEvents []gomatrix.Event, newToken string)
 	r.latestRoomState.RecalculateMemberListAndServers()
 }
 
-func (r *Room) concatForwardPagination(newEvents []gomatrix.Event, newToken string) {
+// observeLazyMembers adds the members lazy loaded alongside a page of events to the room state, unless we already know
+// them: lazy loaded members are as of that page, which may be long before the members we know are as of.
+func (r *Room) observeLazyMembers(state []Event) {
+	for _, event := range state {
+		if event.Type != "m.room.member" || event.StateKey == nil {
+			continue
+		}
+		if _, ok := r.latestRoomState.MemberMap[*event.StateKey]; !ok {
+			r.latestRoomState.UpdateOnEvent(&event, false)
+		}
+	}
+}
+
+// observeLatest records ev as the newest event received.
+func (r *Room) observeLatest(ev *Event) {
+	r.latestObservedID = ev.ID
+	r.latestObservedTS = ev.Timestamp
+}
+
+// LatestObserved returns the ID and timestamp of the newest event received for this room, hidden or not.
+func (r *Room) LatestObserved() (eventID string, timestamp int) {
+	return r.latestObservedID, r.latestObservedTS
+}
+
+func (r *Room) concatForwardPagination(newEvents []Event, newToken string) {
+	if len(newEvents) > 0 {
+		r.observeLatest(&newEvents[len(newEvents)-1])
+	}
 	for _, event := range newEvents {
-		// TODO Handle redaction and skip adding to TL
-		//if event.Type == "m.room.redaction" {
-		// Might want an Event Map->*Event so we can skip an O(n) task
-		//}
+		if event.Type == "m.room.redaction" {
+			r.applyRedaction(&event)
+		}
 
-		if ShouldHideEvent(event) {
+		// state must be applied even from events we do not show, such as tombstones.
+		r.latestRoomState.UpdateOnEvent(&event, false)
+		r.observeRelations(&event)
+		if r.client.shouldHideEvent(event) {
 			continue
 		}
+		r.observeActivity(&event)
 
-		r.latestRoomState.UpdateOnEvent(&event, false)
-		r.eventList = append([]gomatrix.Event{event}, r.eventList...)
+		r.eventList = append([]Event{event}, r.eventList...)
 	}
 	r.forwardPaginationToken = newToken
 	r.latestRoomState.RecalculateMemberListAndServers()
@@ -103,7 +200,7 @@ func (r *Room) findEventIndex(anchor string, backpaginate bool) (int, bool) {
 	}
 
 	if backpaginate {
-		if numNew, _ := r.client.backpaginateRoom(r, 100); numNew > 0 {
+		if numNew, _ := r.client.backpaginateRoom(context.Background(), r, 100); numNew > 0 {
 			return r.findEventIndex(anchor, false)
 		}
 	}
@@ -114,56 +211,204 @@ func (r *Room) findEventIndex(anchor string, backpaginate bool) (int, bool) {
 // backpaginate on every single call.
 const overcompensateBackpaginationBy = 32
 
-func (r *Room) backpaginateIfNeeded(anchorIndex, offset, number int) {
-	if r.HasReachedHistoricEndOfTimeline {
-		return
-	}
+// MaxBackpaginationBatch caps how many events we ask for in each back-pagination request.
+const MaxBackpaginationBatch = 500
 
+// DefaultMaxBackpaginations is the default of Client.MaxBackpaginations.
+const DefaultMaxBackpaginations = 20
+
+// truncated=true if it gave up after Client.MaxBackpaginations calls without having as many events as it wanted.
+func (r *Room) backpaginateIfNeeded(ctx context.Context, anchorIndex, offset, number int) (truncated bool) {
 	// delta is the number of events we should have, to comfortably handle this request, if we do not have this many
-	// then ask the mxclient to backpaginate this room by at least delta-length events.
-	length := len(r.eventList)
-	if delta := anchorIndex + offset + number + overcompensateBackpaginationBy; delta >= length {
+	// then ask the mxclient to backpaginate this room by at least delta-length events, in batches of at most
+	// MaxBackpaginationBatch so that the homeserver does not cap them for us.
+	delta := anchorIndex + offset + number + overcompensateBackpaginationBy
+	for calls := 0; !r.HasReachedHistoricEndOfTimeline && delta >= len(r.eventList); calls++ {
+		if calls >= utils.Max(r.client.MaxBackpaginations, 1) {
+			return true
+		}
+
+		numNew, err := r.client.backpaginateRoom(ctx, r, utils.Min(delta-len(r.eventList), MaxBackpaginationBatch))
+		if err != nil {
+			break
+		}
 		// if no error encountered and zero events then we are likely at the last historical event.
-		if numNew, err := r.client.backpaginateRoom(r, delta-length); err == nil {
-			if numNew == 0 {
-				r.HasReachedHistoricEndOfTimeline = true
-			}
+		if numNew == 0 {
+			r.HasReachedHistoricEndOfTimeline = true
+		}
+	}
+	return false
+}
+
+// BackpaginateTowardsStart makes a single back-pagination request for MaxBackpaginationBatch events within ctx, unless
+// the start of the timeline has already been reached, returning whether it has been by now. Callers wanting the whole
+// timeline call it until it has, up to Client.MaxBackpaginations times, so that they need not hold the room meanwhile.
+func (r *Room) BackpaginateTowardsStart(ctx context.Context) (atStart bool, err error) {
+	if !r.HasReachedHistoricEndOfTimeline {
+		numNew, err := r.client.backpaginateRoom(ctx, r, MaxBackpaginationBatch)
+		if err != nil {
+			return false, err
+		}
+		if numNew == 0 {
+			r.HasReachedHistoricEndOfTimeline = true
+		}
+	}
+	return r.HasReachedHistoricEndOfTimeline, nil
+}
+
+// GetEventsAfter returns up to limit of the events following afterID, newest first like the timeline, or if afterID is
+// empty the oldest events we hold of the room, see BackpaginateTowardsStart. atBottomEnd=true if they reach the latest
+// event. Anchoring to an event rather than an offset keeps successive calls in step while the timeline grows at either
+// end.
+func (r *Room) GetEventsAfter(afterID string, limit int) (events []Event, atBottomEnd bool, err error) {
+	end := len(r.eventList)
+	if afterID != "" {
+		index, found := r.findEventIndex(afterID, false)
+		if !found {
+			return nil, false, ErrEventNotFound
 		}
+		end = index
 	}
+
+	start := utils.Max(end-limit, 0)
+	return r.eventList[start:end], start == 0, nil
 }
 
-func (r *Room) getBackwardEventRange(anchorIndex, offset, number int) []gomatrix.Event {
-	r.backpaginateIfNeeded(anchorIndex, offset, number)
+func (r *Room) getBackwardEventRange(ctx context.Context, anchorIndex, offset, number int) ([]Event, bool) {
+	truncated := r.backpaginateIfNeeded(ctx, anchorIndex, offset, number)
 
 	length := len(r.eventList)
 	startIndex := utils.Min(anchorIndex+offset, length)
-	return r.eventList[startIndex:utils.Min(startIndex+number, length)]
+	return r.eventList[startIndex:utils.Min(startIndex+number, length)], truncated
 }
 
-func (r *Room) getForwardEventRange(index, offset, number int) []gomatrix.Event {
+func (r *Room) getForwardEventRange(index, offset, number int) []Event {
 	topIndex := utils.Bound(0, index+number-offset, len(r.eventList))
 	return r.eventList[utils.Max(topIndex-number, 0):topIndex]
 }
 
+// ErrEventNotFound is returned when the homeserver does not know of an event, or will not show it to us.
+var ErrEventNotFound = errors.New("event not found")
+
+// GetEventContext fetches the events surrounding eventID from the homeserver, newest first like the timeline, with
+// up to limit events split between either side. Events we would hide are dropped, except for eventID itself.
+// The request is made within ctx.
+func (r *Room) GetEventContext(ctx context.Context, eventID string, limit int) ([]Event, error) {
+	resp, err := r.client.EventContext(ctx, r.ID, eventID, limit)
+	if err != nil {
+		if httpErr, ok := err.(gomatrix.HTTPError); ok && httpErr.Code == http.StatusNotFound {
+			return nil, ErrEventNotFound
+		}
+		return nil, err
+	}
+
+	// events_after is chronological whereas events_before is already newest first.
+	var events []Event
+	for _, event := range resp.EventsAfter {
+		if !r.client.shouldHideEvent(event) {
+			events = append([]Event{event}, events...)
+		}
+	}
+	events = append(events, resp.Event)
+	for _, event := range resp.EventsBefore {
+		if !r.client.shouldHideEvent(event) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// MaxJumpBackpaginations caps how many times we backpaginate a room looking for a point in time.
+const MaxJumpBackpaginations = 20
+
+// FindEventAtTime returns the ID of the latest event at or before ts (unix millis), backpaginating until it is loaded.
+// The homeserver is asked to resolve the event via MSC3030 where supported, otherwise we compare event timestamps.
+// If ts precedes all the events we could reach, the oldest event loaded is returned. The requests are made within ctx.
+func (r *Room) FindEventAtTime(ctx context.Context, ts int) (eventID string, found bool) {
+	var targetID string
+	if resp, err := r.client.TimestampToEvent(ctx, r.ID, ts, "b"); err == nil {
+		targetID = resp.EventID
+	}
+
+	for i := 0; ; i++ {
+		if targetID != "" {
+			if index, found := r.findEventIndex(targetID, false); found {
+				return r.eventList[index].ID, true
+			}
+		}
+
+		// eventList[0] is the latest event, so once the oldest event is old enough the first match is the latest.
+		if length := len(r.eventList); length > 0 && r.eventList[length-1].Timestamp <= ts {
+			for _, event := range r.eventList {
+				if event.Timestamp <= ts {
+					return event.ID, true
+				}
+			}
+		}
+
+		if r.HasReachedHistoricEndOfTimeline || i >= MaxJumpBackpaginations {
+			break
+		}
+		numNew, err := r.client.backpaginateRoom(ctx, r, 100)
+		if err != nil {
+			break
+		}
+		if numNew == 0 {
+			r.HasReachedHistoricEndOfTimeline = true
+		}
+	}
+
+	if length := len(r.eventList); length > 0 {
+		return r.eventList[length-1].ID, true
+	}
+	return "", false
+}
+
+// LastActive returns when each user last sent one of the events we have loaded (unix millis), keyed by mxid.
+func (r *Room) LastActive() map[string]int {
+	lastActive := make(map[string]int)
+	for _, event := range r.eventList {
+		if _, ok := lastActive[event.Sender]; !ok {
+			lastActive[event.Sender] = event.Timestamp
+		}
+	}
+	return lastActive
+}
+
+// LatestEventTimestamp returns the timestamp of the latest event in the timeline, ok=false if the timeline is empty.
+func (r *Room) LatestEventTimestamp() (timestamp int, ok bool) {
+	if len(r.eventList) == 0 {
+		return 0, false
+	}
+	return r.eventList[0].Timestamp, true
+}
+
+// Pseudonyms returns the pseudonyms of the users of the room, nil unless they are to be anonymized.
+func (r *Room) Pseudonyms() *Pseudonyms {
+	return r.pseudonyms
+}
+
 // GetState returns an instance of RoomState believed to represent the current state of the room.
 func (r *Room) GetState() RoomState {
 	return r.latestRoomState
 }
 
 // GetEventPage returns a paginated slice of events, as well as whether this slice rests at either/both ends of the timeline.
-func (r *Room) GetEventPage(anchor string, offset int, pageSize int) (events []gomatrix.Event, atTopEnd, atBottomEnd bool, err error) {
+// truncated=true if the history leading up to the slice is yet to be back-paginated, as it was too far back to reach.
+// Back-pagination stops should ctx be cancelled, leaving the slice short, for the caller to notice and give up on.
+func (r *Room) GetEventPage(ctx context.Context, anchor string, offset int, pageSize int) (events []Event, atTopEnd, atBottomEnd, truncated bool, err error) {
 	var anchorIndex int
 	if anchor != "" {
 		if index, found := r.findEventIndex(anchor, false); found {
 			anchorIndex = index
 		} else {
-			err = errors.New("Could not find event")
+			err = ErrEventNotFound
 			return
 		}
 	}
 
 	if offset >= 0 {
-		events = r.getBackwardEventRange(anchorIndex, offset, pageSize)
+		events, truncated = r.getBackwardEventRange(ctx, anchorIndex, offset, pageSize)
 	} else {
 		events = r.getForwardEventRange(anchorIndex, -offset, pageSize)
 	}
@@ -171,30 +416,24 @@ func (r *Room) GetEventPage(anchor string, offset int, pageSize int) (events []g
 	// Consider ourselves at end if the ID matches the respective end of the stored event list.
 	numEvents, totalNumEvents := len(events), len(r.eventList)
 	if numEvents > 0 {
-		atTopEnd = events[numEvents-1].ID == r.eventList[totalNumEvents-1].ID
+		// the oldest event we have is only the top end if we could reach it, otherwise there is more to come.
+		atTopEnd = !truncated && events[numEvents-1].ID == r.eventList[totalNumEvents-1].ID
 		atBottomEnd = events[0].ID == r.eventList[0].ID
 	}
 	return
 }
 
-const RoomInitialSyncLimit = 256
-
-// NewRoom fetches :roomId/initialSync for a room and instantiates a room to represent it.
-func (m *Client) NewRoom(roomID string) (*Room, error) {
-	resp, err := m.RoomInitialSync(roomID, RoomInitialSyncLimit)
+// NewRoom fetches :roomId/initialSync for a room, with the latest Client.SyncTimelineLimit events, and instantiates a
+// room to represent it. The sync is made within ctx.
+func (m *Client) NewRoom(ctx context.Context, roomID string) (*Room, error) {
+	resp, err := m.RoomInitialSync(ctx, roomID, m.syncTimelineLimit())
 
 	if err != nil {
-		return nil, err
-	}
-
-	// filter out m.room.redactions and reverse ordering at once.
-	var filteredEventList []gomatrix.Event
-	for _, event := range resp.Messages.Chunk {
-		if ShouldHideEvent(event) {
-			continue
+		// giving up on a request is no fault of the homeserver's.
+		if ctx.Err() == nil {
+			recordSyncFailure(err)
 		}
-
-		filteredEventList = append([]gomatrix.Event{event}, filteredEventList...)
+		return nil, err
 	}
 
 	newRoom := &Room{
@@ -202,30 +441,83 @@ func (m *Client) NewRoom(roomID string) (*Room, error) {
 		ID:     roomID,
 		forwardPaginationToken: resp.Messages.End,
 		backPaginationToken:    resp.Messages.Start,
-		eventList:              filteredEventList,
 		latestRoomState:        *NewRoomState(m),
+		annotations:            make(map[string]annotation),
+		pollResponses:          make(map[string]pollResponse),
+		pollEnds:               make(map[string]pollEnd),
+		replacements:           make(map[string]replacement),
+		threadReplies:          make(map[string]map[string]threadReply),
+		readReceipts:           make(map[string]readReceipt),
 		LastAccess:             time.Now(),
 	}
 
+	if len(resp.Messages.Chunk) > 0 {
+		newRoom.observeLatest(&resp.Messages.Chunk[len(resp.Messages.Chunk)-1])
+	}
+
+	// filter out m.room.redactions and reverse ordering at once.
+	var filteredEventList []Event
+	for _, event := range resp.Messages.Chunk {
+		newRoom.observeRelations(&event)
+		if m.shouldHideEvent(event) {
+			continue
+		}
+		newRoom.observeActivity(&event)
+
+		filteredEventList = append([]Event{event}, filteredEventList...)
+	}
+	newRoom.eventList = filteredEventList
+
 	for _, event := range resp.State {
 		newRoom.latestRoomState.UpdateOnEvent(&event, true)
 	}
 
+	if m.ShowReadReceipts {
+		for _, event := range resp.Receipts {
+			newRoom.observeReceipts(&event)
+		}
+	}
+
 	newRoom.latestRoomState.RecalculateMemberListAndServers()
 
+	if m.Anonymize {
+		mxids := make([]string, 0, len(newRoom.latestRoomState.MemberMap))
+		for mxid := range newRoom.latestRoomState.MemberMap {
+			mxids = append(mxids, mxid)
+		}
+		newRoom.pseudonyms = newPseudonyms(mxids)
+	}
+
 	return newRoom, nil
 }
 
 // RoomInfo summates basic currentState parameters
 func (r *Room) RoomInfo() RoomInfo {
+	nameOf, avatarURL := MemberInfo.GetName, r.latestRoomState.CalculateAvatar()
+	// rooms must not be named nor pictured after the members they would otherwise identify.
+	if r.pseudonyms != nil {
+		nameOf = func(member MemberInfo) string {
+			return r.pseudonyms.Name(member.MXID)
+		}
+		avatarURL = r.latestRoomState.AvatarURL
+	}
+
 	return RoomInfo{
 		r.ID,
-		r.latestRoomState.CalculateName(),
+		r.latestRoomState.CalculateName(r.ID, nameOf),
 		r.latestRoomState.canonicalAlias,
+		r.latestRoomState.altAliases,
 		r.latestRoomState.Topic,
-		r.latestRoomState.AvatarURL,
+		r.latestRoomState.topicHTML,
+		avatarURL,
 		r.latestRoomState.GetNumMemberEvents(),
 		r.latestRoomState.NumMembers(),
 		len(r.latestRoomState.Servers()),
+		r.latestRoomState.tombstone,
+		r.latestRoomState.ViaServers(),
+		r.Activity(),
+		r.latestRoomState.Emotes(),
+		r.numMessages,
+		r.HasReachedHistoricEndOfTimeline,
 	}
 }
@@ -0,0 +1,102 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// handleEndlessHistory answers each back-pagination with another batch of 10 messages, without the start of the room
+// ever being reached unless endAfter (> 0) batches have been.
+func handleEndlessHistory(hs *fakeHomeserver, endAfter int) {
+	batches := 0
+	hs.handle("/messages", func(w http.ResponseWriter, r *http.Request) {
+		var messages []string
+		if endAfter <= 0 || batches < endAfter {
+			batches++
+			messages = make([]string, 10)
+			for i := range messages {
+				messages[i] = `{"event_id":"$%d","type":"m.room.message","sender":"@alice:example.org","content":{"msgtype":"m.text","body":"hi"}}`
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"start":"s","end":"e` + strconv.Itoa(batches) + `","chunk":` + numberedEvents("b"+strconv.Itoa(batches)+"_", messages) + `}`))
+	})
+}
+
+func TestGetEventPageMaxBackpaginations(t *testing.T) {
+	const initialSync = `{"messages":{"start":"s0","end":"e0","chunk":[]},"state":[]}`
+	tests := []struct {
+		name               string
+		maxBackpaginations int
+		endAfter           int
+		wantRequests       int
+		wantEvents         int
+		wantTruncated      bool
+	}{
+		{"capped", 3, 0, 3, 30, true},
+		{"at least one", 0, 0, 1, 10, true},
+		{"the start reached within the cap", 5, 2, 3, 20, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hs := newFakeHomeserver(t)
+			handleEndlessHistory(hs, test.endAfter)
+			room := newTestRoom(t, hs, initialSync)
+			room.client.MaxBackpaginations = test.maxBackpaginations
+
+			// the page & the buffer kept beyond it take more batches than we may load.
+			events, atTopEnd, _, truncated, err := room.GetEventPage(context.Background(), "", 0, 50)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hs.numRequests("/messages"); got != test.wantRequests {
+				t.Errorf("made %d back-paginations, want %d", got, test.wantRequests)
+			}
+			if truncated != test.wantTruncated || atTopEnd == test.wantTruncated {
+				t.Errorf("got truncated = %v, atTopEnd = %v, want truncated = %v", truncated, atTopEnd, test.wantTruncated)
+			}
+			if len(events) != test.wantEvents {
+				t.Errorf("got %d events, want the %d loaded", len(events), test.wantEvents)
+			}
+		})
+	}
+}
+
+func TestPermalink(t *testing.T) {
+	tests := []struct {
+		name    string
+		servers []string
+		eventID string
+		want    string
+	}{
+		{"room", nil, "", "https://matrix.to/#/!r:example.org"},
+		{"event", nil, "$ev", "https://matrix.to/#/!r:example.org/$ev"},
+		{"via servers", []string{"example.org", "host.org:8448"}, "$ev",
+			"https://matrix.to/#/!r:example.org/$ev?via=example.org&via=host.org%3A8448"},
+		{"room via a server", []string{"example.org"}, "", "https://matrix.to/#/!r:example.org?via=example.org"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info := RoomInfo{RoomID: "!r:example.org", ViaServers: test.servers}
+			if got := info.Permalink(test.eventID); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/matrix-org/gomatrix"
+	"strconv"
+	"time"
+)
+
+// DefaultSyncTimelineLimit is the default of Client.SyncTimelineLimit.
+const DefaultSyncTimelineLimit = 256
+
+// MaxSyncTimelineLimit caps Client.SyncTimelineLimit at what homeservers will return in one go, Synapse caps it there.
+const MaxSyncTimelineLimit = 1000
+
+// DefaultSyncTimeout is the default of Client.SyncTimeout, as long as any other request to the homeserver may take.
+const DefaultSyncTimeout = 30 * time.Second
+
+// RoomEventFilter is the subset of https://spec.matrix.org/v1.6/client-server-api/#filtering we send with /messages.
+type RoomEventFilter struct {
+	Limit int `json:"limit,omitempty"`
+	// LazyLoadMembers asks for the member events of the senders of the events returned alongside them, so that we need
+	// never fetch the whole member list of large rooms to show who sent what.
+	LazyLoadMembers bool `json:"lazy_load_members,omitempty"`
+}
+
+// RespMessages is gomatrix.RespMessages along with the member events lazy loaded for its chunk, of our Event.
+type RespMessages struct {
+	Start string  `json:"start"`
+	Chunk []Event `json:"chunk"`
+	End   string  `json:"end"`
+	State []Event `json:"state"`
+}
+
+// syncTimelineLimit returns how many events to request when syncing a room.
+func (m *Client) syncTimelineLimit() int {
+	if m.SyncTimelineLimit <= 0 {
+		return DefaultSyncTimelineLimit
+	}
+	return m.SyncTimelineLimit
+}
+
+// syncClient returns a gomatrix client whose requests time out after SyncTimeout in place of the usual timeout, and are
+// made within ctx.
+func (m *Client) syncClient(ctx context.Context) *gomatrix.Client {
+	httpClient := *m.withContext(ctx).Client
+	httpClient.Timeout = DefaultSyncTimeout
+	if m.SyncTimeout > 0 {
+		httpClient.Timeout = m.SyncTimeout
+	}
+	return m.withHTTPClient(&httpClient)
+}
+
+// messagesFilter returns the filter we send with /messages for up to limit events.
+func messagesFilter(limit int) RoomEventFilter {
+	return RoomEventFilter{Limit: limit, LazyLoadMembers: true}
+}
+
+// messages makes an HTTP request according to https://spec.matrix.org/v1.6/client-server-api/#get_matrixclientv3roomsroomidmessages
+// via cli, with messagesFilter applied.
+func messages(cli *gomatrix.Client, roomID, from string, dir rune, limit int) (resp *RespMessages, err error) {
+	filter, err := json.Marshal(messagesFilter(limit))
+	if err != nil {
+		return nil, err
+	}
+
+	urlPath := cli.BuildURLWithQuery([]string{"rooms", roomID, "messages"}, map[string]string{
+		"from":   from,
+		"dir":    string(dir),
+		"limit":  strconv.Itoa(limit),
+		"filter": string(filter),
+	})
+	_, err = cli.MakeRequest("GET", urlPath, nil, &resp)
+	return
+}
@@ -0,0 +1,106 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestMessagesFilterJSON(t *testing.T) {
+	tests := []struct {
+		limit int
+		want  string
+	}{
+		{64, `{"limit":64,"lazy_load_members":true}`},
+		{MaxSyncTimelineLimit, `{"limit":1000,"lazy_load_members":true}`},
+		{0, `{"lazy_load_members":true}`},
+	}
+	for _, test := range tests {
+		filter, err := json.Marshal(messagesFilter(test.limit))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(filter) != test.want {
+			t.Errorf("messagesFilter(%d) = %s, want %s", test.limit, filter, test.want)
+		}
+	}
+}
+
+// TestPaginationFilters asserts what each sync asks the homeserver for, and that the members lazy loaded alongside
+// their events are kept.
+func TestPaginationFilters(t *testing.T) {
+	const lazyMember = `{"event_id":"$bob","type":"m.room.member","state_key":"@bob:example.org","sender":"@bob:example.org",
+		"content":{"membership":"join","displayname":"Bob"}}`
+	hs := newFakeHomeserver(t)
+	var query url.Values
+	hs.handle("/rooms/"+testRoomID+"/messages", func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Write([]byte(`{"start":"t0","end":"t1","chunk":[],"state":[` + lazyMember + `]}`))
+	})
+	var initialSyncQuery url.Values
+	hs.handle("/rooms/"+testRoomID+"/initialSync", func(w http.ResponseWriter, r *http.Request) {
+		initialSyncQuery = r.URL.Query()
+		w.Write([]byte(`{"messages":{"start":"back","end":"forward","chunk":[]},"state":[]}`))
+	})
+	cli := newTestClient(t, hs)
+	cli.SyncTimelineLimit = 100
+	room, err := cli.NewRoom(context.Background(), testRoomID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := initialSyncQuery.Get("limit"); got != "100" {
+		t.Errorf("initial sync asked for %s events, want the SyncTimelineLimit of 100", got)
+	}
+
+	tests := []struct {
+		name      string
+		paginate  func() (int, error)
+		wantFrom  string
+		wantDir   string
+		wantLimit string
+	}{
+		{"back-pagination asks for at least minimumPagination", func() (int, error) {
+			return cli.backpaginateRoom(context.Background(), room, 10)
+		}, "back", "b", "64"},
+		{"forward pagination asks for at least SyncTimelineLimit", func() (int, error) {
+			return cli.forwardpaginateRoom(context.Background(), room, 10)
+		}, "forward", "f", "100"},
+		{"forward pagination asks for more if need be", func() (int, error) {
+			return cli.forwardpaginateRoom(context.Background(), room, 500)
+		}, "t1", "f", "500"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := test.paginate(); err != nil {
+				t.Fatal(err)
+			}
+			if query.Get("from") != test.wantFrom || query.Get("dir") != test.wantDir || query.Get("limit") != test.wantLimit {
+				t.Errorf("asked for from=%s dir=%s limit=%s, want from=%s dir=%s limit=%s", query.Get("from"),
+					query.Get("dir"), query.Get("limit"), test.wantFrom, test.wantDir, test.wantLimit)
+			}
+			want := `{"limit":` + test.wantLimit + `,"lazy_load_members":true}`
+			if got := query.Get("filter"); got != want {
+				t.Errorf("filter = %s, want %s", got, want)
+			}
+			if _, ok := room.GetState().MemberMap["@bob:example.org"]; !ok {
+				t.Error("lazy loaded member was not kept")
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"context"
+	"github.com/matrix-org/gomatrix"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// GetThreadRoot returns the ID of the root of the thread the event is part of, empty string if it is in no thread.
+func GetThreadRoot(ev *Event) string {
+	if relType, rootID, ok := GetRelatesTo(ev); ok && relType == "m.thread" {
+		return rootID
+	}
+	return ""
+}
+
+// ThreadSummary describes the replies we have seen to the root of a thread.
+type ThreadSummary struct {
+	NumReplies        int
+	LatestReplyTS     int
+	LatestReplyID     string
+	LatestReplySender string
+}
+
+// observeThreadReply records ev as a reply to the thread it is in, if any.
+func (r *Room) observeThreadReply(ev *Event) {
+	rootID := GetThreadRoot(ev)
+	if rootID == "" {
+		return
+	}
+
+	if r.threadReplies[rootID] == nil {
+		r.threadReplies[rootID] = make(map[string]threadReply)
+	}
+	r.threadReplies[rootID][ev.ID] = threadReply{ev.Sender, ev.Timestamp}
+}
+
+type threadReply struct {
+	sender    string
+	timestamp int
+}
+
+// GetThreadSummaries summarises the threads rooted at any of the given events, keyed by the ID of the root.
+// Only replies in the part of the timeline we have loaded are counted.
+func (r *Room) GetThreadSummaries(events []Event) map[string]ThreadSummary {
+	summaries := make(map[string]ThreadSummary)
+	for _, ev := range events {
+		replies, ok := r.threadReplies[ev.ID]
+		if !ok || len(replies) == 0 {
+			continue
+		}
+
+		summary := ThreadSummary{NumReplies: len(replies)}
+		for replyID, reply := range replies {
+			if reply.timestamp > summary.LatestReplyTS {
+				summary.LatestReplyTS = reply.timestamp
+				summary.LatestReplyID = replyID
+				summary.LatestReplySender = reply.sender
+			}
+		}
+		summaries[ev.ID] = summary
+	}
+	return summaries
+}
+
+// GroupThreads moves the replies to threads whose root is among events out of them, keyed by the ID of the root.
+// Replies to roots elsewhere are left in place, as are the roots themselves.
+func GroupThreads(events []Event) (timeline []Event, replies map[string][]Event) {
+	roots := make(map[string]bool, len(events))
+	for _, ev := range events {
+		roots[ev.ID] = true
+	}
+
+	replies = make(map[string][]Event)
+	timeline = make([]Event, 0, len(events))
+	for _, ev := range events {
+		if rootID := GetThreadRoot(&ev); rootID != "" && roots[rootID] {
+			replies[rootID] = append(replies[rootID], ev)
+			continue
+		}
+		timeline = append(timeline, ev)
+	}
+	return
+}
+
+type RespRelations struct {
+	Chunk     []Event `json:"chunk"`
+	NextBatch string  `json:"next_batch"`
+}
+
+// ThreadRelations makes an HTTP request according to https://spec.matrix.org/v1.6/client-server-api/#get_matrixclientv1roomsroomidrelationseventidreltype
+// for the events in the thread rooted at rootID, newest first, which is abandoned should ctx be cancelled.
+func (m *Client) ThreadRelations(ctx context.Context, roomID, rootID, from string, limit int) (resp *RespRelations, err error) {
+	cli := m.withContext(ctx)
+	u, _ := url.Parse(cli.BuildBaseURL("_matrix", "client", "v1", "rooms", roomID, "relations", rootID, "m.thread"))
+	q := u.Query()
+	q.Set("limit", strconv.Itoa(limit))
+	if from != "" {
+		q.Set("from", from)
+	}
+	u.RawQuery = q.Encode()
+
+	_, err = cli.MakeRequest("GET", u.String(), nil, &resp)
+	return
+}
+
+// MaxThreadReplies caps how many replies of a thread are fetched to show it.
+const MaxThreadReplies = 500
+
+// GetThread fetches the root of a thread and up to MaxThreadReplies of its replies from the homeserver, newest first
+// like the timeline with the root last. The requests are made within ctx.
+func (r *Room) GetThread(ctx context.Context, rootID string) ([]Event, error) {
+	var root Event
+	if index, found := r.findEventIndex(rootID, false); found {
+		root = r.eventList[index]
+	} else {
+		resp, err := r.client.RoomEvent(ctx, r.ID, rootID)
+		if err != nil {
+			if httpErr, ok := err.(gomatrix.HTTPError); ok && httpErr.Code == http.StatusNotFound {
+				return nil, ErrEventNotFound
+			}
+			return nil, err
+		}
+		root = *resp
+	}
+
+	var events []Event
+	from := ""
+	for len(events) < MaxThreadReplies {
+		resp, err := r.client.ThreadRelations(ctx, r.ID, rootID, from, MaxThreadReplies-len(events))
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range resp.Chunk {
+			if !r.client.shouldHideEvent(event) {
+				events = append(events, event)
+			}
+		}
+		if from = resp.NextBatch; from == "" || len(resp.Chunk) == 0 {
+			break
+		}
+	}
+	return append(events, root), nil
+}
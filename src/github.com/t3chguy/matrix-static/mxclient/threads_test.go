@@ -0,0 +1,66 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import (
+	"reflect"
+	"testing"
+)
+
+const threadsInitialSync = `{
+	"messages": {
+		"start": "s0",
+		"end": "s1",
+		"chunk": [
+			{"event_id": "$root", "type": "m.room.message", "sender": "@a:example.org", "origin_server_ts": 1, "content": {"msgtype": "m.text", "body": "root"}},
+			{"event_id": "$main", "type": "m.room.message", "sender": "@b:example.org", "origin_server_ts": 2, "content": {"msgtype": "m.text", "body": "main"}},
+			{"event_id": "$reply1", "type": "m.room.message", "sender": "@b:example.org", "origin_server_ts": 3,
+				"content": {"msgtype": "m.text", "body": "first", "m.relates_to": {"rel_type": "m.thread", "event_id": "$root"}}},
+			{"event_id": "$orphan", "type": "m.room.message", "sender": "@c:example.org", "origin_server_ts": 4,
+				"content": {"msgtype": "m.text", "body": "orphan", "m.relates_to": {"rel_type": "m.thread", "event_id": "$unloaded"}}},
+			{"event_id": "$reply2", "type": "m.room.message", "sender": "@c:example.org", "origin_server_ts": 5,
+				"content": {"msgtype": "m.text", "body": "second", "m.relates_to": {"rel_type": "m.thread", "event_id": "$root"}}}
+		]
+	},
+	"state": []
+}`
+
+func TestGroupThreads(t *testing.T) {
+	room := newTestRoom(t, newFakeHomeserver(t), threadsInitialSync)
+	// pages are rendered oldest first.
+	events := ReverseEventsCopy(room.eventList)
+
+	timeline, replies := GroupThreads(events)
+	if got, want := eventIDs(timeline), []string{"$root", "$main", "$orphan"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got timeline %v, want %v", got, want)
+	}
+	if got, want := eventIDs(replies["$root"]), []string{"$reply1", "$reply2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got replies to $root %v, want %v", got, want)
+	}
+	// the root of the orphan is not among the events, so it is kept in the timeline to link to its thread from.
+	if _, ok := replies["$unloaded"]; ok {
+		t.Errorf("the orphan was grouped under a root we do not have: %v", replies)
+	}
+}
+
+func TestGetThreadSummaries(t *testing.T) {
+	room := newTestRoom(t, newFakeHomeserver(t), threadsInitialSync)
+
+	summaries := room.GetThreadSummaries(room.eventList)
+	want := map[string]ThreadSummary{"$root": {NumReplies: 2, LatestReplyTS: 5, LatestReplyID: "$reply2", LatestReplySender: "@c:example.org"}}
+	if !reflect.DeepEqual(summaries, want) {
+		t.Errorf("got %+v, want %+v", summaries, want)
+	}
+}
@@ -17,12 +17,12 @@ package mxclient
 import "github.com/matrix-org/gomatrix"
 
 // Keeping here in case it becomes used again.
-//func ConcatEventsSlices(slices ...[]gomatrix.Event) []gomatrix.Event {
+//func ConcatEventsSlices(slices ...[]Event) []Event {
 //	var totalLen int
 //	for _, s := range slices {
 //		totalLen += len(s)
 //	}
-//	tmp := make([]gomatrix.Event, totalLen)
+//	tmp := make([]Event, totalLen)
 //	var i int
 //	for _, s := range slices {
 //		i += copy(tmp[i:], s)
@@ -31,8 +31,8 @@ import "github.com/matrix-org/gomatrix"
 //}
 
 // ReverseEventsCopy returns a copy of the input slice with all elements in reverse order.
-func ReverseEventsCopy(events []gomatrix.Event) []gomatrix.Event {
-	var newEvents []gomatrix.Event
+func ReverseEventsCopy(events []Event) []Event {
+	var newEvents []Event
 	for i := len(events) - 1; i >= 0; i-- {
 		newEvents = append(newEvents, events[i])
 	}
@@ -59,36 +59,41 @@ func TextForRespError(respErr gomatrix.RespError) string {
 	return respErr.Err + " (" + respErr.ErrCode + ")"
 }
 
-// ShouldHideEvent returns a bool the event should be ignored in the timeline view, mimicking riot-web
-func ShouldHideEvent(ev gomatrix.Event) bool {
-	// m.room.create ?
-
-	// we want to hide all unknowns +:
-	// m.room.redaction
-	// m.room.aliases
-	// m.room.canonical_alias
-
-	if ev.StateKey == nil {
-		// Message Event
-		if ev.Type == "m.room.message" {
-			return false
-		}
-	} else {
-		// State Event
-		if ev.Type == "m.room.history_visibility" ||
-			ev.Type == "m.room.join_rules" ||
-			ev.Type == "m.room.member" ||
-			ev.Type == "m.room.power_levels" ||
-			ev.Type == "m.room.name" ||
-			ev.Type == "m.room.topic" ||
-			ev.Type == "m.room.avatar" {
-			return false
-		}
+// shownElsewhere are the event types which are shown other than as entries in the timeline, so are hidden from it.
+var shownElsewhere = map[string]bool{
+	"m.room.redaction":       true,
+	"m.reaction":             true, // grouped beneath the event they annotate
+	PollResponseType:         true, // tallied beneath the poll they answer
+	UnstablePollResponseType: true,
+	PollEndType:              true, // the poll they end is shown closed
+	UnstablePollEndType:      true,
+	"m.room.aliases":         true, // the room header lists the aliases of the room
+	"m.room.canonical_alias": true,
+	"m.room.tombstone":       true, // shown atop the timeline
+	"m.room.pinned_events":   true, // listed atop the timeline
+}
 
-		if ev.Type == "im.vector.modular.widgets" {
-			return false
-		}
+// ShouldHideEvent returns a bool the event should be ignored in the timeline view. Events of types we do not know how
+// to render are still shown, generically, so that the archive has no unexplained gaps.
+func ShouldHideEvent(ev Event) bool {
+	// edits are applied to the event they replace instead.
+	if ev.Type == "m.room.message" {
+		return IsEdit(&ev)
 	}
+	return shownElsewhere[ev.Type]
+}
 
-	return true
+// shouldHideEvent extends ShouldHideEvent with the operator's choices of what to hide.
+func (m *Client) shouldHideEvent(ev Event) bool {
+	if ev.Type == "m.room.encrypted" && m.HideEncryptedEvents {
+		return true
+	}
+	if m.EventTypes.hides(ev.Type) {
+		return true
+	}
+	// messages we hide are edits, which are shown by applying them to the message they replace instead.
+	if ev.Type != "m.room.message" && m.EventTypes.shows(ev.Type) {
+		return false
+	}
+	return ShouldHideEvent(ev)
 }
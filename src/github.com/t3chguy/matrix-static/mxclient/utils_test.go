@@ -0,0 +1,85 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mxclient
+
+import "testing"
+
+func TestShouldHideEncryptedEvents(t *testing.T) {
+	encrypted := Event{Type: "m.room.encrypted", Content: map[string]interface{}{"algorithm": "m.megolm.v1.aes-sha2"}}
+	for _, hide := range []bool{false, true} {
+		m := &Client{HideEncryptedEvents: hide}
+		if got := m.shouldHideEvent(encrypted); got != hide {
+			t.Errorf("shouldHideEvent() = %v with HideEncryptedEvents = %v", got, hide)
+		}
+	}
+}
+
+func TestShouldHideEventTypes(t *testing.T) {
+	m := &Client{EventTypes: EventTypeFilter{
+		Shown:  []string{"m.reaction", "m.room.message", "org.example.*"},
+		Hidden: []string{"m.room.member", "org.example.secret"},
+	}}
+	edit := Event{Type: "m.room.message", Content: map[string]interface{}{
+		"m.relates_to": map[string]interface{}{"rel_type": "m.replace", "event_id": "$original"},
+	}}
+
+	tests := []struct {
+		name string
+		ev   Event
+		want bool
+	}{
+		{"hidden by us, shown by the operator", Event{Type: "m.reaction"}, false},
+		{"shown by us, hidden by the operator", Event{Type: "m.room.member"}, true},
+		{"shown & hidden by the operator", Event{Type: "org.example.secret"}, true},
+		{"shown by prefix", Event{Type: "org.example.widget"}, false},
+		{"edits are applied rather than shown", edit, true},
+		{"left to us", Event{Type: "m.room.redaction"}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := m.shouldHideEvent(test.ev); got != test.want {
+				t.Errorf("shouldHideEvent() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestShouldHideEvent(t *testing.T) {
+	stateKey := ""
+	tests := []struct {
+		name string
+		ev   Event
+		want bool
+	}{
+		{"message", Event{Type: "m.room.message", Content: map[string]interface{}{"body": "hi"}}, false},
+		{"edit", Event{Type: "m.room.message", Content: map[string]interface{}{
+			"m.relates_to": map[string]interface{}{"rel_type": "m.replace", "event_id": "$original"},
+		}}, true},
+		{"unknown message event", Event{Type: "org.example.ping"}, false},
+		{"unknown state event", Event{Type: "org.example.state", StateKey: &stateKey}, false},
+		{"redaction", Event{Type: "m.room.redaction"}, true},
+		{"reaction", Event{Type: "m.reaction"}, true},
+		{"canonical alias", Event{Type: "m.room.canonical_alias", StateKey: &stateKey}, true},
+		{"tombstone", Event{Type: "m.room.tombstone", StateKey: &stateKey}, true},
+		{"pinned events", Event{Type: "m.room.pinned_events", StateKey: &stateKey}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ShouldHideEvent(test.ev); got != test.want {
+				t.Errorf("ShouldHideEvent() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
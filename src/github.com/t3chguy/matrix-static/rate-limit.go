@@ -0,0 +1,117 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitSweepPeriod is how often buckets which have refilled are forgotten, a full bucket behaves as a new one.
+const RateLimitSweepPeriod = time.Minute
+
+// tokenBucket holds the tokens a client has left as of last, it is refilled lazily when next taken from.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens accrued at rate per second since it was last refilled, up to burst.
+func (b *tokenBucket) refill(now time.Time, rate float64, burst int) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(burst), b.tokens+elapsed*rate)
+	}
+	b.last = now
+}
+
+// take takes a token from the bucket if it has one, otherwise returning how long until it will.
+func (b *tokenBucket) take(now time.Time, rate float64, burst int) (ok bool, wait time.Duration) {
+	b.refill(now, rate, burst)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+// rateLimiter keeps a tokenBucket per client IP.
+type rateLimiter struct {
+	rate  float64
+	burst int
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:      rate,
+		burst:     burst,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// take takes a token from the bucket of clientIP, creating it full if it is new.
+func (l *rateLimiter) take(clientIP string, now time.Time) (ok bool, wait time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= RateLimitSweepPeriod {
+		l.sweep(now)
+	}
+
+	bucket, exists := l.buckets[clientIP]
+	if !exists {
+		bucket = &tokenBucket{float64(l.burst), now}
+		l.buckets[clientIP] = bucket
+	}
+	return bucket.take(now, l.rate, l.burst)
+}
+
+// sweep forgets the buckets which have refilled, must be called with mu held.
+func (l *rateLimiter) sweep(now time.Time) {
+	for clientIP, bucket := range l.buckets {
+		if bucket.refill(now, l.rate, l.burst); bucket.tokens >= float64(l.burst) {
+			delete(l.buckets, clientIP)
+		}
+	}
+	l.lastSweep = now
+}
+
+// Middleware responds 429 Too Many Requests, with the seconds until the client may retry, once a client has exhausted
+// its bucket.
+func (l *rateLimiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ok, wait := l.take(clientIP(c), time.Now())
+		if ok {
+			c.Next()
+			return
+		}
+
+		retryAfter := int(math.Ceil(wait.Seconds()))
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.String(http.StatusTooManyRequests, "Too many requests, please slow down.")
+		c.Abort()
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterRefill(t *testing.T) {
+	// 2 tokens a second, so one every 500ms, up to 3.
+	limiter := newRateLimiter(2, 3)
+	start := time.Now()
+
+	tests := []struct {
+		name     string
+		after    time.Duration
+		wantOK   bool
+		wantWait time.Duration
+	}{
+		{"a new client may burst", 0, true, 0},
+		{"up to the burst", 0, true, 0},
+		{"the last of the burst", 0, true, 0},
+		{"then is limited", 0, false, 500 * time.Millisecond},
+		{"until a token has accrued", 250 * time.Millisecond, false, 250 * time.Millisecond},
+		{"which it may then take", 500 * time.Millisecond, true, 0},
+		{"but not another", 500 * time.Millisecond, false, 500 * time.Millisecond},
+		{"the bucket refills no further than the burst", time.Hour, true, 0},
+		{"of which there are only 3", time.Hour, true, 0},
+		{"tokens", time.Hour, true, 0},
+		{"to take", time.Hour, false, 500 * time.Millisecond},
+	}
+	for _, test := range tests {
+		ok, wait := limiter.take("192.0.2.1", start.Add(test.after))
+		if ok != test.wantOK || wait != test.wantWait {
+			t.Errorf("%s: take() = %v, %v, want %v, %v", test.name, ok, wait, test.wantOK, test.wantWait)
+		}
+	}
+
+	if ok, _ := limiter.take("192.0.2.2", start.Add(time.Hour)); !ok {
+		t.Errorf("other clients are limited by the bucket of another")
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	limiter := newRateLimiter(1, 2)
+	start := time.Now()
+	limiter.take("192.0.2.1", start)
+	limiter.take("192.0.2.2", start)
+	limiter.take("192.0.2.2", start)
+
+	// 192.0.2.1 has refilled a minute later whereas 192.0.2.2 is taking again, so must be kept.
+	limiter.take("192.0.2.2", start.Add(RateLimitSweepPeriod))
+	if _, ok := limiter.buckets["192.0.2.1"]; ok {
+		t.Errorf("refilled bucket was not swept")
+	}
+	if _, ok := limiter.buckets["192.0.2.2"]; !ok {
+		t.Errorf("bucket in use was swept")
+	}
+}
+
+// TestRateLimiterMiddleware asserts that clients behind a trusted proxy are limited by the IP in X-Forwarded-For
+// rather than by that of the proxy, which would otherwise limit all of them together.
+func TestRateLimiterMiddleware(t *testing.T) {
+	proxies, err := newTrustedProxies("X-Forwarded-For", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(proxies.Middleware(), newRateLimiter(1, 1).Middleware())
+	router.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	get := func(remoteAddr, forwardedFor string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		wantCode     int
+	}{
+		{"first client via the proxy", "10.0.0.1:1234", "192.0.2.1", http.StatusOK},
+		{"second client via the proxy", "10.0.0.1:1234", "192.0.2.2", http.StatusOK},
+		{"first client again", "10.0.0.1:1234", "203.0.113.9, 192.0.2.1", http.StatusTooManyRequests},
+		{"the header is ignored from untrusted peers", "198.51.100.1:1234", "192.0.2.3", http.StatusOK},
+		{"who are limited by their own IP", "198.51.100.1:1234", "192.0.2.4", http.StatusTooManyRequests},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := get(test.remoteAddr, test.forwardedFor)
+			if w.Code != test.wantCode {
+				t.Fatalf("got %d, want %d", w.Code, test.wantCode)
+			}
+			if test.wantCode == http.StatusTooManyRequests {
+				if retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After")); err != nil || retryAfter < 1 {
+					t.Errorf("got Retry-After %q, want at least 1 second", w.Header().Get("Retry-After"))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"container/list"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sync"
+)
+
+type renderedPage struct {
+	roomID string
+	key    string
+	header http.Header
+	body   []byte
+}
+
+// RenderCache is an LRU cache of rendered room pages bounded by the total size of their bodies.
+// Pages are kept until the workers send the ID of their room down the invalidation channel.
+type RenderCache struct {
+	mutex    sync.Mutex
+	maxBytes int
+	numBytes int
+	ll       *list.List
+	items    map[string]*list.Element
+	// rooms indexes the cached pages of each room so that they can be dropped together.
+	rooms map[string]map[string]*list.Element
+	// generations is bumped on every invalidation of a room, discarding renders which began before it.
+	generations map[string]uint64
+}
+
+// NewRenderCache instantiates a RenderCache which will hold at most maxBytes of pages,
+// dropping those of any roomID received from invalidations.
+func NewRenderCache(maxBytes int, invalidations <-chan string) *RenderCache {
+	rc := &RenderCache{
+		maxBytes:    maxBytes,
+		ll:          list.New(),
+		items:       make(map[string]*list.Element),
+		rooms:       make(map[string]map[string]*list.Element),
+		generations: make(map[string]uint64),
+	}
+	go func() {
+		for roomID := range invalidations {
+			rc.Invalidate(roomID)
+		}
+	}()
+	return rc
+}
+
+// get returns the page cached under key if any, otherwise the generation of the room to pass to add.
+func (rc *RenderCache) get(roomID, key string) (*renderedPage, uint64) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	if el, ok := rc.items[key]; ok {
+		rc.ll.MoveToFront(el)
+		renderCacheResults.WithLabelValues(renderCacheHit).Inc()
+		return el.Value.(*renderedPage), 0
+	}
+	renderCacheResults.WithLabelValues(renderCacheMiss).Inc()
+	return nil, rc.generations[roomID]
+}
+
+// add stores page unless its room has been invalidated since generation, evicting the least recently used pages until
+// it fits. Pages larger than the whole budget are not stored.
+func (rc *RenderCache) add(page *renderedPage, generation uint64) {
+	size := len(page.body)
+	if size > rc.maxBytes {
+		return
+	}
+
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	if rc.generations[page.roomID] != generation {
+		return
+	}
+	if el, ok := rc.items[page.key]; ok {
+		rc.remove(el)
+	}
+
+	for rc.numBytes+size > rc.maxBytes {
+		rc.remove(rc.ll.Back())
+	}
+
+	el := rc.ll.PushFront(page)
+	rc.items[page.key] = el
+	if rc.rooms[page.roomID] == nil {
+		rc.rooms[page.roomID] = make(map[string]*list.Element)
+	}
+	rc.rooms[page.roomID][page.key] = el
+	rc.numBytes += size
+}
+
+func (rc *RenderCache) remove(el *list.Element) {
+	page := rc.ll.Remove(el).(*renderedPage)
+	delete(rc.items, page.key)
+	delete(rc.rooms[page.roomID], page.key)
+	if len(rc.rooms[page.roomID]) == 0 {
+		delete(rc.rooms, page.roomID)
+	}
+	rc.numBytes -= len(page.body)
+}
+
+// Invalidate drops every cached page of roomID.
+func (rc *RenderCache) Invalidate(roomID string) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	rc.generations[roomID]++
+	renderCacheResults.WithLabelValues(renderCacheInvalidate).Inc()
+	for _, el := range rc.rooms[roomID] {
+		rc.remove(el)
+	}
+}
+
+// Len returns the number of pages currently held.
+func (rc *RenderCache) Len() int {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	return rc.ll.Len()
+}
+
+// Middleware serves room pages from the cache, rendering and storing them on a miss.
+// It must follow the middleware loading the RoomWorker so that the room is synced before its pages are cached.
+func (rc *RenderCache) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "GET" && c.Request.Method != "HEAD" || isStreamedRequest(c) {
+			c.Next()
+			return
+		}
+
+		roomID := c.Param("roomID")
+		// everything which changes the rendering of a page in a room, along with its ETag if it has been set so that
+		// pages rendered under pseudonyms since reassigned are not served before the room's invalidation is received.
+		key := roomID + "\x00" + c.Request.URL.RequestURI() + "\x00" + c.Request.Header.Get("Accept-Language") +
+			"\x00" + c.Writer.Header().Get("ETag")
+
+		page, generation := rc.get(roomID, key)
+		if page != nil {
+			header := c.Writer.Header()
+			for name, values := range page.header {
+				if _, exists := header[name]; !exists {
+					header[name] = values
+				}
+			}
+			c.Writer.WriteHeader(http.StatusOK)
+			c.Writer.Write(page.body)
+			c.Abort()
+			return
+		}
+
+		original := c.Writer
+		w := &bufferedResponseWriter{ResponseWriter: original}
+		c.Writer = w
+		defer func() { c.Writer = original }()
+
+		c.Next()
+
+		body, status := w.buf.Bytes(), w.Status()
+		original.WriteHeader(status)
+		original.Write(body)
+
+		if status == http.StatusOK {
+			header := make(http.Header, len(original.Header()))
+			for name, values := range original.Header() {
+				header[name] = append([]string(nil), values...)
+			}
+			rc.add(&renderedPage{roomID, key, header, append([]byte(nil), body...)}, generation)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/t3chguy/matrix-static/mxclient"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newRenderCacheRouter returns a router serving room pages through rc, whose bodies count how often each was rendered.
+func newRenderCacheRouter(rc *RenderCache) (*gin.Engine, map[string]int) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	renders := make(map[string]int)
+	handler := func(c *gin.Context) {
+		renders[c.Request.URL.RequestURI()]++
+		if c.Query("status") == "error" {
+			c.String(http.StatusInternalServerError, "error")
+			return
+		}
+		c.Header("X-Rendered", "yes")
+		c.String(http.StatusOK, "%s rendered %d", c.Request.URL.RequestURI(), renders[c.Request.URL.RequestURI()])
+	}
+	router.GET("/room/:roomID/", rc.Middleware(), handler)
+	router.GET("/room/:roomID/export.json", rc.Middleware(), handler)
+	return router, renders
+}
+
+func getRoomPage(router *gin.Engine, path, acceptLanguage string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if acceptLanguage != "" {
+		req.Header.Set("Accept-Language", acceptLanguage)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRenderCacheMiddleware(t *testing.T) {
+	rc := NewRenderCache(1<<20, make(chan string))
+	router, renders := newRenderCacheRouter(rc)
+
+	tests := []struct {
+		name           string
+		path           string
+		acceptLanguage string
+		invalidate     string
+		wantBody       string
+		wantRenders    int
+	}{
+		{"miss renders", "/room/!a:b/", "", "", "/room/!a:b/ rendered 1", 1},
+		{"hit is served from the cache", "/room/!a:b/", "", "", "/room/!a:b/ rendered 1", 1},
+		{"query is part of the key", "/room/!a:b/?offset=10", "", "", "/room/!a:b/?offset=10 rendered 1", 1},
+		{"language is part of the key", "/room/!a:b/", "de", "", "/room/!a:b/ rendered 2", 2},
+		{"other rooms are unaffected by invalidation", "/room/!a:b/", "", "!c:d", "/room/!a:b/ rendered 1", 2},
+		{"invalidation drops the room's pages", "/room/!a:b/", "", "!a:b", "/room/!a:b/ rendered 3", 3},
+		{"and re-caches them", "/room/!a:b/", "", "", "/room/!a:b/ rendered 3", 3},
+		{"errors are not cached", "/room/!a:b/?status=error", "", "", "error", 1},
+		{"errors are rendered again", "/room/!a:b/?status=error", "", "", "error", 2},
+		{"streamed exports are not cached", "/room/!a:b/export.json", "", "", "/room/!a:b/export.json rendered 1", 1},
+		{"streamed exports are rendered again", "/room/!a:b/export.json", "", "", "/room/!a:b/export.json rendered 2", 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.invalidate != "" {
+				rc.Invalidate(test.invalidate)
+			}
+			w := getRoomPage(router, test.path, test.acceptLanguage)
+			if w.Body.String() != test.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), test.wantBody)
+			}
+			if renders[test.path] != test.wantRenders {
+				t.Errorf("rendered %d times, want %d", renders[test.path], test.wantRenders)
+			}
+			if w.Code == http.StatusOK && w.Header().Get("X-Rendered") != "yes" {
+				t.Errorf("headers of the page were not kept: %v", w.Header())
+			}
+		})
+	}
+}
+
+func TestRenderCacheInvalidationChannel(t *testing.T) {
+	invalidations := make(chan string)
+	rc := NewRenderCache(1<<20, invalidations)
+	router, _ := newRenderCacheRouter(rc)
+
+	getRoomPage(router, "/room/!a:b/", "")
+	if rc.Len() != 1 {
+		t.Fatalf("Len() = %d, want 1", rc.Len())
+	}
+	invalidations <- "!a:b"
+	for deadline := time.Now().Add(time.Second); rc.Len() != 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("page was not dropped once its room was sent down the invalidation channel")
+		}
+	}
+}
+
+func TestRenderCacheEviction(t *testing.T) {
+	page := func(roomID, key string, size int) *renderedPage {
+		return &renderedPage{roomID, key, http.Header{}, []byte(strings.Repeat("x", size))}
+	}
+
+	rc := NewRenderCache(100, make(chan string))
+	rc.add(page("!a:b", "1", 40), 0)
+	rc.add(page("!a:b", "2", 40), 0)
+	// 1 is now the most recently used, so 2 is evicted to make room for 3.
+	if hit, _ := rc.get("!a:b", "1"); hit == nil {
+		t.Fatal("1 missing")
+	}
+	rc.add(page("!c:d", "3", 40), 0)
+	if hit, _ := rc.get("!a:b", "2"); hit != nil {
+		t.Error("least recently used page was not evicted")
+	}
+	if hit, _ := rc.get("!a:b", "1"); hit == nil {
+		t.Error("recently used page was evicted")
+	}
+
+	rc.add(page("!a:b", "big", 101), 0)
+	if hit, _ := rc.get("!a:b", "big"); hit != nil {
+		t.Error("page larger than the whole budget was stored")
+	}
+
+	// renders which began before an invalidation must not be stored once it has happened.
+	_, generation := rc.get("!a:b", "4")
+	rc.Invalidate("!a:b")
+	rc.add(page("!a:b", "4", 10), generation)
+	if hit, _ := rc.get("!a:b", "4"); hit != nil {
+		t.Error("page rendered before its room was invalidated was stored")
+	}
+	if rc.Len() != 1 || rc.numBytes != 40 {
+		t.Errorf("Len() = %d holding %d bytes, want only 3 of 40", rc.Len(), rc.numBytes)
+	}
+}
+
+// TestRenderCacheRoomErrorPages asserts that the error pages of rooms are not answered 200, lest they are cached in
+// place of the room's pages.
+func TestRenderCacheRoomErrorPages(t *testing.T) {
+	rc := NewRenderCache(1<<20, make(chan string))
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	renders := 0
+	router.GET("/room/:roomID/", rc.Middleware(), func(c *gin.Context) {
+		renders++
+		err := errors.New("homeserver unreachable")
+		if c.Query("anchor") != "" {
+			err = mxclient.ErrEventNotFound
+		}
+		writeRoomErrorPage(c, err, "Event not found", mxclient.RoomInfo{RoomID: c.Param("roomID")})
+	})
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+	}{
+		{"failing homeserver", "/room/!a:b/", http.StatusBadGateway},
+		{"unknown event", "/room/!a:b/?anchor=$unknown", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			before := renders
+			for i := 0; i < 2; i++ {
+				if w := getRoomPage(router, test.path, ""); w.Code != test.wantCode {
+					t.Errorf("got %d, want %d", w.Code, test.wantCode)
+				}
+			}
+			if got := renders - before; got != 2 {
+				t.Errorf("rendered %d times, want 2 as the error page is not cached", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/t3chguy/matrix-static/templates"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var renderQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "room_render_queue_depth",
+	Help: "How many room page requests are waiting for one of the --max-concurrent-renders to finish.",
+})
+
+// renderLimiter bounds how many room pages are loaded & rendered at once, so that a crawler requesting many at once
+// cannot exhaust our memory & CPU. Its Middleware must precede the one loading the RoomWorker, whose initial sync of a
+// room is the costliest part of loading it. Requests beyond that wait their turn in a queue of bounded size, until their
+// deadline, and those finding the queue full are turned away straight away.
+type renderLimiter struct {
+	slots chan struct{}
+	queue chan struct{}
+}
+
+func newRenderLimiter(maxRenders, maxQueued int) *renderLimiter {
+	return &renderLimiter{
+		slots: make(chan struct{}, maxRenders),
+		queue: make(chan struct{}, maxQueued),
+	}
+}
+
+// acquire takes a render slot, queueing for one until ctx is done if none are free, returning whether it got one and
+// if not whether that was because the queue was full.
+func (l *renderLimiter) acquire(ctx context.Context) (acquired, queueFull bool) {
+	select {
+	case l.slots <- struct{}{}:
+		return true, false
+	default:
+	}
+
+	select {
+	case l.queue <- struct{}{}:
+	default:
+		return false, true
+	}
+	renderQueueDepth.Inc()
+	defer func() {
+		<-l.queue
+		renderQueueDepth.Dec()
+	}()
+
+	select {
+	case l.slots <- struct{}{}:
+		return true, false
+	case <-ctx.Done():
+		return false, false
+	}
+}
+
+func (l *renderLimiter) release() {
+	<-l.slots
+}
+
+// Middleware holds a render slot for the rest of the request. Streamed exports are left alone, they are expected to
+// take a while and would hold their slot throughout, and are bounded by --request-timeout instead.
+func (l *renderLimiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isStreamedRequest(c) {
+			c.Next()
+			return
+		}
+
+		acquired, queueFull := l.acquire(c.Request.Context())
+		if queueFull {
+			abortRendersBusy(c)
+			return
+		}
+		if !acquired {
+			abortIfCancelled(c)
+			return
+		}
+		defer l.release()
+		c.Next()
+	}
+}
+
+// abortRendersBusy responds 503 asking the client to try again shortly, as too many pages are being rendered already.
+func abortRendersBusy(c *gin.Context) {
+	requestLogger(c).Warn("Turning away request as the render queue is full")
+	c.Header("Retry-After", strconv.Itoa(int(RetryAfter/time.Second)))
+	if isJSONRequest(c) {
+		abortWithJSONError(c, http.StatusServiceUnavailable, "M_UNKNOWN", "Too many rooms are being loaded, try again shortly.")
+		return
+	}
+
+	c.Status(http.StatusServiceUnavailable)
+	templates.WritePageTemplate(c.Writer, &templates.ErrorPage{
+		ErrType: "Too many pages are being loaded right now.",
+		Details: "The archive is busy, try again in a few moments.",
+	})
+	c.Abort()
+}
@@ -0,0 +1,114 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestRenderLimiterSaturated asserts that the initial syncs of rooms wait for a render slot, so that with the only
+// slot held by a slow sync the next request for a room waits in the queue, until its deadline or until the slot is
+// freed, and those finding the queue full are turned away without any sync being started for them.
+func TestRenderLimiterSaturated(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var turnedAwaySyncs int32
+	emptySync := `{"messages":{"start":"s0","end":"e0","chunk":[]},"state":[]}`
+	client := newTestClient(t,
+		homeserverRoute{suffix: "/rooms/!slow:example.org/initialSync", handler: func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+			w.Write([]byte(emptySync))
+		}},
+		homeserverRoute{suffix: "/rooms/!turned-away:example.org/initialSync", handler: func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&turnedAwaySyncs, 1)
+			w.Write([]byte(emptySync))
+		}},
+		homeserverRoute{suffix: "/initialSync", status: http.StatusOK, body: emptySync},
+	)
+	limiter := newRenderLimiter(1, 1)
+	router := newTestRoomRouter(client, nil, nil, func(roomRouter *gin.RouterGroup) {
+		roomRouter.GET("/", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	}, limiter.Middleware())
+
+	serve := func(ctx context.Context, roomID string) <-chan *httptest.ResponseRecorder {
+		done := make(chan *httptest.ResponseRecorder, 1)
+		go func() {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/room/"+roomID+"/", nil).WithContext(ctx))
+			done <- w
+		}()
+		return done
+	}
+	waitQueued := func(t *testing.T) {
+		for deadline := time.Now().Add(5 * time.Second); len(limiter.queue) == 0; time.Sleep(time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatal("request was never queued")
+			}
+		}
+	}
+
+	slow := serve(context.Background(), "!slow:example.org")
+	<-started
+
+	tests := []struct {
+		name     string
+		roomID   string
+		timeout  time.Duration
+		wantCode int
+	}{
+		// the queue is free, its request giving up at its deadline while the slot is held.
+		{"queued until the deadline", "!queued:example.org", 50 * time.Millisecond, http.StatusServiceUnavailable},
+		{"queued until the slot is freed", "!queued:example.org", 0, http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.Background(), func() {}
+			if test.timeout > 0 {
+				ctx, cancel = context.WithTimeout(ctx, test.timeout)
+			}
+			defer cancel()
+			queued := serve(ctx, test.roomID)
+			waitQueued(t)
+
+			if test.wantCode == http.StatusOK {
+				// with the queue full the next request is turned away, before its room is synced.
+				turnedAway := <-serve(context.Background(), "!turned-away:example.org")
+				if turnedAway.Code != http.StatusServiceUnavailable || turnedAway.Header().Get("Retry-After") == "" {
+					t.Errorf("turned away request got %d with Retry-After %q, want a 503 asking to retry",
+						turnedAway.Code, turnedAway.Header().Get("Retry-After"))
+				}
+				if n := atomic.LoadInt32(&turnedAwaySyncs); n != 0 {
+					t.Errorf("turned away request synced its room %d times, want 0", n)
+				}
+				close(release)
+			}
+
+			w := <-queued
+			if w.Code != test.wantCode {
+				t.Errorf("queued request got %d, want %d", w.Code, test.wantCode)
+			}
+		})
+	}
+
+	if w := <-slow; w.Code != http.StatusOK {
+		t.Errorf("request holding the slot got %d, want %d", w.Code, http.StatusOK)
+	}
+}
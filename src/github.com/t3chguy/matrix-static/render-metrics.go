@@ -0,0 +1,79 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/t3chguy/matrix-static/templates"
+	"net/http"
+	"time"
+)
+
+var roomRenderDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "room_render_duration_seconds",
+		Help:    "How long room timelines took to render, excluding waiting on the workers & writing the response.",
+		Buckets: prometheus.DefBuckets,
+	},
+	[]string{"route"},
+)
+
+// The results counted by renderCacheResults.
+const (
+	renderCacheHit        = "hit"
+	renderCacheMiss       = "miss"
+	renderCacheInvalidate = "invalidate"
+)
+
+var renderCacheResults = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "render_cache_results_total",
+		Help: "How many room page lookups hit & missed the render cache, and how many times a room's pages were invalidated.",
+	},
+	[]string{"result"},
+)
+
+// RegisterRenderMetrics registers the render metrics into reg.
+func RegisterRenderMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(roomRenderDuration)
+
+	// so that the hit ratio can be computed before the first of each is counted.
+	for _, result := range []string{renderCacheHit, renderCacheMiss, renderCacheInvalidate} {
+		renderCacheResults.WithLabelValues(result)
+	}
+	reg.MustRegister(renderCacheResults)
+	reg.MustRegister(renderQueueDepth)
+}
+
+// writeRoomChatPage renders page into memory before writing it, so that only the render is observed for route.
+func writeRoomChatPage(c *gin.Context, route string, page *templates.RoomChatPage) {
+	var b bytes.Buffer
+	start := time.Now()
+	templates.WritePageTemplate(&b, page)
+	roomRenderDuration.WithLabelValues(route).Observe(time.Since(start).Seconds())
+
+	c.Data(http.StatusOK, "text/html; charset=utf-8", b.Bytes())
+}
+
+// writeRoomChatJSON builds the JSON timeline doc lazily so that its construction is observed for route.
+func writeRoomChatJSON(c *gin.Context, route string, build func() roomChatJSON) {
+	start := time.Now()
+	doc := build()
+	roomRenderDuration.WithLabelValues(route).Observe(time.Since(start).Seconds())
+
+	c.JSON(http.StatusOK, doc)
+}
@@ -0,0 +1,141 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/t3chguy/matrix-static/mxclient"
+	"github.com/t3chguy/matrix-static/templates"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// numRenders returns how many renders roomRenderDuration has observed for route.
+func numRenders(t *testing.T, route string) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := roomRenderDuration.WithLabelValues(route).(prometheus.Histogram).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestRenderDurationByRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/page", func(c *gin.Context) {
+		writeRoomChatPage(c, "test_page", &templates.RoomChatPage{RoomInfo: mxclient.RoomInfo{RoomID: "!r:example.org", Name: "Render Room"}})
+	})
+	router.GET("/chat.json", func(c *gin.Context) {
+		writeRoomChatJSON(c, "test_json", func() roomChatJSON {
+			return roomChatJSON{Room: roomJSON{RoomID: "!r:example.org"}}
+		})
+	})
+
+	pagesBefore, docsBefore := numRenders(t, "test_page"), numRenders(t, "test_json")
+
+	page := getRoomPage(router, "/page", "")
+	if page.Code != http.StatusOK || !strings.HasPrefix(page.Header().Get("Content-Type"), "text/html") ||
+		!strings.Contains(page.Body.String(), "Render Room") {
+		t.Errorf("got %d %s, want the page: %s", page.Code, page.Header().Get("Content-Type"), page.Body.String())
+	}
+	doc := getRoomPage(router, "/chat.json", "")
+	if doc.Code != http.StatusOK || !strings.Contains(doc.Body.String(), `"!r:example.org"`) {
+		t.Errorf("got %d, want the timeline doc: %s", doc.Code, doc.Body.String())
+	}
+
+	if got := numRenders(t, "test_page") - pagesBefore; got != 1 {
+		t.Errorf("observed %d renders of the page, want 1", got)
+	}
+	if got := numRenders(t, "test_json") - docsBefore; got != 1 {
+		t.Errorf("observed %d builds of the timeline doc, want 1", got)
+	}
+}
+
+// numRenderCacheResults returns how many of result renderCacheResults has counted.
+func numRenderCacheResults(t *testing.T, result string) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := renderCacheResults.WithLabelValues(result).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestRenderCacheResults(t *testing.T) {
+	rc := NewRenderCache(1<<20, make(chan string))
+	router, _ := newRenderCacheRouter(rc)
+
+	tests := []struct {
+		name                                    string
+		invalidate                              bool
+		wantHits, wantMisses, wantInvalidations float64
+	}{
+		{"miss", false, 0, 1, 0},
+		{"hit", false, 1, 0, 0},
+		{"invalidated", true, 0, 1, 1},
+		{"hit again", false, 1, 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hits, misses := numRenderCacheResults(t, renderCacheHit), numRenderCacheResults(t, renderCacheMiss)
+			invalidations := numRenderCacheResults(t, renderCacheInvalidate)
+			if test.invalidate {
+				rc.Invalidate("!results:example.org")
+			}
+			getRoomPage(router, "/room/!results:example.org/", "")
+
+			if got := numRenderCacheResults(t, renderCacheHit) - hits; got != test.wantHits {
+				t.Errorf("counted %v hits, want %v", got, test.wantHits)
+			}
+			if got := numRenderCacheResults(t, renderCacheMiss) - misses; got != test.wantMisses {
+				t.Errorf("counted %v misses, want %v", got, test.wantMisses)
+			}
+			if got := numRenderCacheResults(t, renderCacheInvalidate) - invalidations; got != test.wantInvalidations {
+				t.Errorf("counted %v invalidations, want %v", got, test.wantInvalidations)
+			}
+		})
+	}
+}
+
+func TestRegisterRenderMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	RegisterRenderMetrics(reg)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := make(map[string]bool)
+	for _, family := range families {
+		if family.GetName() != "render_cache_results_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				results[label.GetValue()] = true
+			}
+		}
+	}
+	// each result is exported before it is first counted, for the hit ratio to be computable from the start.
+	for _, result := range []string{renderCacheHit, renderCacheMiss, renderCacheInvalidate} {
+		if !results[result] {
+			t.Errorf("render_cache_results_total lacks the %s result: %v", result, results)
+		}
+	}
+}
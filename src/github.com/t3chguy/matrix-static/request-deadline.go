@@ -0,0 +1,76 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/t3chguy/matrix-static/templates"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// requestDeadline bounds how long we spend on each request, the context of which is also cancelled should the client
+// disconnect, so that work still queued on its behalf can be skipped. Streamed exports are expected to take a while,
+// so are only abandoned along with the client, their write deadline being extended as they go.
+func requestDeadline(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isStreamedRequest(c) {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// renderDeadline bounds how long we spend on room pages, which may wait on the homeserver to paginate, tighter than
+// requestDeadline so that users are told to try again well before the server's write timeout cuts them off.
+func renderDeadline(timeout time.Duration) gin.HandlerFunc {
+	return requestDeadline(timeout)
+}
+
+// RetryAfter is how long we ask users to wait before retrying requests we ran out of time for.
+const RetryAfter = 5 * time.Second
+
+// abortIfCancelled aborts the request if the client has gone or we ran out of time for it, returning whether it did,
+// with a 503 asking them to try again in case they are still there. Handlers check this before rendering, which would
+// otherwise be wasted.
+func abortIfCancelled(c *gin.Context) bool {
+	err := c.Request.Context().Err()
+	if err == nil {
+		return false
+	}
+
+	requestLogger(c).WithError(err).Warn("Abandoning request")
+	c.Header("Retry-After", strconv.Itoa(int(RetryAfter/time.Second)))
+	if isJSONRequest(c) {
+		abortWithJSONError(c, http.StatusServiceUnavailable, "M_UNKNOWN", "Timed out loading the room, try again shortly.")
+		return true
+	}
+
+	c.Status(http.StatusServiceUnavailable)
+	templates.WritePageTemplate(c.Writer, &templates.ErrorPage{
+		ErrType: "This page took too long to load.",
+		Details: "The homeserver is being slow to respond, try again in a few moments.",
+	})
+	c.Abort()
+	return true
+}
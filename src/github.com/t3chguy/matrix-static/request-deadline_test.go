@@ -0,0 +1,222 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/t3chguy/matrix-static/sanitizer"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const slowRoomID = "!slow:example.org"
+
+// testDeadline is the deadline of requests to a homeserver which takes slowHomeserverDelay to answer them.
+const (
+	testDeadline        = 100 * time.Millisecond
+	slowHomeserverDelay = 5 * time.Second
+)
+
+// slowHomeserverRoute answers requests whose path ends in suffix once slowHomeserverDelay has passed, or gives up
+// along with the request.
+func slowHomeserverRoute(suffix string) homeserverRoute {
+	return homeserverRoute{suffix: suffix, handler: func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(slowHomeserverDelay):
+			w.Write([]byte(`{}`))
+		case <-r.Context().Done():
+		}
+	}}
+}
+
+// TestRequestDeadlineSlowHomeserver asserts that pages waiting on a slow homeserver are answered with a 503 at their
+// deadline, rather than once the homeserver gets around to answering.
+func TestRequestDeadlineSlowHomeserver(t *testing.T) {
+	client := newTestClient(t,
+		slowHomeserverRoute("/rooms/!unsynced:example.org/initialSync"),
+		homeserverRoute{suffix: "/rooms/" + slowRoomID + "/initialSync", status: http.StatusOK,
+			body: `{"messages":{"start":"s0","end":"e0","chunk":[]},"state":[]}`},
+		slowHomeserverRoute("/rooms/"+slowRoomID+"/messages"),
+	)
+	sanitizerFn := sanitizer.InitSanitizer()
+	router := newTestRoomRouter(client, nil, nil, func(roomRouter *gin.RouterGroup) {
+		roomRouter.GET("/chat.json", func(c *gin.Context) {
+			serveRoomChatJSON(c, c.MustGet("RoomWorker").(Worker), RoomTimelineSize, sanitizerFn)
+		})
+	}, requestDeadline(testDeadline))
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"initial sync", "/room/!unsynced:example.org/chat.json"},
+		{"back-pagination", "/room/" + slowRoomID + "/chat.json"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start := time.Now()
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+
+			if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+				t.Errorf("got %d with Retry-After %q, want a 503 asking to retry", w.Code, w.Header().Get("Retry-After"))
+			}
+			if took := time.Since(start); took > testDeadline+time.Second {
+				t.Errorf("took %s to answer, want about the deadline of %s", took, testDeadline)
+			}
+		})
+	}
+}
+
+// TestJobsGiveUpAtDeadline asserts that each job waiting on a slow homeserver gives up along with its request.
+func TestJobsGiveUpAtDeadline(t *testing.T) {
+	client := newTestClient(t,
+		homeserverRoute{suffix: "/rooms/" + slowRoomID + "/initialSync", status: http.StatusOK,
+			body: `{"messages":{"start":"s0","end":"e0","chunk":[]},"state":[]}`},
+		slowHomeserverRoute("/messages"),
+		slowHomeserverRoute("/timestamp_to_event"),
+		slowHomeserverRoute("/event/$root"),
+		slowHomeserverRoute("/relations/$root/m.thread"),
+		slowHomeserverRoute("/context/$event"),
+	)
+	worker := NewWorker(0, client, nil)
+	worker.Queue <- &RoomInitialSyncJob{slowRoomID, context.Background()}
+	if resp := (<-worker.Output).(*RoomInitialSyncResp); resp.err != nil {
+		t.Fatal(resp.err)
+	}
+
+	tests := []struct {
+		name string
+		job  func(ctx context.Context) Job
+	}{
+		{"events", func(ctx context.Context) Job { return RoomEventsJob{slowRoomID, "", 0, RoomTimelineSize, ctx} }},
+		{"event context", func(ctx context.Context) Job { return RoomEventContextJob{slowRoomID, "$event", RoomContextSize, ctx} }},
+		{"thread", func(ctx context.Context) Job { return RoomThreadJob{slowRoomID, "$root", ctx} }},
+		{"jump to date", func(ctx context.Context) Job { return RoomJumpToDateJob{slowRoomID, 1000, ctx} }},
+		{"export", func(ctx context.Context) Job { return RoomExportBackpaginateJob{slowRoomID, ctx} }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), testDeadline)
+			defer cancel()
+
+			start := time.Now()
+			worker.Queue <- test.job(ctx)
+			<-worker.Output
+			if took := time.Since(start); took > testDeadline+time.Second {
+				t.Errorf("took %s to answer, want about the deadline of %s", took, testDeadline)
+			}
+		})
+	}
+}
+
+func TestRequestDeadline(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(requestDeadline(time.Minute))
+	deadlines := make(map[string]time.Time)
+	for _, path := range []string{"/room/:roomID/", "/room/:roomID/export.json"} {
+		router.GET(path, func(c *gin.Context) {
+			deadline, _ := c.Request.Context().Deadline()
+			deadlines[c.Request.URL.Path] = deadline
+		})
+	}
+
+	start := time.Now()
+	getRoomPage(router, "/room/!r:example.org/", "")
+	if deadline := deadlines["/room/!r:example.org/"]; deadline.Before(start.Add(time.Minute)) || deadline.After(time.Now().Add(time.Minute)) {
+		t.Errorf("got deadline %v, want a minute after the request", deadline)
+	}
+	// exports are only abandoned along with the client.
+	getRoomPage(router, "/room/!r:example.org/export.json", "")
+	if deadline := deadlines["/room/!r:example.org/export.json"]; !deadline.IsZero() {
+		t.Errorf("got deadline %v for an export, want none", deadline)
+	}
+}
+
+func TestAbortIfCancelled(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name      string
+		path      string
+		ctx       context.Context
+		wantAbort bool
+		wantBody  string
+	}{
+		{"ongoing", "/room/!r:example.org/", context.Background(), false, ""},
+		{"abandoned page", "/room/!r:example.org/", cancelled, true, "This page took too long to load."},
+		{"abandoned JSON", "/room/!r:example.org/chat.json", cancelled, true, `"errcode":"M_UNKNOWN"`},
+	}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	var aborted, isAborted bool
+	for _, path := range []string{"/room/:roomID/", "/room/:roomID/chat.json"} {
+		router.GET(path, func(c *gin.Context) {
+			aborted = abortIfCancelled(c)
+			isAborted = c.IsAborted()
+		})
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil).WithContext(test.ctx))
+
+			if aborted != test.wantAbort || isAborted != test.wantAbort {
+				t.Fatalf("abortIfCancelled() = %v, aborted = %v, want %v", aborted, isAborted, test.wantAbort)
+			}
+			if !test.wantAbort {
+				return
+			}
+			if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "5" {
+				t.Errorf("got %d with Retry-After %q, want 503 with 5", w.Code, w.Header().Get("Retry-After"))
+			}
+			if !strings.Contains(w.Body.String(), test.wantBody) {
+				t.Errorf("body lacks %s: %s", test.wantBody, w.Body.String())
+			}
+		})
+	}
+}
+
+// TestRoomInitialSyncJobAbandoned asserts that rooms are not synced for requests abandoned while queued for the worker.
+func TestRoomInitialSyncJobAbandoned(t *testing.T) {
+	syncs := 0
+	client := newTestClient(t, homeserverRoute{suffix: "/rooms/" + slowRoomID + "/initialSync", handler: func(w http.ResponseWriter, r *http.Request) {
+		syncs++
+		w.Write([]byte(`{"messages":{"start":"s0","end":"e0","chunk":[]},"state":[]}`))
+	}})
+	worker := NewWorker(0, client, nil)
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	worker.Queue <- &RoomInitialSyncJob{slowRoomID, cancelled}
+	if resp := (<-worker.Output).(*RoomInitialSyncResp); resp.err != context.Canceled || syncs != 0 {
+		t.Errorf("got error %v having synced %d times, want %v without syncing", resp.err, syncs, context.Canceled)
+	}
+
+	worker.Queue <- &RoomInitialSyncJob{slowRoomID, context.Background()}
+	if resp := (<-worker.Output).(*RoomInitialSyncResp); resp.err != nil || syncs != 1 {
+		t.Fatalf("got error %v having synced %d times, want the room synced", resp.err, syncs)
+	}
+	// once synced, the room is there for requests however little time they have left.
+	worker.Queue <- &RoomInitialSyncJob{slowRoomID, cancelled}
+	if resp := (<-worker.Output).(*RoomInitialSyncResp); resp.err != nil || syncs != 1 {
+		t.Errorf("got error %v having synced %d times, want the synced room", resp.err, syncs)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	log "github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/t3chguy/matrix-static/mxclient"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestLogger returns a logger tagged with the ID of the request, for everything logged on behalf of it.
+func requestLogger(c *gin.Context) *log.Entry {
+	return mxclient.Logger(c.Request.Context())
+}
+
+// logRequests tags each request with an ID, we accept one from a proxy in front of us. The ID is echoed in the
+// response & carried by the context of the request, so that the homeserver requests made for it send it too.
+// Then it logs the request once it has completed.
+func logRequests(c *gin.Context) {
+	start := time.Now()
+
+	requestID := c.Request.Header.Get(mxclient.RequestIDHeader)
+	if !validRequestID.MatchString(requestID) {
+		requestID = newRequestID()
+	}
+	c.Request = c.Request.WithContext(mxclient.WithRequestID(c.Request.Context(), requestID))
+	c.Header(mxclient.RequestIDHeader, requestID)
+
+	c.Next()
+
+	entry := requestLogger(c).WithFields(log.Fields{
+		"method":    c.Request.Method,
+		"path":      c.Request.URL.Path,
+		"status":    c.Writer.Status(),
+		"latency":   time.Since(start).String(),
+		"client_ip": clientIP(c),
+	})
+	if len(c.Errors) > 0 {
+		entry = entry.WithField("errors", c.Errors.String())
+	}
+
+	if c.Writer.Status() >= http.StatusInternalServerError {
+		entry.Error("Request failed")
+	} else {
+		entry.Info("Request completed")
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/t3chguy/matrix-static/mxclient"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLogRequestsCarriesRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(logRequests)
+	router.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, "%s", mxclient.RequestID(c.Request.Context()))
+	})
+
+	tests := []struct {
+		name      string
+		requestID string
+		wantOurs  bool
+	}{
+		{"accepts a valid ID from a proxy", "proxy-id.1_2", false},
+		{"generates one if there is none", "", true},
+		{"generates one in place of an invalid ID", "not valid!", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.requestID != "" {
+				req.Header.Set(mxclient.RequestIDHeader, test.requestID)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			echoed := w.Header().Get(mxclient.RequestIDHeader)
+			if w.Body.String() != echoed {
+				t.Errorf("request context carries %q, response header %q", w.Body.String(), echoed)
+			}
+			if test.wantOurs {
+				if echoed == test.requestID || !validRequestID.MatchString(echoed) {
+					t.Errorf("got request ID %q, want a newly generated one", echoed)
+				}
+			} else if echoed != test.requestID {
+				t.Errorf("got request ID %q, want %q", echoed, test.requestID)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+)
+
+// robotsPolicy is what crawlers may index of the archive, everything else is only ever linked from what they may.
+type robotsPolicy struct {
+	AllowDirectory bool
+	AllowRooms     bool
+}
+
+// robotsTxt renders the robots.txt for the public routes served under prefix (with trailing slash).
+// The media proxy, room exports, metricsPath and versionPath are always disallowed, sitemapURL is omitted if empty.
+func robotsTxt(policy robotsPolicy, prefix, metricsPath, versionPath, sitemapURL string) string {
+	var sb strings.Builder
+	sb.WriteString("User-agent: *\n")
+
+	disallow := func(path string) {
+		sb.WriteString("Disallow: " + path + "\n")
+	}
+
+	disallow(prefix + "media/")
+	disallow(prefix + "thumb/")
+	disallow(metricsPath)
+	disallow(versionPath)
+	disallow(prefix + "room/*/members/*")
+	// exports are whole timelines over again, which crawlers have no need to fetch on top of the pages.
+	disallow(prefix + "room/*/export.json")
+	if !policy.AllowRooms {
+		disallow(prefix + "room/")
+	}
+	if !policy.AllowDirectory {
+		// only the directory itself and its pages, which leaves the paths nested under the prefix alone.
+		disallow(prefix + "$")
+		disallow(prefix + "?")
+		disallow(prefix + "rooms")
+	}
+
+	// the sitemap only lists room pages, so there is no point pointing crawlers at it if those are disallowed.
+	if sitemapURL != "" && policy.AllowRooms {
+		sb.WriteString("\nSitemap: " + sitemapURL + "\n")
+	}
+	return sb.String()
+}
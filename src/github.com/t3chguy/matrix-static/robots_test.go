@@ -0,0 +1,59 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRobotsTxt(t *testing.T) {
+	const sitemap = "https://static.example.org/archive/sitemap.xml"
+	// always is what is disallowed whatever the policy.
+	always := []string{
+		"User-agent: *",
+		"Disallow: /archive/media/",
+		"Disallow: /archive/thumb/",
+		"Disallow: /metrics",
+		"Disallow: /version",
+		"Disallow: /archive/room/*/members/*",
+		"Disallow: /archive/room/*/export.json",
+	}
+	tests := []struct {
+		name       string
+		policy     robotsPolicy
+		sitemapURL string
+		want       []string
+	}{
+		{"allow everything", robotsPolicy{AllowDirectory: true, AllowRooms: true}, sitemap,
+			[]string{"", "Sitemap: " + sitemap}},
+		{"allow everything without a sitemap", robotsPolicy{AllowDirectory: true, AllowRooms: true}, "", nil},
+		{"disallow rooms", robotsPolicy{AllowDirectory: true}, sitemap,
+			[]string{"Disallow: /archive/room/"}},
+		{"disallow the directory", robotsPolicy{AllowRooms: true}, sitemap,
+			[]string{"Disallow: /archive/$", "Disallow: /archive/?", "Disallow: /archive/rooms", "", "Sitemap: " + sitemap}},
+		{"disallow everything", robotsPolicy{}, sitemap,
+			[]string{"Disallow: /archive/room/", "Disallow: /archive/$", "Disallow: /archive/?", "Disallow: /archive/rooms"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := robotsTxt(test.policy, "/archive/", "/metrics", "/version", test.sitemapURL)
+			want := strings.Join(append(append([]string{}, always...), test.want...), "\n") + "\n"
+			if got != want {
+				t.Errorf("got\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
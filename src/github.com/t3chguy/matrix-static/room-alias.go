@@ -0,0 +1,113 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/gin-contrib/cache/persistence"
+	"github.com/gin-gonic/gin"
+	"github.com/matrix-org/gomatrix"
+	"github.com/t3chguy/matrix-static/mxclient"
+	"github.com/t3chguy/matrix-static/templates"
+	"net/http"
+	"time"
+)
+
+// RoomAliasResolutionTTL is how long an alias is trusted to point at the same room, aliases rarely move.
+const RoomAliasResolutionTTL = 5 * time.Minute
+
+// roomAliasResolver resolves room aliases to room IDs via the homeserver directory, caching successful lookups.
+type roomAliasResolver struct {
+	client *mxclient.Client
+	cache  *persistence.InMemoryStore
+}
+
+func newRoomAliasResolver(client *mxclient.Client) *roomAliasResolver {
+	return &roomAliasResolver{client, persistence.NewInMemoryStore(RoomAliasResolutionTTL)}
+}
+
+// Resolve returns the room ID roomAlias points at, found=false if the directory does not know of it.
+func (r *roomAliasResolver) Resolve(roomAlias string) (roomID string, found bool, err error) {
+	if r.cache.Get(roomAlias, &roomID) == nil {
+		return roomID, true, nil
+	}
+
+	resp, err := r.client.GetRoomDirectoryAlias(roomAlias)
+	if err != nil {
+		if httpErr, ok := err.(gomatrix.HTTPError); ok && httpErr.Code == http.StatusNotFound {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	if resp.RoomID == "" {
+		return "", false, nil
+	}
+
+	r.cache.Set(roomAlias, resp.RoomID, RoomAliasResolutionTTL)
+	return resp.RoomID, true, nil
+}
+
+// InvalidRoomIDDetails explains what we expect of room IDs & aliases in URLs.
+const InvalidRoomIDDetails = "Rooms are identified by an ID of the form !opaque_id:server_name or an alias of the form #room_alias:server_name."
+
+// abortInvalidRoomID responds 400 Bad Request to requests for what cannot be a room.
+func abortInvalidRoomID(c *gin.Context) {
+	if isJSONRequest(c) {
+		abortWithJSONError(c, http.StatusBadRequest, "M_INVALID_PARAM", InvalidRoomIDDetails)
+		return
+	}
+
+	c.Status(http.StatusBadRequest)
+	templates.WritePageTemplate(c.Writer, &templates.ErrorPage{
+		ErrType: "Unable to Load Room.",
+		Details: InvalidRoomIDDetails,
+	})
+	c.Abort()
+}
+
+// serveRoomAlias redirects /alias/:roomAlias to the room it resolves to. Blocked aliases are checked ahead of the
+// resolver's cache so that reloading the blocklist takes effect immediately.
+func serveRoomAlias(resolver *roomAliasResolver, blocklist *roomBlocklist, basePath string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roomAlias := c.Param("roomAlias")
+		if !mxclient.IsValidRoomAlias(roomAlias) {
+			abortInvalidRoomID(c)
+			return
+		}
+		if blocklist.IsBlocked(roomAlias) {
+			abortBlockedRoom(c)
+			return
+		}
+
+		roomID, found, err := resolver.Resolve(roomAlias)
+		if err != nil {
+			c.Status(http.StatusBadGateway)
+			templates.WritePageTemplate(c.Writer, &templates.ErrorPage{
+				ErrType: "Unable to resolve Room Alias.",
+				Error:   err,
+			})
+			return
+		}
+		if !found {
+			c.Status(http.StatusNotFound)
+			templates.WritePageTemplate(c.Writer, &templates.ErrorPage{
+				ErrType: "Unable to resolve Room Alias.",
+				Details: "No room could be found for " + roomAlias + ", check that it is spelled correctly and still exists.",
+			})
+			return
+		}
+
+		c.Redirect(http.StatusFound, basePath+"room/"+roomID+"/")
+	}
+}
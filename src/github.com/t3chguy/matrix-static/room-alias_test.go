@@ -0,0 +1,136 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"testing"
+)
+
+const (
+	testRoomAlias   = "#room:example.org"
+	testAliasRoomID = "!room:example.org"
+)
+
+// aliasRoutes answer the directory lookup of testRoomAlias with testAliasRoomID and of any other alias with M_NOT_FOUND.
+var aliasRoutes = []homeserverRoute{
+	{suffix: "/directory/room/" + testRoomAlias, status: http.StatusOK, body: `{"room_id":"` + testAliasRoomID + `","servers":["example.org"]}`},
+	{suffix: "/directory/room/#unknown:example.org", status: http.StatusNotFound, body: `{"errcode":"M_NOT_FOUND","error":"Room alias not found"}`},
+}
+
+func TestServeRoomAlias(t *testing.T) {
+	client := newTestClient(t, aliasRoutes...)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	blocklist := &roomBlocklist{newTestRoomList("#blocked:example.org")}
+	router.GET("/alias/:roomAlias", serveRoomAlias(newRoomAliasResolver(client), blocklist, "/"))
+
+	tests := []struct {
+		name         string
+		path         string
+		wantCode     int
+		wantLocation string
+	}{
+		{"resolved alias", "/alias/%23room:example.org", http.StatusFound, "/room/" + testAliasRoomID + "/"},
+		{"unknown alias", "/alias/%23unknown:example.org", http.StatusNotFound, ""},
+		{"blocked alias", "/alias/%23blocked:example.org", http.StatusNotFound, ""},
+		{"invalid alias", "/alias/room", http.StatusBadRequest, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := getRoomPage(router, test.path, "")
+			if w.Code != test.wantCode || w.Header().Get("Location") != test.wantLocation {
+				t.Errorf("got %d to %q, want %d to %q", w.Code, w.Header().Get("Location"), test.wantCode, test.wantLocation)
+			}
+		})
+	}
+}
+
+// TestLoadRoomWorkerAlias asserts that room pages addressed by alias redirect to the same page under the room ID.
+func TestLoadRoomWorkerAlias(t *testing.T) {
+	client := newTestClient(t, aliasRoutes...)
+	router := newTestRoomRouter(client, nil, nil, func(roomRouter *gin.RouterGroup) {
+		roomRouter.GET("/members", func(c *gin.Context) { c.Status(http.StatusOK) })
+	})
+
+	tests := []struct {
+		name         string
+		path         string
+		wantCode     int
+		wantLocation string
+	}{
+		{"resolved alias", "/room/%23room:example.org/members?page=2", http.StatusFound, "/room/%21room:example.org/members?page=2"},
+		{"unknown alias", "/room/%23unknown:example.org/members", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := getRoomPage(router, test.path, "")
+			if w.Code != test.wantCode || w.Header().Get("Location") != test.wantLocation {
+				t.Errorf("got %d to %q, want %d to %q", w.Code, w.Header().Get("Location"), test.wantCode, test.wantLocation)
+			}
+		})
+	}
+}
+
+func TestRoomAliasResolverCache(t *testing.T) {
+	lookups := 0
+	client := newTestClient(t, homeserverRoute{suffix: "/directory/room/" + testRoomAlias, handler: func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"room_id":"` + testAliasRoomID + `"}`))
+	}})
+	resolver := newRoomAliasResolver(client)
+
+	for i := 0; i < 2; i++ {
+		if roomID, found, err := resolver.Resolve(testRoomAlias); err != nil || !found || roomID != testAliasRoomID {
+			t.Fatalf("got %q, %v, %v, want %q", roomID, found, err, testAliasRoomID)
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("looked up the alias %d times, want 1", lookups)
+	}
+
+	if _, found, err := resolver.Resolve("#unknown:example.org"); err != nil || found {
+		t.Errorf("unknown alias got found=%v with error %v, want not found", found, err)
+	}
+}
+
+// TestLoadRoomWorkerInvalidRoomID asserts that every room route turns away what cannot be a room before asking the
+// homeserver about it.
+func TestLoadRoomWorkerInvalidRoomID(t *testing.T) {
+	requests := 0
+	client := newTestClient(t, homeserverRoute{suffix: "/", handler: func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusInternalServerError)
+	}})
+	router := newTestRoomRouter(client, nil, nil, func(roomRouter *gin.RouterGroup) {
+		for _, path := range []string{"/", "/members", "/servers", "/$:eventID"} {
+			roomRouter.GET(path, func(c *gin.Context) { c.Status(http.StatusOK) })
+		}
+	})
+
+	for _, roomID := range []string{"garbage", "!nocolon", "%23nocolon", "@alice:example.org", "!room:exa%20mple.org"} {
+		for _, subroute := range []string{"", "members", "servers", "$event"} {
+			path := "/room/" + roomID + "/" + subroute
+			if w := getRoomPage(router, path, ""); w.Code != http.StatusBadRequest {
+				t.Errorf("%s got %d, want %d", path, w.Code, http.StatusBadRequest)
+			}
+		}
+	}
+	if requests != 0 {
+		t.Errorf("made %d requests to the homeserver, want none", requests)
+	}
+}
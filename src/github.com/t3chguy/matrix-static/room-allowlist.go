@@ -0,0 +1,61 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/matrix-org/gomatrix"
+	"github.com/t3chguy/matrix-static/mxclient"
+)
+
+// roomAllowlist holds the only rooms the operator has chosen to serve, an empty allowlist allows every room.
+// Listed rooms are joined as our account when loaded, so that we may serve those which cannot be peeked into.
+type roomAllowlist struct {
+	*roomList
+	client *mxclient.Client
+}
+
+// newRoomAllowlist loads the allowlist at path, an empty path allows every room.
+func newRoomAllowlist(path string, resolver *roomAliasResolver, client *mxclient.Client) (*roomAllowlist, error) {
+	allowlist := &roomAllowlist{&roomList{name: "Room Allowlist", path: path, resolver: resolver}, client}
+	return allowlist, allowlist.Load()
+}
+
+// Load (re)reads the allowlist and joins each of its rooms, joining a room we are already in being harmless.
+func (a *roomAllowlist) Load() error {
+	if err := a.roomList.Load(); err != nil {
+		return err
+	}
+
+	for _, entry := range a.Entries() {
+		if _, err := a.client.JoinRoom(entry, "", nil); err != nil {
+			log.WithError(err).WithField("roomIDOrAlias", entry).Warn("Unable to join allowed Room")
+		}
+	}
+	return nil
+}
+
+// IsAllowed returns whether the room ID or alias may be served.
+func (a *roomAllowlist) IsAllowed(roomIDOrAlias string) bool {
+	return len(a.Entries()) == 0 || a.Contains(roomIDOrAlias)
+}
+
+// FilterRooms returns the rooms which are allowed by ID or by any of their aliases.
+func (a *roomAllowlist) FilterRooms(rooms []gomatrix.PublicRoomsChunk) []gomatrix.PublicRoomsChunk {
+	if len(a.Entries()) == 0 {
+		return rooms
+	}
+	return a.filterRooms(rooms, true)
+}
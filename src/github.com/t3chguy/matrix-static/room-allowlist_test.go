@@ -0,0 +1,123 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/matrix-org/gomatrix"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRoomAllowlistLoad(t *testing.T) {
+	var mu sync.Mutex
+	var joined []string
+	client := newTestClient(t,
+		homeserverRoute{suffix: "/directory/room/#allowed:example.org", status: http.StatusOK, body: `{"room_id":"!aliased:example.org"}`},
+		homeserverRoute{suffix: "/join/!unjoinable:example.org", status: http.StatusForbidden, body: `{"errcode":"M_FORBIDDEN","error":"Nope"}`},
+		// joining any other room succeeds.
+		homeserverRoute{suffix: ":example.org", handler: func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			joined = append(joined, strings.TrimPrefix(r.URL.Path, "/_matrix/client/r0/join/"))
+			mu.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"room_id":"!joined:example.org"}`))
+		}},
+	)
+	resolver := newRoomAliasResolver(client)
+
+	// without a list every room is allowed, and none are joined.
+	allowlist, err := newRoomAllowlist("", resolver, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !allowlist.IsAllowed("!any:example.org") || len(joined) != 0 {
+		t.Errorf("an empty allowlist does not allow every room, or joined %v", joined)
+	}
+
+	path := filepath.Join(t.TempDir(), "allowlist.json")
+	if err := ioutil.WriteFile(path, []byte(`["!allowed:example.org", "#allowed:example.org", "!unjoinable:example.org"]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// rooms we fail to join are still allowed, in case they can be peeked into.
+	allowlist, err = newRoomAllowlist(path, resolver, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, roomIDOrAlias := range []string{"!allowed:example.org", "#allowed:example.org", "!aliased:example.org", "!unjoinable:example.org"} {
+		if !allowlist.IsAllowed(roomIDOrAlias) {
+			t.Errorf("%s is not allowed", roomIDOrAlias)
+		}
+	}
+	if allowlist.IsAllowed("!other:example.org") {
+		t.Error("a room outside the allowlist is allowed")
+	}
+	sort.Strings(joined)
+	if want := []string{"!allowed:example.org", "#allowed:example.org"}; strings.Join(joined, " ") != strings.Join(want, " ") {
+		t.Errorf("joined %v, want %v", joined, want)
+	}
+}
+
+func TestRoomAllowlistFilterRooms(t *testing.T) {
+	allowlist := &roomAllowlist{newTestRoomList("!allowed:example.org", "#canonical:example.org", "#alt:example.org"), nil}
+	rooms := []gomatrix.PublicRoomsChunk{
+		{RoomID: "!other:example.org", CanonicalAlias: "#other:example.org"},
+		{RoomID: "!allowed:example.org"},
+		{RoomID: "!canonical:example.org", CanonicalAlias: "#canonical:example.org"},
+		{RoomID: "!alt:example.org", Aliases: []string{"#another:example.org", "#alt:example.org"}},
+	}
+
+	var got []string
+	for _, room := range allowlist.FilterRooms(rooms) {
+		got = append(got, room.RoomID)
+	}
+	if want := "!allowed:example.org !canonical:example.org !alt:example.org"; strings.Join(got, " ") != want {
+		t.Errorf("got %v, want %s", got, want)
+	}
+	if got := (&roomAllowlist{&roomList{}, nil}).FilterRooms(rooms); len(got) != len(rooms) {
+		t.Errorf("an empty allowlist filtered out %d rooms", len(rooms)-len(got))
+	}
+}
+
+// TestLoadRoomWorkerNotAllowed asserts that rooms outside of the allowlist are answered as though they did not exist,
+// without syncing them.
+func TestLoadRoomWorkerNotAllowed(t *testing.T) {
+	var syncs int32
+	client := newTestClient(t, homeserverRoute{suffix: "/initialSync", handler: func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&syncs, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"messages":{"start":"s0","end":"e0","chunk":[]},"state":[]}`))
+	}})
+	allowlist := &roomAllowlist{newTestRoomList("!allowed:example.org"), client}
+	router := newTestRoomRouter(client, nil, allowlist, func(roomRouter *gin.RouterGroup) {
+		roomRouter.GET("/", func(c *gin.Context) { c.String(http.StatusOK, "room") })
+	})
+
+	if w := getRoomPage(router, "/room/!other:example.org/", ""); w.Code != http.StatusNotFound {
+		t.Errorf("got %d for a room outside the allowlist, want 404", w.Code)
+	}
+	if w := getRoomPage(router, "/room/!allowed:example.org/", ""); w.Code != http.StatusOK {
+		t.Errorf("got %d for an allowed room, want 200", w.Code)
+	}
+	if got := atomic.LoadInt32(&syncs); got != 1 {
+		t.Errorf("synced %d rooms, want only the allowed one", got)
+	}
+}
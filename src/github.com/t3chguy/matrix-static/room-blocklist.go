@@ -0,0 +1,64 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/matrix-org/gomatrix"
+	"github.com/t3chguy/matrix-static/mxclient"
+	"github.com/t3chguy/matrix-static/templates"
+	"net/http"
+)
+
+// roomBlocklist holds the rooms the operator has chosen not to serve.
+type roomBlocklist struct {
+	*roomList
+}
+
+// newRoomBlocklist loads the blocklist at path, an empty path blocks nothing.
+func newRoomBlocklist(path string, resolver *roomAliasResolver) (*roomBlocklist, error) {
+	blocklist := &roomBlocklist{&roomList{name: "Room Blocklist", path: path, resolver: resolver}}
+	return blocklist, blocklist.Load()
+}
+
+// IsBlocked returns whether the room ID or alias is blocked.
+func (b *roomBlocklist) IsBlocked(roomIDOrAlias string) bool {
+	return b.Contains(roomIDOrAlias)
+}
+
+// FilterRooms returns the rooms which are blocked neither by ID nor by any of their aliases.
+func (b *roomBlocklist) FilterRooms(rooms []gomatrix.PublicRoomsChunk) []gomatrix.PublicRoomsChunk {
+	if len(b.Entries()) == 0 {
+		return rooms
+	}
+	return b.filterRooms(rooms, false)
+}
+
+// abortBlockedRoom responds as we would for a room which does not permit us to access it, so as not to confirm that a
+// blocked room exists.
+func abortBlockedRoom(c *gin.Context) {
+	details := mxclient.TextForRespError(gomatrix.RespError{ErrCode: "M_GUEST_ACCESS_FORBIDDEN"})
+	if isJSONRequest(c) {
+		abortWithJSONError(c, http.StatusNotFound, "M_NOT_FOUND", details)
+		return
+	}
+
+	c.Status(http.StatusNotFound)
+	templates.WritePageTemplate(c.Writer, &templates.ErrorPage{
+		ErrType: "Unable to Join Room.",
+		Details: details,
+	})
+	c.Abort()
+}
@@ -0,0 +1,124 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/matrix-org/gomatrix"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRoomBlocklistLoad(t *testing.T) {
+	client := newTestClient(t,
+		homeserverRoute{suffix: "/directory/room/#blocked:example.org", status: http.StatusOK, body: `{"room_id":"!aliased:example.org"}`},
+	)
+	path := filepath.Join(t.TempDir(), "blocklist.json")
+	write := func(data string) {
+		if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`["!blocked:example.org", "#blocked:example.org"]`)
+	blocklist, err := newRoomBlocklist(path, newRoomAliasResolver(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, roomIDOrAlias := range []string{"!blocked:example.org", "#blocked:example.org", "!aliased:example.org"} {
+		if !blocklist.IsBlocked(roomIDOrAlias) {
+			t.Errorf("%s is not blocked", roomIDOrAlias)
+		}
+	}
+
+	// as on SIGHUP, a list which cannot be read leaves the one loaded before in place.
+	write(`{"not": "an array"}`)
+	if err := blocklist.Load(); err == nil {
+		t.Error("an invalid blocklist was loaded")
+	}
+	if !blocklist.IsBlocked("!blocked:example.org") {
+		t.Error("an invalid blocklist replaced the one loaded before")
+	}
+
+	write(`["!other:example.org"]`)
+	if err := blocklist.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if blocklist.IsBlocked("!blocked:example.org") || !blocklist.IsBlocked("!other:example.org") {
+		t.Errorf("got entries %v after reloading, want [!other:example.org]", blocklist.Entries())
+	}
+}
+
+func TestRoomBlocklistFilterRooms(t *testing.T) {
+	blocklist := &roomBlocklist{newTestRoomList("!blocked:example.org", "#canonical:example.org", "#alt:example.org")}
+	rooms := []gomatrix.PublicRoomsChunk{
+		{RoomID: "!open:example.org", CanonicalAlias: "#open:example.org"},
+		{RoomID: "!blocked:example.org"},
+		{RoomID: "!canonical:example.org", CanonicalAlias: "#canonical:example.org"},
+		{RoomID: "!alt:example.org", Aliases: []string{"#other:example.org", "#alt:example.org"}},
+	}
+
+	filtered := blocklist.FilterRooms(rooms)
+	if len(filtered) != 1 || filtered[0].RoomID != "!open:example.org" {
+		t.Errorf("got %v, want only !open:example.org", filtered)
+	}
+	if got := (&roomBlocklist{&roomList{}}).FilterRooms(rooms); len(got) != len(rooms) {
+		t.Errorf("an empty blocklist filtered out %d rooms", len(rooms)-len(got))
+	}
+}
+
+// TestLoadRoomWorkerBlocked asserts that blocked rooms are answered as though they did not exist, without syncing them.
+func TestLoadRoomWorkerBlocked(t *testing.T) {
+	var syncs int32
+	client := newTestClient(t,
+		homeserverRoute{suffix: "/initialSync", handler: func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&syncs, 1)
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"messages":{"start":"s0","end":"e0","chunk":[]},"state":[]}`))
+		}},
+		homeserverRoute{suffix: "/directory/room/#blocked:example.org", status: http.StatusOK, body: `{"room_id":"!aliased:example.org"}`},
+	)
+	blocklist := &roomBlocklist{newTestRoomList("!blocked:example.org", "#blocked:example.org", "!aliased:example.org")}
+	router := newTestRoomRouter(client, blocklist, nil, func(roomRouter *gin.RouterGroup) {
+		roomRouter.GET("/", func(c *gin.Context) { c.String(http.StatusOK, "room") })
+		roomRouter.GET("/members", func(c *gin.Context) { c.String(http.StatusOK, "members") })
+	})
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+	}{
+		{"blocked room", "/room/!blocked:example.org/", http.StatusNotFound},
+		{"subroute of a blocked room", "/room/!blocked:example.org/members", http.StatusNotFound},
+		{"blocked alias", "/room/%23blocked:example.org/", http.StatusNotFound},
+		{"room of a blocked alias", "/room/!aliased:example.org/", http.StatusNotFound},
+		{"open room", "/room/!open:example.org/", http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := getRoomPage(router, test.path, "")
+			if w.Code != test.wantCode {
+				t.Errorf("got %d, want %d", w.Code, test.wantCode)
+			}
+		})
+	}
+	if got := atomic.LoadInt32(&syncs); got != 1 {
+		t.Errorf("synced %d rooms, want only the open one", got)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/gin-contrib/cache/persistence"
+	"github.com/t3chguy/matrix-static/mxclient"
+	"strconv"
+	"time"
+)
+
+// RoomDirectoryCacheTTL is how long a page of the room directory is served from the cache, so that every hit on the
+// directory is not a request to the homeserver's room directory.
+const RoomDirectoryCacheTTL = time.Minute
+
+// roomDirectoryCache fetches pages of the room directory from the homeserver, caching them by their since token &
+// search term for RoomDirectoryCacheTTL.
+type roomDirectoryCache struct {
+	client *mxclient.Client
+	cache  *persistence.InMemoryStore
+}
+
+func newRoomDirectoryCache(client *mxclient.Client) *roomDirectoryCache {
+	return &roomDirectoryCache{client, persistence.NewInMemoryStore(RoomDirectoryCacheTTL)}
+}
+
+// GetPage returns the page of limit rooms from since matching searchTerm, see mxclient.Client.GetRoomDirectoryPage.
+// Errors are not cached, so that expired tokens are reported as such & failed requests are retried.
+func (d *roomDirectoryCache) GetPage(since string, limit int, searchTerm string) (page *mxclient.RoomDirectoryPage, err error) {
+	key := strconv.Itoa(limit) + "\x00" + since + "\x00" + searchTerm
+	if d.cache.Get(key, &page) == nil {
+		return page, nil
+	}
+
+	page, err = d.client.GetRoomDirectoryPage(since, limit, searchTerm)
+	if err != nil {
+		return nil, err
+	}
+
+	d.cache.Set(key, page, RoomDirectoryCacheTTL)
+	return page, nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/t3chguy/matrix-static/mxclient"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRoomDirectoryCacheGetPage(t *testing.T) {
+	requests := 0
+	homeserver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		var req mxclient.ReqPublicRoomsFiltered
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Since == "expired" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errcode":"M_UNKNOWN","error":"Invalid token"}`))
+			return
+		}
+		w.Write([]byte(`{"chunk":[{"room_id":"!a:example.org","world_readable":true}],"next_batch":"next"}`))
+	}))
+	defer homeserver.Close()
+
+	client, err := mxclient.NewRawClient(homeserver.URL, homeserver.URL, "@guest:example.org", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	directory := newRoomDirectoryCache(client)
+
+	tests := []struct {
+		name         string
+		since        string
+		searchTerm   string
+		wantErr      bool
+		wantRequests int
+	}{
+		{"first page", "", "", false, 1},
+		{"first page again is cached", "", "", false, 1},
+		{"search is cached separately", "", "matrix", false, 2},
+		{"search again is cached", "", "matrix", false, 2},
+		{"next page is cached separately", "next", "", false, 3},
+		{"expired token", "expired", "", true, 4},
+		{"errors are not cached", "expired", "", true, 5},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page, err := directory.GetPage(test.since, PublicRoomsPageSize, test.searchTerm)
+			if test.wantErr {
+				if err != mxclient.ErrInvalidDirectoryToken {
+					t.Errorf("GetPage() err = %v, want ErrInvalidDirectoryToken", err)
+				}
+			} else if err != nil || len(page.Rooms) != 1 || page.NextBatch != "next" {
+				t.Errorf("GetPage() = %+v, %v", page, err)
+			}
+			if requests != test.wantRequests {
+				t.Errorf("homeserver requested %d times, want %d", requests, test.wantRequests)
+			}
+		})
+	}
+}
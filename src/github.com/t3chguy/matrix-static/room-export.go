@@ -0,0 +1,137 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/t3chguy/matrix-static/mxclient"
+	"github.com/t3chguy/matrix-static/sanitizer"
+	"github.com/t3chguy/matrix-static/utils"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RoomExportBatchSize is how many events each RoomExportJob of an export fetches, the worker is only held that long.
+const RoomExportBatchSize = 256
+
+// isStreamedRequest returns whether the request is for a room export, which must be passed through as it is written
+// rather than buffered by the middleware compressing & caching responses.
+func isStreamedRequest(c *gin.Context) bool {
+	return strings.HasSuffix(c.Request.URL.Path, "/export.json")
+}
+
+type responseControllerKey struct{}
+
+// withResponseControllers puts the http.ResponseController of each response on the context of its request, as gin's
+// ResponseWriter hides it, so that streamed responses can extend their write deadline.
+func withResponseControllers(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), responseControllerKey{}, http.NewResponseController(w))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// extendWriteDeadline gives the response another timeout to be written in, where it is not buffered the server's write
+// timeout would otherwise cut it off. It does nothing for responses without a controller, e.g. in tests.
+func extendWriteDeadline(c *gin.Context, timeout time.Duration) {
+	if rc, ok := c.Request.Context().Value(responseControllerKey{}).(*http.ResponseController); ok {
+		rc.SetWriteDeadline(time.Now().Add(timeout))
+	}
+}
+
+// streamRoomExport writes the whole timeline of the room we can reach, oldest first, as newline delimited eventJSON.
+// The room is back-paginated to its start a batch at a time first, then each batch of events is flushed as it is
+// written so that neither we nor the client need hold the export in memory. Each batch gets another writeTimeout.
+// Exports cut short once underway end with an error record in place of the rest of the timeline.
+func streamRoomExport(c *gin.Context, worker Worker, writeTimeout time.Duration, sanitizerFn *sanitizer.Sanitizer) {
+	roomID := c.Param("roomID")
+	ctx := c.Request.Context()
+
+	truncated := true
+	for calls := 0; calls < utils.Max(worker.client.MaxBackpaginations, 1); calls++ {
+		extendWriteDeadline(c, writeTimeout)
+		worker.Queue <- Job(RoomExportBackpaginateJob{roomID, ctx})
+		resp := (<-worker.Output).(RoomExportBackpaginateResp)
+
+		if abortIfCancelled(c) {
+			return
+		}
+		if resp.err == errRoomGone {
+			abortWithJSONError(c, http.StatusServiceUnavailable, "M_UNKNOWN", "Could not export room.")
+			return
+		}
+		// the homeserver failing us leaves the export with the history we could reach, as does running out of calls.
+		if resp.err != nil {
+			break
+		}
+		if resp.AtStart {
+			truncated = false
+			break
+		}
+	}
+
+	encoder := json.NewEncoder(c.Writer)
+	var afterID string
+	for batch := 0; ; batch++ {
+		extendWriteDeadline(c, writeTimeout)
+		worker.Queue <- Job(RoomExportJob{roomID, afterID, RoomExportBatchSize})
+		resp := (<-worker.Output).(RoomEventsResp)
+
+		if batch == 0 {
+			if abortIfCancelled(c) {
+				return
+			}
+			if resp.err != nil {
+				abortWithJSONError(c, http.StatusServiceUnavailable, "M_UNKNOWN", "Could not export room.")
+				return
+			}
+
+			header := c.Writer.Header()
+			header.Set("Content-Type", "application/x-ndjson")
+			// ask reverse proxies such as nginx to pass each batch through as we flush it.
+			header.Set("X-Accel-Buffering", "no")
+			// known up front as reaching the start of the room happens first.
+			if truncated {
+				header.Set("X-History-Truncated", "true")
+			}
+			c.Status(http.StatusOK)
+			c.Writer.WriteHeaderNow()
+		} else if err := resp.err; err != nil || ctx.Err() != nil {
+			if err == nil {
+				err = ctx.Err()
+			}
+			// the export is already underway, all that can be done is to cut it short.
+			requestLogger(c).WithError(err).WithField("batch", batch).Warn("Abandoning room export")
+			encoder.Encode(gin.H{"errcode": "M_UNKNOWN", "error": "The export was cut short: " + err.Error() + "."})
+			c.Writer.Flush()
+			return
+		}
+
+		for _, ev := range mxclient.ReverseEventsCopy(resp.Events) {
+			if err := encoder.Encode(newEventJSON(&ev, resp, sanitizerFn)); err != nil {
+				return
+			}
+			afterID = ev.ID
+		}
+		c.Writer.Flush()
+
+		if resp.AtBottomEnd || len(resp.Events) == 0 {
+			return
+		}
+	}
+}
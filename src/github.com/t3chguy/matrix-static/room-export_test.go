@@ -0,0 +1,200 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/t3chguy/matrix-static/mxclient"
+	"github.com/t3chguy/matrix-static/sanitizer"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const exportRoomID = "!export:example.org"
+
+// testMessages returns the JSON of messages $from to $to in that order, each sent at its number.
+func testMessages(from, to int) string {
+	var events []string
+	for i := from; ; {
+		events = append(events, fmt.Sprintf(`{"event_id":"$%d","type":"m.room.message","sender":"@alice:example.org","origin_server_ts":%d,"content":{"msgtype":"m.text","body":"%d"}}`, i, i, i))
+		if i == to {
+			break
+		}
+		if from < to {
+			i++
+		} else {
+			i--
+		}
+	}
+	return "[" + strings.Join(events, ",") + "]"
+}
+
+// newExportClient returns a client of a homeserver holding messages $1 to $last of exportRoomID, the latest numSynced
+// being in its initialSync. The rest are back-paginated two at a time, each page taking delay, failing with failStatus
+// if set.
+func newExportClient(t *testing.T, last, numSynced, maxBackpaginations int, delay time.Duration, failStatus int) *mxclient.Client {
+	initialSync := `{"messages":{"start":"t` + fmt.Sprint(last-numSynced) + `","end":"e","chunk":` + testMessages(last-numSynced+1, last) + `},"state":[]}`
+	client := newTestClient(t,
+		homeserverRoute{suffix: "/rooms/" + exportRoomID + "/initialSync", status: http.StatusOK, body: initialSync},
+		homeserverRoute{suffix: "/rooms/" + exportRoomID + "/messages", handler: func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(delay)
+			if failStatus != 0 {
+				w.WriteHeader(failStatus)
+				w.Write([]byte(`{"errcode":"M_UNKNOWN","error":"Failed"}`))
+				return
+			}
+			// t<n> is the token of the page back from $n, which is empty once there is nothing before it.
+			var newest int
+			fmt.Sscanf(r.URL.Query().Get("from"), "t%d", &newest)
+			chunk := "[]"
+			if newest > 0 {
+				chunk = testMessages(newest, maxInt(newest-1, 1))
+			}
+			fmt.Fprintf(w, `{"start":"t%d","end":"t%d","chunk":%s}`, newest, maxInt(newest-2, 0), chunk)
+		}},
+	)
+	client.MaxBackpaginations = maxBackpaginations
+	return client
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func newExportRouter(client *mxclient.Client, writeTimeout time.Duration, middleware ...gin.HandlerFunc) *gin.Engine {
+	sanitizerFn := sanitizer.InitSanitizer()
+	return newTestRoomRouter(client, nil, nil, func(roomRouter *gin.RouterGroup) {
+		roomRouter.GET("/export.json", func(c *gin.Context) {
+			streamRoomExport(c, c.MustGet("RoomWorker").(Worker), writeTimeout, sanitizerFn)
+		})
+	}, middleware...)
+}
+
+// readExport returns the event IDs of the export and the error it was cut short by, if any.
+func readExport(t *testing.T, body string) (eventIDs []string, errcode string) {
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		var record map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("line %q is not JSON: %v", scanner.Text(), err)
+		}
+		if errcode != "" {
+			t.Fatalf("record %q follows the error record", scanner.Text())
+		}
+		if id, ok := record["event_id"].(string); ok {
+			eventIDs = append(eventIDs, id)
+		} else {
+			errcode, _ = record["errcode"].(string)
+		}
+	}
+	return
+}
+
+func TestStreamRoomExport(t *testing.T) {
+	tests := []struct {
+		name               string
+		maxBackpaginations int
+		failStatus         int
+		wantEventIDs       []string
+		wantTruncated      bool
+	}{
+		{"whole room", 5, 0, []string{"$1", "$2", "$3", "$4", "$5", "$6"}, false},
+		{"start out of reach", 1, 0, []string{"$3", "$4", "$5", "$6"}, true},
+		{"homeserver failing", 5, http.StatusBadRequest, []string{"$5", "$6"}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router := newExportRouter(newExportClient(t, 6, 2, test.maxBackpaginations, 0, test.failStatus), time.Minute)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/room/"+exportRoomID+"/export.json", nil))
+
+			if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/x-ndjson" {
+				t.Fatalf("got %d of %q", w.Code, w.Header().Get("Content-Type"))
+			}
+			if truncated := w.Header().Get("X-History-Truncated") == "true"; truncated != test.wantTruncated {
+				t.Errorf("got truncated %v, want %v", truncated, test.wantTruncated)
+			}
+			eventIDs, errcode := readExport(t, w.Body.String())
+			if !reflect.DeepEqual(eventIDs, test.wantEventIDs) || errcode != "" {
+				t.Errorf("got events %v & error %q, want %v", eventIDs, errcode, test.wantEventIDs)
+			}
+		})
+	}
+}
+
+// disconnectingRecorder cancels the request, as a client disconnecting would, once the first batch is flushed.
+type disconnectingRecorder struct {
+	*httptest.ResponseRecorder
+	cancel context.CancelFunc
+}
+
+func (w disconnectingRecorder) Flush() {
+	w.ResponseRecorder.Flush()
+	w.cancel()
+}
+
+func TestStreamRoomExportCutShort(t *testing.T) {
+	// enough events for a second batch, all of which are in the initialSync.
+	router := newExportRouter(newExportClient(t, RoomExportBatchSize+10, RoomExportBatchSize+10, 1, 0, 0), time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := disconnectingRecorder{httptest.NewRecorder(), cancel}
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/room/"+exportRoomID+"/export.json", nil).WithContext(ctx))
+
+	eventIDs, errcode := readExport(t, w.Body.String())
+	if len(eventIDs) != RoomExportBatchSize || errcode != "M_UNKNOWN" {
+		t.Errorf("got %d events & error %q, want the %d of the first batch & an error record", len(eventIDs), errcode, RoomExportBatchSize)
+	}
+}
+
+// TestStreamRoomExportOutlastsTimeouts exports a room whose back-pagination takes longer than both the request
+// deadline & the server's write timeout, neither of which may cut the export off.
+func TestStreamRoomExportOutlastsTimeouts(t *testing.T) {
+	const writeTimeout = 300 * time.Millisecond
+	client := newExportClient(t, 8, 2, 5, 150*time.Millisecond, 0)
+	router := newExportRouter(client, writeTimeout, requestDeadline(100*time.Millisecond))
+
+	server := httptest.NewUnstartedServer(withResponseControllers(router))
+	server.Config.WriteTimeout = writeTimeout
+	server.Start()
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/room/" + exportRoomID + "/export.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var body strings.Builder
+	if _, err := bufio.NewReader(resp.Body).WriteTo(&body); err != nil {
+		t.Fatalf("export was cut off: %v", err)
+	}
+	eventIDs, errcode := readExport(t, body.String())
+	if resp.StatusCode != http.StatusOK || len(eventIDs) != 8 || errcode != "" {
+		t.Errorf("got %d with events %v & error %q, want all 8 events", resp.StatusCode, eventIDs, errcode)
+	}
+}
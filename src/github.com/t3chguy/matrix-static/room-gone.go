@@ -0,0 +1,45 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/t3chguy/matrix-static/templates"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// errRoomGone is returned by jobs for rooms the worker no longer holds, as they were discarded for inactivity after the
+// request loaded them. The next request for the room syncs it afresh.
+var errRoomGone = errors.New("room is no longer synced")
+
+// abortRoomGone responds 503 asking the client to try again shortly, as the room went away while loading the page.
+func abortRoomGone(c *gin.Context) {
+	requestLogger(c).WithError(errRoomGone).Warn("Room went away while loading the page")
+	c.Header("Retry-After", strconv.Itoa(int(RetryAfter/time.Second)))
+	if isJSONRequest(c) {
+		abortWithJSONError(c, http.StatusServiceUnavailable, "M_UNKNOWN", "The room is being reloaded, try again shortly.")
+		return
+	}
+
+	c.Status(http.StatusServiceUnavailable)
+	templates.WritePageTemplate(c.Writer, &templates.ErrorPage{
+		ErrType: "This room is being reloaded.",
+		Details: "The room was unloaded while loading this page, try again in a few moments.",
+	})
+	c.Abort()
+}
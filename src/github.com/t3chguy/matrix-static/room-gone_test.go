@@ -0,0 +1,73 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestRoomJobsRoomGone asserts that the jobs of a room which the worker does not hold return errRoomGone rather than
+// panicking, as when the room is discarded between a request loading it and its jobs running.
+func TestRoomJobsRoomGone(t *testing.T) {
+	const roomID = "!gone:example.org"
+	worker := NewWorker(0, newTestClient(t), nil)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		job  Job
+		err  func(resp JobResp) error
+	}{
+		{"events", RoomEventsJob{roomID, "", 0, 10, ctx}, func(resp JobResp) error { return resp.(RoomEventsResp).err }},
+		{"event context", RoomEventContextJob{roomID, "$one", 5, ctx}, func(resp JobResp) error { return resp.(RoomEventsResp).err }},
+		{"thread", RoomThreadJob{roomID, "$one", ctx}, func(resp JobResp) error { return resp.(RoomEventsResp).err }},
+		{"pinned events", RoomPinnedEventsJob{roomID, 3, ctx}, func(resp JobResp) error { return resp.(RoomPinnedEventsResp).err }},
+		{"latest event", RoomLatestEventJob{roomID}, func(resp JobResp) error { return resp.(RoomLatestEventResp).err }},
+		{"jump to date", RoomJumpToDateJob{roomID, 1000, ctx}, func(resp JobResp) error { return resp.(RoomJumpToDateResp).err }},
+		{"members", RoomMembersJob{roomID, 0, 10, ""}, func(resp JobResp) error { return resp.(RoomMembersResp).err }},
+		{"member info", RoomMemberInfoJob{roomID, "@alice:example.org"}, func(resp JobResp) error { return resp.(RoomMemberInfoResp).Err }},
+		{"aliases", RoomAliasesJob{roomID, 1, 10}, func(resp JobResp) error { return resp.(RoomAliasesResp).err }},
+		{"servers", RoomServersJob{roomID, 1, 10}, func(resp JobResp) error { return resp.(RoomServersResp).err }},
+		{"power levels", RoomPowerLevelsJob{roomID}, func(resp JobResp) error { return resp.(RoomPowerLevelsResp).err }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			worker.Queue <- test.job
+			if err := test.err(<-worker.Output); err != errRoomGone {
+				t.Errorf("got error %v, want %v", err, errRoomGone)
+			}
+		})
+	}
+}
+
+// TestAbortRoomGone asserts that pages of rooms gone away while loading ask the client to try again shortly.
+func TestAbortRoomGone(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/room/:roomID/", abortRoomGone)
+	router.GET("/room/:roomID/chat.json", abortRoomGone)
+
+	for _, path := range []string{"/room/!gone:example.org/", "/room/!gone:example.org/chat.json"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+			t.Errorf("%s got %d with Retry-After %q, want a 503 asking to retry", path, w.Code, w.Header().Get("Retry-After"))
+		}
+	}
+}
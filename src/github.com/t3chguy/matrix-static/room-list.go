@@ -0,0 +1,131 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	log "github.com/Sirupsen/logrus"
+	"github.com/matrix-org/gomatrix"
+	"io/ioutil"
+	"sync"
+)
+
+// roomList holds a set of rooms the operator has chosen, loaded from a JSON array of room IDs & aliases.
+// Aliases are resolved when loaded, so that their rooms are matched by ID too.
+type roomList struct {
+	// name is what the list is called in the logs.
+	name     string
+	path     string
+	resolver *roomAliasResolver
+
+	mu      sync.RWMutex
+	rooms   map[string]bool
+	entries []string
+	// roomIDs are those which the aliases among entries resolved to.
+	roomIDs map[string]string
+}
+
+// Load (re)reads the list from its path, keeping what was loaded before if it cannot be read.
+func (l *roomList) Load() error {
+	if l.path == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(l.path)
+	if err != nil {
+		return err
+	}
+	var entries []string
+	if err = json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+
+	rooms := make(map[string]bool, len(entries))
+	roomIDs := make(map[string]string)
+	for _, entry := range entries {
+		if entry == "" {
+			continue
+		}
+		rooms[entry] = true
+
+		if entry[0] == '#' {
+			roomID, found, err := l.resolver.Resolve(entry)
+			if err != nil || !found {
+				log.WithError(err).WithField("roomAlias", entry).Warnf("Unable to resolve Room Alias in %s", l.name)
+				continue
+			}
+			rooms[roomID] = true
+			roomIDs[entry] = roomID
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rooms = rooms
+	l.entries = entries
+	l.roomIDs = roomIDs
+	log.WithField("path", l.path).WithField("numRooms", len(entries)).Infof("Loaded %s", l.name)
+	return nil
+}
+
+// Contains returns whether the room ID or alias is in the list.
+func (l *roomList) Contains(roomIDOrAlias string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.rooms[roomIDOrAlias]
+}
+
+// Entries returns the room IDs & aliases as listed.
+func (l *roomList) Entries() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.entries
+}
+
+// RoomID returns the room ID of the entry, which is itself unless it is an alias we have resolved.
+func (l *roomList) RoomID(entry string) string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if roomID, ok := l.roomIDs[entry]; ok {
+		return roomID
+	}
+	return entry
+}
+
+// filterRooms returns the rooms which are in the list by ID or by any of their aliases if keep, else those which aren't.
+func (l *roomList) filterRooms(rooms []gomatrix.PublicRoomsChunk, keep bool) []gomatrix.PublicRoomsChunk {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	filtered := make([]gomatrix.PublicRoomsChunk, 0, len(rooms))
+	for _, room := range rooms {
+		if l.containsRoom(room) == keep {
+			filtered = append(filtered, room)
+		}
+	}
+	return filtered
+}
+
+func (l *roomList) containsRoom(room gomatrix.PublicRoomsChunk) bool {
+	if l.rooms[room.RoomID] || l.rooms[room.CanonicalAlias] {
+		return true
+	}
+	for _, alias := range room.Aliases {
+		if l.rooms[alias] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/t3chguy/matrix-static/mxclient"
+	"github.com/t3chguy/matrix-static/templates"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// loadRoomWorker is the first middleware of the room routes, turning away rooms we may not serve and redirecting
+// aliases to their room IDs. Other rooms are synced by the worker holding them if need be, which is then set as
+// "RoomWorker" for the handlers to send their jobs to.
+func loadRoomWorker(workers *Workers, blocklist *roomBlocklist, allowlist *roomAllowlist, resolver *roomAliasResolver, basePath string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roomID := c.Param("roomID")
+
+		// catch typos before they reach the homeserver, which would give a less helpful error.
+		if !mxclient.IsValidRoomID(roomID) && !mxclient.IsValidRoomAlias(roomID) {
+			abortInvalidRoomID(c)
+			return
+		}
+
+		// aliases are checked as well as the room IDs they redirect to, in case they could not be resolved.
+		if blocklist.IsBlocked(roomID) {
+			abortBlockedRoom(c)
+			return
+		}
+		// rooms outside of the allowlist are never synced, aliases are checked by the room IDs they redirect to.
+		if roomID[0] != '#' && !allowlist.IsAllowed(roomID) {
+			abortBlockedRoom(c)
+			return
+		}
+
+		// Aliases are redirected to the same page under the room ID, which is what we key everything on.
+		if roomID[0] == '#' {
+			resolvedID, found, err := resolver.Resolve(roomID)
+			if err != nil && isJSONRequest(c) {
+				abortWithJSONError(c, http.StatusBadGateway, "M_UNKNOWN", "Unable to resolve Room Alias.")
+				return
+			}
+			if err != nil {
+				c.Status(http.StatusBadGateway)
+				templates.WritePageTemplate(c.Writer, &templates.ErrorPage{
+					ErrType: "Unable to resolve Room Alias.",
+					Error:   err,
+				})
+				c.Abort()
+				return
+			}
+			if !found && isJSONRequest(c) {
+				abortWithJSONError(c, http.StatusNotFound, "M_NOT_FOUND", "No room could be found for "+roomID+".")
+				return
+			}
+			if !found {
+				c.Status(http.StatusNotFound)
+				templates.WritePageTemplate(c.Writer, &templates.ErrorPage{
+					ErrType: "Unable to resolve Room Alias.",
+					Details: "No room could be found for " + roomID + ", check that it is spelled correctly and still exists.",
+				})
+				c.Abort()
+				return
+			}
+
+			target := url.URL{
+				Path:     basePath + "room/" + resolvedID + strings.SplitN(c.Request.URL.Path, roomID, 2)[1],
+				RawQuery: c.Request.URL.RawQuery,
+			}
+			c.Redirect(http.StatusFound, target.String())
+			c.Abort()
+			return
+		}
+
+		worker := workers.GetWorkerForRoomID(roomID)
+
+		worker.Queue <- &RoomInitialSyncJob{roomID, c.Request.Context()}
+		resp := (<-worker.Output).(*RoomInitialSyncResp)
+		if abortIfCancelled(c) {
+			return
+		}
+
+		if resp.err != nil {
+			if respErr, ok := mxclient.UnwrapRespError(resp.err); ok {
+				// we do not distinguish rooms which do not exist from those we may not peek into.
+				if isJSONRequest(c) {
+					abortWithJSONError(c, http.StatusNotFound, "M_NOT_FOUND", mxclient.TextForRespError(respErr))
+					return
+				}
+				c.Status(http.StatusNotFound)
+				templates.WritePageTemplate(c.Writer, &templates.ErrorPage{
+					ErrType: "Unable to Join Room.",
+					Details: mxclient.TextForRespError(respErr),
+				})
+				c.Abort()
+				return
+			}
+
+			if isJSONRequest(c) {
+				abortWithJSONError(c, http.StatusInternalServerError, "M_UNKNOWN", "Cannot Load Room. Internal Server Error.")
+				return
+			}
+			templates.WritePageTemplate(c.Writer, &templates.ErrorPage{
+				ErrType: "Cannot Load Room. Internal Server Error.",
+				Error:   resp.err,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Set("RoomWorker", worker)
+		c.Next()
+	}
+}
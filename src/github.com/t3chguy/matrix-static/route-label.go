@@ -0,0 +1,85 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"strings"
+	"sync"
+)
+
+// unmatchedRouteLabel labels requests which matched no route, so that their paths cannot mint series of their own.
+const unmatchedRouteLabel = "unmatched"
+
+// routeLabeller labels requests by the template of the route they matched (e.g. /room/:roomID/), so that all requests
+// to a parametrized route share a single series, as our gin predates c.FullPath().
+type routeLabeller struct {
+	engine *gin.Engine
+
+	once sync.Once
+	// routes are the route templates by method, read from engine on first use once all routes have been registered.
+	routes map[string][]string
+}
+
+func newRouteLabeller(engine *gin.Engine) *routeLabeller {
+	return &routeLabeller{engine: engine}
+}
+
+// Label returns the template of the route which c matched, or unmatchedRouteLabel.
+func (l *routeLabeller) Label(c *gin.Context) string {
+	l.once.Do(func() {
+		l.routes = make(map[string][]string)
+		for _, route := range l.engine.Routes() {
+			l.routes[route.Method] = append(l.routes[route.Method], route.Path)
+		}
+	})
+
+	for _, template := range l.routes[c.Request.Method] {
+		if expandRoute(template, c.Params) == c.Request.URL.Path {
+			return template
+		}
+	}
+	return unmatchedRouteLabel
+}
+
+// expandRoute returns the path which template matches given params, or "" if they are not exactly its parameters.
+// Only the one route which matched a request expands back to its path with its params, whichever segments those
+// params' values may also equal.
+func expandRoute(template string, params gin.Params) string {
+	segments := strings.Split(template, "/")
+	numParams := 0
+	for i, segment := range segments {
+		// parameters run from their : or * to the end of the segment, e.g. $:eventID.
+		start := strings.IndexAny(segment, ":*")
+		if start == -1 {
+			continue
+		}
+
+		value, ok := params.Get(segment[start+1:])
+		if !ok {
+			return ""
+		}
+		numParams++
+		if segment[start] == '*' {
+			// catch-all values retain their leading slash.
+			value = strings.TrimPrefix(value, "/")
+		}
+		segments[i] = segment[:start] + value
+	}
+	if numParams != len(params) {
+		return ""
+	}
+	return strings.Join(segments, "/")
+}
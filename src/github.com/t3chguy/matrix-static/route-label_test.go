@@ -0,0 +1,75 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouteLabellerLabel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	labeller := newRouteLabeller(router)
+
+	var label string
+	handler := func(c *gin.Context) {
+		label = labeller.Label(c)
+	}
+	router.Use(handler)
+	for _, route := range []string{
+		"/",
+		"/alias/:roomAlias",
+		"/room/:roomID/",
+		"/room/:roomID/members",
+		"/room/:roomID/$:eventID",
+		"/room/:roomID/members/:mxid",
+		"/css/*filepath",
+	} {
+		router.GET(route, handler)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/", "/"},
+		{"/alias/a", "/alias/:roomAlias"},
+		// values overlapping with the literal segments of their route.
+		{"/alias/alias", "/alias/:roomAlias"},
+		{"/alias/lias", "/alias/:roomAlias"},
+		{"/room/room/", "/room/:roomID/"},
+		{"/room/members/members", "/room/:roomID/members"},
+		{"/room/!a:b/members", "/room/:roomID/members"},
+		{"/room/$ev/$ev", "/room/:roomID/$:eventID"},
+		{"/room/room/$room", "/room/:roomID/$:eventID"},
+		{"/room/members/members/members", "/room/:roomID/members/:mxid"},
+		{"/room/@a:b/members/@a:b", "/room/:roomID/members/:mxid"},
+		{"/css/main.css", "/css/*filepath"},
+		{"/css/css/css", "/css/*filepath"},
+		{"/nowhere", unmatchedRouteLabel},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			label = ""
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, test.path, nil))
+			if label != test.want {
+				t.Errorf("Label(%q) = %q, want %q", test.path, label, test.want)
+			}
+		})
+	}
+}
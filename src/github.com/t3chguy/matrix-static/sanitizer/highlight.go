@@ -0,0 +1,290 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sanitizer
+
+import (
+	"bytes"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"strings"
+	"unicode"
+)
+
+// language describes enough of the lexical syntax of a programming language to pick out its keywords, comments,
+// strings & numbers, which is all the highlighting we do.
+type language struct {
+	keywords      map[string]bool
+	lineComments  []string
+	blockComments [][2]string
+	// quotes are the characters which delimit strings, only those in multilineQuotes may span lines.
+	quotes          string
+	multilineQuotes string
+}
+
+func words(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range strings.Fields(s) {
+		set[word] = true
+	}
+	return set
+}
+
+var cLikeComments = [][2]string{{"/*", "*/"}}
+
+var languageGo = &language{
+	keywords: words(`break case chan const continue default defer else fallthrough for func go goto if import interface
+		map package range return select struct switch type var nil true false iota`),
+	lineComments: []string{"//"}, blockComments: cLikeComments, quotes: "\"'`", multilineQuotes: "`",
+}
+
+var languagePython = &language{
+	keywords: words(`and as assert async await break class continue def del elif else except finally for from global if
+		import in is lambda nonlocal not or pass raise return try while with yield None True False`),
+	lineComments: []string{"#"}, quotes: `"'`,
+}
+
+var languageJavaScript = &language{
+	keywords: words(`async await break case catch class const continue debugger default delete do else export extends
+		finally for function if import in instanceof let new of return super switch this throw try typeof var void while
+		with yield null undefined true false interface type enum implements`),
+	lineComments: []string{"//"}, blockComments: cLikeComments, quotes: "\"'`", multilineQuotes: "`",
+}
+
+var languageRust = &language{
+	keywords: words(`as async await break const continue crate dyn else enum extern false fn for if impl in let loop match
+		mod move mut pub ref return self Self static struct super trait true type unsafe use where while`),
+	lineComments: []string{"//"}, blockComments: cLikeComments, quotes: `"`,
+}
+
+var languageC = &language{
+	keywords: words(`auto break case char const continue default do double else enum extern float for goto if inline int
+		long register return short signed sizeof static struct switch typedef union unsigned void volatile while bool
+		class namespace template typename public private protected virtual new delete this true false nullptr NULL`),
+	lineComments: []string{"//"}, blockComments: cLikeComments, quotes: `"'`,
+}
+
+var languageJava = &language{
+	keywords: words(`abstract boolean break byte case catch char class const continue default do double else enum
+		extends final finally float for if implements import instanceof int interface long native new package private
+		protected public return short static super switch synchronized this throw throws try void volatile while var true
+		false null`),
+	lineComments: []string{"//"}, blockComments: cLikeComments, quotes: `"'`,
+}
+
+var languageShell = &language{
+	keywords:     words(`if then else elif fi case esac for while until do done in function return local export`),
+	lineComments: []string{"#"}, quotes: `"'`, multilineQuotes: `"'`,
+}
+
+var languageJSON = &language{
+	keywords: words(`true false null`),
+	quotes:   `"`,
+}
+
+var languageYAML = &language{
+	keywords:     words(`true false null yes no`),
+	lineComments: []string{"#"}, quotes: `"'`,
+}
+
+// languages are those we highlight, by the names used in language-* classes.
+var languages = map[string]*language{
+	"go": languageGo, "golang": languageGo,
+	"python": languagePython, "py": languagePython,
+	"javascript": languageJavaScript, "js": languageJavaScript, "typescript": languageJavaScript, "ts": languageJavaScript,
+	"rust": languageRust, "rs": languageRust,
+	"c": languageC, "cpp": languageC, "c++": languageC, "h": languageC,
+	"java": languageJava, "kotlin": languageJava,
+	"sh": languageShell, "bash": languageShell, "shell": languageShell, "zsh": languageShell,
+	"json": languageJSON,
+	"yaml": languageYAML, "yml": languageYAML,
+}
+
+// The classes of the spans highlighted tokens are wrapped in, which the stylesheet colours.
+const (
+	classKeyword = "hl-keyword"
+	classComment = "hl-comment"
+	classString  = "hl-string"
+	classNumber  = "hl-number"
+)
+
+type token struct {
+	class string // empty for unhighlighted text
+	text  string
+}
+
+func isIdentifierRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// tokenize splits code into the tokens of lang, adjacent unhighlighted text is merged into a single token.
+func (lang *language) tokenize(code string) []token {
+	var tokens []token
+	emit := func(class, text string) {
+		if class == "" && len(tokens) > 0 && tokens[len(tokens)-1].class == "" {
+			tokens[len(tokens)-1].text += text
+			return
+		}
+		tokens = append(tokens, token{class, text})
+	}
+
+	runes := []rune(code)
+	for i := 0; i < len(runes); {
+		if end := lang.commentEnd(runes[i:]); end > 0 {
+			emit(classComment, string(runes[i:i+end]))
+			i += end
+			continue
+		}
+
+		r, start := runes[i], i
+		switch {
+		case strings.ContainsRune(lang.quotes, r):
+			multiline := strings.ContainsRune(lang.multilineQuotes, r)
+			for i++; i < len(runes) && runes[i] != r && (multiline || runes[i] != '\n'); i++ {
+				if runes[i] == '\\' && r != '`' {
+					i++
+				}
+			}
+			if i < len(runes) && runes[i] == r {
+				i++
+			}
+			if i > len(runes) {
+				i = len(runes)
+			}
+			emit(classString, string(runes[start:i]))
+		case unicode.IsDigit(r):
+			for i++; i < len(runes) && (isIdentifierRune(runes[i]) || runes[i] == '.'); i++ {
+			}
+			emit(classNumber, string(runes[start:i]))
+		case isIdentifierRune(r):
+			for i++; i < len(runes) && isIdentifierRune(runes[i]); i++ {
+			}
+			if word := string(runes[start:i]); lang.keywords[word] {
+				emit(classKeyword, word)
+			} else {
+				emit("", word)
+			}
+		default:
+			emit("", string(r))
+			i++
+		}
+	}
+	return tokens
+}
+
+func hasPrefix(runes []rune, prefix string) bool {
+	for _, r := range prefix {
+		if len(runes) == 0 || runes[0] != r {
+			return false
+		}
+		runes = runes[1:]
+	}
+	return true
+}
+
+// commentEnd returns the length in runes of the comment code starts with, 0 if it does not start with one.
+func (lang *language) commentEnd(code []rune) int {
+	for _, prefix := range lang.lineComments {
+		if hasPrefix(code, prefix) {
+			end := 0
+			for end < len(code) && code[end] != '\n' {
+				end++
+			}
+			return end
+		}
+	}
+	for _, delims := range lang.blockComments {
+		if hasPrefix(code, delims[0]) {
+			for end := len([]rune(delims[0])); end < len(code); end++ {
+				if hasPrefix(code[end:], delims[1]) {
+					return end + len([]rune(delims[1]))
+				}
+			}
+			return len(code)
+		}
+	}
+	return 0
+}
+
+// codeLanguage returns the language named by the language-* class of a code element, if we highlight it.
+func codeLanguage(n *html.Node) *language {
+	for _, attr := range n.Attr {
+		if attr.Key == "class" && strings.HasPrefix(attr.Val, "language-") {
+			return languages[strings.ToLower(strings.TrimPrefix(attr.Val, "language-"))]
+		}
+	}
+	return nil
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(textContent(c))
+	}
+	return b.String()
+}
+
+// highlightCodeBlocks replaces the contents of each <pre><code class="language-*"> of a language we know among nodes
+// with its highlighted tokens, other code blocks are left as they were.
+func highlightCodeBlocks(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		highlightCodeBlocks(c)
+	}
+
+	if n.Type != html.ElementNode || n.DataAtom != atom.Code || n.Parent == nil || n.Parent.DataAtom != atom.Pre {
+		return
+	}
+	lang := codeLanguage(n)
+	if lang == nil {
+		return
+	}
+
+	tokens := lang.tokenize(textContent(n))
+	for n.FirstChild != nil {
+		n.RemoveChild(n.FirstChild)
+	}
+	for _, tok := range tokens {
+		text := &html.Node{Type: html.TextNode, Data: tok.text}
+		if tok.class == "" {
+			n.AppendChild(text)
+			continue
+		}
+		span := &html.Node{Type: html.ElementNode, Data: "span", DataAtom: atom.Span,
+			Attr: []html.Attribute{{Key: "class", Val: tok.class}}}
+		span.AppendChild(text)
+		n.AppendChild(span)
+	}
+}
+
+// highlight returns the sanitized HTML str with its code blocks highlighted, or str as it was should that fail.
+// We highlight after sanitizing, as the policy does not let the classes of our spans through.
+func highlight(str string) string {
+	context := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(str), context)
+	if err != nil {
+		return str
+	}
+
+	var b bytes.Buffer
+	for _, n := range nodes {
+		highlightCodeBlocks(n)
+		if err := html.Render(&b, n); err != nil {
+			return str
+		}
+	}
+	return b.String()
+}
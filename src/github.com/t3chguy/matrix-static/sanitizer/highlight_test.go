@@ -0,0 +1,85 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sanitizer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		lang *language
+		code string
+		want []token
+	}{
+		{"keywords & numbers", languageGo, "return 42",
+			[]token{{classKeyword, "return"}, {"", " "}, {classNumber, "42"}}},
+		{"identifiers containing keywords are not", languageGo, "format",
+			[]token{{"", "format"}}},
+		{"strings with escaped quotes", languageGo, `"a\"b" + x`,
+			[]token{{classString, `"a\"b"`}, {"", " + x"}}},
+		{"strings end with their line unless multiline", languagePython, "'open\nx",
+			[]token{{classString, "'open"}, {"", "\nx"}}},
+		{"multiline strings", languageGo, "`a\nb`",
+			[]token{{classString, "`a\nb`"}}},
+		{"line comments end with their line", languagePython, "x # comment\ny",
+			[]token{{"", "x "}, {classComment, "# comment"}, {"", "\ny"}}},
+		{"block comments", languageC, "a /* b */ c",
+			[]token{{"", "a "}, {classComment, "/* b */"}, {"", " c"}}},
+		{"unterminated block comments run to the end", languageC, "a /* b",
+			[]token{{"", "a "}, {classComment, "/* b"}}},
+		{"unicode identifiers", languageRust, "let größe = 1.5",
+			[]token{{classKeyword, "let"}, {"", " größe = "}, {classNumber, "1.5"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.lang.tokenize(test.code); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("tokenize(%q) = %v, want %v", test.code, got, test.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeHighlightsCode(t *testing.T) {
+	tests := []struct {
+		name      string
+		highlight bool
+		str       string
+		want      string
+	}{
+		{"known languages are highlighted", true, `<pre><code class="language-go">if x &lt; 1 {}</code></pre>`,
+			`<pre><code class="language-go"><span class="hl-keyword">if</span> x &lt; <span class="hl-number">1</span> {}</code></pre>`},
+		{"language names are case insensitive", true, `<pre><code class="language-JSON">true</code></pre>`,
+			`<pre><code class="language-JSON"><span class="hl-keyword">true</span></code></pre>`},
+		{"unknown languages are not", true, `<pre><code class="language-cobol">MOVE 1 TO X</code></pre>`,
+			`<pre><code class="language-cobol">MOVE 1 TO X</code></pre>`},
+		{"nor inline code", true, `<code class="language-go">if</code>`, `<code class="language-go">if</code>`},
+		{"nor code when disabled", false, `<pre><code class="language-go">if</code></pre>`,
+			`<pre><code class="language-go">if</code></pre>`},
+		{"classes of the sender are not let through", true, `<pre><code class="hl-keyword">if</code></pre>`,
+			`<pre><code>if</code></pre>`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := InitSanitizer()
+			s.HighlightCode = test.highlight
+			if got, ok := sanitizeTrimmed(s, test.str); !ok || got != test.want {
+				t.Errorf("Sanitize(%q) = %q, %v, want %q", test.str, got, ok, test.want)
+			}
+		})
+	}
+}
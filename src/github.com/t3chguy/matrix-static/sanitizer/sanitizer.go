@@ -18,11 +18,21 @@ import (
 	"bytes"
 	"github.com/microcosm-cc/bluemonday"
 	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
 type Sanitizer struct {
 	*bluemonday.Policy
+
+	// HighlightCode highlights the syntax of code blocks with a language-* class of a language we know.
+	HighlightCode bool
+
+	// MaxBodyLength caps how many characters of a message are rendered by Truncate, 0 for no limit.
+	MaxBodyLength int
 }
 
 // Sanitize will parse and clean up the HTML of the input string, then sanitize allowed tags.
@@ -35,10 +45,326 @@ func (s *Sanitizer) Sanitize(str string) (sanitizedStr string, ok bool) {
 		return "", false
 	}
 
+	body := root.FirstChild.LastChild
+	rewriteMatrixToLinks(body)
+	rewriteImages(body)
+
 	var b bytes.Buffer
-	html.Render(&b, root.FirstChild.LastChild)
+	html.Render(&b, body)
+
+	sanitizedStr = string(s.SanitizeBytes(b.Bytes()))
+	if s.HighlightCode && strings.Contains(sanitizedStr, `class="language-`) {
+		sanitizedStr = highlight(sanitizedStr)
+	}
+	return sanitizedStr, true
+}
+
+var bareURLRegex = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// Linkify escapes the plain text str into HTML, turning any bare http(s) URLs within it into links.
+func (s *Sanitizer) Linkify(str string) string {
+	var b strings.Builder
+	last := 0
+	for _, match := range bareURLRegex.FindAllStringIndex(str, -1) {
+		start, end := match[0], match[1]
+		// punctuation ending the sentence a URL is in is not part of it.
+		end = start + len(strings.TrimRight(str[start:end], ".,;:!?)]}'"))
+
+		b.WriteString(html.EscapeString(str[last:start]))
+		link := html.EscapeString(str[start:end])
+		b.WriteString(`<a href="` + link + `">` + link + `</a>`)
+		last = end
+	}
+	b.WriteString(html.EscapeString(str[last:]))
+
+	return s.Policy.Sanitize(b.String())
+}
+
+const matrixToPrefix = "https://matrix.to/#/"
+
+// localMatrixToLink maps a matrix.to permalink to the equivalent page of ours,
+// isUser=true if the permalink is of a user so should not be a link at all, ok=false if it is not recognised.
+func localMatrixToLink(href string) (link string, isUser, ok bool) {
+	if !strings.HasPrefix(href, matrixToPrefix) {
+		return "", false, false
+	}
+
+	// drop any ?via= server list, we only link to rooms which we can already see.
+	fragment := strings.SplitN(strings.TrimPrefix(href, matrixToPrefix), "?", 2)[0]
+	var parts []string
+	for _, part := range strings.Split(fragment, "/") {
+		part, err := url.PathUnescape(part)
+		if err != nil || part == "" {
+			return "", false, false
+		}
+		parts = append(parts, part)
+	}
+
+	switch {
+	case len(parts) == 1 && parts[0][0] == '@':
+		return "", true, true
+	case len(parts) == 1 && parts[0][0] == '!':
+		return "./room/" + url.PathEscape(parts[0]) + "/", false, true
+	case len(parts) == 1 && parts[0][0] == '#':
+		return "./alias/" + url.PathEscape(parts[0]), false, true
+	case len(parts) == 2 && parts[0][0] == '!' && parts[1][0] == '$':
+		return "./room/" + url.PathEscape(parts[0]) + "/" + url.PathEscape(parts[1]), false, true
+	}
+	return "", false, false
+}
+
+// hrefRegex matches the hrefs links may have: those localMatrixToLink points at our room & alias pages, or absolute URLs
+// of the schemes allowed. Other relative URLs are not, as protocol-relative ones such as //evil.example lead elsewhere.
+var hrefRegex = regexp.MustCompile(`^(?:\./room/%21|\./alias/%23|[a-zA-Z][a-zA-Z0-9+.-]*:)`)
+
+// rewriteMatrixToLinks points recognised matrix.to links at our own pages and turns user pills into plain spans.
+func rewriteMatrixToLinks(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		rewriteMatrixToLinks(c)
+	}
+
+	if n.Type != html.ElementNode || n.Data != "a" {
+		return
+	}
+
+	for i, attr := range n.Attr {
+		if attr.Key != "href" {
+			continue
+		}
+
+		link, isUser, ok := localMatrixToLink(attr.Val)
+		if !ok {
+			return
+		}
+
+		if isUser {
+			n.Data = "span"
+			n.Attr = []html.Attribute{{Key: "class", Val: "userPill"}}
+		} else {
+			n.Attr[i].Val = link
+		}
+		return
+	}
+}
+
+// MaxImageSize bounds the width & height of inline images, e.g. custom emoji, so that messages cannot blow up the page.
+const MaxImageSize = 256
+
+// imageThumbnailSize is the width & height of the thumbnails inline images are shown from, which must be one of
+// mediaproxy.ThumbnailSizes so that the proxy will serve them, MaxImageSize so that they stay sharp at any size allowed.
+const imageThumbnailSize = MaxImageSize
+
+// imageSrcRegex matches the src of images which rewriteImages has pointed at the media proxy.
+var imageSrcRegex = regexp.MustCompile(`^\./thumb/[^/?#]+/[^/?#]+\?`)
 
-	return string(s.SanitizeBytes(b.Bytes())), true
+// proxiedImageSrc maps the mxc src of an inline image to a thumbnail of it via our media proxy, ok=false if it is not
+// an mxc, as images from anywhere else would let senders see who reads their messages.
+func proxiedImageSrc(src string) (link string, ok bool) {
+	if !strings.HasPrefix(src, "mxc://") {
+		return "", false
+	}
+	parts := strings.Split(strings.SplitN(strings.TrimPrefix(src, "mxc://"), "#", 2)[0], "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", false
+	}
+
+	q := url.Values{}
+	q.Set("width", strconv.Itoa(imageThumbnailSize))
+	q.Set("height", strconv.Itoa(imageThumbnailSize))
+	q.Set("method", "scale")
+	return "./thumb/" + url.PathEscape(parts[0]) + "/" + url.PathEscape(parts[1]) + "?" + q.Encode(), true
+}
+
+// clampImageSize bounds a width or height attribute to MaxImageSize, ok=false if it is not a positive integer.
+func clampImageSize(size string) (clamped string, ok bool) {
+	n, err := strconv.Atoi(strings.TrimSpace(size))
+	if err != nil || n <= 0 {
+		return "", false
+	}
+	if n > MaxImageSize {
+		n = MaxImageSize
+	}
+	return strconv.Itoa(n), true
+}
+
+// rewriteImages points images with an mxc src at our media proxy, bounding their size, and replaces those with any
+// other src by their alt text.
+func rewriteImages(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		rewriteImages(c)
+		c = next
+	}
+
+	if n.Type != html.ElementNode || n.Data != "img" {
+		return
+	}
+
+	var src, alt string
+	attrs := make([]html.Attribute, 0, len(n.Attr))
+	for _, attr := range n.Attr {
+		switch attr.Key {
+		case "src":
+			src = attr.Val
+		case "width", "height":
+			if size, ok := clampImageSize(attr.Val); ok {
+				attrs = append(attrs, html.Attribute{Key: attr.Key, Val: size})
+			}
+		case "alt":
+			alt = attr.Val
+			attrs = append(attrs, attr)
+		case "title":
+			attrs = append(attrs, attr)
+		}
+	}
+
+	link, ok := proxiedImageSrc(src)
+	if !ok {
+		if n.Parent != nil {
+			if alt != "" {
+				n.Parent.InsertBefore(&html.Node{Type: html.TextNode, Data: alt}, n)
+			}
+			n.Parent.RemoveChild(n)
+		}
+		return
+	}
+	n.Attr = append(attrs, html.Attribute{Key: "src", Val: link})
+}
+
+// EmoteSize is the height inline custom emoji are shown at, the size of the text around them.
+const EmoteSize = 32
+
+// shortcodeRegex matches :shortcode: of custom emoji, where one may be.
+var shortcodeRegex = regexp.MustCompile(`:[^:\s]+:`)
+
+// Emotify replaces the :shortcode: of each of emotes (mxcs by shortcode, without colons) found in the text of the
+// already sanitized sanitizedStr with an inline image of it via our media proxy, unknown shortcodes are left be. Text
+// within code is left alone, shortcodes there are likely to be anything but.
+func (s *Sanitizer) Emotify(sanitizedStr string, emotes map[string]string) string {
+	if len(emotes) == 0 || !shortcodeRegex.MatchString(sanitizedStr) {
+		return sanitizedStr
+	}
+
+	context := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	nodes, err := html.ParseFragment(strings.NewReader(sanitizedStr), context)
+	if err != nil {
+		return sanitizedStr
+	}
+
+	var b bytes.Buffer
+	for _, n := range nodes {
+		context.AppendChild(n)
+	}
+	emotifyNode(context, emotes)
+	for n := context.FirstChild; n != nil; n = n.NextSibling {
+		html.Render(&b, n)
+	}
+	return b.String()
+}
+
+func emotifyNode(n *html.Node, emotes map[string]string) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch {
+		case c.Type == html.TextNode:
+			emotifyText(c, emotes)
+		case c.Type == html.ElementNode && c.Data != "code" && c.Data != "pre":
+			emotifyNode(c, emotes)
+		}
+		c = next
+	}
+}
+
+// emotifyText splits the text node n around the known shortcodes within it, inserting images of them in their place.
+func emotifyText(n *html.Node, emotes map[string]string) {
+	text := n.Data
+	last := 0
+	for _, match := range shortcodeRegex.FindAllStringIndex(text, -1) {
+		shortcode := text[match[0]:match[1]]
+		src, ok := proxiedImageSrc(emotes[strings.Trim(shortcode, ":")])
+		if !ok {
+			continue
+		}
+
+		if match[0] > last {
+			n.Parent.InsertBefore(&html.Node{Type: html.TextNode, Data: text[last:match[0]]}, n)
+		}
+		n.Parent.InsertBefore(&html.Node{
+			Type:     html.ElementNode,
+			Data:     "img",
+			DataAtom: atom.Img,
+			Attr: []html.Attribute{
+				{Key: "class", Val: "emote"},
+				{Key: "src", Val: src},
+				{Key: "alt", Val: shortcode},
+				{Key: "title", Val: shortcode},
+				{Key: "height", Val: strconv.Itoa(EmoteSize)},
+			},
+		}, n)
+		last = match[1]
+	}
+	n.Data = text[last:]
+}
+
+// Truncate cuts the already sanitized sanitizedStr short after MaxBodyLength characters of its text, counting each
+// element as one too so that floods of markup are cut short alike. Elements left open by the cut are closed, so the
+// HTML it returns remains balanced; truncated is set if anything was cut.
+func (s *Sanitizer) Truncate(sanitizedStr string) (truncatedStr string, truncated bool) {
+	// every character & element takes at least a byte, so anything shorter fits.
+	if s.MaxBodyLength <= 0 || len(sanitizedStr) <= s.MaxBodyLength {
+		return sanitizedStr, false
+	}
+
+	context := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	nodes, err := html.ParseFragment(strings.NewReader(sanitizedStr), context)
+	if err != nil {
+		return sanitizedStr, false
+	}
+
+	for _, n := range nodes {
+		context.AppendChild(n)
+	}
+	budget := s.MaxBodyLength
+	if !truncateNode(context, &budget) {
+		return sanitizedStr, false
+	}
+
+	var b bytes.Buffer
+	for n := context.FirstChild; n != nil; n = n.NextSibling {
+		html.Render(&b, n)
+	}
+	return b.String(), true
+}
+
+// truncateNode cuts the descendants of n short once budget characters have been spent, returning whether it cut any.
+func truncateNode(n *html.Node, budget *int) (truncated bool) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if *budget <= 0 {
+			n.RemoveChild(c)
+			truncated = true
+			c = next
+			continue
+		}
+
+		switch c.Type {
+		case html.TextNode:
+			if runes := []rune(c.Data); len(runes) > *budget {
+				c.Data = string(runes[:*budget])
+				truncated = true
+				*budget = 0
+			} else {
+				*budget -= len(runes)
+			}
+		case html.ElementNode:
+			*budget--
+			if truncateNode(c, budget) {
+				truncated = true
+			}
+		}
+		c = next
+	}
+	return
 }
 
 // InitSanitizer sets up and returns a bluemonday policy.
@@ -48,12 +374,23 @@ func InitSanitizer() *Sanitizer {
 	p.AllowElements("font", "del", "h1", "h2", "h3", "h4", "h5", "h6", "blockquote", "p", "a", "ul", "ol", "nl", "li", "b", "i", "u", "strong", "em", "strike", "code", "hr", "br", "div", "table", "thead", "caption", "tbody", "tr", "th", "td", "pre", "span")
 
 	p.AllowAttrs("color", "data-mx-bg-color", "data-mx-color").OnElements("font")
-	p.AllowAttrs("data-mx-bg-color", "data-mx-color").OnElements("span")
-	p.AllowAttrs("href", "name", "targetPretty", "rel").OnElements("a")
+	p.AllowAttrs("data-mx-bg-color", "data-mx-color", "data-mx-spoiler").OnElements("span")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^userPill$`)).OnElements("span")
+	// language hints of code blocks, for stylesheets to highlight by.
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[a-zA-Z0-9_+#-]+$`)).OnElements("code")
+	p.AllowAttrs("href").Matching(hrefRegex).OnElements("a")
+	p.AllowAttrs("name", "targetPretty", "rel").OnElements("a")
+	// only as rewritten by rewriteImages, so via our media proxy with a bounded size.
+	p.AllowElements("img")
+	p.AllowAttrs("src").Matching(imageSrcRegex).OnElements("img")
+	p.AllowAttrs("width", "height").Matching(regexp.MustCompile(`^[0-9]{1,3}$`)).OnElements("img")
+	p.AllowAttrs("alt", "title").OnElements("img")
 
 	p.AllowURLSchemes("http", "https", "ftp", "mailto")
+	// for matrix.to permalinks rewritten to our own pages, hrefRegex keeps out relative URLs of anywhere else.
+	p.AllowRelativeURLs(true)
 	p.AddTargetBlankToFullyQualifiedLinks(true)
 	p.AddSpaceWhenStrippingTag(true)
 
-	return &Sanitizer{p}
+	return &Sanitizer{Policy: p}
 }
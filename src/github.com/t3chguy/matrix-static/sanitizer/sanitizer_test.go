@@ -0,0 +1,307 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sanitizer
+
+import (
+	"golang.org/x/net/html"
+	"strings"
+	"testing"
+)
+
+// unbalancedTag returns the first tag of str which is closed without being open or left open, "" if there are none.
+func unbalancedTag(str string) string {
+	var open []string
+	z := html.NewTokenizer(strings.NewReader(str))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if len(open) > 0 {
+				return open[len(open)-1]
+			}
+			return ""
+		case html.StartTagToken:
+			if name, _ := z.TagName(); !isVoidElement(string(name)) {
+				open = append(open, string(name))
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			if len(open) == 0 || open[len(open)-1] != string(name) {
+				return "/" + string(name)
+			}
+			open = open[:len(open)-1]
+		}
+	}
+}
+
+func isVoidElement(name string) bool {
+	switch name {
+	case "br", "hr", "img":
+		return true
+	}
+	return false
+}
+
+// sanitizeTrimmed sanitizes str without the spaces the policy pads the document's wrapping tags with as it strips them.
+func sanitizeTrimmed(s *Sanitizer, str string) (string, bool) {
+	sanitized, ok := s.Sanitize(str)
+	return strings.TrimSpace(sanitized), ok
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxLength     int
+		str           string
+		want          string
+		wantTruncated bool
+	}{
+		{"no limit", 0, "<b>bold</b> text", "<b>bold</b> text", false},
+		{"short enough", 100, "<b>bold</b> text", "<b>bold</b> text", false},
+		{"text fits once markup is not counted by its bytes", 10, "<b>bold</b> text", "<b>bold</b> text", false},
+		{"plain text", 5, "hello world", "hello", true},
+		{"runes are counted rather than bytes", 3, "héllo wörld", "hél", true},
+		{"cut within an element closes it", 5, "<b>bold text</b> after", "<b>bold</b>", true},
+		{"cut within nested elements closes them all", 4, "<blockquote><p><em>quoted text</em></p></blockquote>",
+			"<blockquote><p><em>q</em></p></blockquote>", true},
+		{"elements after the cut are dropped", 6, "<p>first</p><p>second</p><p>third</p>", "<p>first</p>", true},
+		{"floods of markup are cut short", 3, "<br/><br/><br/><br/><br/><br/>", "<br/><br/><br/>", true},
+		{"lists stay balanced", 8, "<ul><li>one</li><li>two</li><li>three</li></ul>", "<ul><li>one</li><li>tw</li></ul>", true},
+		{"entities count as the character they are", 3, "a &lt; b &amp; c", "a &lt;", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := InitSanitizer()
+			s.MaxBodyLength = test.maxLength
+			got, truncated := s.Truncate(test.str)
+			if got != test.want || truncated != test.wantTruncated {
+				t.Errorf("Truncate(%q) = %q, %v, want %q, %v", test.str, got, truncated, test.want, test.wantTruncated)
+			}
+			if tag := unbalancedTag(got); tag != "" {
+				t.Errorf("Truncate(%q) = %q, which leaves <%s> unbalanced", test.str, got, tag)
+			}
+		})
+	}
+}
+
+func TestLocalMatrixToLink(t *testing.T) {
+	tests := []struct {
+		href       string
+		wantLink   string
+		wantIsUser bool
+		wantOK     bool
+	}{
+		{"https://matrix.to/#/!room:example.org", "./room/%21room:example.org/", false, true},
+		{"https://matrix.to/#/!room:example.org?via=example.org", "./room/%21room:example.org/", false, true},
+		{"https://matrix.to/#/%23alias%3Aexample.org", "./alias/%23alias:example.org", false, true},
+		{"https://matrix.to/#/!room:example.org/$event?via=example.org", "./room/%21room:example.org/$event", false, true},
+		{"https://matrix.to/#/@alice:example.org", "", true, true},
+		{"https://matrix.to/#/", "", false, false},
+		{"https://matrix.to/#/!room:example.org/@alice:example.org", "", false, false},
+		{"https://matrix.to/#/%zz", "", false, false},
+		{"https://example.org/#/!room:example.org", "", false, false},
+	}
+	for _, test := range tests {
+		link, isUser, ok := localMatrixToLink(test.href)
+		if link != test.wantLink || isUser != test.wantIsUser || ok != test.wantOK {
+			t.Errorf("localMatrixToLink(%q) = %q, %v, %v, want %q, %v, %v", test.href, link, isUser, ok,
+				test.wantLink, test.wantIsUser, test.wantOK)
+		}
+	}
+}
+
+func TestSanitizeMatrixToLinks(t *testing.T) {
+	tests := []struct {
+		name string
+		str  string
+		want string
+	}{
+		{"rooms link to our page of them", `<a href="https://matrix.to/#/!room:example.org?via=example.org">room</a>`,
+			`<a href="./room/%21room:example.org/">room</a>`},
+		{"user pills become spans", `<a href="https://matrix.to/#/@alice:example.org">Alice</a>: hi`,
+			`<span class="userPill">Alice</span>: hi`},
+		{"other links open elsewhere", `<a href="https://example.org/">example</a>`,
+			`<a href="https://example.org/" target="_blank" rel="noopener">example</a>`},
+		{"unrecognised permalinks are kept", `<a href="https://matrix.to/#/+group:example.org">group</a>`,
+			`<a href="https://matrix.to/#/+group:example.org" target="_blank" rel="noopener">group</a>`},
+		{"scripts are not links", `<a href="javascript:alert(1)">click</a>`, `click`},
+		{"events link to our page of them", `<a href="https://matrix.to/#/!room:example.org/$event?via=example.org">event</a>`,
+			`<a href="./room/%21room:example.org/$event">event</a>`},
+		{"aliases link to our page of them", `<a href="https://matrix.to/#/%23room:example.org">alias</a>`,
+			`<a href="./alias/%23room:example.org">alias</a>`},
+		{"protocol-relative links are not links", `<a href="//evil.example/">click</a>`, `click`},
+		{"protocol-relative links with backslashes are not links", `<a href="/\evil.example/">click</a>`, `click`},
+		{"other relative links are not links", `<a href="../admin/room/!room:example.org/resync">click</a>`, `click`},
+		{"nor are relative links posing as ours", `<a href="./room/../admin">click</a>`, `click`},
+	}
+	s := InitSanitizer()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got, ok := sanitizeTrimmed(s, test.str); !ok || got != test.want {
+				t.Errorf("Sanitize(%q) = %q, %v, want %q", test.str, got, ok, test.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeImages(t *testing.T) {
+	const thumb = `./thumb/example.org/emoji?height=256&amp;method=scale&amp;width=256`
+	tests := []struct {
+		name string
+		str  string
+		want string
+	}{
+		{"mxc images are proxied", `<img src="mxc://example.org/emoji" alt=":wave:">`,
+			`<img alt=":wave:" src="` + thumb + `"/>`},
+		{"sizes are bounded", `<img src="mxc://example.org/emoji" width="32" height="1000" title="wave">`,
+			`<img width="32" height="256" title="wave" src="` + thumb + `"/>`},
+		{"invalid sizes are dropped", `<img src="mxc://example.org/emoji" width="-1" height="huge">`,
+			`<img src="` + thumb + `"/>`},
+		{"other attributes are dropped", `<img src="mxc://example.org/emoji" onerror="alert(1)" style="width:9999px">`,
+			`<img src="` + thumb + `"/>`},
+		{"other images are replaced by their alt text", `before <img src="https://tracker.example.org/pixel.gif" alt="pixel"> after`,
+			`before pixel after`},
+		{"or dropped without any", `<img src="https://tracker.example.org/pixel.gif">`, ``},
+		{"malformed mxcs are dropped", `<img src="mxc://example.org">`, ``},
+	}
+	s := InitSanitizer()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got, ok := sanitizeTrimmed(s, test.str); !ok || got != test.want {
+				t.Errorf("Sanitize(%q) = %q, %v, want %q", test.str, got, ok, test.want)
+			}
+		})
+	}
+}
+
+func TestClampImageSize(t *testing.T) {
+	tests := []struct {
+		size        string
+		wantClamped string
+		wantOK      bool
+	}{
+		{"32", "32", true},
+		{" 64 ", "64", true},
+		{"256", "256", true},
+		{"257", "256", true},
+		{"0", "", false},
+		{"-5", "", false},
+		{"50%", "", false},
+	}
+	for _, test := range tests {
+		if clamped, ok := clampImageSize(test.size); clamped != test.wantClamped || ok != test.wantOK {
+			t.Errorf("clampImageSize(%q) = %q, %v, want %q, %v", test.size, clamped, ok, test.wantClamped, test.wantOK)
+		}
+	}
+}
+
+func TestEmotify(t *testing.T) {
+	const wave = `<img class="emote" src="./thumb/example.org/wave?height=256&amp;method=scale&amp;width=256" alt=":wave:" title=":wave:" height="32"/>`
+	emotes := map[string]string{"wave": "mxc://example.org/wave", "broken": "https://example.org/broken.png"}
+	tests := []struct {
+		name string
+		str  string
+		want string
+	}{
+		{"shortcodes are replaced", "hi :wave:", "hi " + wave},
+		{"within markup", "<b>:wave: :wave:</b>!", "<b>" + wave + " " + wave + "</b>!"},
+		{"unknown shortcodes are left be", "hi :unknown: :wave:", "hi :unknown: " + wave},
+		{"as are those of emotes which are not mxcs", "hi :broken:", "hi :broken:"},
+		{"and those in code", "<code>a :wave: b</code><pre>:wave:</pre>", "<code>a :wave: b</code><pre>:wave:</pre>"},
+		{"text is kept escaped", "a &lt; b :wave:", "a &lt; b " + wave},
+	}
+	s := InitSanitizer()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := s.Emotify(test.str, emotes); got != test.want {
+				t.Errorf("Emotify(%q) = %q, want %q", test.str, got, test.want)
+			}
+		})
+	}
+
+	if got := s.Emotify("hi :wave:", nil); got != "hi :wave:" {
+		t.Errorf("Emotify() without emotes = %q, want it unchanged", got)
+	}
+}
+
+func TestSanitizeSpoilers(t *testing.T) {
+	tests := []struct {
+		name string
+		str  string
+		want string
+	}{
+		{"spoilers are kept", `<span data-mx-spoiler>ending</span>`, `<span data-mx-spoiler="">ending</span>`},
+		{"as are their reasons", `<span data-mx-spoiler="film">ending</span>`, `<span data-mx-spoiler="film">ending</span>`},
+		{"markup in reasons is escaped", `<span data-mx-spoiler="<script>alert(1)</script>">ending</span>`,
+			`<span data-mx-spoiler="&lt;script&gt;alert(1)&lt;/script&gt;">ending</span>`},
+		{"reasons cannot break out of the attribute", `<span data-mx-spoiler='"><img src=x onerror=alert(1)>'>ending</span>`,
+			`<span data-mx-spoiler="&#34;&gt;&lt;img src=x onerror=alert(1)&gt;">ending</span>`},
+		{"nor bring other attributes along", `<span data-mx-spoiler="film" onmouseover="alert(1)">ending</span>`,
+			`<span data-mx-spoiler="film">ending</span>`},
+	}
+	s := InitSanitizer()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got, ok := sanitizeTrimmed(s, test.str); !ok || got != test.want {
+				t.Errorf("Sanitize(%q) = %q, %v, want %q", test.str, got, ok, test.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeCodeLanguages(t *testing.T) {
+	tests := []struct {
+		name string
+		str  string
+		want string
+	}{
+		{"language hints are kept", `<pre><code class="language-go">x := 1</code></pre>`, `<pre><code class="language-go">x := 1</code></pre>`},
+		{"with the symbols of language names", `<code class="language-c++">x++</code>`, `<code class="language-c++">x++</code>`},
+		{"other classes are not", `<pre><code class="evil">x</code></pre>`, `<pre><code>x</code></pre>`},
+		{"nor several at once", `<code class="language-go evil">x</code>`, `<code>x</code>`},
+		{"nor hints on other elements", `<pre class="language-go">x</pre>`, `<pre>x</pre>`},
+	}
+	s := InitSanitizer()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got, ok := sanitizeTrimmed(s, test.str); !ok || got != test.want {
+				t.Errorf("Sanitize(%q) = %q, %v, want %q", test.str, got, ok, test.want)
+			}
+		})
+	}
+}
+
+func TestLinkify(t *testing.T) {
+	s := InitSanitizer()
+	tests := []struct {
+		name string
+		str  string
+		want string
+	}{
+		{"plain", "Be nice", "Be nice"},
+		{"bare URL", "Rules at https://example.org/rules.", `Rules at <a href="https://example.org/rules" target="_blank" rel="noopener">https://example.org/rules</a>.`},
+		{"markup is escaped", "<b>bold</b> & http://example.org/?a=1&b=2",
+			`&lt;b&gt;bold&lt;/b&gt; &amp; <a href="http://example.org/?a=1&amp;b=2" target="_blank" rel="noopener">http://example.org/?a=1&amp;b=2</a>`},
+		{"quotes end a URL", `see "https://example.org/x"onmouseover="alert(1)"`,
+			`see &#34;<a href="https://example.org/x" target="_blank" rel="noopener">https://example.org/x</a>&#34;onmouseover=&#34;alert(1)&#34;`},
+		{"other schemes are not linked", "javascript:alert(1)", "javascript:alert(1)"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := strings.TrimSpace(s.Linkify(test.str)); got != test.want {
+				t.Errorf("Linkify(%q) = %q, want %q", test.str, got, test.want)
+			}
+		})
+	}
+}
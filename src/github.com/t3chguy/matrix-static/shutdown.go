@@ -0,0 +1,41 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	log "github.com/Sirupsen/logrus"
+	"net/http"
+	"time"
+)
+
+// shutdown stops srv accepting new connections and drains the in-flight requests, then stops the background jobs by
+// cancel, waiting on forwardPaginatorDone. It gives up on whatever is left once timeout has passed.
+func shutdown(srv *http.Server, timeout time.Duration, cancel context.CancelFunc, forwardPaginatorDone <-chan struct{}) {
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), timeout)
+	defer cancelShutdown()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.WithError(err).Error("Failed to gracefully drain HTTP Server")
+	}
+	cancel()
+
+	select {
+	case <-forwardPaginatorDone:
+		log.Info("Shut down gracefully")
+	case <-shutdownCtx.Done():
+		log.Error("Timed out waiting for the Forward Paginator to stop")
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestShutdown asserts that once shutting down, new connections are refused whereas the request in flight completes,
+// and only then are the background jobs stopped.
+func TestShutdown(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+		w.Write([]byte("done"))
+	}))
+	defer srv.Close()
+
+	type result struct {
+		body string
+		err  error
+	}
+	inFlight := make(chan result, 1)
+	go func() {
+		resp, err := http.Get(srv.URL)
+		if err != nil {
+			inFlight <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		inFlight <- result{string(body), err}
+	}()
+	<-entered
+
+	ctx, cancel := context.WithCancel(context.Background())
+	forwardPaginatorDone := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		select {
+		case <-release:
+		default:
+			t.Error("background jobs were stopped before the request in flight completed")
+		}
+		close(forwardPaginatorDone)
+	}()
+
+	shutdownDone := make(chan struct{})
+	go func() {
+		shutdown(srv.Config, 5*time.Second, cancel, forwardPaginatorDone)
+		close(shutdownDone)
+	}()
+
+	// the listener is closed straight away, though the request in flight holds up the shutdown.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, err := net.DialTimeout("tcp", srv.Listener.Addr().String(), time.Second)
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("new connections are still accepted after shutting down")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case <-shutdownDone:
+		t.Fatal("shut down before the request in flight completed")
+	default:
+	}
+
+	close(release)
+	if got := <-inFlight; got.err != nil || got.body != "done" {
+		t.Errorf("in flight request got %q, %v, want it to complete", got.body, got.err)
+	}
+	select {
+	case <-shutdownDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not finish shutting down")
+	}
+}
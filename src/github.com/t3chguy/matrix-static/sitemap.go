@@ -0,0 +1,86 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/matrix-org/gomatrix"
+	"github.com/t3chguy/matrix-static/templates"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// sitemapRooms are the rooms listed by the sitemaps, as held by mxclient.WorldReadableRooms.
+type sitemapRooms interface {
+	Len() int
+	GetPage(page, pageSize int) []gomatrix.PublicRoomsChunk
+}
+
+// sitemapHandlers serve the sitemaps of rooms, those filtered out are left out of them. lastModified returns the
+// timestamp of the latest event of the rooms loaded, keyed by roomID.
+type sitemapHandlers struct {
+	rooms             sitemapRooms
+	filter            func([]gomatrix.PublicRoomsChunk) []gomatrix.PublicRoomsChunk
+	lastModified      func() map[string]int
+	publicServePrefix string
+}
+
+// serveSitemap serves the sitemap of the rooms, split into a sitemap index of numbered sitemaps once there are too
+// many rooms for just one.
+func (h *sitemapHandlers) serveSitemap(c *gin.Context) {
+	baseURL := publicBaseURL(c, h.publicServePrefix)
+	c.Header("Content-Type", "application/xml; charset=utf-8")
+
+	if numRooms := h.rooms.Len(); numRooms > templates.SitemapMaxURLs {
+		sitemapIndex := &templates.SitemapIndex{
+			NumSitemaps: (numRooms + templates.SitemapMaxURLs - 1) / templates.SitemapMaxURLs,
+			BaseURL:     baseURL,
+		}
+		sitemapIndex.WriteSitemapIndex(c.Writer)
+		return
+	}
+
+	sitemap := &templates.Sitemap{
+		Rooms:        h.filter(h.rooms.GetPage(1, templates.SitemapMaxURLs)),
+		LastModified: h.lastModified(),
+		BaseURL:      baseURL,
+	}
+	sitemap.WriteSitemap(c.Writer)
+}
+
+// serveNumberedSitemap serves the numbered sitemaps listed by the sitemap index, from 0.xml.
+func (h *sitemapHandlers) serveNumberedSitemap(c *gin.Context) {
+	name := c.Param("name")
+	page, err := strconv.Atoi(strings.TrimSuffix(name, ".xml"))
+	if err != nil || page < 0 || !strings.HasSuffix(name, ".xml") {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	rooms := h.rooms.GetPage(page+1, templates.SitemapMaxURLs)
+	if len(rooms) == 0 {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	c.Header("Content-Type", "application/xml; charset=utf-8")
+	sitemap := &templates.Sitemap{
+		Rooms:        h.filter(rooms),
+		LastModified: h.lastModified(),
+		BaseURL:      publicBaseURL(c, h.publicServePrefix),
+	}
+	sitemap.WriteSitemap(c.Writer)
+}
@@ -0,0 +1,108 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/xml"
+	"github.com/gin-gonic/gin"
+	"github.com/matrix-org/gomatrix"
+	"github.com/t3chguy/matrix-static/templates"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// fakeSitemapRooms holds numRooms rooms numbered from 0.
+type fakeSitemapRooms struct {
+	numRooms int
+}
+
+func (r fakeSitemapRooms) Len() int {
+	return r.numRooms
+}
+
+func (r fakeSitemapRooms) GetPage(page, pageSize int) []gomatrix.PublicRoomsChunk {
+	var rooms []gomatrix.PublicRoomsChunk
+	for i := (page - 1) * pageSize; i < page*pageSize && i < r.numRooms; i++ {
+		rooms = append(rooms, gomatrix.PublicRoomsChunk{RoomID: "!" + strconv.Itoa(i) + ":example.org"})
+	}
+	return rooms
+}
+
+type sitemapXML struct {
+	XMLName  xml.Name
+	URLs     []string `xml:"url>loc"`
+	Sitemaps []string `xml:"sitemap>loc"`
+}
+
+func TestSitemapBoundary(t *testing.T) {
+	tests := []struct {
+		name         string
+		numRooms     int
+		path         string
+		wantCode     int
+		wantRoot     string
+		wantURLs     int
+		wantSitemaps int
+	}{
+		{"exactly as many rooms as fit in one sitemap", templates.SitemapMaxURLs, "/sitemap.xml", http.StatusOK, "urlset",
+			templates.SitemapMaxURLs, 0},
+		{"one room too many is split into an index", templates.SitemapMaxURLs + 1, "/sitemap.xml", http.StatusOK,
+			"sitemapindex", 0, 2},
+		{"of a full first sitemap", templates.SitemapMaxURLs + 1, "/sitemap/0.xml", http.StatusOK, "urlset",
+			templates.SitemapMaxURLs, 0},
+		{"and a second of the rest", templates.SitemapMaxURLs + 1, "/sitemap/1.xml", http.StatusOK, "urlset", 1, 0},
+		{"beyond which there are none", templates.SitemapMaxURLs + 1, "/sitemap/2.xml", http.StatusNotFound, "", 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sitemaps := &sitemapHandlers{
+				rooms: fakeSitemapRooms{test.numRooms},
+				filter: func(rooms []gomatrix.PublicRoomsChunk) []gomatrix.PublicRoomsChunk {
+					return rooms
+				},
+				lastModified: func() map[string]int {
+					return nil
+				},
+			}
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.GET("/sitemap.xml", sitemaps.serveSitemap)
+			router.GET("/sitemap/:name", sitemaps.serveNumberedSitemap)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+			if w.Code != test.wantCode {
+				t.Fatalf("got %d, want %d", w.Code, test.wantCode)
+			}
+			if test.wantCode != http.StatusOK {
+				return
+			}
+
+			var got sitemapXML
+			if err := xml.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.XMLName.Local != test.wantRoot || len(got.URLs) != test.wantURLs || len(got.Sitemaps) != test.wantSitemaps {
+				t.Errorf("got <%s> of %d URLs & %d sitemaps, want <%s> of %d URLs & %d sitemaps", got.XMLName.Local,
+					len(got.URLs), len(got.Sitemaps), test.wantRoot, test.wantURLs, test.wantSitemaps)
+			}
+			if test.wantSitemaps > 0 && got.Sitemaps[1] != "http://example.com/sitemap/1.xml" {
+				t.Errorf("second sitemap is at %q, want http://example.com/sitemap/1.xml", got.Sitemaps[1])
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// assetETags memoizes the content hash ETag of each asset by its name, size & modification time, the latter two
+// catch files of the theme directory being changed underneath us (embedded files never change).
+var assetETags sync.Map
+
+func assetETag(name string, file http.File, info os.FileInfo) (string, error) {
+	key := name + "\x00" + strconv.FormatInt(info.Size(), 10) + "\x00" + info.ModTime().String()
+	if etag, ok := assetETags.Load(key); ok {
+		return etag.(string), nil
+	}
+
+	hash := sha1.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	etag := `"` + hex.EncodeToString(hash.Sum(nil)) + `"`
+	assetETags.Store(key, etag)
+	return etag, nil
+}
+
+// serveAssets serves the files of assets for routes with a *filepath param, with a content hash ETag and letting
+// clients cache them for maxAge, pages link assets with the assetVersion as a query string so that deploys bust it.
+func serveAssets(assets http.FileSystem, maxAge time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("filepath")
+		file, err := assets.Open(name)
+		if err != nil {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		defer file.Close()
+
+		info, err := file.Stat()
+		if err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		etag, err := assetETag(name, file, info)
+		if err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		header := c.Writer.Header()
+		header.Set("ETag", etag)
+		if maxAge > 0 {
+			header.Set("Cache-Control", "public, max-age="+strconv.Itoa(int(maxAge/time.Second)))
+		}
+		// answers If-None-Match against the ETag set above.
+		http.ServeContent(c.Writer, c.Request, name, info.ModTime(), file)
+	}
+}
+
+// assetVersion hashes every asset we may serve, the embedded ones and those of the themeDir, so that it changes
+// whenever a deploy changes any of them.
+func assetVersion(themeDir string) string {
+	hash := sha1.New()
+	add := func(name string, open func() (io.ReadCloser, error)) {
+		file, err := open()
+		if err != nil {
+			return
+		}
+		defer file.Close()
+		hash.Write([]byte(name))
+		io.Copy(hash, file)
+	}
+
+	fs.WalkDir(embeddedAssets, "assets", func(name string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			add(name, func() (io.ReadCloser, error) { return embeddedAssets.Open(name) })
+		}
+		return nil
+	})
+	if themeDir != "" {
+		for _, dir := range []string{"css", "img"} {
+			filepath.WalkDir(filepath.Join(themeDir, dir), func(name string, entry fs.DirEntry, err error) error {
+				if err == nil && !entry.IsDir() {
+					add(name, func() (io.ReadCloser, error) { return os.Open(name) })
+				}
+				return nil
+			})
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:12]
+}
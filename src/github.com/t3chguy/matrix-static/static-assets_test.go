@@ -0,0 +1,192 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"github.com/t3chguy/matrix-static/templates"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newAssetRouter returns a router serving the assets as main does, overridden by those of themeDir if it is set.
+func newAssetRouter(themeDir string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	for _, dir := range []string{"img", "css"} {
+		router.GET("/"+dir+"/*filepath", serveAssets(assetFileSystem(themeDir, dir), 0))
+	}
+	return router
+}
+
+var stylesheetHref = regexp.MustCompile(`<link rel="stylesheet" type="text/css" href="([^"]+)">`)
+
+// TestPageStylesheetIsEmbedded renders a page and fetches the stylesheet it links, which must be served from the
+// embedded assets even though there are no assets on disk next to the binary.
+func TestPageStylesheetIsEmbedded(t *testing.T) {
+	templates.AssetVersion = assetVersion("")
+	var page bytes.Buffer
+	templates.WritePageTemplate(&page, &templates.ErrorPage{ErrType: "Test."})
+
+	match := stylesheetHref.FindStringSubmatch(page.String())
+	if match == nil {
+		t.Fatalf("page links no stylesheet: %s", page.String())
+	}
+	href := match[1]
+	if !strings.HasSuffix(href, "css/main.css?v="+templates.AssetVersion) {
+		t.Errorf("stylesheet %q is not versioned with %q", href, templates.AssetVersion)
+	}
+
+	want, err := embeddedAssets.ReadFile("assets/css/main.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	newAssetRouter("").ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+strings.TrimPrefix(href, templates.BasePath), nil))
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), want) {
+		t.Fatalf("got %d with %d bytes, want the %d bytes of the embedded main.css", w.Code, w.Body.Len(), len(want))
+	}
+	if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/css") {
+		t.Errorf("got Content-Type %q, want text/css", contentType)
+	}
+}
+
+func TestServeAssets(t *testing.T) {
+	themeDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(themeDir, "css"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(themeDir, "css", "main.css"), []byte("body{color:red}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	embeddedCSS, _ := embeddedAssets.ReadFile("assets/css/main.css")
+	embeddedFavicon, _ := embeddedAssets.ReadFile("assets/img/favicon.ico")
+
+	tests := []struct {
+		name       string
+		themeDir   string
+		path       string
+		wantStatus int
+		wantBody   []byte
+	}{
+		{"embedded stylesheet", "", "/css/main.css", http.StatusOK, embeddedCSS},
+		{"embedded image", "", "/img/favicon.ico", http.StatusOK, embeddedFavicon},
+		{"missing asset", "", "/css/missing.css", http.StatusNotFound, nil},
+		{"directories are not listed", "", "/css/", http.StatusNotFound, nil},
+		{"no escaping the assets", "", "/css/../../theme.go", http.StatusNotFound, nil},
+		{"theme overrides the stylesheet", themeDir, "/css/main.css", http.StatusOK, []byte("body{color:red}")},
+		{"theme falls back to embedded images", themeDir, "/img/favicon.ico", http.StatusOK, embeddedFavicon},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router := newAssetRouter(test.themeDir)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+			if w.Code != test.wantStatus {
+				t.Fatalf("got status %d, want %d", w.Code, test.wantStatus)
+			}
+			if test.wantStatus != http.StatusOK {
+				return
+			}
+			if !bytes.Equal(w.Body.Bytes(), test.wantBody) {
+				t.Errorf("got %d bytes, want %d", w.Body.Len(), len(test.wantBody))
+			}
+
+			// the content hash ETag lets clients revalidate for free.
+			etag := w.Header().Get("ETag")
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			req.Header.Set("If-None-Match", etag)
+			w = httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if etag == "" || w.Code != http.StatusNotModified {
+				t.Errorf("revalidating ETag %q got %d, want %d", etag, w.Code, http.StatusNotModified)
+			}
+		})
+	}
+}
+
+func TestServeAssetsMaxAge(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name   string
+		maxAge time.Duration
+		want   string
+	}{
+		{"a week", 7 * 24 * time.Hour, "public, max-age=604800"},
+		{"always revalidate", 0, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/css/*filepath", serveAssets(assetFileSystem("", "css"), test.maxAge))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/css/main.css", nil))
+			if got := w.Header().Get("Cache-Control"); w.Code != http.StatusOK || got != test.want {
+				t.Errorf("got %d with Cache-Control %q, want %q", w.Code, got, test.want)
+			}
+		})
+	}
+}
+
+// TestAssetVersionFollowsTheme asserts that changing a file of the theme changes both the fingerprint pages link
+// assets with and the ETag of the file, so that neither a long max-age nor revalidation serves the old one.
+func TestAssetVersionFollowsTheme(t *testing.T) {
+	themeDir := t.TempDir()
+	stylesheet := filepath.Join(themeDir, "css", "main.css")
+	if err := os.MkdirAll(filepath.Dir(stylesheet), 0755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(css string, modTime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(stylesheet, []byte(css), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(stylesheet, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	etag := func() string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		newAssetRouter(themeDir).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/css/main.css", nil))
+		return w.Header().Get("ETag")
+	}
+
+	embedded := assetVersion("")
+	if embedded != assetVersion("") || len(embedded) != 12 {
+		t.Errorf("assetVersion() = %q, want a stable 12 character fingerprint", embedded)
+	}
+
+	write("body{color:red}", time.Unix(1000, 0))
+	red, redETag := assetVersion(themeDir), etag()
+	if red == embedded {
+		t.Errorf("assetVersion() = %q with a theme as without one", red)
+	}
+
+	write("body{color:green}", time.Unix(2000, 0))
+	if green := assetVersion(themeDir); green == red {
+		t.Errorf("assetVersion() = %q after the theme changed", green)
+	}
+	if greenETag := etag(); greenETag == redETag {
+		t.Errorf("ETag = %s after the stylesheet changed", greenETag)
+	}
+}
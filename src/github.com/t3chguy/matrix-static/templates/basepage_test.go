@@ -0,0 +1,68 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templates
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPageTemplateTheme(t *testing.T) {
+	defer func(theme Theme) { SiteTheme = theme }(SiteTheme)
+	page := &ErrorPage{ErrType: "Room not found."}
+
+	SiteTheme = Theme{SiteName: "Acme Archive"}
+	plain := PageTemplate(page)
+	if !strings.Contains(plain, "<title>Acme Archive - Alias ERROR</title>") {
+		t.Errorf("PageTemplate() is not titled after the site: %s", plain)
+	}
+	if strings.Contains(plain, "<style>") || strings.Contains(plain, "siteLogo") {
+		t.Errorf("PageTemplate() is branded beyond its name: %s", plain)
+	}
+
+	SiteTheme = Theme{SiteName: "Acme <Archive>", AccentColor: "#c0ffee", LogoURL: "https://acme.example/logo.png"}
+	branded := PageTemplate(page)
+	for _, want := range []string{
+		"<style>a { color:#c0ffee; } tr.dateSep { background-color:#c0ffee; }</style>",
+		`<a class="siteLogo" href="./"><img src="https://acme.example/logo.png" alt="Acme &lt;Archive&gt;" /></a>`,
+	} {
+		if !strings.Contains(branded, want) {
+			t.Errorf("PageTemplate() is missing %s: %s", want, branded)
+		}
+	}
+}
+
+func TestPageTemplateBasePath(t *testing.T) {
+	defer func(basePath string) { BasePath = basePath }(BasePath)
+	BasePath = "/archive/"
+
+	page := PageTemplate(&ErrorPage{ErrType: "Room not found."})
+	base := strings.Index(page, `<base href="/archive/">`)
+	if base == -1 || base > strings.Index(page, "<title>") {
+		t.Errorf("PageTemplate() does not start its head with the base path: %s", page)
+	}
+	for _, want := range []string{
+		`<link rel="stylesheet" type="text/css" href="/archive/css/main.css`,
+		`<link rel="shortcut icon" href="/archive/img/favicon.ico`,
+		`<meta name="msapplication-config" content="/archive/img/browserconfig.xml`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("PageTemplate() is missing %s: %s", want, page)
+		}
+	}
+	if strings.Contains(page, `href="/img/`) || strings.Contains(page, `href="/css/`) {
+		t.Errorf("PageTemplate() links to assets outside of the base path: %s", page)
+	}
+}
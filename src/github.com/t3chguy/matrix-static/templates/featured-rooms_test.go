@@ -0,0 +1,60 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templates
+
+import (
+	"github.com/matrix-org/gomatrix"
+	"strings"
+	"testing"
+)
+
+func TestFeaturedRoomsPage(t *testing.T) {
+	page := PageTemplate(&FeaturedRoomsPage{Rooms: []gomatrix.PublicRoomsChunk{
+		{RoomID: "!a:example.org", Name: "<i>Alpha</i>", CanonicalAlias: "#alpha:example.org", NumJoinedMembers: 1, Topic: "All <b>about</b> alpha"},
+		{RoomID: "!b:example.org", NumJoinedMembers: 2},
+	}})
+	for _, want := range []string{
+		`<a class="featuredRoom" href="./room/!a:example.org/">`,
+		"<h3>&lt;i&gt;Alpha&lt;/i&gt;</h3><sup>#alpha:example.org</sup><div>1 member</div><p>All &lt;b&gt;about&lt;/b&gt; alpha</p>",
+		// rooms are named by their ID if they have neither name nor alias.
+		"<h3>!b:example.org</h3><sup></sup><div>2 members</div></div></a>",
+		`<a href="./rooms">Browse all public rooms</a>`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("PageTemplate() is missing %s: %s", want, page)
+		}
+	}
+}
+
+func TestRoomsPagePath(t *testing.T) {
+	page := &RoomsPage{Path: "./rooms", Query: "alpha", Rooms: []gomatrix.PublicRoomsChunk{
+		{RoomID: "!a:example.org", Name: "<i>Alpha</i>"},
+	}}
+	got := PageTemplate(page)
+	for _, want := range []string{
+		`<form class="roomSearch" method="get" action="./rooms">`,
+		"<div>&lt;i&gt;Alpha&lt;/i&gt;</div>",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("PageTemplate() is missing %s: %s", want, got)
+		}
+	}
+	if strings.Contains(got, "<i>Alpha</i>") {
+		t.Errorf("PageTemplate() renders the room name as HTML: %s", got)
+	}
+	if got, want := page.pageURL("t1"), "./rooms?from=t1&q=alpha"; got != want {
+		t.Errorf("pageURL() = %s, want %s", got, want)
+	}
+}
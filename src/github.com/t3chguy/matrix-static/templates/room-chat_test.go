@@ -0,0 +1,867 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templates
+
+import (
+	"encoding/json"
+	"github.com/t3chguy/matrix-static/mxclient"
+	"github.com/t3chguy/matrix-static/sanitizer"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewestPageURL(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skip(err)
+	}
+	tests := []struct {
+		name string
+		page RoomChatPage
+		want string
+	}{
+		{"chronological pages jump down to the end", RoomChatPage{}, "./room/!r:example.org/#timelineEnd"},
+		{"newest first pages start with the newest", RoomChatPage{Descending: true}, "./room/!r:example.org/?order=desc"},
+		{"an explicit size is kept", RoomChatPage{PageSize: 50, ExplicitPageSize: true},
+			"./room/!r:example.org/?limit=50#timelineEnd"},
+		{"the default size is not", RoomChatPage{PageSize: 50}, "./room/!r:example.org/#timelineEnd"},
+		{"the timezone is kept", RoomChatPage{Descending: true, PageSize: 50, ExplicitPageSize: true, Location: london},
+			"./room/!r:example.org/?limit=50&order=desc&tz=Europe%2FLondon"},
+		{"anchors & offsets are not", RoomChatPage{Anchor: "$event", CurrentOffset: 100},
+			"./room/!r:example.org/#timelineEnd"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.page.RoomInfo = mxclient.RoomInfo{RoomID: "!r:example.org"}
+			if got := test.page.newestPageURL(); got != test.want {
+				t.Errorf("newestPageURL() = %q, want %q", got, test.want)
+			}
+			if header := test.page.Header(); !strings.Contains(header, `href="`+html.EscapeString(test.want)+`"`) {
+				t.Errorf("Header() does not link to %q: %s", test.want, header)
+			}
+		})
+	}
+}
+
+func TestPrintRoomHeaderMessageCount(t *testing.T) {
+	tests := []struct {
+		numMessages int
+		allKnown    bool
+		want        string
+	}{
+		{0, true, "0 messages"},
+		{1, true, "1 message"},
+		{2, true, "2 messages"},
+		{1, false, "1+ messages"},
+		{64, false, "64+ messages"},
+	}
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			roomInfo := mxclient.RoomInfo{RoomID: "!r:example.org", NumMessages: test.numMessages, AllMessagesKnown: test.allKnown}
+			header := PrintRoomHeader(roomInfo)
+			if !strings.Contains(header, ">"+test.want+"<") {
+				t.Errorf("PrintRoomHeader() does not count %q: %s", test.want, header)
+			}
+			if !strings.Contains(header, `href="./room/!r:example.org/">Jump to newest</a>`) {
+				t.Errorf("PrintRoomHeader() does not link to the newest messages: %s", header)
+			}
+		})
+	}
+}
+
+// testEvent unmarshals the event JSON, failing the test if it is malformed.
+func testEvent(t *testing.T, data string) mxclient.Event {
+	t.Helper()
+	var ev mxclient.Event
+	if err := json.Unmarshal([]byte(data), &ev); err != nil {
+		t.Fatal(err)
+	}
+	return ev
+}
+
+func TestPrintReplyQuote(t *testing.T) {
+	reply := func(replyTo string) mxclient.Event {
+		return testEvent(t, `{"event_id":"$reply","type":"m.room.message","sender":"@bob:example.org",
+			"content":{"msgtype":"m.text","body":"> <@alice:example.org> hi\n\nhello",
+				"m.relates_to":{"m.in_reply_to":{"event_id":"`+replyTo+`"}}}}`)
+	}
+	targets := map[string]mxclient.Event{
+		"$target": testEvent(t, `{"event_id":"$target","type":"m.room.message","sender":"@alice:example.org",
+			"content":{"msgtype":"m.text","body":"> <@carol:example.org> first\n> second\n\nhi there"}}`),
+		"$redacted": testEvent(t, `{"event_id":"$redacted","type":"m.room.message","sender":"@alice:example.org",
+			"content":{},"unsigned":{"redacted_because":{"sender":"@mod:example.org","content":{}}}}`),
+		"$base/64+id": testEvent(t, `{"event_id":"$base/64+id","type":"m.room.message","sender":"@alice:example.org",
+			"content":{"msgtype":"m.text","body":"hi"}}`),
+	}
+
+	tests := []struct {
+		name     string
+		replyTo  string
+		wantHref string
+		want     string
+	}{
+		{"the target's own fallback is stripped from its preview", "$target", "./room/!r:example.org/$target", "hi there"},
+		{"redacted targets are shown as deleted", "$redacted", "./room/!r:example.org/$redacted", "[deleted message]"},
+		{"targets outside the window are linked to", "$unloaded", "./room/!r:example.org/$unloaded",
+			"A message not shown here"},
+		{"event IDs are escaped", "$base/64+id", "./room/!r:example.org/$base%2F64+id", "hi"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &RoomChatPage{RoomInfo: mxclient.RoomInfo{RoomID: "!r:example.org"}, ReplyTo: targets}
+			ev := reply(test.replyTo)
+			quote := p.printReplyQuote(&ev)
+			if !strings.Contains(quote, `href="`+test.wantHref+`"`) {
+				t.Errorf("printReplyQuote() does not link to %q: %s", test.wantHref, quote)
+			}
+			if !strings.Contains(quote, test.want) {
+				t.Errorf("printReplyQuote() does not contain %q: %s", test.want, quote)
+			}
+			if strings.Contains(quote, "&gt;") || strings.Contains(quote, "first") {
+				t.Errorf("printReplyQuote() contains a reply fallback: %s", quote)
+			}
+		})
+	}
+}
+
+func TestPrintStateChange(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		prev    string
+		want    string
+	}{
+		{"set", `{"name":"Lobby"}`, `{}`, `Alice set the room name to "Lobby".`},
+		{"removed", `{}`, `{"name":"Lobby"}`, `Alice removed the room name "Lobby".`},
+		{"changed", `{"name":"<b>Hall</b>"}`, `{"name":"Lobby"}`,
+			`Alice changed the room name to "&lt;b&gt;Hall&lt;/b&gt;" from "Lobby".`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &RoomChatPage{
+				RoomInfo:  mxclient.RoomInfo{RoomID: "!r:example.org"},
+				MemberMap: map[string]mxclient.MemberInfo{"@alice:example.org": {MXID: "@alice:example.org", DisplayName: "Alice"}},
+			}
+			ev := testEvent(t, `{"event_id":"$name","type":"m.room.name","sender":"@alice:example.org","state_key":"",
+				"content":`+test.content+`,"unsigned":{"prev_content":`+test.prev+`}}`)
+			ev.PrevContent = ev.Unsigned["prev_content"].(map[string]interface{})
+			got := p.printStateChange(&ev, "name", "room name")
+			// the sender is linked to their member page.
+			got = regexp.MustCompile(`<[^>]*>`).ReplaceAllString(got, "")
+			if got != test.want {
+				t.Errorf("printStateChange() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+var tagRegex = regexp.MustCompile(`<[^>]*>`)
+
+// textOf returns the text of markup with its tags removed and whitespace collapsed, leaving entities escaped.
+func textOf(markup string) string {
+	return strings.Join(strings.Fields(tagRegex.ReplaceAllString(markup, " ")), " ")
+}
+
+// newTestChatPage returns a page of !r:example.org whose members are Alice, whose name is markup, & Bob.
+func newTestChatPage() *RoomChatPage {
+	return &RoomChatPage{
+		RoomInfo: mxclient.RoomInfo{RoomID: "!r:example.org"},
+		MemberMap: map[string]mxclient.MemberInfo{
+			"@alice:example.org": {MXID: "@alice:example.org", DisplayName: "<b>Alice</b>"},
+			"@bob:example.org":   {MXID: "@bob:example.org", DisplayName: "Bob"},
+		},
+		Sanitizer: sanitizer.InitSanitizer(),
+	}
+}
+
+func TestPrintEmote(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		want     string
+		wantHTML string
+	}{
+		{"plain", `{"msgtype":"m.emote","body":"waves <hello>"}`, "* &lt;b&gt;Alice&lt;/b&gt; waves &lt;hello&gt;", ""},
+		{"formatted", `{"msgtype":"m.emote","body":"waves","format":"org.matrix.custom.html",
+			"formatted_body":"<em>waves</em><script>alert(1)</script>"}`, "* &lt;b&gt;Alice&lt;/b&gt; waves", "<em>waves</em>"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := newTestChatPage()
+			ev := testEvent(t, `{"event_id":"$emote","type":"m.room.message","sender":"@alice:example.org",
+				"origin_server_ts":1500000000000,"content":`+test.content+`}`)
+			got := p.printEvent(&ev, nil, false)
+
+			emote := regexp.MustCompile(`(?s)<span class="emote">.*</span>`).FindString(got)
+			if emote == "" {
+				t.Fatalf("printEvent() does not render an emote: %s", got)
+			}
+			if text := textOf(emote); !strings.HasPrefix(text, test.want) {
+				t.Errorf("emote reads %q, want %q", text, test.want)
+			}
+			if test.wantHTML != "" && !strings.Contains(emote, test.wantHTML) {
+				t.Errorf("emote does not contain %q: %s", test.wantHTML, emote)
+			}
+			if strings.Contains(got, "<script") || strings.Contains(got, "<b>") {
+				t.Errorf("printEvent() contains unescaped markup: %s", got)
+			}
+		})
+	}
+}
+
+func TestPrintPinnedEvents(t *testing.T) {
+	pinned := func(eventID, body string) mxclient.Event {
+		return testEvent(t, `{"event_id":"`+eventID+`","type":"m.room.message","sender":"@bob:example.org",
+			"origin_server_ts":1500000000000,"content":{"msgtype":"m.text","body":"`+body+`"}}`)
+	}
+	tests := []struct {
+		name      string
+		pinned    []mxclient.Event
+		numPinned int
+		want      []string
+		wantNotIn []string
+	}{
+		{"several pins", []mxclient.Event{pinned("$a", "rules"), pinned("$b", "faq")}, 2,
+			[]string{"Pinned messages (2)", `href="./room/!r:example.org/$a"`, "rules", `href="./room/!r:example.org/$b"`, "faq"},
+			[]string{"Showing"}},
+		{"pins beyond those shown are counted", []mxclient.Event{pinned("$a", "rules")}, 3,
+			[]string{"Pinned messages (3)", `href="./room/!r:example.org/$a"`, "Showing 1 of 3 pinned messages."}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := newTestChatPage()
+			p.Pinned, p.NumPinned = test.pinned, test.numPinned
+			got := p.printPinnedEvents()
+			for _, want := range test.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("printPinnedEvents() is missing %s: %s", want, got)
+				}
+			}
+			for _, unwanted := range test.wantNotIn {
+				if strings.Contains(got, unwanted) {
+					t.Errorf("printPinnedEvents() has %s: %s", unwanted, got)
+				}
+			}
+		})
+	}
+}
+
+// messageTest is a case of rendering the content of an m.room.message event, whose output must contain each of want
+// & none of wantNotIn.
+type messageTest struct {
+	name      string
+	content   string
+	want      []string
+	wantNotIn []string
+}
+
+func runMessageTests(t *testing.T, tests []messageTest) {
+	t.Helper()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := newTestChatPage()
+			ev := testEvent(t, `{"event_id":"$message","type":"m.room.message","sender":"@bob:example.org","content":`+test.content+`}`)
+			got := p.textForMRoomMessageEvent(&ev)
+			for _, want := range test.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("textForMRoomMessageEvent() is missing %s: %s", want, got)
+				}
+			}
+			for _, unwanted := range test.wantNotIn {
+				if strings.Contains(got, unwanted) {
+					t.Errorf("textForMRoomMessageEvent() has %s: %s", unwanted, got)
+				}
+			}
+		})
+	}
+}
+
+func TestTextForFileMessage(t *testing.T) {
+	runMessageTests(t, []messageTest{
+		{"plaintext", `{"msgtype":"m.file","body":"report <1>.pdf","url":"mxc://example.org/report",
+			"info":{"mimetype":"application/pdf","size":1572864}}`,
+			[]string{`<a class="m.file" href="./media/example.org/report" rel="noopener" download>`, "report &lt;1&gt;.pdf",
+				"<sup>(application/pdf, 1.5 MiB)</sup>"},
+			[]string{"encrypted"}},
+		{"without info", `{"msgtype":"m.file","body":"notes.txt","url":"mxc://example.org/notes"}`,
+			[]string{`href="./media/example.org/notes"`, "notes.txt"}, []string{"<sup>"}},
+		{"encrypted", `{"msgtype":"m.file","body":"secret.pdf","info":{"mimetype":"application/pdf","size":512},
+			"file":{"url":"mxc://example.org/secret","key":{"k":"key"},"iv":"iv","hashes":{"sha256":"hash"},"v":"v2"}}`,
+			[]string{`<span class="m.file">`, "secret.pdf", "<sup>(application/pdf, 512 B)</sup>",
+				"This file is encrypted and cannot be downloaded from the archive."},
+			[]string{"./media/", " download>"}},
+		{"malformed", `{"msgtype":"m.file","body":"nothing.pdf"}`, []string{"Redacted or Malformed Event"}, []string{"nothing.pdf"}},
+	})
+}
+
+func TestFormatFileSize(t *testing.T) {
+	tests := []struct {
+		size int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{5 << 30, "5.0 GiB"},
+	}
+	for _, test := range tests {
+		if got := formatFileSize(test.size); got != test.want {
+			t.Errorf("formatFileSize(%d) = %q, want %q", test.size, got, test.want)
+		}
+	}
+}
+
+func TestTextForAudioVideoMessage(t *testing.T) {
+	runMessageTests(t, []messageTest{
+		{"audio", `{"msgtype":"m.audio","body":"voice.ogg","url":"mxc://example.org/voice","info":{"mimetype":"audio/ogg"}}`,
+			[]string{`<audio class="m.audio" controls preload="metadata">`,
+				`<source src="./media/example.org/voice" type="audio/ogg"/>`,
+				`<a href="./media/example.org/voice" rel="noopener" download>voice.ogg</a></audio>`},
+			nil},
+		{"video with a poster", `{"msgtype":"m.video","body":"clip.mp4","url":"mxc://example.org/clip",
+			"info":{"mimetype":"video/mp4","thumbnail_url":"mxc://example.org/poster"}}`,
+			[]string{`<video class="m.video" controls preload="metadata" poster="./media/example.org/poster">`,
+				`<source src="./media/example.org/clip" type="video/mp4"/>`,
+				`<a href="./media/example.org/clip" rel="noopener" download>clip.mp4</a></video>`},
+			nil},
+		{"video without a poster or mimetype", `{"msgtype":"m.video","body":"clip.webm","url":"mxc://example.org/clip"}`,
+			[]string{`<video class="m.video" controls preload="metadata">`, `<source src="./media/example.org/clip"/>`},
+			[]string{"poster", "type="}},
+		{"encrypted video", `{"msgtype":"m.video","body":"secret.mp4","file":{"url":"mxc://example.org/secret","v":"v2"}}`,
+			[]string{`<span class="m.video">`, "secret.mp4", "This file is encrypted and cannot be downloaded from the archive."},
+			[]string{"<video", "./media/"}},
+	})
+}
+
+func TestTextForLocationMessage(t *testing.T) {
+	runMessageTests(t, []messageTest{
+		{"with a geo URI", `{"msgtype":"m.location","body":"The office","geo_uri":"geo:51.5,-0.12;u=20"}`,
+			[]string{`<a class="m.location" href="https://www.openstreetmap.org/?mlat=51.5&amp;mlon=-0.12#map=16/51.5/-0.12" rel="noopener" target="_blank">`,
+				"📍 The office"}, nil},
+		{"without a body", `{"msgtype":"m.location","geo_uri":"geo:51.5,-0.12"}`, []string{"📍 Shared a location"}, nil},
+		{"with a malformed geo URI", `{"msgtype":"m.location","body":"Somewhere","geo_uri":"geo:here"}`,
+			[]string{"Somewhere"}, []string{"<a "}},
+		{"malformed", `{"msgtype":"m.location"}`, []string{"Redacted or Malformed Event"}, nil},
+	})
+}
+
+func TestPaginationLinksKeepLimit(t *testing.T) {
+	events := []mxclient.Event{{ID: "$older"}, {ID: "$newer"}}
+	tests := []struct {
+		name      string
+		page      RoomChatPage
+		wantOlder string
+		wantNewer string
+	}{
+		{"an explicit size is kept", RoomChatPage{PageSize: 100, ExplicitPageSize: true, Anchor: "$a", CurrentOffset: 200},
+			"./room/!r:example.org/?anchor=%24a&offset=300&limit=100",
+			"./room/!r:example.org/?anchor=%24a&offset=198&limit=100"},
+		{"the default size is not", RoomChatPage{PageSize: 50, Anchor: "$a", CurrentOffset: 200},
+			"./room/!r:example.org/?anchor=%24a&offset=250", "./room/!r:example.org/?anchor=%24a&offset=198"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.page.RoomInfo = mxclient.RoomInfo{RoomID: "!r:example.org"}
+			test.page.Events = events
+			if older := test.page.printOlderLink(); !strings.Contains(older, `href="`+test.wantOlder+`"`) {
+				t.Errorf("printOlderLink() does not link to %q: %s", test.wantOlder, older)
+			}
+			if newer := test.page.printNewerLink(); !strings.Contains(newer, `href="`+test.wantNewer+`"`) {
+				t.Errorf("printNewerLink() does not link to %q: %s", test.wantNewer, newer)
+			}
+		})
+	}
+}
+
+func TestPrintOlderLinkHistoryTruncated(t *testing.T) {
+	p := RoomChatPage{RoomInfo: mxclient.RoomInfo{RoomID: "!r:example.org"}, Events: []mxclient.Event{{ID: "$a"}},
+		Anchor: "$a", CurrentOffset: 200, PageSize: 50, HistoryTruncated: true}
+	older := p.printOlderLink()
+	// reloading the same page loads more of the history leading up to it.
+	for _, want := range []string{`<div class="historyTruncated">History truncated:`,
+		`href="./room/!r:example.org/?anchor=%24a&offset=200">`, "Load more history"} {
+		if !strings.Contains(older, want) {
+			t.Errorf("printOlderLink() is missing %s: %s", want, older)
+		}
+	}
+
+	p.HistoryTruncated = false
+	if older := p.printOlderLink(); strings.Contains(older, "historyTruncated") || !strings.Contains(older, "offset=250") {
+		t.Errorf("printOlderLink() does not link to the older page: %s", older)
+	}
+}
+
+func TestBodyOrder(t *testing.T) {
+	message := func(eventID string, ts int) mxclient.Event {
+		return testEvent(t, `{"event_id":"`+eventID+`","type":"m.room.message","sender":"@bob:example.org",
+			"origin_server_ts":`+strconv.Itoa(ts)+`,"content":{"msgtype":"m.text","body":"`+eventID+`"}}`)
+	}
+	oldestFirst := []mxclient.Event{message("$one", 1000), message("$two", 2000), message("$three", 3000)}
+	newestFirst := mxclient.ReverseEventsCopy(oldestFirst)
+
+	const older = "./room/!r:example.org/?anchor=%24three&offset=250"
+	const newer = "./room/!r:example.org/?anchor=%24three&offset=197"
+	tests := []struct {
+		name       string
+		descending bool
+		events     []mxclient.Event
+		wantEvents []string
+		wantLinks  []string
+	}{
+		{"chronological", false, oldestFirst, []string{"$one", "$two", "$three"}, []string{older, newer}},
+		{"newest first", true, newestFirst, []string{"$three", "$two", "$one"}, []string{newer + "&order=desc", older + "&order=desc"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := newTestChatPage()
+			p.Events, p.Descending = test.events, test.descending
+			p.Anchor, p.CurrentOffset, p.PageSize = "$three", 200, 50
+			body := p.Body()
+
+			var gotEvents []string
+			// each event's timestamp is its permalink.
+			for _, match := range regexp.MustCompile(`!r:example\.org/(\$\w+)" title=`).FindAllStringSubmatch(body, -1) {
+				gotEvents = append(gotEvents, match[1])
+			}
+			if strings.Join(gotEvents, " ") != strings.Join(test.wantEvents, " ") {
+				t.Errorf("got events %v, want %v", gotEvents, test.wantEvents)
+			}
+
+			var gotLinks []string
+			for _, match := range regexp.MustCompile(`<div class="paginate"><a href="([^"]*)"`).FindAllStringSubmatch(body, -1) {
+				gotLinks = append(gotLinks, match[1])
+			}
+			if strings.Join(gotLinks, " ") != strings.Join(test.wantLinks, " ") {
+				t.Errorf("got pagination links %v, want %v", gotLinks, test.wantLinks)
+			}
+		})
+	}
+}
+
+func TestBodyThreads(t *testing.T) {
+	message := func(eventID string, ts int, threadRoot string) mxclient.Event {
+		relatesTo := ""
+		if threadRoot != "" {
+			relatesTo = `,"m.relates_to":{"rel_type":"m.thread","event_id":"` + threadRoot + `"}`
+		}
+		return testEvent(t, `{"event_id":"`+eventID+`","type":"m.room.message","sender":"@bob:example.org",
+			"origin_server_ts":`+strconv.Itoa(ts)+`,"content":{"msgtype":"m.text","body":"`+eventID+`"`+relatesTo+`}}`)
+	}
+	p := newTestChatPage()
+	p.Events = []mxclient.Event{
+		message("$root", 1000, ""),
+		message("$reply", 2000, "$root"),
+		message("$orphan", 3000, "$elsewhere"),
+	}
+	body := p.Body()
+
+	summary := regexp.MustCompile(`(?s)<tr class="threadSummary">.*?</details>`).FindString(body)
+	if !strings.Contains(summary, `<a href="./room/!r:example.org/thread/$root">1 reply in thread</a>`) ||
+		!strings.Contains(summary, "$reply") {
+		t.Errorf("the reply is not grouped under its root: %s", body)
+	}
+	if strings.Contains(summary, "$orphan") {
+		t.Errorf("the orphan is grouped under another root: %s", summary)
+	}
+	if !strings.Contains(body, `<a href="./room/!r:example.org/thread/$elsewhere">In thread</a>`) {
+		t.Errorf("the orphan does not link to its thread: %s", body)
+	}
+}
+
+func TestPrintRoomCreate(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		want      []string
+		wantNotIn []string
+	}{
+		{"normal", `{"creator":"@bob:example.org","room_version":"10"}`,
+			[]string{"Bob created the room on 14 Jul 2017.", "Room version 10."}, []string{"continuation"}},
+		{"before room versions", `{"creator":"@bob:example.org"}`, []string{"Room version 1."}, nil},
+		{"upgraded", `{"creator":"@bob:example.org","room_version":"10","predecessor":{"room_id":"!old:example.org","event_id":"$tombstone"}}`,
+			[]string{"Room version 10.", `<a href="./room/!old:example.org/">This room is a continuation of another conversation.</a>`}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := newTestChatPage()
+			ev := testEvent(t, `{"event_id":"$create","type":"m.room.create","sender":"@bob:example.org","state_key":"",
+				"origin_server_ts":1500000000000,"content":`+test.content+`}`)
+			got := p.printEvent(&ev, nil, false)
+			text := textOf(got)
+			for _, want := range test.want {
+				if !strings.Contains(got, want) && !strings.Contains(text, want) {
+					t.Errorf("printEvent() is missing %s: %s", want, got)
+				}
+			}
+			for _, unwanted := range test.wantNotIn {
+				if strings.Contains(got, unwanted) {
+					t.Errorf("printEvent() has %s: %s", unwanted, got)
+				}
+			}
+		})
+	}
+
+	// rooms whose creation is further back than the page have no banner.
+	p := newTestChatPage()
+	p.Events = []mxclient.Event{testEvent(t, `{"event_id":"$message","type":"m.room.message","sender":"@bob:example.org",
+		"origin_server_ts":1500000000000,"content":{"msgtype":"m.text","body":"hi"}}`)}
+	if body := p.Body(); strings.Contains(body, "roomCreate") {
+		t.Errorf("Body() has a creation banner without the creation event: %s", body)
+	}
+}
+
+func TestBodyTombstone(t *testing.T) {
+	tests := []struct {
+		name      string
+		tombstone mxclient.Tombstone
+		want      []string
+	}{
+		{"tombstoned", mxclient.Tombstone{Body: "We moved <here>", ReplacementRoomID: "!new:example.org"},
+			[]string{`<div class="tombstone"><h3>We moved &lt;here&gt;</h3><a href="./room/!new:example.org/">The conversation continues here.</a></div>`}},
+		{"tombstoned without a body", mxclient.Tombstone{ReplacementRoomID: "!new:example.org"},
+			[]string{"<h3>This room has been replaced and is no longer active.</h3>"}},
+		{"not tombstoned", mxclient.Tombstone{}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := newTestChatPage()
+			p.RoomInfo.Tombstone = test.tombstone
+			body := p.Body()
+			if len(test.want) == 0 && strings.Contains(body, "tombstone") {
+				t.Errorf("Body() has a tombstone banner: %s", body)
+			}
+			for _, want := range test.want {
+				if !strings.Contains(body, want) {
+					t.Errorf("Body() is missing %s: %s", want, body)
+				}
+			}
+		})
+	}
+}
+
+func TestPrintReadReceipts(t *testing.T) {
+	tests := []struct {
+		name     string
+		receipts mxclient.ReadReceipts
+		want     string
+	}{
+		{"one reader", mxclient.ReadReceipts{Readers: []string{"@bob:example.org"}, NumReaders: 1}, "Seen by Bob"},
+		{"names are escaped", mxclient.ReadReceipts{Readers: []string{"@alice:example.org", "@bob:example.org"}, NumReaders: 2},
+			"Seen by &lt;b&gt;Alice&lt;/b&gt; and Bob"},
+		{"readers beyond those listed are counted", mxclient.ReadReceipts{Readers: []string{"@bob:example.org", "@carol:example.org"}, NumReaders: 5},
+			"Seen by Bob, @carol:example.org and 3 others"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := newTestChatPage()
+			p.Receipts = map[string]mxclient.ReadReceipts{"$event": test.receipts}
+			if got := textOf(p.printReadReceipts("$event")); got != test.want {
+				t.Errorf("printReadReceipts() = %q, want %q", got, test.want)
+			}
+			if got := p.printReadReceipts("$unread"); got != "" {
+				t.Errorf("printReadReceipts() of an unread event = %q, want nothing", got)
+			}
+		})
+	}
+}
+
+func TestPrintEventTimezone(t *testing.T) {
+	// 23:30 UTC on New Year's Eve, already the next day in Berlin.
+	ev := testEvent(t, `{"event_id":"$e","type":"m.room.message","sender":"@bob:example.org","origin_server_ts":1609457400000,
+		"content":{"msgtype":"m.text","body":"Happy new year"}}`)
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no timezone database:", err)
+	}
+	tests := []struct {
+		name     string
+		location *time.Location
+		wantTime string
+		wantDate string
+	}{
+		{"UTC by default", nil, `title="31 Dec 2020 23:30:00 UTC"><time datetime="2020-12-31T23:30:00Z">23:30:00</time>`, "31 Dec 2020"},
+		{"in the zone of the page", berlin, `title="1 Jan 2021 00:30:00 CET"><time datetime="2020-12-31T23:30:00Z">00:30:00</time>`, "1 Jan 2021"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := newTestChatPage()
+			p.Location = test.location
+			out := p.printEvent(&ev, nil, false)
+			if !strings.Contains(out, test.wantTime) {
+				t.Errorf("printEvent() does not contain %q: %s", test.wantTime, out)
+			}
+			if !strings.Contains(out, `<td colspan="3">`+test.wantDate+`</td>`) {
+				t.Errorf("printEvent() is not dated %s: %s", test.wantDate, out)
+			}
+		})
+	}
+
+	p := newTestChatPage()
+	p.Location = berlin
+	p.Events = []mxclient.Event{ev}
+	p.Anchor = "$e"
+	if older := p.printOlderLink(); !strings.Contains(older, "&tz=Europe%2FBerlin") {
+		t.Errorf("printOlderLink() does not keep the timezone: %s", older)
+	}
+}
+
+func TestPrintSticker(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"small enough", `{"body":"a cat","url":"mxc://example.org/cat","info":{"w":128,"h":64}}`,
+			`<img class="m.sticker" src="./media/example.org/cat" alt="a cat" title="a cat" width="128" height="64" />`},
+		{"too wide", `{"body":"a cat","url":"mxc://example.org/cat","info":{"w":1024,"h":512}}`, `width="256" height="128"`},
+		{"too tall", `{"body":"a cat","url":"mxc://example.org/cat","info":{"w":300,"h":600}}`, `width="128" height="256"`},
+		{"without info", `{"body":"a cat","url":"mxc://example.org/cat"}`, `style="max-width:256px; max-height:256px;"`},
+		{"without a valid url", `{"body":"a cat","url":"https://example.org/cat.png","info":{"w":128,"h":64}}`,
+			"Redacted or Malformed Event"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := newTestChatPage()
+			ev := testEvent(t, `{"event_id":"$sticker","type":"m.sticker","sender":"@bob:example.org","content":`+test.content+`}`)
+			if got := p.printEvent(&ev, nil, false); !strings.Contains(got, test.want) {
+				t.Errorf("printEvent() does not contain %s: %s", test.want, got)
+			}
+		})
+	}
+}
+
+func TestPrintEncryptedEvent(t *testing.T) {
+	p := newTestChatPage()
+	ev := testEvent(t, `{"event_id":"$secret","type":"m.room.encrypted","sender":"@bob:example.org",
+		"content":{"algorithm":"m.megolm.v1.aes-sha2","ciphertext":"AwgAEnAC"}}`)
+	got := p.printEvent(&ev, nil, false)
+	want := `<a class="encrypted" href="./room/!r:example.org/$secret">🔒 Encrypted message — not viewable in the static archive</a>`
+	if !strings.Contains(got, want) {
+		t.Errorf("printEvent() does not contain %s: %s", want, got)
+	}
+	if strings.Contains(got, "AwgAEnAC") {
+		t.Errorf("printEvent() shows the ciphertext: %s", got)
+	}
+}
+
+func TestBodyMembershipSummary(t *testing.T) {
+	member := func(eventID, mxid, prevMembership, membership string) mxclient.Event {
+		prevContent := ""
+		if prevMembership != "" {
+			prevContent = `,"prev_content":{"membership":"` + prevMembership + `"}`
+		}
+		return testEvent(t, `{"event_id":"`+eventID+`","type":"m.room.member","sender":"`+mxid+`","state_key":"`+mxid+`",
+			"content":{"membership":"`+membership+`"}`+prevContent+`}`)
+	}
+	events := []mxclient.Event{
+		member("$j1", "@carol:example.org", "", "join"),
+		member("$j2", "@dave:example.org", "", "join"),
+		member("$l1", "@erin:example.org", "join", "leave"),
+	}
+
+	tests := []struct {
+		name      string
+		threshold int
+		highlight bool
+		want      []string
+		wantNotIn []string
+	}{
+		{"collapsed", 2, false, []string{`<tr class="membershipSummary">`, "<details><summary>2 users joined and 1 left</summary>"}, nil},
+		{"opened to the highlighted event", 2, true, []string{"<details open><summary>2 users joined and 1 left</summary>"}, nil},
+		{"too short to collapse", 3, false, nil, []string{"membershipSummary"}},
+		{"never collapsed", 0, false, nil, []string{"membershipSummary"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := newTestChatPage()
+			p.Events, p.MembershipCollapseThreshold = events, test.threshold
+			p.Anchor, p.Highlight, p.PageSize = "$l1", test.highlight, 50
+			body := p.Body()
+			for _, want := range test.want {
+				if !strings.Contains(body, want) {
+					t.Errorf("Body() is missing %s: %s", want, body)
+				}
+			}
+			for _, unwanted := range test.wantNotIn {
+				if strings.Contains(body, unwanted) {
+					t.Errorf("Body() has %s: %s", unwanted, body)
+				}
+			}
+			// the events summarised are all still there to be expanded.
+			for _, eventID := range []string{"$j1", "$j2", "$l1"} {
+				if !strings.Contains(body, `!r:example.org/`+eventID+`" title=`) {
+					t.Errorf("Body() lacks %s", eventID)
+				}
+			}
+		})
+	}
+}
+
+func TestBodyRepeatedMessages(t *testing.T) {
+	message := func(eventID, body string) mxclient.Event {
+		return testEvent(t, `{"event_id":"`+eventID+`","type":"m.room.message","sender":"@bob:example.org",
+			"content":{"msgtype":"m.text","body":"`+body+`"}}`)
+	}
+	p := newTestChatPage()
+	p.Events = []mxclient.Event{message("$1", "buy now"), message("$2", "BUY NOW"), message("$3", "buy now!"), message("$4", "bye")}
+	p.RepeatCollapseSimilarity, p.RepeatCollapseMinRun = 0.8, 3
+	p.Anchor, p.PageSize = "$4", 50
+
+	body := p.Body()
+	summary := regexp.MustCompile(`<tr class="repeatSummary">.*?</details>`).FindString(body)
+	if !strings.Contains(summary, "<details><summary>(repeated 2 more times)</summary>") {
+		t.Fatalf("Body() does not collapse the repeats: %s", body)
+	}
+	// the first of the run is shown, the repeats are tucked away & the rest follows.
+	for _, eventID := range []string{"$2", "$3"} {
+		if !strings.Contains(summary, "!r:example.org/"+eventID+`"`) {
+			t.Errorf("the summary lacks %s: %s", eventID, summary)
+		}
+	}
+	for _, eventID := range []string{"$1", "$4"} {
+		if strings.Contains(summary, "!r:example.org/"+eventID+`"`) || !strings.Contains(body, "!r:example.org/"+eventID+`"`) {
+			t.Errorf("%s is not shown outside of the summary: %s", eventID, body)
+		}
+	}
+
+	// repeats are opened to show the event highlighted among them.
+	p.Anchor, p.Highlight = "$3", true
+	if body := p.Body(); !strings.Contains(body, "<details open><summary>(repeated 2 more times)</summary>") {
+		t.Errorf("Body() does not open the repeats to the highlighted event: %s", body)
+	}
+}
+
+func TestPrintMentions(t *testing.T) {
+	tests := []struct {
+		name     string
+		mentions string
+		want     string
+	}{
+		{"members & others", `{"user_ids":["@alice:example.org","@stranger:example.org"]}`,
+			`<div class="mentions"> <span class="userPill mention" title="@alice:example.org">&lt;b&gt;Alice&lt;/b&gt;</span>` +
+				` <span class="userPill mention" title="@stranger:example.org">@stranger:example.org</span></div>`},
+		{"the room", `{"room":true}`, `<div class="mentions"><span class="userPill roomMention">@room</span></div>`},
+		{"nobody", `{"user_ids":[]}`, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := newTestChatPage()
+			ev := testEvent(t, `{"event_id":"$m","type":"m.room.message","sender":"@bob:example.org",
+				"content":{"msgtype":"m.text","body":"hey","m.mentions":`+test.mentions+`}}`)
+			if got := strings.TrimSpace(p.printMentions(&ev)); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPrintNotice(t *testing.T) {
+	p := newTestChatPage()
+	notice := testEvent(t, `{"event_id":"$notice","type":"m.room.message","sender":"@bob:example.org",
+		"content":{"msgtype":"m.notice","body":"Build passed"}}`)
+	got := p.printEvent(&notice, nil, false)
+	want := `<td class="notice"><span class="noticeMarker" title="Sent as a notice, usually by a bot">bot</span> Build passed`
+	if !strings.Contains(got, want) {
+		t.Errorf("printEvent() does not contain %s: %s", want, got)
+	}
+
+	text := testEvent(t, `{"event_id":"$text","type":"m.room.message","sender":"@bob:example.org",
+		"content":{"msgtype":"m.text","body":"Build passed"}}`)
+	if got := p.printEvent(&text, nil, false); strings.Contains(got, "notice") {
+		t.Errorf("printEvent() marks a message as a notice: %s", got)
+	}
+}
+
+func TestPrintEventPermalink(t *testing.T) {
+	p := newTestChatPage()
+	p.RoomInfo.ViaServers = []string{"example.org", "matrix.org"}
+	ev := testEvent(t, `{"event_id":"$ev","type":"m.room.message","sender":"@bob:example.org","content":{"msgtype":"m.text","body":"hi"}}`)
+	want := `<a href="https://matrix.to/#/!r:example.org/$ev?via=example.org&amp;via=matrix.org" title=`
+	if got := p.printEvent(&ev, nil, false); !strings.Contains(got, want) {
+		t.Errorf("printEvent() does not link to the event via the servers of the room: %s", got)
+	}
+}
+
+func TestPrintUnsupportedEvent(t *testing.T) {
+	p := newTestChatPage()
+	ev := testEvent(t, `{"event_id":"$poke","type":"org.example.poke","sender":"@bob:example.org","state_key":"<x>",
+		"content":{"target":"<@alice:example.org>","count":2}}`)
+	got := p.printEvent(&ev, nil, false)
+	for _, want := range []string{
+		`<td class="unsupportedEvent"><details><summary>`,
+		"Bob</a> sent an unsupported event of type org.example.poke.</summary>",
+		"<div>state_key: <code>&lt;x&gt;</code></div>",
+		`<pre>{` + "\n" + `  &quot;count&quot;: 2,` + "\n" + `  &quot;target&quot;: &quot;\u003c@alice:example.org\u003e&quot;` + "\n" + `}</pre>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("printEvent() does not contain %s: %s", want, got)
+		}
+	}
+
+	ev = testEvent(t, `{"event_id":"$ping","type":"org.example.ping","sender":"@bob:example.org","content":{}}`)
+	if got := p.printEvent(&ev, nil, false); strings.Contains(got, "state_key") {
+		t.Errorf("printEvent() shows a state key for a message event: %s", got)
+	}
+}
+
+func TestPrintPoll(t *testing.T) {
+	tests := []struct {
+		name        string
+		undisclosed bool
+		results     mxclient.PollResults
+		want        []string
+		wantNotIn   []string
+	}{
+		{"open", false, mxclient.PollResults{Votes: map[string]int{"pizza": 2}, NumVoters: 2}, []string{
+			`<li>&lt;Pizza&gt; <meter min="0" max="2" value="2"></meter> <span class="pollVotes">2 votes</span></li>`,
+			`<li>Sushi <meter min="0" max="2" value="0"></meter> <span class="pollVotes">0 votes</span></li>`,
+			"2 votes cast · Poll open",
+		}, []string{"pollWinner"}},
+		{"closed", false, mxclient.PollResults{Votes: map[string]int{"pizza": 2, "sushi": 1}, NumVoters: 3, Closed: true, ClosedAt: 86400000}, []string{
+			`<li class="pollWinner">&lt;Pizza&gt; <meter min="0" max="3" value="2"></meter>`,
+			`<li>Sushi <meter min="0" max="3" value="1"></meter> <span class="pollVotes">1 vote</span></li>`,
+			"3 votes cast · Poll ended 2 Jan 1970 00:00",
+		}, nil},
+		{"undisclosed", true, mxclient.PollResults{Votes: map[string]int{"pizza": 1}, NumVoters: 1}, []string{
+			"<li>&lt;Pizza&gt;</li><li>Sushi</li>",
+			"1 vote cast · Results will be shown when the poll ends",
+		}, []string{"<meter", "pollVotes"}},
+		{"undisclosed once closed", true, mxclient.PollResults{Votes: map[string]int{"pizza": 1}, NumVoters: 1, Closed: true, ClosedAt: 86400000}, []string{
+			`<li class="pollWinner">&lt;Pizza&gt; <meter min="0" max="1" value="1"></meter>`,
+		}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			poll := &mxclient.Poll{Question: "Lunch?", MaxSelections: 1, Undisclosed: test.undisclosed,
+				Answers: []mxclient.PollAnswer{{ID: "pizza", Text: "<Pizza>"}, {ID: "sushi", Text: "Sushi"}}}
+			got := newTestChatPage().printPoll(poll, test.results)
+			for _, want := range test.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("printPoll() is missing %s: %s", want, got)
+				}
+			}
+			for _, unwanted := range test.wantNotIn {
+				if strings.Contains(got, unwanted) {
+					t.Errorf("printPoll() has %s: %s", unwanted, got)
+				}
+			}
+		})
+	}
+}
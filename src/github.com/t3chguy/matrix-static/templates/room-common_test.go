@@ -0,0 +1,111 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templates
+
+import (
+	"github.com/t3chguy/matrix-static/mxclient"
+	"strings"
+	"testing"
+)
+
+func TestPrintRoomSocialMeta(t *testing.T) {
+	longTopic := strings.Repeat("é", socialDescriptionLength+10)
+	tests := []struct {
+		name      string
+		roomInfo  mxclient.RoomInfo
+		want      []string
+		wantNotIn []string
+	}{
+		{"named room", mxclient.RoomInfo{Name: "Room <1>", Topic: "A topic"},
+			[]string{`<meta property="og:title" content="Room &lt;1&gt;">`, `<meta property="og:description" content="A topic">`},
+			[]string{`og:image`}},
+		{"long topics are cut short", mxclient.RoomInfo{Name: "Room", Topic: longTopic},
+			[]string{`content="` + strings.Repeat("é", socialDescriptionLength) + `…"`}, nil},
+		{"no topic, no description", mxclient.RoomInfo{Name: "Room"}, nil, []string{`description`}},
+		{"avatars are pictured", mxclient.RoomInfo{Name: "Room",
+			AvatarURL: *mxclient.NewMXCURL("mxc://example.org/avatar", "https://media.example.org")},
+			[]string{`<meta property="og:image" content="https://media.example.org/_matrix/media/r0/thumbnail/example.org/avatar?height=256&amp;method=crop&amp;width=256">`},
+			nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			meta := PrintRoomSocialMeta(test.roomInfo)
+			for _, want := range test.want {
+				if !strings.Contains(meta, want) {
+					t.Errorf("PrintRoomSocialMeta() is missing %s: %s", want, meta)
+				}
+			}
+			for _, unwanted := range test.wantNotIn {
+				if strings.Contains(meta, unwanted) {
+					t.Errorf("PrintRoomSocialMeta() has %s: %s", unwanted, meta)
+				}
+			}
+		})
+	}
+}
+
+func TestPrintRoomHeaderAliases(t *testing.T) {
+	tests := []struct {
+		name      string
+		roomInfo  mxclient.RoomInfo
+		want      []string
+		wantNotIn []string
+	}{
+		{"canonical alias & alternatives", mxclient.RoomInfo{RoomID: "!r:example.org", CanonicalAlias: "#lobby:example.org",
+			AltAliases: []string{"#hall:example.org", "#foyer:other.org"}},
+			[]string{`<a href="./alias/%23lobby%3Aexample.org">#lobby:example.org</a>`,
+				`<li><a href="./alias/%23hall%3Aexample.org">#hall:example.org</a></li>`,
+				`<li><a href="./alias/%23foyer%3Aother.org">#foyer:other.org</a></li>`},
+			[]string{`<div class="roomAlias">!r:example.org</div>`}},
+		{"no alias shows the room ID", mxclient.RoomInfo{RoomID: "!r:example.org"},
+			[]string{`<div class="roomAlias">!r:example.org</div>`},
+			[]string{`./alias/`, `altAliases`}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := PrintRoomHeader(test.roomInfo)
+			for _, want := range test.want {
+				if !strings.Contains(header, want) {
+					t.Errorf("PrintRoomHeader() is missing %s: %s", want, header)
+				}
+			}
+			for _, unwanted := range test.wantNotIn {
+				if strings.Contains(header, unwanted) {
+					t.Errorf("PrintRoomHeader() has %s: %s", unwanted, header)
+				}
+			}
+		})
+	}
+}
+
+func TestPrintRoomHeaderTopic(t *testing.T) {
+	tests := []struct {
+		name     string
+		roomInfo mxclient.RoomInfo
+		want     string
+	}{
+		{"sanitized HTML is rendered as is", mxclient.RoomInfo{Topic: "Rules", TopicHTML: "<b>Rules</b>"},
+			`<td class="maxWidth"><b>Rules</b></td>`},
+		{"plaintext is escaped", mxclient.RoomInfo{Topic: "<b>Rules</b>"}, `<td class="maxWidth">&lt;b&gt;Rules&lt;/b&gt;</td>`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.roomInfo.RoomID = "!r:example.org"
+			if header := PrintRoomHeader(test.roomInfo); !strings.Contains(header, test.want) {
+				t.Errorf("PrintRoomHeader() is missing %s: %s", test.want, header)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templates
+
+import (
+	"encoding/xml"
+	"github.com/t3chguy/matrix-static/mxclient"
+	"github.com/t3chguy/matrix-static/sanitizer"
+	"strings"
+	"testing"
+)
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID      string     `xml:"id"`
+	Title   string     `xml:"title"`
+	Updated string     `xml:"updated"`
+	Author  string     `xml:"author>name"`
+	Links   []atomLink `xml:"link"`
+	Content string     `xml:"content"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+func TestRoomFeed(t *testing.T) {
+	const base = "https://static.example.org/"
+	feed := &RoomFeed{
+		RoomInfo:  mxclient.RoomInfo{RoomID: "!r:example.org", Name: "Lobby"},
+		MemberMap: map[string]mxclient.MemberInfo{"@alice:example.org": {MXID: "@alice:example.org", DisplayName: "Alice"}},
+		Events: []mxclient.Event{
+			testEvent(t, `{"event_id":"$newer","type":"m.room.message","sender":"@alice:example.org","origin_server_ts":1500000060000,
+				"content":{"msgtype":"m.text","body":"<b>bold</b> & plain"}}`),
+			testEvent(t, `{"event_id":"$older","type":"m.room.message","sender":"@bob:example.org","origin_server_ts":1500000000000,
+				"content":{"msgtype":"m.text","body":"hello","format":"org.matrix.custom.html","formatted_body":"<i>hello</i>"}}`),
+		},
+		BaseURL:   base,
+		Sanitizer: sanitizer.InitSanitizer(),
+	}
+
+	var got atomFeed
+	if err := xml.Unmarshal([]byte(feed.Feed()), &got); err != nil {
+		t.Fatalf("feed is not valid Atom: %v\n%s", err, feed.Feed())
+	}
+
+	if got.ID != base+"room/!r:example.org/" || got.Title != "Lobby" {
+		t.Errorf("feed id %q & title %q, want the room's", got.ID, got.Title)
+	}
+	if got.Updated != "2017-07-14T02:41:00Z" {
+		t.Errorf("feed updated %q, want that of the newest entry", got.Updated)
+	}
+	wantFeedLinks := []atomLink{
+		{"self", "application/atom+xml", base + "room/!r:example.org/feed.atom"},
+		{"alternate", "text/html", base + "room/!r:example.org/"},
+	}
+	if len(got.Links) != len(wantFeedLinks) || got.Links[0] != wantFeedLinks[0] || got.Links[1] != wantFeedLinks[1] {
+		t.Errorf("feed links %+v, want %+v", got.Links, wantFeedLinks)
+	}
+
+	wantEntries := []struct {
+		id, title, updated, author, content string
+	}{
+		{base + "room/!r:example.org/$newer", "Alice: <b>bold</b> & plain", "2017-07-14T02:41:00Z", "Alice",
+			"&lt;b&gt;bold&lt;/b&gt; &amp; plain"},
+		{base + "room/!r:example.org/$older", "@bob:example.org: hello", "2017-07-14T02:40:00Z", "@bob:example.org",
+			"<i>hello</i>"},
+	}
+	if len(got.Entries) != len(wantEntries) {
+		t.Fatalf("got %d entries, want %d", len(got.Entries), len(wantEntries))
+	}
+	for i, want := range wantEntries {
+		entry := got.Entries[i]
+		if entry.ID != want.id || entry.Title != want.title || entry.Updated != want.updated || entry.Author != want.author {
+			t.Errorf("entry %d = %q %q %q by %q, want %q %q %q by %q", i, entry.ID, entry.Title, entry.Updated, entry.Author,
+				want.id, want.title, want.updated, want.author)
+		}
+		// the sanitizer pads the tags it strips, such as those wrapping the body, with spaces.
+		if strings.TrimSpace(entry.Content) != want.content {
+			t.Errorf("entry %d content %q, want %q", i, entry.Content, want.content)
+		}
+		wantLinks := []atomLink{
+			{"alternate", "text/html", want.id},
+			{"related", "", "https://matrix.to/#/!r:example.org/" + want.id[len(base+"room/!r:example.org/"):]},
+		}
+		if len(entry.Links) != len(wantLinks) || entry.Links[0] != wantLinks[0] || entry.Links[1] != wantLinks[1] {
+			t.Errorf("entry %d links %+v, want %+v", i, entry.Links, wantLinks)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templates
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSparklinePoints(t *testing.T) {
+	tests := []struct {
+		name   string
+		counts []int
+		want   string
+	}{
+		{"none", nil, ""},
+		{"a single count is flat", []int{5}, "0,1.0 56.0,1.0"},
+		{"no messages lie along the bottom", []int{0, 0, 0}, "0.0,13.0 28.0,13.0 56.0,13.0"},
+		{"the largest reaches the top", []int{0, 2, 4, 1}, "0.0,13.0 18.7,7.0 37.3,1.0 56.0,10.0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := sparklinePoints(test.counts); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMessagesPerDay(t *testing.T) {
+	tests := []struct {
+		counts []int
+		want   string
+	}{
+		{nil, "0"},
+		{[]int{0, 0}, "0.0"},
+		{[]int{1, 2, 4}, "2.3"},
+	}
+	for _, test := range tests {
+		if got := messagesPerDay(test.counts); got != test.want {
+			t.Errorf("messagesPerDay(%v) = %q, want %q", test.counts, got, test.want)
+		}
+	}
+}
+
+func TestPrintSparkline(t *testing.T) {
+	if got := printSparkline(nil); got != "" {
+		t.Errorf("printSparkline(nil) = %q, want nothing", got)
+	}
+	want := `<svg class="sparkline" width="56" height="14" viewBox="0 0 56 14" aria-hidden="true">` +
+		`<polyline fill="none" stroke="currentColor" stroke-width="1" points="0.0,13.0 56.0,1.0" /></svg>`
+	if got := printSparkline([]int{0, 3}); !strings.Contains(got, want) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+)
+
+// validAccentColor allows hex colors and named colors, nothing which could break out of the CSS it is written into.
+var validAccentColor = regexp.MustCompile(`^(#[0-9A-Fa-f]{3}|#[0-9A-Fa-f]{6}|[A-Za-z]+)$`)
+
+var errInvalidAccentColor = errors.New("accent color must be a hex or named CSS color")
+
+func validateAccentColor(color string) error {
+	if color != "" && !validAccentColor.MatchString(color) {
+		return errInvalidAccentColor
+	}
+	return nil
+}
+
+// embeddedAssets are the stylesheets & images we serve, compiled in so that the binary is self-contained.
+//
+//go:embed assets
+var embeddedAssets embed.FS
+
+// overlayFileSystem opens each file from the first of its layers to have it, so that a theme directory need only
+// contain the assets it overrides. Directories are not served, so that they cannot be listed.
+type overlayFileSystem []http.FileSystem
+
+func (layers overlayFileSystem) Open(name string) (http.File, error) {
+	for _, layer := range layers {
+		file, err := layer.Open(name)
+		if err != nil {
+			continue
+		}
+		if info, err := file.Stat(); err == nil && !info.IsDir() {
+			return file, nil
+		}
+		file.Close()
+	}
+	return nil, os.ErrNotExist
+}
+
+// assetFileSystem returns the file system to serve the embedded assets under dir from, with those under the same dir
+// of the themeDir taking precedence, if there is one.
+func assetFileSystem(themeDir, dir string) http.FileSystem {
+	var layers overlayFileSystem
+	if themeDir != "" {
+		layers = append(layers, http.Dir(filepath.Join(themeDir, dir)))
+	}
+	embedded, _ := fs.Sub(embeddedAssets, path.Join("assets", dir))
+	return append(layers, http.FS(embedded))
+}
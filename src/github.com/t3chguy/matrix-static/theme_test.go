@@ -0,0 +1,85 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateAccentColor(t *testing.T) {
+	for _, color := range []string{"", "#fff", "#1A2b3C", "rebeccapurple"} {
+		if err := validateAccentColor(color); err != nil {
+			t.Errorf("validateAccentColor(%q) = %v, want nil", color, err)
+		}
+	}
+	for _, color := range []string{"#ffff", "#12345g", "red; } body { display: none", "rgb(0,0,0)", "red</style>"} {
+		if err := validateAccentColor(color); err != errInvalidAccentColor {
+			t.Errorf("validateAccentColor(%q) = %v, want %v", color, err, errInvalidAccentColor)
+		}
+	}
+}
+
+// readAsset returns the contents of name in fileSystem, ok=false if it is not served.
+func readAsset(t *testing.T, fileSystem http.FileSystem, name string) (contents string, ok bool) {
+	t.Helper()
+	file, err := fileSystem.Open(name)
+	if err != nil {
+		return "", false
+	}
+	defer file.Close()
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data), true
+}
+
+func TestAssetFileSystem(t *testing.T) {
+	themeDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(themeDir, "css"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	const themed = "body { background: black; }"
+	if err := ioutil.WriteFile(filepath.Join(themeDir, "css", "main.css"), []byte(themed), 0644); err != nil {
+		t.Fatal(err)
+	}
+	embedded, err := embeddedAssets.ReadFile("assets/css/main.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the theme's stylesheet replaces ours,
+	if got, ok := readAsset(t, assetFileSystem(themeDir, "css"), "/main.css"); !ok || got != themed {
+		t.Errorf("got %q, %v for the themed stylesheet, want %q", got, ok, themed)
+	}
+	// which is served as built in without a theme,
+	if got, ok := readAsset(t, assetFileSystem("", "css"), "/main.css"); !ok || got != string(embedded) {
+		t.Errorf("got %d bytes, %v for the built in stylesheet, want %d", len(got), ok, len(embedded))
+	}
+	// and the assets it does not override still are.
+	if _, ok := readAsset(t, assetFileSystem(themeDir, "img"), "/favicon-16.png"); !ok {
+		t.Error("a built in image is not served alongside the theme")
+	}
+
+	for _, name := range []string{"/", "/missing.css"} {
+		if _, ok := readAsset(t, assetFileSystem(themeDir, "css"), name); ok {
+			t.Errorf("%s is served", name)
+		}
+	}
+}
@@ -63,3 +63,11 @@ func Max(a, b int) int {
 	}
 	return b
 }
+
+// LimitRunes returns str cut down to at most max runes.
+func LimitRunes(str string, max int) string {
+	if runes := []rune(str); len(runes) > max {
+		return string(runes[:max])
+	}
+	return str
+}
@@ -0,0 +1,112 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import "testing"
+
+func TestStrToIntDefault(t *testing.T) {
+	tests := []struct {
+		str  string
+		def  int
+		want int
+	}{
+		{"10", 5, 10},
+		{"-3", 5, -3},
+		{"", 5, 5},
+		{"ten", 5, 5},
+		{"10.5", 5, 5},
+	}
+	for _, test := range tests {
+		if got := StrToIntDefault(test.str, test.def); got != test.want {
+			t.Errorf("StrToIntDefault(%q, %d) = %d, want %d", test.str, test.def, got, test.want)
+		}
+	}
+}
+
+func TestCalcPaginationStartEnd(t *testing.T) {
+	tests := []struct {
+		page, pageSize, length int
+		wantStart, wantEnd     int
+	}{
+		{0, 10, 25, 0, 24},
+		{1, 10, 25, 0, 10},
+		{3, 10, 25, 20, 25},
+		{4, 10, 25, 25, 25},
+	}
+	for _, test := range tests {
+		start, end := CalcPaginationStartEnd(test.page, test.pageSize, test.length)
+		if start != test.wantStart || end != test.wantEnd {
+			t.Errorf("CalcPaginationStartEnd(%d, %d, %d) = %d, %d, want %d, %d",
+				test.page, test.pageSize, test.length, start, end, test.wantStart, test.wantEnd)
+		}
+	}
+}
+
+func TestBound(t *testing.T) {
+	tests := []struct {
+		min, val, max int
+		want          int
+	}{
+		{1, 5, 10, 5},
+		{1, 0, 10, 1},
+		{1, 11, 10, 10},
+		{1, 1, 10, 1},
+		{1, 10, 10, 10},
+	}
+	for _, test := range tests {
+		if got := Bound(test.min, test.val, test.max); got != test.want {
+			t.Errorf("Bound(%d, %d, %d) = %d, want %d", test.min, test.val, test.max, got, test.want)
+		}
+	}
+}
+
+func TestMinMax(t *testing.T) {
+	tests := []struct {
+		a, b             int
+		wantMin, wantMax int
+	}{
+		{1, 2, 1, 2},
+		{2, 1, 1, 2},
+		{-1, -1, -1, -1},
+	}
+	for _, test := range tests {
+		if got := Min(test.a, test.b); got != test.wantMin {
+			t.Errorf("Min(%d, %d) = %d, want %d", test.a, test.b, got, test.wantMin)
+		}
+		if got := Max(test.a, test.b); got != test.wantMax {
+			t.Errorf("Max(%d, %d) = %d, want %d", test.a, test.b, got, test.wantMax)
+		}
+	}
+}
+
+func TestLimitRunes(t *testing.T) {
+	tests := []struct {
+		str  string
+		max  int
+		want string
+	}{
+		{"hello", 10, "hello"},
+		{"hello", 5, "hello"},
+		{"hello", 3, "hel"},
+		{"héllo wörld", 7, "héllo w"},
+		{"🙂🙂🙂", 2, "🙂🙂"},
+		{"hello", 0, ""},
+	}
+	for _, test := range tests {
+		if got := LimitRunes(test.str, test.max); got != test.want {
+			t.Errorf("LimitRunes(%q, %d) = %q, want %q", test.str, test.max, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"runtime"
+	"testing"
+)
+
+func TestBuildInfo(t *testing.T) {
+	defer func(version, gitCommit, buildDate string) {
+		Version, GitCommit, BuildDate = version, gitCommit, buildDate
+	}(Version, GitCommit, BuildDate)
+	Version, GitCommit, BuildDate = "v1.2.3", "0123abc", "2021-03-04T12:30:00Z"
+
+	data, err := json.Marshal(buildInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"version":"v1.2.3","git_commit":"0123abc","build_date":"2021-03-04T12:30:00Z","go_version":"` + runtime.Version() + `"}`
+	if string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+}
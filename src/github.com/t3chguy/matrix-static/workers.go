@@ -15,6 +15,7 @@
 package main
 
 import (
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/t3chguy/matrix-static/mxclient"
 	"hash/fnv"
 )
@@ -30,6 +31,16 @@ type Worker struct {
 	Queue  chan Job
 	Output chan JobResp
 	rooms  map[string]*mxclient.Room
+
+	// invalidations receives the ID of every room whose timeline has changed or which has been discarded.
+	invalidations chan<- string
+}
+
+// invalidate notifies any listener that what is held for roomID has changed.
+func (w *Worker) invalidate(roomID string) {
+	if w.invalidations != nil {
+		w.invalidations <- roomID
+	}
 }
 
 func (w *Worker) Start() {
@@ -44,10 +55,11 @@ type Workers struct {
 	workers    []Worker
 }
 
-func NewWorkers(numWorkers uint32, m *mxclient.Client) *Workers {
+// NewWorkers starts numWorkers workers, which send the IDs of rooms that changed to invalidations if it is not nil.
+func NewWorkers(numWorkers uint32, m *mxclient.Client, invalidations chan<- string) *Workers {
 	workers := make([]Worker, 0, numWorkers)
 	for i := uint32(0); i < numWorkers; i++ {
-		workers = append(workers, *NewWorker(int(i), m))
+		workers = append(workers, *NewWorker(int(i), m, invalidations))
 	}
 	return &Workers{numWorkers, workers}
 }
@@ -76,14 +88,63 @@ func (ws *Workers) JobForAllWorkers(job Job) {
 	}
 }
 
+// NumRooms asks each worker how many rooms it holds, as only the worker itself may touch its room map.
+func (ws *Workers) NumRooms() (numRooms int) {
+	for _, worker := range ws.workers {
+		worker.Queue <- RoomCountJob{}
+		numRooms += (<-worker.Output).(RoomCountResp).NumRooms
+	}
+	return
+}
+
+// LatestEventTimestamps returns the timestamp of the latest event of every room currently loaded, keyed by roomID.
+func (ws *Workers) LatestEventTimestamps() map[string]int {
+	timestamps := make(map[string]int)
+	for _, worker := range ws.workers {
+		worker.Queue <- RoomLatestTimestampsJob{}
+		for roomID, timestamp := range (<-worker.Output).(RoomLatestTimestampsResp).Timestamps {
+			timestamps[roomID] = timestamp
+		}
+	}
+	return timestamps
+}
+
+// Activity returns the message counts of every room held by the workers, only rooms which have been viewed are held.
+func (ws *Workers) Activity() map[string][]int {
+	activity := make(map[string][]int)
+	for _, worker := range ws.workers {
+		worker.Queue <- RoomActivityJob{}
+		for roomID, counts := range (<-worker.Output).(RoomActivityResp).Activity {
+			activity[roomID] = counts
+		}
+	}
+	return activity
+}
+
+// RegisterMetrics registers the worker metrics into reg, these are evaluated lazily on scrape.
+func (ws *Workers) RegisterMetrics(reg prometheus.Registerer) {
+	// Rooms are joined (or peeked) by the client account when first requested and discarded once unused.
+	reg.MustRegister(prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "synced_rooms_total",
+			Help: "The number of rooms currently synced and held in memory by the workers.",
+		},
+		func() float64 {
+			return float64(ws.NumRooms())
+		},
+	))
+}
+
 // NewWorker instantiates a worker and their necessary channels, then starts them and returns them.
-func NewWorker(id int, m *mxclient.Client) *Worker {
+func NewWorker(id int, m *mxclient.Client, invalidations chan<- string) *Worker {
 	worker := &Worker{
 		ID:     id,
 		client: m,
 		Queue:  make(chan Job),
 		Output: make(chan JobResp),
 		rooms:  make(map[string]*mxclient.Room),
+
+		invalidations: invalidations,
 	}
 	go worker.Start()
 	return worker
@@ -0,0 +1,75 @@
+// Copyright 2017 Michael Telatynski <7t3chguy@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/t3chguy/matrix-static/mxclient"
+	"testing"
+)
+
+func TestRegisterMetricsNumRooms(t *testing.T) {
+	ws := NewWorkers(2, nil, nil)
+	reg := prometheus.NewRegistry()
+	ws.RegisterMetrics(reg)
+
+	syncedRooms := func() float64 {
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, family := range families {
+			if family.GetName() == "synced_rooms_total" {
+				return family.GetMetric()[0].GetGauge().GetValue()
+			}
+		}
+		t.Fatal("synced_rooms_total is not registered")
+		return 0
+	}
+
+	if got := syncedRooms(); got != 0 {
+		t.Errorf("synced_rooms_total = %v before any room is synced, want 0", got)
+	}
+
+	// the rooms are held before either worker is next given a job, so are seen by them.
+	ws.workers[0].rooms["!a:example.org"] = &mxclient.Room{}
+	ws.workers[1].rooms["!b:example.org"] = &mxclient.Room{}
+	ws.workers[1].rooms["!c:example.org"] = &mxclient.Room{}
+	if got := syncedRooms(); got != 3 {
+		t.Errorf("synced_rooms_total = %v, want 3 as held across the workers", got)
+	}
+	if got := ws.NumRooms(); got != 3 {
+		t.Errorf("NumRooms() = %d, want 3", got)
+	}
+}
+
+func TestWorkersActivity(t *testing.T) {
+	ws := NewWorkers(2, nil, nil)
+	if got := ws.Activity(); len(got) != 0 {
+		t.Errorf("Activity() = %v before any room is synced, want none", got)
+	}
+
+	ws.workers[0].rooms["!a:example.org"] = &mxclient.Room{}
+	ws.workers[1].rooms["!b:example.org"] = &mxclient.Room{}
+	activity := ws.Activity()
+	for _, roomID := range []string{"!a:example.org", "!b:example.org"} {
+		if counts, ok := activity[roomID]; !ok || len(counts) != mxclient.ActivityDays {
+			t.Errorf("got %v for %s, want the counts of %d days", counts, roomID, mxclient.ActivityDays)
+		}
+	}
+	if len(activity) != 2 {
+		t.Errorf("got the activity of %d rooms, want 2 as held across the workers", len(activity))
+	}
+}